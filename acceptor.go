@@ -21,8 +21,12 @@
 package starx
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lonnng/starx/cluster"
@@ -36,13 +40,31 @@ import (
 // information.
 // only used in package internal, can not accessible by other package
 type acceptor struct {
-	id         int64
-	socket     net.Conn
-	status     networkStatus
-	sessionMap map[int64]*session.Session // backend sessions
-	f2bMap     map[int64]int64            // frontend session id -> backend session id map
-	b2fMap     map[int64]int64            // backend session id -> frontend session id map
-	lastTime   int64                      // last heartbeat unix time stamp
+	id          int64
+	socket      net.Conn
+	status      networkStatus
+	sessionLock sync.RWMutex               // protects sessionMap, f2bMap and b2fMap
+	sessionMap  map[int64]*session.Session // backend sessions
+	f2bMap      map[int64]int64            // frontend session id -> backend session id map
+	b2fMap      map[int64]int64            // backend session id -> frontend session id map
+	lastTime    int64                      // last heartbeat unix time stamp
+
+	streamLock sync.Mutex                 // protects streams
+	streams    map[uint64]*rpc.BidiStream // bidirectional streams opened by frontend
+
+	encoding uint32 // rpc.Encoding accepted by frontend, accessed atomically
+
+	callLock sync.Mutex               // protects calls
+	calls    map[uint64]*inflightCall // calls in processing, which can be canceled by frontend
+
+	dedup *dedupWindow // recently received calls, nil means deduplication disabled
+}
+
+// inflightCall is a call in processing, which will be canceled when the caller
+// abandoned it, or the connection closed
+type inflightCall struct {
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // Create new backend session instance
@@ -55,6 +77,8 @@ func newAcceptor(id int64, conn net.Conn) *acceptor {
 		f2bMap:     make(map[int64]int64),
 		b2fMap:     make(map[int64]int64),
 		lastTime:   time.Now().Unix(),
+		streams:    make(map[uint64]*rpc.BidiStream),
+		calls:      make(map[uint64]*inflightCall),
 	}
 }
 
@@ -66,30 +90,183 @@ func (a *acceptor) String() string {
 		a.lastTime)
 }
 
+// cancellable reports whether the request can be canceled by the caller
+func cancellable(rr *rpc.Request) bool {
+	return (rr.Kind == rpc.Sys || rr.Kind == rpc.User) && !rr.Notify && rr.Stream == 0
+}
+
+// track registers the call, which can be canceled by the caller
+func (a *acceptor) track(seq uint64) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.callLock.Lock()
+	a.calls[seq] = &inflightCall{ctx: ctx, cancel: cancel}
+	a.callLock.Unlock()
+}
+
+// untrack removes the completed call
+func (a *acceptor) untrack(seq uint64) {
+	a.callLock.Lock()
+	call, ok := a.calls[seq]
+	delete(a.calls, seq)
+	a.callLock.Unlock()
+	if ok {
+		call.cancel()
+	}
+}
+
+// cancel cancels the call abandoned by the caller
+func (a *acceptor) cancel(seq uint64) {
+	a.callLock.Lock()
+	call, ok := a.calls[seq]
+	a.callLock.Unlock()
+	if ok {
+		call.cancel()
+	}
+}
+
+// callContext returns the context of the call, which is done when the call
+// canceled by the caller
+func (a *acceptor) callContext(seq uint64) context.Context {
+	a.callLock.Lock()
+	defer a.callLock.Unlock()
+
+	if call, ok := a.calls[seq]; ok {
+		return call.ctx
+	}
+	return context.Background()
+}
+
+// tlsConn is the connection secured by tls, e.g: *tls.Conn and the
+// connections of rpc.QUIC
+type tlsConn interface {
+	ConnectionState() tls.ConnectionState
+}
+
+// peer returns the identity of the frontend server
+func (a *acceptor) peer() *rpc.Peer {
+	p := &rpc.Peer{Addr: a.socket.RemoteAddr()}
+	if conn, ok := a.socket.(tlsConn); ok {
+		p.Certificates = conn.ConnectionState().PeerCertificates
+	}
+	return p
+}
+
+// pong responses the keepalive ping of frontend
+func (a *acceptor) pong() {
+	a.heartbeat()
+	response := rpc.GetResponse()
+	response.Kind = rpc.RemotePong
+	if err := a.writeResponse(response); err != nil {
+		log.Errorf(err.Error())
+	}
+	rpc.FreeResponse(response)
+}
+
 func (a *acceptor) heartbeat() {
 	a.lastTime = time.Now().Unix()
 }
 
 func (a *acceptor) Session(sid int64) *session.Session {
+	a.sessionLock.Lock()
 	if bsid, ok := a.f2bMap[sid]; ok && bsid > 0 {
-		return a.sessionMap[bsid]
+		s := a.sessionMap[bsid]
+		a.sessionLock.Unlock()
+		return s
 	}
 	s := session.New(a)
 	a.sessionMap[s.ID] = s
 	a.f2bMap[sid] = s.ID
 	a.b2fMap[s.ID] = sid
+	a.sessionLock.Unlock()
+
+	// callbacks may access the session of acceptor
+	transporter.sessionCreated(s)
 	return s
 }
 
+// frontendID returns the frontend session id of the backend session
+func (a *acceptor) frontendID(bsid int64) (int64, bool) {
+	a.sessionLock.RLock()
+	defer a.sessionLock.RUnlock()
+
+	sid, ok := a.b2fMap[bsid]
+	return sid, ok
+}
+
+// removeSession removes the backend session
+func (a *acceptor) removeSession(bsid int64) {
+	a.sessionLock.Lock()
+	defer a.sessionLock.Unlock()
+
+	delete(a.sessionMap, bsid)
+	if fid, ok := a.b2fMap[bsid]; ok {
+		delete(a.b2fMap, bsid)
+		delete(a.f2bMap, fid)
+	}
+}
+
 func (a *acceptor) Close() {
 	a.status = statusClosed
+	a.sessionLock.RLock()
+	sessions := make([]*session.Session, 0, len(a.sessionMap))
 	for _, s := range a.sessionMap {
-		transporter.closeSession(s)
+		sessions = append(sessions, s)
+	}
+	a.sessionLock.RUnlock()
+	for _, s := range sessions {
+		transporter.closeSession(s, CloseFrontendLost)
+	}
+
+	a.streamLock.Lock()
+	for seq, stream := range a.streams {
+		delete(a.streams, seq)
+		stream.Abort()
+	}
+	a.streamLock.Unlock()
+
+	a.callLock.Lock()
+	for seq, call := range a.calls {
+		delete(a.calls, seq)
+		call.cancel()
 	}
+	a.callLock.Unlock()
+
 	transporter.removeAcceptor(a)
 	a.socket.Close()
 }
 
+func (a *acceptor) stream(seq uint64) *rpc.BidiStream {
+	a.streamLock.Lock()
+	defer a.streamLock.Unlock()
+
+	return a.streams[seq]
+}
+
+func (a *acceptor) addStream(stream *rpc.BidiStream) {
+	a.streamLock.Lock()
+	defer a.streamLock.Unlock()
+
+	a.streams[stream.Seq] = stream
+}
+
+func (a *acceptor) removeStream(seq uint64) {
+	a.streamLock.Lock()
+	defer a.streamLock.Unlock()
+
+	delete(a.streams, seq)
+}
+
+func (a *acceptor) setEncoding(enc rpc.Encoding) {
+	atomic.StoreUint32(&a.encoding, uint32(enc))
+}
+
+// writeResponse compresses the payload if frontend accepts, and writes the
+// response to frontend
+func (a *acceptor) writeResponse(resp *rpc.Response) error {
+	resp.EncodeData(rpc.Encoding(atomic.LoadUint32(&a.encoding)))
+	return rpc.WriteResponse(a.socket, resp)
+}
+
 func (a *acceptor) ID() int64 {
 	return a.id
 }
@@ -100,7 +277,7 @@ func (a *acceptor) Send(data []byte) error {
 }
 
 func (a *acceptor) Push(session *session.Session, route string, v interface{}) error {
-	data, err := serializeOrRaw(v)
+	data, err := serializeFor(session, v)
 	if err != nil {
 		return err
 	}
@@ -113,7 +290,7 @@ func (a *acceptor) Push(session *session.Session, route string, v interface{}) e
 		return err
 	}
 
-	sid, ok := rs.b2fMap[session.ID]
+	sid, ok := rs.frontendID(session.ID)
 	if !ok {
 		log.Errorf("sid not exists")
 		return ErrSidNotExists
@@ -125,17 +302,71 @@ func (a *acceptor) Push(session *session.Session, route string, v interface{}) e
 		Data:  data,
 		Sid:   sid,
 	}
-	return rpc.WriteResponse(a.socket, resp)
+	return a.writeResponse(resp)
+}
+
+// pushSession replicates the changed attributes of session to frontend session
+func (a *acceptor) pushSession(session *session.Session) error {
+	data, err := session.EncodeChanges()
+	if err != nil || data == nil {
+		return err
+	}
+
+	sid, ok := a.frontendID(session.ID)
+	if !ok {
+		log.Errorf("sid not exists")
+		return ErrSidNotExists
+	}
+	resp := &rpc.Response{
+		Kind: rpc.HandlerSession,
+		Data: data,
+		Sid:  sid,
+	}
+	return a.writeResponse(resp)
+}
+
+// broadcast sends the broadcast of cluster channel to the frontend server,
+// which expands it to the members there
+func (a *acceptor) broadcast(data []byte) error {
+	return a.writeResponse(&rpc.Response{Kind: rpc.HandlerBroadcast, Data: data})
+}
+
+// Kick asks the frontend server to kick the session with the reason
+func (a *acceptor) Kick(session *session.Session, v interface{}) error {
+	data, err := serializeFor(session, v)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("UID=%d, Type=Kick, Data=%+v", session.Uid, v)
+
+	sid, ok := a.frontendID(session.ID)
+	if !ok {
+		log.Errorf("sid not exists")
+		return ErrSidNotExists
+	}
+	resp := &rpc.Response{
+		Kind: rpc.HandlerKick,
+		Data: data,
+		Sid:  sid,
+	}
+	return a.writeResponse(resp)
 }
 
 // Response message to session
 func (a *acceptor) Response(session *session.Session, v interface{}) error {
-	data, err := serializeOrRaw(v)
+	return a.ResponseWithCode(session, 0, v)
+}
+
+// ResponseWithCode responses message with status code to session, the code is
+// carried by the error code of rpc response
+func (a *acceptor) ResponseWithCode(session *session.Session, code uint, v interface{}) error {
+	data, err := serializeFor(session, v)
 	if err != nil {
 		return err
 	}
 
-	log.Debugf("UID=%d, Type=Response, Data=%+v", session.Uid, v)
+	log.Debugf("UID=%d, Type=Response, Code=%d, Data=%+v", session.Uid, code, v)
 
 	rs, err := transporter.acceptor(session.Entity.ID())
 	if err != nil {
@@ -143,17 +374,18 @@ func (a *acceptor) Response(session *session.Session, v interface{}) error {
 		return err
 	}
 
-	sid, ok := rs.b2fMap[session.ID]
+	sid, ok := rs.frontendID(session.ID)
 	if !ok {
 		log.Errorf("sid not exists")
 		return ErrSidNotExists
 	}
 	resp := &rpc.Response{
-		Kind: rpc.HandlerResponse,
-		Data: data,
-		Sid:  sid,
+		Kind:      rpc.HandlerResponse,
+		Data:      data,
+		Sid:       sid,
+		ErrorCode: int32(code),
 	}
-	return rpc.WriteResponse(a.socket, resp)
+	return a.writeResponse(resp)
 }
 
 func (a *acceptor) Call(session *session.Session, route string, reply interface{}, args ...interface{}) error {
@@ -166,7 +398,8 @@ func (a *acceptor) Call(session *session.Session, route string, reply interface{
 		return ErrRPCLocal
 	}
 
-	data, err := gobEncode(args...)
+	seri := serializerOf(r.Service)
+	data, err := encodeArgs(seri, args...)
 	if err != nil {
 		return err
 	}
@@ -176,5 +409,5 @@ func (a *acceptor) Call(session *session.Session, route string, reply interface{
 		return err
 	}
 
-	return gobDecode(reply, ret)
+	return seri.Deserialize(ret, reply)
 }
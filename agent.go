@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/lonnng/starx/cluster"
@@ -38,6 +39,7 @@ var (
 	ErrRPCLocal          = errors.New("RPC object must location in different server type")
 	ErrSidNotExists      = errors.New("sid not exists")
 	ErrSendChannelClosed = errors.New("agent send channel closed")
+	ErrSendBufferFull    = errors.New("agent send buffer full")
 )
 
 // Agent corresponding a user, used for store raw socket information
@@ -48,9 +50,16 @@ type agent struct {
 	status     networkStatus
 	session    *session.Session
 	sendBuffer chan []byte
+	batch      pushBatch         // pushes coalesced, written by the goroutine writing client
+	closing    chan closeRequest // asks the goroutine writing client to close the session
 	recvBuffer chan *packet.Packet
 	die        chan bool
-	lastTime   int64 // last heartbeat unix time stamp
+	lastTime   int64        // last heartbeat unix time stamp
+	warnedAt   int64        // last active time of session when idle warning pushed
+	keys       atomic.Value // ciphers of payloads negotiated in handshake, *payloadKeys
+	token      string       // reconnect token issued in handshake, guarded by transporter
+	requests   *bucket      // token bucket of requests, used by the goroutine reading client
+	migrating  int32        // whether the session is migrating, accessed atomically
 }
 
 // Create new agent instance
@@ -59,7 +68,8 @@ func newAgent(conn net.Conn) *agent {
 		socket:     conn,
 		status:     statusStart,
 		lastTime:   time.Now().Unix(),
-		sendBuffer: make(chan []byte, packetBufferSize),
+		sendBuffer: make(chan []byte, sendBufferSize()),
+		closing:    make(chan closeRequest, 1),
 		recvBuffer: make(chan *packet.Packet, packetBufferSize),
 		die:        make(chan bool, 1),
 	}
@@ -67,6 +77,12 @@ func newAgent(conn net.Conn) *agent {
 	a.session = s
 	a.id = s.ID
 
+	meta := session.Meta{ConnectedAt: time.Now()}
+	if addr := conn.RemoteAddr(); addr != nil {
+		meta.RemoteAddr = addr.String()
+	}
+	s.SetMeta(meta)
+
 	return a
 }
 
@@ -82,22 +98,52 @@ func (a *agent) heartbeat() {
 	a.lastTime = time.Now().Unix()
 }
 
+// expired reports whether the client does not send heartbeat in time, the
+// sockets not working yet are checked only when the session has a timeout
+func (a *agent) expired(now time.Time) bool {
+	timeout := a.session.Timeout()
+	if a.status == statusClosed || (a.status != statusWorking && timeout == 0) {
+		return false
+	}
+	if timeout == 0 {
+		timeout = 2 * env.heartbeatInternal
+	}
+	return a.lastTime < now.Add(-timeout).Unix()
+}
+
+// Close closes the session by server
 func (a *agent) Close() {
+	a.closeWith(CloseKicked)
+}
+
+func (a *agent) closeWith(reason CloseReason) {
 	if a.status == statusClosed {
 		return
 	}
 
-	a.status = statusClosed
-	log.Debugf("Session closed, Id=%d, IP=%s", a.session.ID, a.socket.RemoteAddr())
+	transporter.setStatus(a, statusClosed)
+	log.Debugf("Session closed, Id=%d, IP=%s, Reason=%s", a.session.ID, a.socket.RemoteAddr(), reason)
 
 	a.die <- true
 
+	// the packets are buffered in plain text, and sealed with the key of
+	// the resumed connection
+	suspend := a.resumable(reason)
+	var pending [][]byte
+	if suspend {
+		pending = a.pending()
+	}
+
 	// close all channel
 	close(a.die)
 	close(a.recvBuffer)
 	close(a.sendBuffer)
 
-	transporter.closeSession(a.session)
+	if suspend {
+		transporter.suspend(a, reason, pending)
+	} else {
+		transporter.closeSession(a.session, reason)
+	}
 	a.socket.Close()
 }
 
@@ -115,8 +161,7 @@ func (a *agent) Send(data []byte) (err error) {
 	}()
 
 	if a.status < statusClosed {
-		a.sendBuffer <- data
-		return nil
+		return a.enqueue(data)
 	}
 
 	err = ErrSendChannelClosed
@@ -124,7 +169,7 @@ func (a *agent) Send(data []byte) (err error) {
 }
 
 func (a *agent) Push(session *session.Session, route string, v interface{}) error {
-	data, err := serializeOrRaw(v)
+	data, err := serializeFor(session, v)
 	if err != nil {
 		return err
 	}
@@ -136,14 +181,67 @@ func (a *agent) Push(session *session.Session, route string, v interface{}) erro
 
 // Response message to session
 func (a *agent) Response(session *session.Session, v interface{}) error {
-	data, err := serializeOrRaw(v)
+	return a.ResponseWithCode(session, 0, v)
+}
+
+func (a *agent) ResponseWithCode(session *session.Session, code uint, v interface{}) error {
+	data, err := serializeFor(session, v)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Type=Response, UID=%d, Code=%d, Data=%+v", session.Uid, code, v)
+
+	return transporter.response(session, code, data)
+}
+
+// closeRequest asks the goroutine writing client to close the session, after
+// the kick packet written
+type closeRequest struct {
+	reason CloseReason
+	kick   []byte // kick packet written after the packets queued, nil closes immediately
+}
+
+// requestClose closes the session in the goroutine writing client, so the
+// callers never wait for the client, the first request wins
+func (a *agent) requestClose(req closeRequest) {
+	select {
+	case a.closing <- req:
+	default:
+	}
+}
+
+// Kick writes the kick packet with the reason to client after the messages
+// queued before, and closes the connection after written
+func (a *agent) Kick(session *session.Session, v interface{}) error {
+	return a.kick(session, v, CloseKicked)
+}
+
+// kick delivers v to the client before closing the session with reason, the
+// packet is written by the goroutine writing client, which seals it
+func (a *agent) kick(session *session.Session, v interface{}, reason CloseReason) error {
+	data, err := serializeFor(session, v)
 	if err != nil {
 		return err
 	}
 
-	log.Debugf("Type=Response, UID=%d, Data=%+v", session.Uid, v)
+	log.Debugf("Type=Kick, UID=%d, Data=%+v", session.Uid, v)
+
+	p := packet.Packet{
+		Type:   packet.Kick,
+		Length: len(data),
+		Data:   data,
+	}
+	ep, err := p.Pack()
+	if err != nil {
+		return err
+	}
 
-	return transporter.response(session, data)
+	if a.status == statusClosed {
+		return ErrSendChannelClosed
+	}
+	a.requestClose(closeRequest{reason: reason, kick: ep})
+	return nil
 }
 
 func (a *agent) Call(session *session.Session, route string, reply interface{}, args ...interface{}) error {
@@ -156,7 +254,8 @@ func (a *agent) Call(session *session.Session, route string, reply interface{},
 		return ErrRPCLocal
 	}
 
-	data, err := gobEncode(args...)
+	seri := serializerOf(r.Service)
+	data, err := encodeArgs(seri, args...)
 	if err != nil {
 		return err
 	}
@@ -166,5 +265,5 @@ func (a *agent) Call(session *session.Session, route string, reply interface{},
 		return err
 	}
 
-	return gobDecode(reply, ret)
+	return seri.Deserialize(ret, reply)
 }
@@ -0,0 +1,96 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/packet"
+)
+
+func TestAgent_Kick(t *testing.T) {
+	conn, peer := net.Pipe()
+	a := newAgent(conn)
+	go handler.serve(a)
+
+	// the kick does not wait for the client reading
+	a.Send([]byte("queued"))
+	reason := []byte(`{"code":1001,"body":"duplicate login"}`)
+	if err := a.session.Kick(reason); err != nil {
+		t.Fatal(err)
+	}
+
+	// the kick packet is written after the packets queued before, and flushed
+	// before the connection closed
+	data, err := ioutil.ReadAll(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("queued")) {
+		t.Fatalf("packets queued should be written first, got %q", data)
+	}
+	p, _, err := packet.Unpack(data[len("queued"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != packet.Kick || string(p.Data) != string(reason) {
+		t.Fatalf("unexpected packet %v: %s", p.Type, p.Data)
+	}
+	if a.status != statusClosed {
+		t.Fatal("session should be closed after kicked")
+	}
+}
+
+func TestAgent_Expired(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := newAgent(conn)
+	now := time.Unix(a.lastTime, 0).Add(10 * time.Second)
+
+	// sockets not working are never expired without the timeout of session
+	if a.expired(now) {
+		t.Fatal("handshaking socket should not be expired by default")
+	}
+	a.session.SetTimeout(5 * time.Second)
+	if !a.expired(now) {
+		t.Fatal("unauthenticated socket should be expired by the timeout of session")
+	}
+
+	a.status = statusWorking
+	a.session.SetTimeout(time.Minute)
+	if a.expired(now) {
+		t.Fatal("session in loading screen should not be expired")
+	}
+	interval := env.heartbeatInternal
+	env.heartbeatInternal = 6 * time.Second
+	defer func() { env.heartbeatInternal = interval }()
+	a.session.SetTimeout(0)
+	if a.expired(now) {
+		t.Fatal("default timeout should be twice the heartbeat interval")
+	}
+	if !a.expired(now.Add(5 * time.Second)) {
+		t.Fatal("session should be expired after the default timeout")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+
+	"github.com/lonnng/starx/component"
+)
+
+// hasService reports whether any version of the service exists
+func hasService(services map[string]*component.Service, name string) bool {
+	for _, s := range services {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addAliases registers the names as the aliases of the service, requests to
+// the aliases are dispatched to the service, the aliases should not conflict
+// with other services or aliases
+func addAliases(services map[string]*component.Service, aliases map[string]string, names []string, service string) error {
+	if !hasService(services, service) {
+		return errors.New("service does not exists: " + service)
+	}
+	for _, name := range names {
+		if hasService(services, name) {
+			return errors.New("alias conflicts with service: " + name)
+		}
+		if target, ok := aliases[name]; ok && target != service {
+			return errors.New("alias already defined: " + name)
+		}
+	}
+	for _, name := range names {
+		aliases[name] = service
+	}
+	return nil
+}
+
+// removeAliases removes the aliases of the service when no version of the
+// service exists
+func removeAliases(services map[string]*component.Service, aliases map[string]string, service string) {
+	if hasService(services, service) {
+		return
+	}
+	for name, target := range aliases {
+		if target == service {
+			delete(aliases, name)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package starx
+
+import (
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+func TestRemoteService_Alias(t *testing.T) {
+	rs := newRemote()
+	if err := rs.register(&StubComp{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.register(&PatchComp{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rs.alias([]string{"Calc", "LegacyCalc"}, "StubComp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.alias([]string{"Calc"}, "PatchComp"); err == nil {
+		t.Fatal("alias of another service should fail")
+	}
+	if err := rs.alias([]string{"PatchComp"}, "StubComp"); err == nil {
+		t.Fatal("alias conflicts with service should fail")
+	}
+	if err := rs.alias([]string{"Missing"}, "MissingComp"); err == nil {
+		t.Fatal("alias of unknown service should fail")
+	}
+
+	seri := serializerOf("StubComp")
+	data, _ := encodeArgs(seri, 1, &RemoteArgs{Level: 2})
+	for _, route := range []string{"StubComp.Add", "Calc.Add", "LegacyCalc.Add"} {
+		rr := &rpc.Request{Kind: rpc.User, ServiceMethod: route, Data: data}
+		if response := rs.dispatch(nil, nil, rr); response.Error != "" {
+			t.Fatalf("%s: %s", route, response.Error)
+		}
+	}
+
+	if _, err := rs.unregister("StubComp"); err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.aliases) != 0 {
+		t.Fatalf("aliases should be removed with the service, got %v", rs.aliases)
+	}
+}
@@ -21,6 +21,8 @@
 package starx
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -29,6 +31,7 @@ import (
 	"syscall"
 
 	"github.com/gorilla/websocket"
+	"github.com/lonnng/starx/cluster/rpc"
 	"github.com/lonnng/starx/log"
 )
 
@@ -63,20 +66,42 @@ func startup() {
 	// shutdown all components registered by application, that
 	// call by reverse order against register
 	shutdownComps()
+	flushChannels()
 }
 
 // Enable current server accept connection
 func listenAndServe() {
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", app.config.Host, app.config.Port))
+	var (
+		listener net.Listener
+		err      error
+		addr     = app.config.Address()
+	)
+	// backend server accepts rpc connections with the transport
+	if !app.config.IsFrontend && env.rpcTransport != nil {
+		listener, err = env.rpcTransport.Listen(addr)
+	} else {
+		listener, err = rpc.TCP.Listen(addr)
+	}
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-	log.Infof("listen at %s:%d(%s)", app.config.Host, app.config.Port, app.config.String())
+	log.Infof("listen at %s(%s)", addr, app.config.String())
+
+	// backend server accepts rpc connections from other servers
+	if !app.config.IsFrontend && env.rpcTransport == nil && env.rpcTLS != nil && !rpc.IsUnixAddress(addr) {
+		listener = tls.NewListener(listener, env.rpcTLS)
+	}
+
+	app.listener = listener
 
 	defer listener.Close()
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			// listener closed on shutdown
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			log.Errorf(err.Error())
 			continue
 		}
@@ -0,0 +1,87 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+// SendPolicy decides how to handle the packets sent to a client reading
+// slowly, whose send buffer is full
+type SendPolicy int
+
+const (
+	// SendBlock blocks the sender until the buffer has room
+	SendBlock SendPolicy = iota
+
+	// SendDropOldest drops the oldest packet in the buffer
+	SendDropOldest
+
+	// SendDropNewest drops the packet being sent
+	SendDropNewest
+
+	// SendDisconnect closes the session of the slow client
+	SendDisconnect
+)
+
+// SetSendBuffer sets the size of the send buffer of every session, and how
+// to handle the packets sent to a full buffer, so one client reading slowly
+// can not block the broadcaster, it should be called before server started
+func SetSendBuffer(size int, policy SendPolicy) {
+	env.sendBufferSize = size
+	env.sendPolicy = policy
+}
+
+func sendBufferSize() int {
+	if env.sendBufferSize > 0 {
+		return env.sendBufferSize
+	}
+	return packetBufferSize
+}
+
+// enqueue buffers the packet, and handles the overflow with the policy
+func (a *agent) enqueue(data []byte) error {
+	policy := env.sendPolicy
+	if policy == SendBlock {
+		a.sendBuffer <- data
+		return nil
+	}
+
+	for {
+		select {
+		case a.sendBuffer <- data:
+			return nil
+		default:
+		}
+
+		switch policy {
+		case SendDropNewest:
+			return ErrSendBufferFull
+		case SendDisconnect:
+			// closed by the goroutine writing client, the sender may be any
+			// goroutine, e.g: a broadcaster
+			a.requestClose(closeRequest{reason: CloseSlowClient})
+			return ErrSendBufferFull
+		}
+
+		// make room for the packet
+		select {
+		case <-a.sendBuffer:
+		default:
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAgent_SendPolicy(t *testing.T) {
+	defer SetSendBuffer(0, SendBlock)
+
+	send := func(policy SendPolicy) (*agent, error) {
+		SetSendBuffer(2, policy)
+		conn, peer := net.Pipe()
+		defer peer.Close()
+		a := newAgent(conn)
+		a.Send([]byte("a"))
+		a.Send([]byte("b"))
+		return a, a.Send([]byte("c"))
+	}
+	buffered := func(a *agent) string {
+		var s string
+		for _, data := range a.pending() {
+			s += string(data)
+		}
+		return s
+	}
+
+	a, err := send(SendDropOldest)
+	if err != nil || buffered(a) != "bc" {
+		t.Fatalf("oldest packet should be dropped, err=%v", err)
+	}
+
+	a, err = send(SendDropNewest)
+	if err != ErrSendBufferFull || buffered(a) != "ab" {
+		t.Fatalf("newest packet should be dropped, err=%v", err)
+	}
+
+	a, err = send(SendDisconnect)
+	if err != ErrSendBufferFull {
+		t.Fatalf("expect %v, got %v", ErrSendBufferFull, err)
+	}
+	select {
+	case req := <-a.closing:
+		if req.reason != CloseSlowClient || a.status == statusClosed {
+			t.Fatalf("slow client should be closed by the goroutine writing it, got %v", req.reason)
+		}
+	default:
+		t.Fatal("slow client should be disconnected")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package starx
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/session"
+)
+
+// BulkClose controls how CloseWhere closes the sessions, so closing thousands
+// of sessions at once does not flood the network and the backend servers with
+// session closed notifications
+type BulkClose struct {
+	BatchSize int           // sessions closed in a batch, zero means all at once
+	Interval  time.Duration // pause between batches
+}
+
+var (
+	bulkLock  sync.RWMutex
+	bulkClose = BulkClose{BatchSize: 100, Interval: 100 * time.Millisecond}
+)
+
+// SetBulkClose sets how CloseWhere closes the sessions, default 100 sessions
+// every 100ms
+func SetBulkClose(b BulkClose) {
+	bulkLock.Lock()
+	defer bulkLock.Unlock()
+
+	bulkClose = b
+}
+
+func bulkCloseOf() BulkClose {
+	bulkLock.RLock()
+	defer bulkLock.RUnlock()
+
+	return bulkClose
+}
+
+// CloseWhere kicks the sessions of current server which the filter returns
+// true for, e.g: draining a shard, ending a match, the reason is delivered to
+// client as the notice before closed, the sessions of backend server are
+// kicked by their frontend servers. The sessions are closed in batches in the
+// order of session id, it blocks until all closed, and returns the count of
+// sessions closed and the first error
+func CloseWhere(filter func(*session.Session) bool, reason interface{}) (int, error) {
+	var matched []*session.Session
+	for _, s := range transporter.allSessions() {
+		if filter(s) {
+			matched = append(matched, s)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+
+	b := bulkCloseOf()
+	var (
+		closed int
+		first  error
+	)
+	for i, s := range matched {
+		if i > 0 && b.BatchSize > 0 && i%b.BatchSize == 0 {
+			time.Sleep(b.Interval)
+		}
+		if err := s.Kick(reason); err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		closed++
+	}
+	return closed, first
+}
@@ -0,0 +1,75 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package starx
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/session"
+)
+
+func TestCloseWhere(t *testing.T) {
+	SetBulkClose(BulkClose{BatchSize: 1, Interval: 20 * time.Millisecond})
+	defer SetBulkClose(BulkClose{BatchSize: 100, Interval: 100 * time.Millisecond})
+
+	conn, peer := net.Pipe()
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	ac.Session(41).Set("match", 1)
+	ac.Session(42).Set("match", 2)
+	ac.Session(43).Set("match", 1)
+
+	start := time.Now()
+	type result struct {
+		closed int
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		closed, err := CloseWhere(func(s *session.Session) bool {
+			return s.Int("match") == 1
+		}, []byte("match over"))
+		done <- result{closed, err}
+	}()
+
+	for _, sid := range []int64{41, 43} {
+		select {
+		case resp := <-client.ResponseChan:
+			if resp.Kind != rpc.HandlerKick || resp.Sid != sid || string(resp.Data) != "match over" {
+				t.Fatalf("unexpected response %v, Sid=%d", resp.Kind, resp.Sid)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("session %d should be kicked", sid)
+		}
+	}
+	r := <-done
+	if r.err != nil || r.closed != 2 {
+		t.Fatalf("expect 2 sessions closed, got %d, err=%v", r.closed, r.err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("sessions should be closed in batches, elapsed %v", elapsed)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package starx
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+// maxCacheEntries is the max replies cached, replies are not cached when the
+// cache is full of unexpired entries
+const maxCacheEntries = 10000
+
+type cacheKey struct {
+	method string
+	args   [sha256.Size]byte
+}
+
+type cacheEntry struct {
+	data   []byte
+	expire time.Time
+}
+
+// replyCache caches the encoded replies of idempotent remote methods, repeated
+// calls with the same arguments are served without invoking the method
+type replyCache struct {
+	sync.Mutex
+	ttls    map[string]time.Duration // "Service.Method" => ttl
+	entries map[cacheKey]*cacheEntry
+}
+
+func newReplyCache() *replyCache {
+	return &replyCache{
+		ttls:    make(map[string]time.Duration),
+		entries: make(map[cacheKey]*cacheEntry),
+	}
+}
+
+// setTTL marks the method cacheable, zero ttl disables the cache of method
+func (c *replyCache) setTTL(method string, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	if ttl <= 0 {
+		delete(c.ttls, method)
+		for k := range c.entries {
+			if k.method == method {
+				delete(c.entries, k)
+			}
+		}
+		return
+	}
+	c.ttls[method] = ttl
+}
+
+// key returns the cache key of request, and false when the method is not
+// cacheable
+func (c *replyCache) key(rr *rpc.Request) (cacheKey, time.Duration, bool) {
+	ttl, ok := c.ttls[rr.ServiceMethod]
+	if !ok {
+		return cacheKey{}, 0, false
+	}
+	return cacheKey{method: rr.ServiceMethod, args: sha256.Sum256(rr.Data)}, ttl, true
+}
+
+// get returns the cached reply of the request
+func (c *replyCache) get(rr *rpc.Request, now time.Time) ([]byte, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	k, _, ok := c.key(rr)
+	if !ok {
+		return nil, false
+	}
+	e, ok := c.entries[k]
+	if !ok {
+		return nil, false
+	}
+	if now.After(e.expire) {
+		delete(c.entries, k)
+		return nil, false
+	}
+	return e.data, true
+}
+
+// put caches the reply of the request, errors are never cached
+func (c *replyCache) put(rr *rpc.Request, response *rpc.Response, now time.Time) {
+	if response == nil || response.Error != "" {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	k, ttl, ok := c.key(rr)
+	if !ok {
+		return
+	}
+	if len(c.entries) >= maxCacheEntries {
+		c.evict(now)
+		if len(c.entries) >= maxCacheEntries {
+			return
+		}
+	}
+	data := make([]byte, len(response.Data))
+	copy(data, response.Data)
+	c.entries[k] = &cacheEntry{data: data, expire: now.Add(ttl)}
+}
+
+// evict removes the expired entries
+func (c *replyCache) evict(now time.Time) {
+	for k, e := range c.entries {
+		if now.After(e.expire) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// cached dispatches the request, the replies of cacheable methods are served
+// from cache until expired
+func (rs *remoteService) cached(rr *rpc.Request, dispatch func() *rpc.Response) *rpc.Response {
+	now := time.Now()
+	if data, ok := rs.cache.get(rr, now); ok {
+		response := newResponse(rr)
+		response.Data = data
+		return response
+	}
+	response := dispatch()
+	rs.cache.put(rr, response, now)
+	return response
+}
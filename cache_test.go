@@ -0,0 +1,72 @@
+package starx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+func TestReplyCache(t *testing.T) {
+	c := newReplyCache()
+	c.setTTL("Catalog.Items", time.Minute)
+
+	now := time.Now()
+	rr := &rpc.Request{ServiceMethod: "Catalog.Items", Data: []byte("shop")}
+	if _, ok := c.get(rr, now); ok {
+		t.Fatal("expect cache miss")
+	}
+	c.put(rr, &rpc.Response{Data: []byte("items")}, now)
+	if data, ok := c.get(rr, now); !ok || string(data) != "items" {
+		t.Fatalf("expect cached items, got %q", data)
+	}
+
+	other := &rpc.Request{ServiceMethod: "Catalog.Items", Data: []byte("bag")}
+	if _, ok := c.get(other, now); ok {
+		t.Fatal("calls with different arguments should not hit")
+	}
+	if _, ok := c.get(rr, now.Add(2*time.Minute)); ok {
+		t.Fatal("expired reply should not hit")
+	}
+
+	c.put(other, &rpc.Response{Error: "failed"}, now)
+	if _, ok := c.get(other, now); ok {
+		t.Fatal("errors should not be cached")
+	}
+
+	uncached := &rpc.Request{ServiceMethod: "Catalog.Buy", Data: []byte("shop")}
+	c.put(uncached, &rpc.Response{Data: []byte("ok")}, now)
+	if _, ok := c.get(uncached, now); ok {
+		t.Fatal("method not cacheable should not be cached")
+	}
+
+	c.put(rr, &rpc.Response{Data: []byte("items")}, now)
+	c.setTTL("Catalog.Items", 0)
+	if _, ok := c.get(rr, now); ok {
+		t.Fatal("cache should be disabled")
+	}
+}
+
+func TestRemoteService_Cached(t *testing.T) {
+	rs := newRemote()
+	rs.cache.setTTL("Catalog.Items", time.Minute)
+
+	calls := 0
+	dispatch := func() *rpc.Response {
+		calls++
+		response := rpc.GetResponse()
+		response.Data = []byte("items")
+		return response
+	}
+	for i := 0; i < 3; i++ {
+		rr := &rpc.Request{ServiceMethod: "Catalog.Items", Seq: uint64(i), Data: []byte("shop")}
+		response := rs.cached(rr, dispatch)
+		if string(response.Data) != "items" || response.Seq != rr.Seq {
+			t.Fatalf("unexpected response: %+v", response)
+		}
+		rpc.FreeResponse(response)
+	}
+	if calls != 1 {
+		t.Fatalf("expect method invoked once, got %d", calls)
+	}
+}
@@ -1,17 +1,78 @@
 package starx
 
 import (
+	"errors"
 	"sync"
+	"time"
 
+	"github.com/lonnng/starx/cluster"
 	"github.com/lonnng/starx/log"
 	"github.com/lonnng/starx/session"
+	"github.com/lonnng/starx/timer"
 )
 
+// ErrChannelNotFound is returned when the channel of name does not exist
+var ErrChannelNotFound = errors.New("channel not found")
+
+// Channel is a named group of sessions of current server, which is created
+// by ChannelService
 type Channel struct {
 	sync.RWMutex
 	name    string                     // channel name
 	uidMap  map[int64]*session.Session // uid map to session pointer
 	members []int64                    // all user ids
+
+	persistent bool               // whether the members are saved in the channel store
+	pending    map[int64]struct{} // uids restored from the store, which have not reconnected
+
+	saveLock  sync.Mutex // protects dirty and saving
+	dirty     bool       // members changed since last saved
+	saving    bool       // a save is scheduled
+	storeLock sync.Mutex // serializes the saves and delete of the channel in store
+
+	timers  []*timer.Timer    // periodic broadcasts, stopped when destroyed
+	limiter *broadcastLimiter // nil means the broadcasts are not limited
+
+	parent   *Channel   // protected by treeLock
+	children []*Channel // protected by treeLock
+
+	joinCb     []func(*Channel, *session.Session)
+	leaveCb    []func(*Channel, *session.Session, bool)
+	joinRoute  string       // route of the presence broadcast on member joined
+	leaveRoute string       // route of the presence broadcast on member left
+	presence   PresenceFunc // payload of the presence broadcasts, nil means Presence
+
+	seqLock      sync.Mutex                         // serializes the cluster broadcasts expanded, protects following
+	seq          uint64                             // sequence number of the last cluster broadcast expanded
+	epoch        int64                              // epoch of the sequence
+	reorder      map[uint64]*cluster.ChannelMessage // broadcasts arrived before the earlier ones
+	reorderTimer *time.Timer                        // skips the missing broadcasts, nil when none waiting
+	tracker      string                             // id of the server tracking the cluster channel, which the members joined
+
+	shards []*channelShard // shards of members, nil means not sharded
+
+	filters []BroadcastFilter // applied to the broadcasts in order
+
+	mutes   map[int64]map[int64]struct{} // member uid => uids muted by the member
+	mutedBy map[int64]map[int64]struct{} // uid => uids of the members muting it
+
+	metaLock sync.RWMutex // protects following
+	meta     map[string]interface{}
+	metaCb   []func(*Channel, string, interface{}, interface{})
+
+	grace      time.Duration // destroys the channel after empty for grace, zero disables it
+	graceTimer *time.Timer   // destroys the empty channel, nil when not empty
+	graceArmed uint64        // count of the timers armed
+
+	statsLock sync.Mutex // protects stats
+	stats     BroadcastStats
+
+	capacity int                              // max count of members, zero means unlimited
+	fullCb   func(*Channel, *session.Session) // fired with the session rejected by full channel
+
+	historyLock sync.Mutex // protects following
+	historySize int        // count of broadcasts kept, zero means no history
+	history     []broadcastRecord
 }
 
 func newChannel(n string) *Channel {
@@ -27,19 +88,33 @@ func (c *Channel) Member(uid int64) *session.Session {
 	return c.uidMap[uid]
 }
 
+// Members returns the uids of members in the order joined, with cluster
+// channels, the members of current server only
 func (c *Channel) Members() []int64 {
 	c.RLock()
 	defer c.RUnlock()
 
-	return c.members
+	return append([]int64(nil), c.members...)
+}
+
+// Sids returns the session ids of members in the order joined
+func (c *Channel) Sids() []int64 {
+	c.RLock()
+	defer c.RUnlock()
+
+	sids := make([]int64, 0, len(c.members))
+	for _, uid := range c.members {
+		if s, ok := c.uidMap[uid]; ok {
+			sids = append(sids, s.ID)
+		}
+	}
+	return sids
 }
 
 // Push message to partial client, which filter return true
 func (c *Channel) Multicast(route string, v interface{}, filter SessionFilter) error {
-	data, err := serializeOrRaw(v)
-	if err != nil {
-		return err
-	}
+	payloads := newPayloads(v)
+	var err error
 
 	log.Debugf("Type=Multicast Route=%s, Data=%+v", route, v)
 
@@ -50,7 +125,10 @@ func (c *Channel) Multicast(route string, v interface{}, filter SessionFilter) e
 		if !filter(s) {
 			continue
 		}
-		err = transporter.push(s, route, data)
+		var data []byte
+		if data, err = payloads.of(s); err == nil {
+			err = transporter.push(s, route, data)
+		}
 		if err != nil {
 			log.Error(err.Error())
 		}
@@ -59,21 +137,76 @@ func (c *Channel) Multicast(route string, v interface{}, filter SessionFilter) e
 	return nil
 }
 
-// Push message to all client
-func (c *Channel) Broadcast(route string, v interface{}) error {
-	data, err := serializeOrRaw(v)
-	if err != nil {
-		return err
+// Push message to all client, except the sessions of the ids, e.g: the
+// originator of a movement is not echoed its own event. With cluster
+// channels, the members on all frontend servers are pushed, and the ids are
+// the ids of frontend sessions
+func (c *Channel) Broadcast(route string, v interface{}, except ...int64) error {
+	return c.BroadcastFrom(nil, route, v, except...)
+}
+
+// BroadcastFrom pushes the message sent by the sender to all members, like
+// Broadcast, except the members muting the sender. The message passes the
+// filters of the channel first, and ErrBroadcastFiltered is returned when a
+// filter rejects it
+func (c *Channel) BroadcastFrom(sender *session.Session, route string, v interface{}, except ...int64) error {
+	v, ok := c.filter(sender, route, v)
+	if !ok {
+		return ErrBroadcastFiltered
+	}
+	if l := c.limiterOf(); l != nil {
+		if ok, err := l.admit(c, route, v, except, uidOf(sender), time.Now()); !ok {
+			return err
+		}
+	}
+	return c.deliver(route, v, except, uidOf(sender))
+}
+
+// deliver pushes the message admitted to the members
+func (c *Channel) deliver(route string, v interface{}, except []int64, from int64) error {
+	if svrType := channelTypeOf(); svrType != "" {
+		return c.broadcastClusterTree(svrType, route, v, except, from)
 	}
+	return c.broadcastTree(route, v, except, from)
+}
 
+// broadcast pushes the message to the members of current server
+func (c *Channel) broadcast(route string, v interface{}, except []int64, from int64) error {
 	log.Debugf("Type=Broadcast Route=%s, Data=%+v", route, v)
+	c.record(route, v)
+
+	out := &fanout{}
+	err := c.pushMembers(route, newPayloads(v), except, from, nil, out)
+	c.recordFanout(route, out)
+	return err
+}
+
+// pushMembers pushes the payloads to the members, except the members muting
+// the uid from, the sessions in seen are skipped, and the sessions pushed are
+// added to seen when it is not nil, the outcomes are counted in out
+func (c *Channel) pushMembers(route string, payloads *payloads, except []int64, from int64, seen map[int64]bool, out *fanout) error {
+	muting := c.muting(from)
+	if shards := c.shardsOf(); shards != nil {
+		return pushShards(shards, route, payloads, except, muting, seen, out)
+	}
+
+	var err error
 
 	c.RLock()
 	defer c.RUnlock()
 
 	for _, s := range c.uidMap {
-		err = transporter.push(s, route, data)
-		if err != nil {
+		if excluded(s.ID, except) || muting[s.Uid] || seen[s.ID] {
+			continue
+		}
+		if seen != nil {
+			seen[s.ID] = true
+		}
+		var data []byte
+		if data, err = payloads.of(s); err == nil {
+			err = transporter.push(s, route, data)
+		}
+		if err = out.pushed(err); err != nil {
 			log.Error(err.Error())
 		}
 	}
@@ -81,6 +214,12 @@ func (c *Channel) Broadcast(route string, v interface{}) error {
 	return err
 }
 
+// Contains reports whether the uid is a member, e.g: to validate an action
+// before processing it
+func (c *Channel) Contains(uid int64) bool {
+	return c.IsContain(uid)
+}
+
 func (c *Channel) IsContain(uid int64) bool {
 	c.RLock()
 	defer c.RUnlock()
@@ -92,17 +231,66 @@ func (c *Channel) IsContain(uid int64) bool {
 	return false
 }
 
-func (c *Channel) Add(session *session.Session) {
+// Add the session to the channel, with cluster channels, the session of
+// frontend server joins the channel of the cluster. ErrChannelFull is
+// returned when the channel reaches its capacity
+func (c *Channel) Add(session *session.Session) error {
 	c.Lock()
-	defer c.Unlock()
+	_, joined := c.uidMap[session.Uid]
+	if !joined && c.full(session.Uid) {
+		cb := c.fullCb
+		c.Unlock()
 
+		if cb != nil {
+			cb(c, session)
+		}
+		return ErrChannelFull
+	}
+	if !joined {
+		c.members = append(c.members, session.Uid)
+	} else if old := c.uidMap[session.Uid]; old != session {
+		ChannelService.unjoin(old, c)
+	}
 	c.uidMap[session.Uid] = session
-	c.members = append(c.members, session.Uid)
+	ChannelService.join(session, c)
+	c.shardOf(session.Uid).add(session)
+	delete(c.pending, session.Uid)
+	c.occupied()
+	c.Unlock()
+
+	c.track(session, cluster.JoinChannel)
+	c.save()
+	if !joined {
+		c.replay(session)
+		c.joined(session)
+	}
+	return nil
 }
 
 func (c *Channel) Leave(uid int64) {
+	s := c.remove(uid)
+	c.Lock()
+	_, pending := c.pending[uid]
+	delete(c.pending, uid)
+	c.Unlock()
+
+	if s != nil {
+		c.track(s, cluster.LeaveChannel)
+	}
+	if s != nil || pending {
+		c.save()
+	}
+	if s != nil {
+		c.resetSeq()
+		c.left(s, false, true)
+	}
+	c.vacated()
+}
+
+// remove the member of uid from current server, and returns its session
+func (c *Channel) remove(uid int64) *session.Session {
 	if !c.IsContain(uid) {
-		return
+		return nil
 	}
 
 	c.Lock()
@@ -116,17 +304,41 @@ func (c *Channel) Leave(uid int64) {
 			break
 		}
 	}
+	s := c.uidMap[uid]
 	delete(c.uidMap, uid)
+	if s != nil {
+		ChannelService.unjoin(s, c)
+	}
+	c.unmuteAll(uid)
+	c.shardOf(uid).remove(uid)
+	return s
 }
 
 func (c *Channel) LeaveAll() {
 	c.Lock()
-	defer c.Unlock()
-
+	sessions := c.uidMap
+	for _, s := range sessions {
+		ChannelService.unjoin(s, c)
+	}
 	c.uidMap = make(map[int64]*session.Session)
+	c.mutes, c.mutedBy = nil, nil
+	c.resetShards()
 	c.members = make([]int64, 0)
+	c.pending = nil
+	c.Unlock()
+
+	for _, s := range sessions {
+		c.track(s, cluster.LeaveChannel)
+	}
+	c.save()
+	c.resetSeq()
+	for _, s := range sessions {
+		c.left(s, false, false)
+	}
+	c.vacated()
 }
 
+// Count returns the count of members, e.g: the occupancy of a room
 func (c *Channel) Count() int {
 	c.RLock()
 	defer c.RUnlock()
@@ -134,6 +346,53 @@ func (c *Channel) Count() int {
 	return len(c.uidMap)
 }
 
+// Every broadcasts the payload produced by fn to the channel every interval,
+// e.g: world clocks, scoreboard refreshes, lobby countdowns, the tick is
+// skipped when fn returns nil. The timer returned stops the broadcasts, and
+// it is stopped when the channel destroyed
+func (c *Channel) Every(route string, interval time.Duration, fn func() interface{}) *timer.Timer {
+	t := timer.Register(interval, func() {
+		v := fn()
+		if v == nil {
+			return
+		}
+		if err := c.Broadcast(route, v); err != nil {
+			log.Errorf("broadcast channel %s failed: %s", c.name, err.Error())
+		}
+	})
+
+	c.Lock()
+	c.timers = append(c.timers, t)
+	c.Unlock()
+	return t
+}
+
+// Destroy removes all members, and removes the channel from ChannelService,
+// and from the channel store when it is persistent
 func (c *Channel) Destroy() {
+	c.Lock()
+	persistent := c.persistent
+	c.persistent = false
+	timers := c.timers
+	c.timers = nil
+	limiter := c.limiter
+	c.limiter = nil
+	c.grace = 0
+	c.occupied()
+	c.Unlock()
+
+	c.detach()
+
+	for _, t := range timers {
+		t.Stop()
+	}
+	if limiter != nil {
+		limiter.stop()
+	}
+
 	c.LeaveAll()
+	ChannelService.remove(c)
+	if persistent {
+		c.unsave()
+	}
 }
@@ -1,16 +1,50 @@
 package starx
 
 import (
+	"bytes"
+	"fmt"
 	"math/rand"
+	"net"
+	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/lonnng/starx/cluster"
 	"github.com/lonnng/starx/session"
 )
 
+// pipeAgent returns an agent connected with a pipe, which is closed when the
+// test finished
+func pipeAgent(t *testing.T) *agent {
+	conn, peer := net.Pipe()
+	a := transporter.createAgent(conn)
+	t.Cleanup(func() {
+		a.closeWith(CloseDisconnected)
+		peer.Close()
+	})
+	return a
+}
+
+// joinAgents returns n agents of uid 1 to n, which are added to the channel
+// unless it is nil
+func joinAgents(t *testing.T, c *Channel, n int) []*agent {
+	agents := make([]*agent, n)
+	for i := range agents {
+		agents[i] = pipeAgent(t)
+		agents[i].session.Uid = int64(i + 1)
+		if c != nil {
+			c.Add(agents[i].session)
+		}
+	}
+	return agents
+}
+
 func TestChannel_Add(t *testing.T) {
 	c := ChannelService.NewChannel("test_add")
 
 	var paraCount = 100
+	defer unbindAll(paraCount)
 	w := make(chan bool, paraCount)
 	for i := 0; i < paraCount; i++ {
 		go func(id int) {
@@ -50,3 +84,660 @@ func TestChannel_Add(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestChannelService(t *testing.T) {
+	c := ChannelService.NewChannel("test_service")
+	if ChannelService.NewChannel("test_service") != c {
+		t.Fatal("channel of the same name should be returned")
+	}
+	if got, ok := ChannelService.Channel("test_service"); !ok || got != c {
+		t.Fatal("channel should be found by name")
+	}
+
+	s := session.New(nil)
+	s.Uid = 7
+	other := session.New(nil)
+	other.Uid = 8
+	c.Add(s)
+	c.Add(other)
+	if members := ChannelService.Members("test_service"); len(members) != 2 {
+		t.Fatalf("expect 2 members, got %v", members)
+	}
+
+	// the session closed leaves the channels
+	ChannelService.leave(s)
+	if c.IsContain(7) || !c.IsContain(8) {
+		t.Fatal("only the closed session should leave the channel")
+	}
+	// the uid bound by another session stays
+	ChannelService.leave(session.New(nil))
+	if !c.IsContain(8) {
+		t.Fatal("other sessions should not leave the channel")
+	}
+	// the session replaced by another session of the same uid is forgotten
+	replaced := session.New(nil)
+	replaced.Uid = 8
+	c.Add(replaced)
+	ChannelService.leave(other)
+	if c.Member(8) != replaced {
+		t.Fatal("the session replaced should not remove the member")
+	}
+	if _, ok := ChannelService.joined[other.ID]; ok {
+		t.Fatal("the channels of the session replaced should be forgotten")
+	}
+
+	ChannelService.DestroyChannel("test_service")
+	if _, ok := ChannelService.Channel("test_service"); ok || c.Count() != 0 {
+		t.Fatal("destroyed channel should be removed")
+	}
+	if err := ChannelService.Broadcast("test_service", "onChat", []byte("hi")); err != ErrChannelNotFound {
+		t.Fatalf("expect ErrChannelNotFound, got %v", err)
+	}
+}
+
+func TestChannel_BroadcastExcept(t *testing.T) {
+	c := ChannelService.NewChannel("test_except")
+	defer c.Destroy()
+
+	agents := joinAgents(t, c, 3)
+
+	if err := c.Broadcast("onMove", []byte("moved"), agents[0].session.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-agents[0].sendBuffer:
+		t.Fatal("the excluded session should not be pushed")
+	default:
+	}
+	for _, a := range agents[1:] {
+		select {
+		case data := <-a.sendBuffer:
+			if !bytes.Contains(data, []byte("moved")) {
+				t.Fatalf("unexpected push: %q", data)
+			}
+		default:
+			t.Fatal("other sessions should be pushed")
+		}
+	}
+}
+
+func TestChannel_Members(t *testing.T) {
+	c := ChannelService.NewChannel("test_members")
+	defer c.Destroy()
+
+	var sessions []*session.Session
+	for uid := int64(3); uid > 0; uid-- {
+		s := session.New(nil)
+		s.Uid = uid
+		c.Add(s)
+		sessions = append(sessions, s)
+	}
+	c.Add(sessions[0])
+
+	if c.Count() != 3 || !c.Contains(2) || c.Contains(4) {
+		t.Fatalf("unexpected membership, count=%d", c.Count())
+	}
+	members, sids := c.Members(), c.Sids()
+	if len(members) != 3 || members[0] != 3 || members[2] != 1 {
+		t.Fatalf("members should be listed in the order joined, got %v", members)
+	}
+	for i, s := range sessions {
+		if sids[i] != s.ID {
+			t.Fatalf("expect session ids in the order joined, got %v", sids)
+		}
+	}
+
+	members[0] = 100
+	c.Leave(2)
+	if got := c.Members(); len(got) != 2 || got[0] != 3 || got[1] != 1 {
+		t.Fatalf("unexpected members after left, got %v", got)
+	}
+}
+
+func TestChannel_Every(t *testing.T) {
+	c := ChannelService.NewChannel("test_every")
+	a := joinAgents(t, c, 1)[0]
+
+	var ticks int32
+	c.Every("onCountdown", 10*time.Millisecond, func() interface{} {
+		if atomic.AddInt32(&ticks, 1)%2 == 0 {
+			return nil
+		}
+		return []byte("tick")
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case data := <-a.sendBuffer:
+			if !bytes.Contains(data, []byte("onCountdown")) {
+				t.Fatalf("unexpected push: %q", data)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("payload should be broadcast periodically")
+		}
+	}
+
+	c.Destroy()
+	n := atomic.LoadInt32(&ticks)
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&ticks) > n+1 {
+		t.Fatal("broadcasts should stop when channel destroyed")
+	}
+}
+
+func TestChannel_History(t *testing.T) {
+	c := ChannelService.NewChannel("test_history")
+	defer c.Destroy()
+	c.SetHistory(2)
+
+	for _, msg := range []string{"one", "two", "three"} {
+		if err := c.Broadcast("onChat", []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := joinAgents(t, c, 1)[0]
+
+	for _, want := range []string{"two", "three"} {
+		select {
+		case data := <-a.sendBuffer:
+			if !bytes.HasSuffix(data, []byte(want)) {
+				t.Fatalf("expect history %s, got %q", want, data)
+			}
+		default:
+			t.Fatalf("history %s should be pushed to the late joiner", want)
+		}
+	}
+	select {
+	case data := <-a.sendBuffer:
+		t.Fatalf("only the last broadcasts should be kept, got %q", data)
+	default:
+	}
+
+	// re-added member does not get the history again
+	c.Add(a.session)
+	if len(a.sendBuffer) != 0 {
+		t.Fatal("history should be pushed to new members only")
+	}
+}
+
+func TestChannel_BroadcastLimit(t *testing.T) {
+	c := ChannelService.NewChannel("test_limit")
+	defer c.Destroy()
+
+	a := joinAgents(t, c, 1)[0]
+
+	c.SetBroadcastLimit(&BroadcastLimit{RateLimit: RateLimit{QPS: 1, Burst: 1}})
+	if err := c.Broadcast("onChat", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Broadcast("onChat", []byte("two")); err != ErrBroadcastLimited {
+		t.Fatalf("expect %v, got %v", ErrBroadcastLimited, err)
+	}
+	if len(a.sendBuffer) != 1 {
+		t.Fatalf("expect 1 message pushed, got %d", len(a.sendBuffer))
+	}
+	<-a.sendBuffer
+
+	c.SetBroadcastLimit(&BroadcastLimit{RateLimit: RateLimit{QPS: 20, Burst: 1}, Policy: BroadcastCoalesce})
+	for _, msg := range []string{"one", "two", "three"} {
+		if err := c.Broadcast("onMove", []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []string{"one", "three"} {
+		select {
+		case data := <-a.sendBuffer:
+			if !bytes.HasSuffix(data, []byte(want)) {
+				t.Fatalf("expect %s, got %q", want, data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("broadcast %s should be pushed", want)
+		}
+	}
+	select {
+	case data := <-a.sendBuffer:
+		t.Fatalf("delayed broadcasts should be coalesced, got %q", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestChannel_AddChild(t *testing.T) {
+	zone := ChannelService.NewChannel("test_zone")
+	defer zone.Destroy()
+	room1 := ChannelService.NewChannel("test_room1")
+	defer room1.Destroy()
+	room2 := ChannelService.NewChannel("test_room2")
+	defer room2.Destroy()
+
+	if err := zone.AddChild(room1); err != nil {
+		t.Fatal(err)
+	}
+	if err := room1.AddChild(room2); err != nil {
+		t.Fatal(err)
+	}
+	if err := room2.AddChild(zone); err != ErrChannelCycle {
+		t.Fatalf("expect %v, got %v", ErrChannelCycle, err)
+	}
+	// move room2 under zone
+	if err := zone.AddChild(room2); err != nil {
+		t.Fatal(err)
+	}
+	if room2.Parent() != zone || len(room1.Children()) != 0 || len(zone.Children()) != 2 {
+		t.Fatal("room2 should be moved under zone")
+	}
+
+	agents := joinAgents(t, nil, 2)
+	zone.Add(agents[0].session)
+	room1.Add(agents[0].session)
+	room2.Add(agents[1].session)
+
+	if err := zone.Broadcast("onAnnounce", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range agents {
+		if len(a.sendBuffer) != 1 {
+			t.Fatalf("session %d expect 1 message, got %d", i, len(a.sendBuffer))
+		}
+		<-a.sendBuffer
+	}
+
+	if err := room2.Broadcast("onChat", []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if len(agents[0].sendBuffer) != 0 || len(agents[1].sendBuffer) != 1 {
+		t.Fatal("broadcast of child should not reach its parent")
+	}
+	<-agents[1].sendBuffer
+
+	room2.Destroy()
+	if len(zone.Children()) != 1 {
+		t.Fatal("destroyed channel should be detached from parent")
+	}
+}
+
+func TestChannel_OnJoin(t *testing.T) {
+	c := ChannelService.NewChannel("test_presence")
+	defer c.Destroy()
+	c.SetPresence("onJoin", "onLeave", nil)
+
+	var joined []int64
+	var left []bool
+	c.OnJoin(func(_ *Channel, s *session.Session) { joined = append(joined, s.Uid) })
+	c.OnLeave(func(_ *Channel, s *session.Session, disconnected bool) { left = append(left, disconnected) })
+
+	agents := joinAgents(t, c, 2)
+	c.Add(agents[0].session)
+	if !reflect.DeepEqual(joined, []int64{1, 2}) {
+		t.Fatalf("expect joined [1 2], got %v", joined)
+	}
+	if len(agents[1].sendBuffer) != 0 {
+		t.Fatal("presence should not be pushed to the member joined")
+	}
+	select {
+	case data := <-agents[0].sendBuffer:
+		if !bytes.Contains(data, []byte(`"uid":2`)) {
+			t.Fatalf("expect presence of uid 2, got %q", data)
+		}
+	default:
+		t.Fatal("presence should be pushed to the other members")
+	}
+
+	c.disconnect(2)
+	c.Leave(1)
+	if !reflect.DeepEqual(left, []bool{true, false}) {
+		t.Fatalf("expect left [true false], got %v", left)
+	}
+	select {
+	case data := <-agents[0].sendBuffer:
+		if !bytes.Contains(data, []byte(`"uid":2`)) {
+			t.Fatalf("expect presence of uid 2 left, got %q", data)
+		}
+	default:
+		t.Fatal("presence should be pushed to the other members")
+	}
+}
+
+func TestChannel_PresenceFunc(t *testing.T) {
+	c := ChannelService.NewChannel("test_presence_func")
+	defer c.Destroy()
+	c.SetPresence("onJoin", "onLeave", func(_ *Channel, s *session.Session, joined bool) interface{} {
+		return []byte(fmt.Sprintf("%d:%v", s.Uid, joined))
+	})
+
+	agents := joinAgents(t, c, 2)
+	c.Leave(2)
+
+	for _, expect := range []string{"2:true", "2:false"} {
+		select {
+		case data := <-agents[0].sendBuffer:
+			if !bytes.Contains(data, []byte(expect)) {
+				t.Fatalf("expect presence %s, got %q", expect, data)
+			}
+		default:
+			t.Fatal("presence should be pushed to the other members")
+		}
+	}
+}
+
+func TestChannel_SetCapacity(t *testing.T) {
+	c := ChannelService.NewChannel("test_capacity")
+	defer c.Destroy()
+	c.SetCapacity(1)
+
+	var waiting []*session.Session
+	c.OnFull(func(_ *Channel, s *session.Session) { waiting = append(waiting, s) })
+	c.OnLeave(func(c *Channel, _ *session.Session, _ bool) {
+		if len(waiting) > 0 {
+			c.Add(waiting[0])
+			waiting = waiting[1:]
+		}
+	})
+
+	s1 := session.New(nil)
+	s1.Uid = 1
+	s2 := session.New(nil)
+	s2.Uid = 2
+	if err := c.Add(s1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(s2); err != ErrChannelFull {
+		t.Fatalf("expect %v, got %v", ErrChannelFull, err)
+	}
+	if err := c.Add(s1); err != nil {
+		t.Fatalf("member should be re-added to full channel, got %v", err)
+	}
+	if len(waiting) != 1 || waiting[0] != s2 {
+		t.Fatal("session rejected should be passed to OnFull callback")
+	}
+
+	c.Leave(1)
+	if !c.Contains(2) || c.Count() != 1 {
+		t.Fatal("waiting session should join when a member left")
+	}
+}
+
+func TestChannel_SetShards(t *testing.T) {
+	c := ChannelService.NewChannel("test_shards")
+	defer c.Destroy()
+
+	agents := joinAgents(t, nil, 8)
+	for i, a := range agents {
+		if i == 4 {
+			// members added before sharding are moved to shards
+			c.SetShards(3)
+		}
+		c.Add(a.session)
+	}
+	if c.Shards() != 3 {
+		t.Fatalf("expect 3 shards, got %d", c.Shards())
+	}
+
+	if err := c.Broadcast("onChat", []byte("hi"), agents[0].session.ID); err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range agents {
+		want := 1
+		if i == 0 {
+			want = 0
+		}
+		if len(a.sendBuffer) != want {
+			t.Fatalf("session %d expect %d messages, got %d", i, want, len(a.sendBuffer))
+		}
+		if want > 0 {
+			<-a.sendBuffer
+		}
+	}
+
+	c.Leave(2)
+	if err := c.Broadcast("onChat", []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if len(agents[1].sendBuffer) != 0 {
+		t.Fatal("member left should not be pushed")
+	}
+	if len(agents[7].sendBuffer) != 1 {
+		t.Fatal("members should be pushed")
+	}
+}
+
+func TestChannel_AddFilter(t *testing.T) {
+	c := ChannelService.NewChannel("test_filter")
+	defer c.Destroy()
+
+	a := joinAgents(t, c, 1)[0]
+
+	muted := session.New(nil)
+	muted.Uid = 2
+	c.AddFilter(
+		func(sender *session.Session, route string, v interface{}) (interface{}, bool) {
+			return v, sender == nil || sender.Uid != muted.Uid
+		},
+		func(sender *session.Session, route string, v interface{}) (interface{}, bool) {
+			return bytes.Replace(v.([]byte), []byte("darn"), []byte("****"), -1), true
+		},
+	)
+
+	if err := c.BroadcastFrom(muted, "onChat", []byte("hi")); err != ErrBroadcastFiltered {
+		t.Fatalf("expect %v, got %v", ErrBroadcastFiltered, err)
+	}
+	if len(a.sendBuffer) != 0 {
+		t.Fatal("broadcast of muted sender should not be pushed")
+	}
+
+	if err := c.BroadcastFrom(a.session, "onChat", []byte("darn it")); err != nil {
+		t.Fatal(err)
+	}
+	if data := <-a.sendBuffer; !bytes.HasSuffix(data, []byte("**** it")) {
+		t.Fatalf("broadcast should be rewritten by filter, got %q", data)
+	}
+}
+
+func TestChannel_SetMeta(t *testing.T) {
+	c := ChannelService.NewChannel("test_meta")
+	defer c.Destroy()
+
+	var changes []string
+	c.OnMetaChange(func(_ *Channel, key string, old, value interface{}) {
+		changes = append(changes, fmt.Sprintf("%s:%v->%v", key, old, value))
+	})
+
+	c.SetMeta("map", "desert")
+	c.SetMeta("map", "forest")
+	c.SetMeta("owner", int64(1))
+	if c.MetaString("map") != "forest" || c.MetaString("owner") != "" {
+		t.Fatalf("unexpected meta %v", c.AllMeta())
+	}
+	if v, ok := c.Meta("owner"); !ok || v != int64(1) {
+		t.Fatalf("expect owner 1, got %v", v)
+	}
+
+	c.RemoveMeta("owner")
+	c.RemoveMeta("missing")
+	if _, ok := c.Meta("owner"); ok || len(c.AllMeta()) != 1 {
+		t.Fatal("meta removed should not exist")
+	}
+
+	want := []string{"map:<nil>->desert", "map:desert->forest", "owner:<nil>->1", "owner:1-><nil>"}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("expect changes %v, got %v", want, changes)
+	}
+}
+
+func TestChannel_SetAutoDestroy(t *testing.T) {
+	c := ChannelService.NewChannel("test_grace")
+	defer c.Destroy()
+
+	s := session.New(nil)
+	s.Uid = 1
+	c.Add(s)
+	c.SetAutoDestroy(50 * time.Millisecond)
+
+	// rejoined in grace
+	c.Leave(1)
+	time.Sleep(20 * time.Millisecond)
+	c.Add(s)
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := ChannelService.Channel("test_grace"); !ok {
+		t.Fatal("channel rejoined should not be destroyed")
+	}
+
+	c.Leave(1)
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := ChannelService.Channel("test_grace"); ok {
+		t.Fatal("empty channel should be destroyed after grace")
+	}
+}
+
+func TestChannel_BroadcastStats(t *testing.T) {
+	defer SetSendBuffer(0, SendBlock)
+	SetSendBuffer(1, SendDropNewest)
+
+	c := ChannelService.NewChannel("test_stats")
+	defer c.Destroy()
+
+	agents := joinAgents(t, c, 3)
+	// the client reading slowly
+	agents[2].sendBuffer <- []byte("pending")
+
+	if err := c.Broadcast("onChat", []byte("hi"), agents[0].session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Broadcast("onNotice", []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := c.BroadcastStats()
+	if stats.Broadcasts != 2 || stats.Delivered != 2 || stats.Dropped != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	last := stats.Last
+	if last.Route != "onNotice" || last.Members != 3 || last.Delivered != 1 || last.Dropped != 2 {
+		t.Fatalf("unexpected last broadcast %+v", last)
+	}
+}
+
+func TestChannel_Mute(t *testing.T) {
+	c := ChannelService.NewChannel("test_mute")
+	defer c.Destroy()
+
+	agents := joinAgents(t, c, 3)
+	c.Mute(2, 1)
+	if muted := c.Muted(2); !reflect.DeepEqual(muted, []int64{1}) {
+		t.Fatalf("expect muted [1], got %v", muted)
+	}
+
+	check := func(name string, pushed ...int) {
+		for i, a := range agents {
+			want := 0
+			for _, p := range pushed {
+				if p == i {
+					want = 1
+				}
+			}
+			if len(a.sendBuffer) != want {
+				t.Fatalf("%s: session %d expect %d messages, got %d", name, i, want, len(a.sendBuffer))
+			}
+			if want > 0 {
+				<-a.sendBuffer
+			}
+		}
+	}
+
+	c.BroadcastFrom(agents[0].session, "onChat", []byte("hi"), agents[0].session.ID)
+	check("muted", 2)
+	c.Broadcast("onNotice", []byte("hi"))
+	check("not from member", 0, 1, 2)
+	expandChannel(&cluster.ChannelMessage{Channel: "test_mute", Route: "onChat", Data: []byte("hi"), From: 1})
+	check("cluster", 0, 2)
+	c.SetShards(2)
+	c.BroadcastFrom(agents[0].session, "onChat", []byte("hi"))
+	check("sharded", 0, 2)
+
+	c.Unmute(2, 1)
+	c.BroadcastFrom(agents[0].session, "onChat", []byte("hi"))
+	check("unmuted", 0, 1, 2)
+
+	c.Mute(2, 1)
+	c.Leave(2)
+	if len(c.Muted(2)) != 0 {
+		t.Fatal("ignore list should be cleared when the member left")
+	}
+}
+
+func TestChannel_Serialize(t *testing.T) {
+	defer unbindAll(2)
+
+	c := ChannelService.NewChannel("test_snapshot")
+	c.SetHistory(1)
+	c.SetMeta("map", "desert")
+	joinAgents(t, c, 2)
+	c.Broadcast("onChat", []byte("one"))
+	c.Broadcast("onChat", []byte("two"))
+
+	data, err := c.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Destroy()
+
+	a := pipeAgent(t)
+	if err := a.session.Bind(1); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = ChannelService.Deserialize(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy()
+	if c.MetaString("map") != "desert" {
+		t.Fatalf("meta should be restored, got %v", c.AllMeta())
+	}
+	if !c.Contains(1) || c.Contains(2) {
+		t.Fatalf("bound member should join at once, got %v", c.Members())
+	}
+	select {
+	case data := <-a.sendBuffer:
+		if !bytes.HasSuffix(data, []byte("two")) {
+			t.Fatalf("expect history two, got %q", data)
+		}
+	default:
+		t.Fatal("history should be restored")
+	}
+
+	b := pipeAgent(t)
+	if err := b.session.Bind(2); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Contains(2) || len(b.sendBuffer) != 1 {
+		t.Fatal("member should rejoin when bound")
+	}
+}
+
+func TestChannelService_Multicast(t *testing.T) {
+	room1 := ChannelService.NewChannel("test_multicast1")
+	defer room1.Destroy()
+	room2 := ChannelService.NewChannel("test_multicast2")
+	defer room2.Destroy()
+
+	agents := joinAgents(t, nil, 3)
+	room1.Add(agents[0].session)
+	room1.Add(agents[1].session)
+	room2.Add(agents[1].session)
+	room2.Add(agents[2].session)
+
+	if err := ChannelService.Multicast([]string{"test_multicast1", "test_multicast2", "missing"}, "onNotice", []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range agents {
+		if len(a.sendBuffer) != 1 {
+			t.Fatalf("session %d expect 1 message, got %d", i, len(a.sendBuffer))
+		}
+	}
+
+	if err := ChannelService.Multicast([]string{"missing"}, "onNotice", []byte("hi")); err != ErrChannelNotFound {
+		t.Fatalf("expect %v, got %v", ErrChannelNotFound, err)
+	}
+}
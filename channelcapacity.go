@@ -0,0 +1,74 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+
+	"github.com/lonnng/starx/session"
+)
+
+// ErrChannelFull is returned when a session is added to the channel which
+// reaches its capacity
+var ErrChannelFull = errors.New("channel: channel is full")
+
+// SetCapacity limits the count of members of the channel, e.g: the seats of
+// a match or lobby, zero means unlimited. The uids of persistent channel which
+// have not reconnected hold their seats. Lowering the capacity does not
+// remove the members
+func (c *Channel) SetCapacity(n int) {
+	c.Lock()
+	defer c.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	c.capacity = n
+}
+
+// Capacity returns the max count of members, zero means unlimited
+func (c *Channel) Capacity() int {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.capacity
+}
+
+// OnFull sets the callback fired with the session rejected since the channel
+// is full, e.g: to put it in a waiting list, and add it when a member left
+func (c *Channel) OnFull(cb func(c *Channel, s *session.Session)) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.fullCb = cb
+}
+
+// full reports whether the uid can not join the channel, the lock should be
+// held
+func (c *Channel) full(uid int64) bool {
+	if c.capacity == 0 {
+		return false
+	}
+	if _, ok := c.pending[uid]; ok {
+		return false
+	}
+	return len(c.uidMap)+len(c.pending) >= c.capacity
+}
@@ -0,0 +1,123 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"encoding/json"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+)
+
+// Presence is the default payload of the presence broadcasts of a channel,
+// which is encoded as json
+type Presence struct {
+	Channel string `json:"channel"`
+	Uid     int64  `json:"uid"`
+}
+
+// PresenceFunc returns the payload of the presence broadcast of the session
+// joined or left, which is serialized like the message of Broadcast
+type PresenceFunc func(c *Channel, s *session.Session, joined bool) interface{}
+
+// OnJoin registers the callback fired after a session joined the channel,
+// re-adding a member does not fire it
+func (c *Channel) OnJoin(cb func(c *Channel, s *session.Session)) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.joinCb = append(c.joinCb, cb)
+}
+
+// OnLeave registers the callback fired after a member left the channel,
+// disconnected reports whether it left since its session closed
+func (c *Channel) OnLeave(cb func(c *Channel, s *session.Session, disconnected bool)) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.leaveCb = append(c.leaveCb, cb)
+}
+
+// SetPresence broadcasts the presence of the member joined and left to the
+// other members with the routes, so the presence lists of clients stay
+// accurate without polling, empty route disables the broadcast. The payload
+// is returned by fn, nil fn broadcasts Presence encoded as json
+func (c *Channel) SetPresence(joinRoute, leaveRoute string, fn PresenceFunc) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.joinRoute = joinRoute
+	c.leaveRoute = leaveRoute
+	c.presence = fn
+}
+
+// joined fires the callbacks and the presence broadcast on session joined
+func (c *Channel) joined(s *session.Session) {
+	c.RLock()
+	callbacks := c.joinCb
+	route := c.joinRoute
+	c.RUnlock()
+
+	for _, cb := range callbacks {
+		cb(c, s)
+	}
+	if route != "" {
+		c.announce(route, s, true)
+	}
+}
+
+// left fires the callbacks on member left, and the presence broadcast when
+// announce is true
+func (c *Channel) left(s *session.Session, disconnected, announce bool) {
+	c.RLock()
+	callbacks := c.leaveCb
+	route := c.leaveRoute
+	c.RUnlock()
+
+	for _, cb := range callbacks {
+		cb(c, s, disconnected)
+	}
+	if announce && route != "" {
+		c.announce(route, s, false)
+	}
+}
+
+// announce broadcasts the presence of the session except itself
+func (c *Channel) announce(route string, s *session.Session, joined bool) {
+	c.RLock()
+	fn := c.presence
+	c.RUnlock()
+
+	var v interface{}
+	if fn != nil {
+		v = fn(c, s, joined)
+	} else {
+		data, err := json.Marshal(&Presence{Channel: c.name, Uid: s.Uid})
+		if err != nil {
+			log.Errorf("encode presence of channel %s failed: %s", c.name, err.Error())
+			return
+		}
+		v = data
+	}
+	if err := c.Broadcast(route, v, s.ID); err != nil {
+		log.Errorf("broadcast presence of channel %s failed: %s", c.name, err.Error())
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+
+	"github.com/lonnng/starx/session"
+)
+
+// ErrBroadcastFiltered is returned when the broadcast is rejected by a filter
+// of the channel
+var ErrBroadcastFiltered = errors.New("channel: broadcast rejected by filter")
+
+// BroadcastFilter inspects the broadcast of a channel before it is pushed to
+// the members, e.g: profanity filtering, throttling a sender, or mutes. It
+// returns the message pushed, which may be rewritten, and whether the
+// broadcast is allowed. sender is nil for the broadcasts not sent by a member
+type BroadcastFilter func(sender *session.Session, route string, v interface{}) (interface{}, bool)
+
+// AddFilter appends the filters to the filter chain of the channel, a
+// broadcast passes the filters in order, and is dropped by the first one
+// rejecting it
+func (c *Channel) AddFilter(filters ...BroadcastFilter) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.filters = append(c.filters, filters...)
+}
+
+// filter applies the filter chain to the broadcast
+func (c *Channel) filter(sender *session.Session, route string, v interface{}) (interface{}, bool) {
+	c.RLock()
+	filters := c.filters
+	c.RUnlock()
+
+	for _, fn := range filters {
+		var ok bool
+		if v, ok = fn(sender, route, v); !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,79 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"time"
+
+	"github.com/lonnng/starx/log"
+)
+
+// SetAutoDestroy destroys the channel when it stays empty for grace after the
+// last member left, the destroy is cancelled when a session joins in grace,
+// so abandoned rooms do not accumulate. The uids of persistent channel which
+// have not reconnected keep it. The channel without members is destroyed
+// after grace as well. Zero disables it
+func (c *Channel) SetAutoDestroy(grace time.Duration) {
+	c.Lock()
+	c.grace = grace
+	c.occupied()
+	c.Unlock()
+
+	c.vacated()
+}
+
+// vacated arms the timer destroying the channel when it is empty
+func (c *Channel) vacated() {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.grace <= 0 || c.graceTimer != nil || len(c.uidMap)+len(c.pending) > 0 {
+		return
+	}
+	c.graceArmed++
+	armed := c.graceArmed
+	c.graceTimer = time.AfterFunc(c.grace, func() { c.expire(armed) })
+}
+
+// occupied cancels the timer destroying the channel, the lock should be held
+func (c *Channel) occupied() {
+	if c.graceTimer != nil {
+		c.graceTimer.Stop()
+		c.graceTimer = nil
+	}
+}
+
+// expire destroys the channel which stays empty, armed identifies the timer
+// fired, the timer cancelled before is ignored
+func (c *Channel) expire(armed uint64) {
+	c.Lock()
+	if c.graceTimer == nil || c.graceArmed != armed {
+		// cancelled
+		c.Unlock()
+		return
+	}
+	c.graceTimer = nil
+	grace := c.grace
+	c.Unlock()
+
+	log.Infof("destroy channel %s, which is empty beyond %v", c.name, grace)
+	c.Destroy()
+}
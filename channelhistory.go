@@ -0,0 +1,77 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+)
+
+// broadcastRecord is a broadcast kept in the history of channel
+type broadcastRecord struct {
+	route string
+	v     interface{}
+}
+
+// SetHistory keeps the last n broadcasts of the channel, which are pushed to
+// the sessions joined later in order, so late joiners of a chat room or match
+// get the recent context, zero disables it and drops the history
+func (c *Channel) SetHistory(n int) {
+	c.historyLock.Lock()
+	defer c.historyLock.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	c.historySize = n
+	if len(c.history) > n {
+		c.history = append([]broadcastRecord(nil), c.history[len(c.history)-n:]...)
+	}
+}
+
+// record keeps the broadcast in history
+func (c *Channel) record(route string, v interface{}) {
+	c.historyLock.Lock()
+	defer c.historyLock.Unlock()
+
+	if c.historySize == 0 {
+		return
+	}
+	if len(c.history) == c.historySize {
+		copy(c.history, c.history[1:])
+		c.history = c.history[:len(c.history)-1]
+	}
+	c.history = append(c.history, broadcastRecord{route: route, v: v})
+}
+
+// replay pushes the history to the session joined
+func (c *Channel) replay(s *session.Session) {
+	c.historyLock.Lock()
+	history := append([]broadcastRecord(nil), c.history...)
+	c.historyLock.Unlock()
+
+	for _, r := range history {
+		if err := s.Push(r.route, r.v); err != nil {
+			log.Errorf("push history of channel %s failed: %s", c.name, err.Error())
+			return
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/log"
+)
+
+// ErrBroadcastLimited is returned when the broadcast is dropped, because the
+// broadcasts of the channel exceed its limit
+var ErrBroadcastLimited = errors.New("channel: broadcasts exceed the limit")
+
+// BroadcastPolicy decides how to handle the broadcasts of a channel beyond
+// its rate limit
+type BroadcastPolicy int
+
+const (
+	// BroadcastDrop drops the broadcasts
+	BroadcastDrop BroadcastPolicy = iota
+
+	// BroadcastCoalesce delays the broadcasts until a token is available, and
+	// the delayed broadcasts of same route are coalesced to the latest one,
+	// e.g: position or scoreboard updates, the broadcasts are dropped when
+	// QPS is zero
+	BroadcastCoalesce
+)
+
+// BroadcastLimit limits the broadcasts of a channel with token bucket, so a
+// chat flood is not amplified across thousands of members on frontends
+type BroadcastLimit struct {
+	RateLimit                 // broadcasts allowed per second and in a burst
+	Policy    BroadcastPolicy // how to handle the broadcasts beyond the limit
+}
+
+// delayed is a broadcast waiting for a token
+type delayed struct {
+	v      interface{}
+	except []int64
+	from   int64
+}
+
+type broadcastLimiter struct {
+	sync.Mutex
+	limit   BroadcastLimit
+	burst   float64
+	bucket  bucket
+	delayed map[string]*delayed // route => latest broadcast delayed
+	routes  []string            // routes of delayed broadcasts in order
+	timer   *time.Timer         // flushes the delayed broadcasts
+}
+
+// SetBroadcastLimit limits the broadcasts of the channel, nil disables it,
+// the broadcasts delayed are discarded when the limit replaced
+func (c *Channel) SetBroadcastLimit(l *BroadcastLimit) {
+	var limiter *broadcastLimiter
+	if l != nil {
+		burst := float64(l.Burst)
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = &broadcastLimiter{
+			limit:   *l,
+			burst:   burst,
+			bucket:  bucket{tokens: burst, last: time.Now()},
+			delayed: make(map[string]*delayed),
+		}
+	}
+
+	c.Lock()
+	old := c.limiter
+	c.limiter = limiter
+	c.Unlock()
+
+	if old != nil {
+		old.stop()
+	}
+}
+
+func (c *Channel) limiterOf() *broadcastLimiter {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.limiter
+}
+
+// admit reports whether the broadcast is delivered at the moment, returns
+// ErrBroadcastLimited when the broadcast is dropped
+func (l *broadcastLimiter) admit(c *Channel, route string, v interface{}, except []int64, from int64, now time.Time) (bool, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	// the broadcasts delayed go first
+	if len(l.routes) == 0 && l.bucket.take(now, l.limit.QPS, l.burst) {
+		return true, nil
+	}
+
+	if l.limit.Policy != BroadcastCoalesce || l.limit.QPS <= 0 {
+		log.Debugf("Channel=%s broadcasts too fast, Route=%s dropped", c.name, route)
+		return false, ErrBroadcastLimited
+	}
+
+	if d, ok := l.delayed[route]; ok {
+		d.v, d.except, d.from = v, except, from
+	} else {
+		l.delayed[route] = &delayed{v: v, except: except, from: from}
+		l.routes = append(l.routes, route)
+	}
+	l.schedule(c)
+	return false, nil
+}
+
+// schedule flushes the delayed broadcasts when next token is available
+func (l *broadcastLimiter) schedule(c *Channel) {
+	if l.timer != nil {
+		return
+	}
+	wait := time.Duration((1 - l.bucket.tokens) / l.limit.QPS * float64(time.Second))
+	l.timer = time.AfterFunc(wait, func() { l.flush(c) })
+}
+
+// flush delivers the delayed broadcasts as many as the tokens allow
+func (l *broadcastLimiter) flush(c *Channel) {
+	type broadcast struct {
+		route string
+		*delayed
+	}
+	var batch []broadcast
+
+	l.Lock()
+	if l.timer == nil {
+		// stopped
+		l.Unlock()
+		return
+	}
+	l.timer = nil
+	now := time.Now()
+	for len(l.routes) > 0 && l.bucket.take(now, l.limit.QPS, l.burst) {
+		route := l.routes[0]
+		batch = append(batch, broadcast{route: route, delayed: l.delayed[route]})
+		delete(l.delayed, route)
+		l.routes = l.routes[1:]
+	}
+	if len(l.routes) > 0 {
+		l.schedule(c)
+	}
+	l.Unlock()
+
+	for _, b := range batch {
+		if err := c.deliver(b.route, b.v, b.except, b.from); err != nil {
+			log.Errorf("broadcast channel %s failed: %s", c.name, err.Error())
+		}
+	}
+}
+
+// stop discards the delayed broadcasts
+func (l *broadcastLimiter) stop() {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.delayed = make(map[string]*delayed)
+	l.routes = nil
+}
@@ -0,0 +1,96 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+// SetMeta sets the metadata of key of the channel, e.g: room settings, map id
+// or owner, and fires the callbacks registered by OnMetaChange. The metadata
+// is kept by current server, the channels of the same name on other servers
+// have their own
+func (c *Channel) SetMeta(key string, value interface{}) {
+	c.metaLock.Lock()
+	if c.meta == nil {
+		c.meta = make(map[string]interface{})
+	}
+	old := c.meta[key]
+	c.meta[key] = value
+	callbacks := c.metaCb
+	c.metaLock.Unlock()
+
+	for _, cb := range callbacks {
+		cb(c, key, old, value)
+	}
+}
+
+// Meta returns the metadata of key, and reports whether it exists
+func (c *Channel) Meta(key string) (interface{}, bool) {
+	c.metaLock.RLock()
+	defer c.metaLock.RUnlock()
+
+	v, ok := c.meta[key]
+	return v, ok
+}
+
+// MetaString returns the metadata of key as string, empty string when it does
+// not exist or is not a string
+func (c *Channel) MetaString(key string) string {
+	v, _ := c.Meta(key)
+	s, _ := v.(string)
+	return s
+}
+
+// AllMeta returns a copy of all metadata of the channel
+func (c *Channel) AllMeta() map[string]interface{} {
+	c.metaLock.RLock()
+	defer c.metaLock.RUnlock()
+
+	meta := make(map[string]interface{}, len(c.meta))
+	for k, v := range c.meta {
+		meta[k] = v
+	}
+	return meta
+}
+
+// RemoveMeta removes the metadata of key, and fires the callbacks registered
+// by OnMetaChange with nil value
+func (c *Channel) RemoveMeta(key string) {
+	c.metaLock.Lock()
+	old, ok := c.meta[key]
+	delete(c.meta, key)
+	callbacks := c.metaCb
+	c.metaLock.Unlock()
+
+	if !ok {
+		return
+	}
+	for _, cb := range callbacks {
+		cb(c, key, old, nil)
+	}
+}
+
+// OnMetaChange registers the callback fired after the metadata of the channel
+// set or removed, with the old and new values of key, e.g: to broadcast the
+// room settings changed to the members
+func (c *Channel) OnMetaChange(cb func(c *Channel, key string, old, value interface{})) {
+	c.metaLock.Lock()
+	defer c.metaLock.Unlock()
+
+	c.metaCb = append(c.metaCb, cb)
+}
@@ -0,0 +1,117 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import "github.com/lonnng/starx/session"
+
+// Mute adds muted to the ignore list of the member of uid, the broadcasts
+// sent by muted with BroadcastFrom are not pushed to the member, so the
+// application code does not filter every message. The ignore list is cleared
+// when the member left
+func (c *Channel) Mute(uid, muted int64) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.mutes == nil {
+		c.mutes = make(map[int64]map[int64]struct{})
+		c.mutedBy = make(map[int64]map[int64]struct{})
+	}
+	if c.mutes[uid] == nil {
+		c.mutes[uid] = make(map[int64]struct{})
+	}
+	if c.mutedBy[muted] == nil {
+		c.mutedBy[muted] = make(map[int64]struct{})
+	}
+	c.mutes[uid][muted] = struct{}{}
+	c.mutedBy[muted][uid] = struct{}{}
+}
+
+// Unmute removes muted from the ignore list of the member of uid
+func (c *Channel) Unmute(uid, muted int64) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.unmute(uid, muted)
+}
+
+// Muted returns the ignore list of the member of uid
+func (c *Channel) Muted(uid int64) []int64 {
+	c.RLock()
+	defer c.RUnlock()
+
+	uids := make([]int64, 0, len(c.mutes[uid]))
+	for muted := range c.mutes[uid] {
+		uids = append(uids, muted)
+	}
+	return uids
+}
+
+// unmute removes muted from the ignore list, the lock should be held
+func (c *Channel) unmute(uid, muted int64) {
+	if set, ok := c.mutes[uid]; ok {
+		delete(set, muted)
+		if len(set) == 0 {
+			delete(c.mutes, uid)
+		}
+	}
+	if set, ok := c.mutedBy[muted]; ok {
+		delete(set, uid)
+		if len(set) == 0 {
+			delete(c.mutedBy, muted)
+		}
+	}
+}
+
+// unmuteAll clears the ignore list of the member left, the lock should be
+// held
+func (c *Channel) unmuteAll(uid int64) {
+	for muted := range c.mutes[uid] {
+		c.unmute(uid, muted)
+	}
+}
+
+// muting returns the uids of the members muting the uid from, nil when none
+func (c *Channel) muting(from int64) map[int64]bool {
+	if from == 0 {
+		return nil
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	set := c.mutedBy[from]
+	if len(set) == 0 {
+		return nil
+	}
+	uids := make(map[int64]bool, len(set))
+	for uid := range set {
+		uids[uid] = true
+	}
+	return uids
+}
+
+// uidOf returns the uid of the sender, zero for nil
+func uidOf(s *session.Session) int64 {
+	if s == nil {
+		return 0
+	}
+	return s.Uid
+}
@@ -0,0 +1,219 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+)
+
+// ChannelService manages the named channels of current server, e.g: rooms,
+// guilds and the world, the sessions closed leave their channels
+var ChannelService = newChannelService()
+
+type channelService struct {
+	sync.RWMutex
+	channels map[string]*Channel // channel name => channel
+
+	joinedLock sync.Mutex                      // protects joined, it is acquired after the lock of channel
+	joined     map[int64]map[*Channel]struct{} // session id => channels joined
+}
+
+func newChannelService() *channelService {
+	return &channelService{
+		channels: make(map[string]*Channel),
+		joined:   make(map[int64]map[*Channel]struct{}),
+	}
+}
+
+// NewChannel creates the channel of name, or returns the channel created
+// before with the name
+func (c *channelService) NewChannel(name string) *Channel {
+	return c.newChannel(name, false)
+}
+
+// newChannel returns the channel of name, the channel is marked persistent
+// when persistent is true
+func (c *channelService) newChannel(name string, persistent bool) *Channel {
+	c.Lock()
+	ch, ok := c.channels[name]
+	if !ok {
+		ch = newChannel(name)
+		c.channels[name] = ch
+	}
+	c.Unlock()
+
+	if persistent {
+		ch.Lock()
+		ch.persistent = true
+		ch.Unlock()
+	}
+	return ch
+}
+
+// Channel returns the channel of name, and reports whether it exists
+func (c *channelService) Channel(name string) (*Channel, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	ch, ok := c.channels[name]
+	return ch, ok
+}
+
+// Channels returns the names of all channels
+func (c *channelService) Channels() []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	names := make([]string, 0, len(c.channels))
+	for name := range c.channels {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Members returns the uids of the members of the channel, nil when the
+// channel does not exist
+func (c *channelService) Members(name string) []int64 {
+	if ch, ok := c.Channel(name); ok {
+		return ch.Members()
+	}
+	return nil
+}
+
+// Broadcast pushes the message to all members of the channel, except the
+// sessions of the ids
+func (c *channelService) Broadcast(name, route string, v interface{}, except ...int64) error {
+	ch, ok := c.Channel(name)
+	if !ok {
+		return ErrChannelNotFound
+	}
+	return ch.Broadcast(route, v, except...)
+}
+
+// Multicast pushes the message to the members of the channels in a single
+// pass, the session being a member of several channels is pushed once, the
+// channels do not exist are skipped, and ErrChannelNotFound is returned when
+// none exists. The filters, limits and histories of the channels are not
+// applied. With cluster channels, one multicast listing the channels is sent
+// to the servers tracking them, and expanded once on every frontend server,
+// which is not ordered with the broadcasts of the channels
+func (c *channelService) Multicast(names []string, route string, v interface{}) error {
+	var channels []*Channel
+	for _, name := range names {
+		if ch, ok := c.Channel(name); ok {
+			channels = append(channels, ch)
+		}
+	}
+	if len(channels) == 0 {
+		return ErrChannelNotFound
+	}
+
+	if svrType := channelTypeOf(); svrType != "" {
+		found := make([]string, 0, len(channels))
+		for _, ch := range channels {
+			found = append(found, ch.name)
+		}
+		return multicastCluster(svrType, found, route, v)
+	}
+
+	log.Debugf("Type=Multicast Route=%s, Data=%+v, Channels=%v", route, v, names)
+	return multicast(channels, route, v)
+}
+
+// multicast pushes the message to the members of the channels of current
+// server, the session in several channels is pushed once
+func multicast(channels []*Channel, route string, v interface{}) error {
+	var err error
+	payloads := newPayloads(v)
+	seen := make(map[int64]bool)
+	for _, ch := range channels {
+		out := &fanout{}
+		if e := ch.pushMembers(route, payloads, nil, 0, seen, out); e != nil {
+			err = e
+		}
+		ch.recordFanout(route, out)
+	}
+	return err
+}
+
+// DestroyChannel removes the members of the channels, and forgets them
+func (c *channelService) DestroyChannel(names ...string) {
+	for _, name := range names {
+		if ch, ok := c.Channel(name); ok {
+			ch.Destroy()
+		}
+	}
+}
+
+// remove forgets the channel destroyed
+func (c *channelService) remove(ch *Channel) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.channels[ch.name] == ch {
+		delete(c.channels, ch.name)
+	}
+}
+
+// join records the channel joined by the session, it should be called with
+// the lock of channel held
+func (c *channelService) join(s *session.Session, ch *Channel) {
+	c.joinedLock.Lock()
+	defer c.joinedLock.Unlock()
+
+	channels, ok := c.joined[s.ID]
+	if !ok {
+		channels = make(map[*Channel]struct{})
+		c.joined[s.ID] = channels
+	}
+	channels[ch] = struct{}{}
+}
+
+// unjoin forgets the channel left by the session, it should be called with
+// the lock of channel held
+func (c *channelService) unjoin(s *session.Session, ch *Channel) {
+	c.joinedLock.Lock()
+	defer c.joinedLock.Unlock()
+
+	channels := c.joined[s.ID]
+	delete(channels, ch)
+	if len(channels) == 0 {
+		delete(c.joined, s.ID)
+	}
+}
+
+// leave removes the closed session from the channels it joined, the servers
+// tracking the cluster channels are notified by the session closed
+func (c *channelService) leave(s *session.Session) {
+	c.joinedLock.Lock()
+	channels := c.joined[s.ID]
+	delete(c.joined, s.ID)
+	c.joinedLock.Unlock()
+
+	for ch := range channels {
+		if ch.Member(s.Uid) == s {
+			ch.disconnect(s.Uid)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+)
+
+// channelShard is a bucket of the members of sharded channel
+type channelShard struct {
+	sync.RWMutex
+	sessions map[int64]*session.Session // uid => session
+}
+
+// SetShards shards the members of the channel across n buckets, which are
+// pushed by n goroutines in parallel, so a broadcast of the channel with tens
+// of thousands of members, e.g: the world chat, does not iterate a giant map
+// in a single goroutine. n less than 2 disables it
+func (c *Channel) SetShards(n int) {
+	c.Lock()
+	defer c.Unlock()
+
+	if n < 2 {
+		c.shards = nil
+		return
+	}
+	c.shards = make([]*channelShard, n)
+	for i := range c.shards {
+		c.shards[i] = &channelShard{sessions: make(map[int64]*session.Session)}
+	}
+	for uid, s := range c.uidMap {
+		c.shardOf(uid).sessions[uid] = s
+	}
+}
+
+// Shards returns the count of shards, zero means not sharded
+func (c *Channel) Shards() int {
+	c.RLock()
+	defer c.RUnlock()
+
+	return len(c.shards)
+}
+
+func (c *Channel) shardsOf() []*channelShard {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.shards
+}
+
+// shardOf returns the shard of uid, nil when not sharded, the lock should be
+// held
+func (c *Channel) shardOf(uid int64) *channelShard {
+	if len(c.shards) == 0 {
+		return nil
+	}
+	i := uid % int64(len(c.shards))
+	if i < 0 {
+		i = -i
+	}
+	return c.shards[i]
+}
+
+// resetShards removes the members from all shards, the lock should be held
+func (c *Channel) resetShards() {
+	for _, shard := range c.shards {
+		shard.Lock()
+		shard.sessions = make(map[int64]*session.Session)
+		shard.Unlock()
+	}
+}
+
+func (s *channelShard) add(session *session.Session) {
+	if s == nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.sessions[session.Uid] = session
+}
+
+func (s *channelShard) remove(uid int64) {
+	if s == nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.sessions, uid)
+}
+
+// pushShards pushes the payloads to the members of all shards in parallel,
+// the members of uids in muting and the sessions in seen are skipped, and the
+// sessions pushed are added to seen when it is not nil, the outcomes are
+// counted in out
+func pushShards(shards []*channelShard, route string, payloads *payloads, except []int64, muting map[int64]bool, seen map[int64]bool, out *fanout) error {
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex // protects seen and err
+		firstErr error
+	)
+
+	// visit reports whether the session should be pushed
+	visit := func(s *session.Session) bool {
+		id := s.ID
+		if excluded(id, except) || muting[s.Uid] {
+			return false
+		}
+		if seen == nil {
+			return true
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		if seen[id] {
+			return false
+		}
+		seen[id] = true
+		return true
+	}
+
+	for _, shard := range shards {
+		wg.Add(1)
+		go func(shard *channelShard) {
+			defer wg.Done()
+
+			shard.RLock()
+			defer shard.RUnlock()
+
+			for _, s := range shard.sessions {
+				if !visit(s) {
+					continue
+				}
+				data, err := payloads.of(s)
+				if err == nil {
+					err = transporter.push(s, route, data)
+				}
+				if err = out.pushed(err); err != nil {
+					log.Error(err.Error())
+					lock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					lock.Unlock()
+				}
+			}
+		}(shard)
+	}
+	wg.Wait()
+
+	return firstErr
+}
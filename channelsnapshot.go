@@ -0,0 +1,128 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/lonnng/starx/session"
+)
+
+// ChannelSnapshot is the state of a channel exported by Channel.Serialize
+type ChannelSnapshot struct {
+	Name        string                 `json:"name"`
+	Members     []int64                `json:"members"`
+	Meta        map[string]interface{} `json:"meta,omitempty"`
+	HistorySize int                    `json:"historySize,omitempty"`
+	History     []SnapshotBroadcast    `json:"history,omitempty"`
+}
+
+// SnapshotBroadcast is a broadcast in the history of channel snapshot
+type SnapshotBroadcast struct {
+	Route string `json:"route"`
+	Data  []byte `json:"data"` // serialized by the default serializer
+}
+
+// Serialize exports the members by uid, the metadata and the history of the
+// channel, so a match can be handed off to another server or checkpointed
+// for crash recovery. The metadata should be encodable by encoding/json, and
+// the broadcasts in history are serialized by the default serializer
+func (c *Channel) Serialize() ([]byte, error) {
+	snapshot := &ChannelSnapshot{Name: c.name, Meta: c.AllMeta()}
+
+	c.RLock()
+	snapshot.Members = append(snapshot.Members, c.members...)
+	for uid := range c.pending {
+		snapshot.Members = append(snapshot.Members, uid)
+	}
+	c.RUnlock()
+	sort.Slice(snapshot.Members, func(i, j int) bool { return snapshot.Members[i] < snapshot.Members[j] })
+
+	c.historyLock.Lock()
+	snapshot.HistorySize = c.historySize
+	history := append([]broadcastRecord(nil), c.history...)
+	c.historyLock.Unlock()
+
+	for _, r := range history {
+		data, err := serializeOrRaw(r.v)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.History = append(snapshot.History, SnapshotBroadcast{Route: r.route, Data: data})
+	}
+	return json.Marshal(snapshot)
+}
+
+// Deserialize imports the channel exported by Channel.Serialize, the channel
+// of the name is created when it does not exist. The members whose sessions
+// are bound on current server join at once, and the others join when their
+// sessions bound to the uids. The metadata and the history are replaced, and
+// the numbers of metadata are decoded as float64
+func (c *channelService) Deserialize(data []byte) (*Channel, error) {
+	snapshot := &ChannelSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, err
+	}
+
+	ch := c.NewChannel(snapshot.Name)
+
+	history := make([]broadcastRecord, 0, len(snapshot.History))
+	for _, b := range snapshot.History {
+		history = append(history, broadcastRecord{route: b.Route, v: b.Data})
+	}
+	ch.historyLock.Lock()
+	ch.historySize = snapshot.HistorySize
+	ch.history = history
+	ch.historyLock.Unlock()
+
+	for k := range ch.AllMeta() {
+		if _, ok := snapshot.Meta[k]; !ok {
+			ch.RemoveMeta(k)
+		}
+	}
+	for k, v := range snapshot.Meta {
+		ch.SetMeta(k, v)
+	}
+
+	var bound []*session.Session
+	ch.Lock()
+	for _, uid := range snapshot.Members {
+		if _, ok := ch.uidMap[uid]; ok {
+			continue
+		}
+		if sessions := session.SessionsOf(uid); len(sessions) > 0 {
+			bound = append(bound, sessions[0])
+			continue
+		}
+		if ch.pending == nil {
+			ch.pending = make(map[int64]struct{})
+		}
+		ch.pending[uid] = struct{}{}
+	}
+	ch.Unlock()
+
+	rejoinOnce.Do(func() { session.OnBind(ChannelService.rejoin) })
+	for _, s := range bound {
+		ch.Add(s)
+	}
+	return ch, nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// BroadcastResult is the fan-out outcome of a broadcast of channel
+type BroadcastResult struct {
+	Route     string    // route of the broadcast
+	Members   int       // count of members pushed at send time, the sessions excluded are not counted
+	Delivered int       // count of pushes queued to the members
+	Dropped   int       // count of pushes dropped, since send buffers are full or sessions closed
+	Time      time.Time // when the broadcast is sent
+}
+
+// BroadcastStats is the delivery statistics of the broadcasts of channel on
+// current server, with cluster channels, the broadcasts are counted on the
+// frontend servers expanding them
+type BroadcastStats struct {
+	Broadcasts uint64          // count of broadcasts
+	Delivered  uint64          // count of pushes queued to the members
+	Dropped    uint64          // count of pushes dropped
+	Last       BroadcastResult // outcome of the last broadcast
+}
+
+// fanout counts the outcomes of pushing a broadcast to members, it is safe
+// for concurrent use
+type fanout struct {
+	delivered int64
+	dropped   int64
+}
+
+// pushed counts the outcome of a push, the error returned is not a drop
+func (f *fanout) pushed(err error) error {
+	switch err {
+	case nil:
+		atomic.AddInt64(&f.delivered, 1)
+		return nil
+	case ErrSendBufferFull, ErrSendChannelClosed:
+		atomic.AddInt64(&f.dropped, 1)
+		return nil
+	}
+	atomic.AddInt64(&f.dropped, 1)
+	return err
+}
+
+// BroadcastStats returns the delivery statistics of the broadcasts, so that
+// designers can see whether the pushes of big rooms arrive
+func (c *Channel) BroadcastStats() BroadcastStats {
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+
+	return c.stats
+}
+
+// recordFanout adds the outcome of a broadcast to the statistics
+func (c *Channel) recordFanout(route string, f *fanout) {
+	delivered := atomic.LoadInt64(&f.delivered)
+	dropped := atomic.LoadInt64(&f.dropped)
+
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+
+	c.stats.Broadcasts++
+	c.stats.Delivered += uint64(delivered)
+	c.stats.Dropped += uint64(dropped)
+	c.stats.Last = BroadcastResult{
+		Route:     route,
+		Members:   int(delivered + dropped),
+		Delivered: int(delivered),
+		Dropped:   int(dropped),
+		Time:      time.Now(),
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+)
+
+// ChannelStore persists the members of persistent channels, so long-lived
+// channels, e.g: guild chat, survive the restart of server
+type ChannelStore interface {
+	// Save stores the uids of the members of channel
+	Save(name string, uids []int64) error
+
+	// Load returns the uids of the members of all channels saved
+	Load() (map[string][]int64, error)
+
+	// Delete removes the channel
+	Delete(name string) error
+}
+
+// channelSaveDelay is the delay before the members changed are saved, the
+// changes in the delay are coalesced into one save
+var channelSaveDelay = 100 * time.Millisecond
+
+var (
+	channelStoreLock sync.RWMutex
+	channelStore     ChannelStore // nil means channels are not persisted
+	rejoinOnce       sync.Once
+	channelSaves     sync.WaitGroup // saves scheduled
+)
+
+// SetChannelStore persists the channels created by
+// ChannelService.NewPersistentChannel in the store, and restores the channels
+// saved before, whose members rejoin the channels when their sessions bound
+// to the uids again, e.g: reconnected after the server restarted
+func SetChannelStore(store ChannelStore) error {
+	channelStoreLock.Lock()
+	channelStore = store
+	channelStoreLock.Unlock()
+
+	if store == nil {
+		return nil
+	}
+	channels, err := store.Load()
+	if err != nil {
+		return err
+	}
+	for name, uids := range channels {
+		ch := ChannelService.newChannel(name, true)
+		ch.Lock()
+		for _, uid := range uids {
+			if _, ok := ch.uidMap[uid]; ok {
+				continue
+			}
+			if ch.pending == nil {
+				ch.pending = make(map[int64]struct{})
+			}
+			ch.pending[uid] = struct{}{}
+		}
+		ch.Unlock()
+	}
+
+	rejoinOnce.Do(func() { session.OnBind(ChannelService.rejoin) })
+	return nil
+}
+
+func channelStoreOf() ChannelStore {
+	channelStoreLock.RLock()
+	defer channelStoreLock.RUnlock()
+
+	return channelStore
+}
+
+// NewPersistentChannel creates the channel of name like NewChannel, and its
+// members are saved in the channel store
+func (c *channelService) NewPersistentChannel(name string) *Channel {
+	ch := c.newChannel(name, true)
+	ch.save()
+	return ch
+}
+
+// rejoin adds the session bound to the channels which the uid is a member of
+// before restored
+func (c *channelService) rejoin(s *session.Session) {
+	c.RLock()
+	channels := make([]*Channel, 0, len(c.channels))
+	for _, ch := range c.channels {
+		channels = append(channels, ch)
+	}
+	c.RUnlock()
+
+	for _, ch := range channels {
+		ch.RLock()
+		_, ok := ch.pending[s.Uid]
+		ch.RUnlock()
+		if ok {
+			ch.Add(s)
+		}
+	}
+}
+
+// disconnect removes the member of uid whose session closed, the uid stays a
+// member of persistent channel, and rejoins it when reconnected
+func (c *Channel) disconnect(uid int64) {
+	s := c.remove(uid)
+	if s == nil {
+		return
+	}
+
+	c.Lock()
+	if c.persistent {
+		if c.pending == nil {
+			c.pending = make(map[int64]struct{})
+		}
+		c.pending[uid] = struct{}{}
+	}
+	c.Unlock()
+
+	c.resetSeq()
+	c.left(s, true, true)
+	c.vacated()
+}
+
+// save schedules saving the members of persistent channel, it does not block
+// the join and leave, and the changes in channelSaveDelay are saved once
+func (c *Channel) save() {
+	if channelStoreOf() == nil {
+		return
+	}
+
+	c.saveLock.Lock()
+	defer c.saveLock.Unlock()
+
+	c.dirty = true
+	if c.saving {
+		return
+	}
+	c.saving = true
+	channelSaves.Add(1)
+	time.AfterFunc(channelSaveDelay, c.flush)
+}
+
+// flush saves the members until no change left
+func (c *Channel) flush() {
+	defer channelSaves.Done()
+
+	for {
+		c.saveLock.Lock()
+		if !c.dirty {
+			c.saving = false
+			c.saveLock.Unlock()
+			return
+		}
+		c.dirty = false
+		c.saveLock.Unlock()
+
+		c.store()
+	}
+}
+
+// store saves the members of persistent channel, including the ones have not
+// reconnected. The members are copied with storeLock held, so the saves of
+// the channel are in order and the last one is the latest members
+func (c *Channel) store() {
+	store := channelStoreOf()
+	if store == nil {
+		return
+	}
+
+	c.storeLock.Lock()
+	defer c.storeLock.Unlock()
+
+	c.RLock()
+	if !c.persistent {
+		c.RUnlock()
+		return
+	}
+	uids := make([]int64, 0, len(c.members)+len(c.pending))
+	uids = append(uids, c.members...)
+	for uid := range c.pending {
+		uids = append(uids, uid)
+	}
+	c.RUnlock()
+
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	if err := store.Save(c.name, uids); err != nil {
+		log.Errorf("save channel %s failed: %s", c.name, err.Error())
+	}
+}
+
+// unsave removes the destroyed channel from the store, after the save in
+// progress, and the saves scheduled skip the channel no longer persistent
+func (c *Channel) unsave() {
+	if store := channelStoreOf(); store != nil {
+		c.storeLock.Lock()
+		defer c.storeLock.Unlock()
+
+		if err := store.Delete(c.name); err != nil {
+			log.Errorf("delete channel %s failed: %s", c.name, err.Error())
+		}
+	}
+}
+
+// flushChannels waits for the saves of channels scheduled, it is called on
+// shutdown so the latest members are saved
+func flushChannels() {
+	channelSaves.Wait()
+}
+
+// FileChannelStore saves the channels in a json file
+type FileChannelStore struct {
+	sync.Mutex
+	path string
+}
+
+// NewFileChannelStore returns the store saving the channels in the file of
+// path, which is created on the first save
+func NewFileChannelStore(path string) *FileChannelStore {
+	return &FileChannelStore{path: path}
+}
+
+// Save stores the uids of the members of channel
+func (f *FileChannelStore) Save(name string, uids []int64) error {
+	f.Lock()
+	defer f.Unlock()
+
+	channels, err := f.load()
+	if err != nil {
+		return err
+	}
+	channels[name] = uids
+	return f.write(channels)
+}
+
+// Load returns the uids of the members of all channels saved
+func (f *FileChannelStore) Load() (map[string][]int64, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.load()
+}
+
+// Delete removes the channel
+func (f *FileChannelStore) Delete(name string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	channels, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := channels[name]; !ok {
+		return nil
+	}
+	delete(channels, name)
+	return f.write(channels)
+}
+
+func (f *FileChannelStore) load() (map[string][]int64, error) {
+	channels := make(map[string][]int64)
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return channels, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// write replaces the file, a crash in writing leaves the old file intact
+func (f *FileChannelStore) write(channels map[string][]int64) error {
+	data, err := json.Marshal(channels)
+	if err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
@@ -0,0 +1,143 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/lonnng/starx/session"
+)
+
+func TestChannelStore(t *testing.T) {
+	store := NewFileChannelStore(filepath.Join(t.TempDir(), "channels.json"))
+	if err := SetChannelStore(store); err != nil {
+		t.Fatal(err)
+	}
+	defer SetChannelStore(nil)
+
+	saved := func() []int64 {
+		flushChannels()
+		channels, err := store.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return channels["test_guild"]
+	}
+
+	c := ChannelService.NewPersistentChannel("test_guild")
+	s, other := session.New(nil), session.New(nil)
+	s.Uid, other.Uid = 7, 8
+	c.Add(s)
+	c.Add(other)
+	if uids := saved(); !reflect.DeepEqual(uids, []int64{7, 8}) {
+		t.Fatalf("members should be saved, got %v", uids)
+	}
+
+	// the member disconnected stays in the channel saved
+	ChannelService.leave(s)
+	if c.Contains(7) || !reflect.DeepEqual(saved(), []int64{7, 8}) {
+		t.Fatalf("disconnected member should be kept, got %v", saved())
+	}
+	c.Leave(8)
+	if uids := saved(); !reflect.DeepEqual(uids, []int64{7}) {
+		t.Fatalf("member left should be removed, got %v", uids)
+	}
+
+	// restart
+	ChannelService.remove(c)
+	if err := SetChannelStore(store); err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := ChannelService.Channel("test_guild")
+	if !ok || restored == c || restored.Count() != 0 {
+		t.Fatal("channel should be restored without members connected")
+	}
+	reconnected := session.New(nil)
+	if err := reconnected.Bind(7); err != nil {
+		t.Fatal(err)
+	}
+	defer reconnected.Unbind()
+	if restored.Member(7) != reconnected {
+		t.Fatal("member should rejoin the channel when reconnected")
+	}
+
+	restored.Destroy()
+	flushChannels()
+	if channels, _ := store.Load(); len(channels) != 0 {
+		t.Fatalf("destroyed channel should be deleted, got %v", channels)
+	}
+}
+
+func TestChannelStore_Coalesce(t *testing.T) {
+	store := &countingStore{}
+	if err := SetChannelStore(store); err != nil {
+		t.Fatal(err)
+	}
+	defer SetChannelStore(nil)
+
+	c := ChannelService.NewPersistentChannel("test_coalesce")
+	defer c.Destroy()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		go func(uid int64) {
+			defer wg.Done()
+			s := session.New(nil)
+			s.Uid = uid
+			c.Add(s)
+		}(int64(i))
+	}
+	wg.Wait()
+	flushChannels()
+
+	store.Lock()
+	defer store.Unlock()
+	if len(store.last) != 100 {
+		t.Fatalf("latest members should be saved, got %d", len(store.last))
+	}
+	if store.saves >= 100 {
+		t.Fatalf("changes should be coalesced, got %d saves", store.saves)
+	}
+}
+
+// countingStore counts the saves of channel
+type countingStore struct {
+	sync.Mutex
+	saves int
+	last  []int64
+}
+
+func (s *countingStore) Save(name string, uids []int64) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.saves++
+	s.last = uids
+	return nil
+}
+
+func (s *countingStore) Load() (map[string][]int64, error) { return nil, nil }
+
+func (s *countingStore) Delete(name string) error { return nil }
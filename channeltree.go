@@ -0,0 +1,162 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/lonnng/starx/log"
+)
+
+// ErrChannelCycle is returned when a channel is added as a child of itself
+// or of its descendants
+var ErrChannelCycle = errors.New("channel: cycle in channel hierarchy")
+
+// treeLock protects the parents and children of all channels
+var treeLock sync.RWMutex
+
+// AddChild makes the channel the parent of child, e.g: a zone containing
+// rooms, a broadcast of the parent reaches the members of all descendants
+// without duplicate memberships, and a session being a member of several of
+// them is pushed once. The child is detached from its former parent
+func (c *Channel) AddChild(child *Channel) error {
+	treeLock.Lock()
+	defer treeLock.Unlock()
+
+	for p := c; p != nil; p = p.parent {
+		if p == child {
+			return ErrChannelCycle
+		}
+	}
+	if child.parent == c {
+		return nil
+	}
+	if child.parent != nil {
+		child.parent.unlink(child)
+	}
+	child.parent = c
+	c.children = append(c.children, child)
+	return nil
+}
+
+// RemoveChild detaches the child from the channel
+func (c *Channel) RemoveChild(child *Channel) {
+	treeLock.Lock()
+	defer treeLock.Unlock()
+
+	if child.parent == c {
+		c.unlink(child)
+		child.parent = nil
+	}
+}
+
+// Parent returns the parent of the channel, nil for the top channels
+func (c *Channel) Parent() *Channel {
+	treeLock.RLock()
+	defer treeLock.RUnlock()
+
+	return c.parent
+}
+
+// Children returns the children of the channel
+func (c *Channel) Children() []*Channel {
+	treeLock.RLock()
+	defer treeLock.RUnlock()
+
+	return append([]*Channel(nil), c.children...)
+}
+
+// unlink removes the child from children, treeLock should be held
+func (c *Channel) unlink(child *Channel) {
+	for i, ch := range c.children {
+		if ch == child {
+			c.children = append(c.children[:i], c.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// detach removes the destroyed channel from its parent, and its children
+// become top channels
+func (c *Channel) detach() {
+	treeLock.Lock()
+	defer treeLock.Unlock()
+
+	if c.parent != nil {
+		c.parent.unlink(c)
+		c.parent = nil
+	}
+	for _, ch := range c.children {
+		ch.parent = nil
+	}
+	c.children = nil
+}
+
+// descendants returns the channel and all its descendants
+func (c *Channel) descendants() []*Channel {
+	treeLock.RLock()
+	defer treeLock.RUnlock()
+
+	channels := []*Channel{c}
+	for i := 0; i < len(channels); i++ {
+		channels = append(channels, channels[i].children...)
+	}
+	return channels
+}
+
+// broadcastTree pushes the message to the members of the channel and its
+// descendants on current server, each session is pushed once
+func (c *Channel) broadcastTree(route string, v interface{}, except []int64, from int64) error {
+	channels := c.descendants()
+	if len(channels) == 1 {
+		return c.broadcast(route, v, except, from)
+	}
+
+	log.Debugf("Type=Broadcast Route=%s, Data=%+v, Channels=%d", route, v, len(channels))
+	c.record(route, v)
+
+	payloads := newPayloads(v)
+	seen := make(map[int64]bool)
+	out := &fanout{}
+	var err error
+	for _, ch := range channels {
+		if e := ch.pushMembers(route, payloads, except, from, seen, out); e != nil {
+			err = e
+		}
+	}
+	c.recordFanout(route, out)
+	return err
+}
+
+// broadcastClusterTree sends the broadcast to the servers tracking the
+// channel and its descendants, the hierarchy is known by current server only,
+// so the descendants are broadcast one by one
+func (c *Channel) broadcastClusterTree(svrType, route string, v interface{}, except []int64, from int64) error {
+	var err error
+	for _, ch := range c.descendants() {
+		if e := ch.broadcastCluster(svrType, route, v, except, from); e != nil {
+			log.Errorf("broadcast channel %s failed: %s", ch.name, e.Error())
+			err = e
+		}
+	}
+	return err
+}
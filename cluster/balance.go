@@ -0,0 +1,164 @@
+package cluster
+
+import (
+	"errors"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lonnng/starx/session"
+)
+
+var ErrNoServer = errors.New("no server of the type")
+
+// Strategy picks a server from the servers of the same type, the ids are
+// sorted and never empty
+type Strategy interface {
+	Pick(svrIds []string, session *session.Session) string
+}
+
+var (
+	strategyLock sync.RWMutex
+	strategies   map[string]Strategy // server type -> strategy
+)
+
+// SetStrategy set the load balancing strategy of the server type, servers are
+// picked on every call instead of binding to session, nil strategy restores
+// the session binding
+func SetStrategy(svrType string, s Strategy) {
+	strategyLock.Lock()
+	defer strategyLock.Unlock()
+
+	if s == nil {
+		delete(strategies, svrType)
+		return
+	}
+	strategies[svrType] = s
+}
+
+func strategyOf(svrType string) Strategy {
+	strategyLock.RLock()
+	defer strategyLock.RUnlock()
+
+	return strategies[svrType]
+}
+
+// balance picks a server of the type with the strategy
+func balance(s Strategy, svrType string, session *session.Session) (string, error) {
+	svrLock.RLock()
+	ids := make([]string, len(svrTypeMaps[svrType]))
+	copy(ids, svrTypeMaps[svrType])
+	svrLock.RUnlock()
+
+	if len(ids) == 0 {
+		return "", ErrNoServer
+	}
+	sort.Strings(ids)
+	return s.Pick(ids, session), nil
+}
+
+// sid returns the id used in rpc requests of the session
+func sid(s *session.Session) int64 {
+	if s.Entity != nil {
+		return s.Entity.ID()
+	}
+	return s.ID
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+// RoundRobin returns a strategy which picks servers in turn
+func RoundRobin() Strategy {
+	return &roundRobin{}
+}
+
+func (r *roundRobin) Pick(svrIds []string, _ *session.Session) string {
+	n := atomic.AddUint64(&r.next, 1)
+	return svrIds[n%uint64(len(svrIds))]
+}
+
+type leastInFlight struct{}
+
+// LeastInFlight returns a strategy which picks the server with the fewest
+// calls waiting for response, servers not connected yet are counted as idle
+func LeastInFlight() Strategy {
+	return leastInFlight{}
+}
+
+func (leastInFlight) Pick(svrIds []string, _ *session.Session) string {
+	pools := make([]*clientPool, len(svrIds))
+	mutex.RLock()
+	for i, svrId := range svrIds {
+		pools[i] = clientIdMaps[svrId]
+	}
+	mutex.RUnlock()
+
+	id, min := svrIds[0], -1
+	for i, svrId := range svrIds {
+		n := 0
+		if pools[i] != nil {
+			n = pools[i].inflight()
+		}
+		if min < 0 || n < min {
+			id, min = svrId, n
+		}
+	}
+	return id
+}
+
+// defaultReplicas is the count of virtual nodes of every server in hash ring
+const defaultReplicas = 100
+
+type consistentHash struct {
+	sync.Mutex
+	replicas int
+	key      string            // joined server ids of the ring
+	ring     []uint32          // sorted hashes of virtual nodes
+	nodes    map[uint32]string // hash of virtual node -> server id
+}
+
+// ConsistentHash returns a strategy which hashes the session id to a server,
+// so calls of a session always land on the same server, and only a few
+// sessions are moved when servers join or leave, replicas is the count of
+// virtual nodes of every server, default 100 when not positive
+func ConsistentHash(replicas int) Strategy {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return &consistentHash{replicas: replicas}
+}
+
+func (c *consistentHash) Pick(svrIds []string, session *session.Session) string {
+	c.Lock()
+	defer c.Unlock()
+
+	if key := strings.Join(svrIds, ","); key != c.key {
+		c.build(svrIds)
+		c.key = key
+	}
+
+	h := crc32.ChecksumIEEE([]byte(strconv.FormatInt(sid(session), 10)))
+	i := sort.Search(len(c.ring), func(i int) bool { return c.ring[i] >= h })
+	if i == len(c.ring) {
+		i = 0
+	}
+	return c.nodes[c.ring[i]]
+}
+
+func (c *consistentHash) build(svrIds []string) {
+	c.ring = make([]uint32, 0, len(svrIds)*c.replicas)
+	c.nodes = make(map[uint32]string, len(svrIds)*c.replicas)
+	for _, id := range svrIds {
+		for i := 0; i < c.replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + "#" + id))
+			c.ring = append(c.ring, h)
+			c.nodes[h] = id
+		}
+	}
+	sort.Slice(c.ring, func(i, j int) bool { return c.ring[i] < c.ring[j] })
+}
@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/lonnng/starx/session"
+)
+
+func TestRoundRobin(t *testing.T) {
+	ids := []string{"a", "b", "c"}
+	s := RoundRobin()
+	count := map[string]int{}
+	for i := 0; i < 30; i++ {
+		count[s.Pick(ids, &session.Session{})]++
+	}
+	for _, id := range ids {
+		if count[id] != 10 {
+			t.Fatalf("expect 10 picks of %s, got %d", id, count[id])
+		}
+	}
+}
+
+func TestLeastInFlight(t *testing.T) {
+	ids := []string{"balance-a", "balance-b"}
+	if id := LeastInFlight().Pick(ids, &session.Session{}); id != "balance-a" {
+		t.Fatalf("expect balance-a when all idle, got %s", id)
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	ids := []string{"a", "b", "c", "d"}
+	s := ConsistentHash(0)
+
+	picks := map[int64]string{}
+	count := map[string]int{}
+	for sid := int64(0); sid < 1000; sid++ {
+		id := s.Pick(ids, &session.Session{ID: sid})
+		if again := s.Pick(ids, &session.Session{ID: sid}); again != id {
+			t.Fatalf("session %d: expect stable pick %s, got %s", sid, id, again)
+		}
+		picks[sid] = id
+		count[id]++
+	}
+	for _, id := range ids {
+		if count[id] == 0 {
+			t.Fatalf("server %s never picked", id)
+		}
+	}
+
+	// only sessions on the removed server are moved
+	for sid, id := range picks {
+		got := s.Pick(ids[:3], &session.Session{ID: sid})
+		if id != "d" && got != id {
+			t.Fatalf("session %d: expect %s after removing d, got %s", sid, id, got)
+		}
+	}
+}
+
+func TestSticky_Remap(t *testing.T) {
+	type remap struct {
+		sid      int64
+		from, to string
+	}
+	var remaps []remap
+	s := Sticky(0, func(sid int64, from, to string) {
+		remaps = append(remaps, remap{sid, from, to})
+	})
+
+	ids := []string{"a", "b", "c"}
+	picks := map[int64]string{}
+	for sid := int64(0); sid < 100; sid++ {
+		picks[sid] = s.Pick(ids, &session.Session{ID: sid})
+	}
+	if len(remaps) != 0 {
+		t.Fatalf("expect no remap on first calls, got %v", remaps)
+	}
+
+	for sid := int64(0); sid < 100; sid++ {
+		s.Pick(ids[1:], &session.Session{ID: sid})
+	}
+	for _, r := range remaps {
+		if picks[r.sid] != "a" || r.from != "" || r.to == "a" {
+			t.Fatalf("unexpected remap: %+v", r)
+		}
+	}
+	n := len(remaps)
+	if n == 0 {
+		t.Fatal("expect remaps of sessions on removed server")
+	}
+
+	s.(*sticky).forget(0)
+	s.Pick(ids, &session.Session{ID: 0})
+	for sid := int64(1); sid < 100; sid++ {
+		s.Pick(ids, &session.Session{ID: sid})
+	}
+	for _, r := range remaps[n:] {
+		if r.sid == 0 || r.to != "a" || r.from == "" {
+			t.Fatalf("unexpected remap after server joined: %+v", r)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package cluster
+
+import (
+	"strconv"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+)
+
+var sessionBindRoute = &route.Route{Service: "__Session", Method: "Bind"}
+
+// BindUID asks the server of the type to bind the uid to the session, the
+// server kicks the session bound to the uid before, and returns after the
+// kick sent
+func BindUID(svrType string, session *session.Session, uid int64) error {
+	client, err := ClientByType(svrType, session)
+	if err != nil {
+		return err
+	}
+	args := []byte(strconv.FormatInt(uid, 10))
+	return client.Call(rpc.Sys, sessionBindRoute.Service, sessionBindRoute.Method, session.Entity.ID(), new([]byte), args)
+}
@@ -2,6 +2,8 @@ package cluster
 
 import (
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/lonnng/starx/cluster/rpc"
 	"github.com/lonnng/starx/log"
@@ -14,29 +16,206 @@ var (
 	sessionSyncRoute   = &route.Route{Service: "__Session", Method: "Sync"}
 )
 
+// callTimeout is the deadline of every remote call, zero means no deadline
+var callTimeout time.Duration
+
+// SetCallTimeout set the deadline of remote calls, the remote server will
+// drop the calls whose deadline exceeded
+func SetCallTimeout(d time.Duration) {
+	callTimeout = d
+}
+
 // Client send request
 // First argument is namespace, can be set `user` or `sys`
+// The call will be retried when it failed with transient error, and the
+// retry policy of the server type applies to the method, the resent calls
+// count in the attempts of the policy
 func Call(rpcKind rpc.RpcKind, route *route.Route, session *session.Session, args []byte) ([]byte, error) {
+	mirror(rpcKind, route, session, args)
+	policy := retryPolicyOf(route)
+	for attempts := 0; ; {
+		reply, sent, err := call(rpcKind, route, session, args, policy.resends(attempts))
+		if err == nil {
+			return reply, nil
+		}
+
+		attempts += sent
+		if !policy.shouldRetry(attempts, err) {
+			return nil, err
+		}
+
+		log.Infof("remote call %s failed(%s), retry attempt %d", route.String(), err.Error(), attempts)
+		time.Sleep(policy.backoff(attempts))
+	}
+}
+
+// call invokes the remote method, and returns the times the call sent, which
+// is one unless resent
+func call(rpcKind rpc.RpcKind, route *route.Route, session *session.Session, args []byte, resends int) ([]byte, int, error) {
+	client, err := ClientByType(route.ServerType, session)
+	if err != nil {
+		log.Infof(err.Error())
+		return nil, 1, err
+	}
+	reply := new([]byte)
+	trace, meta := traceOf(session), metadataOf(session)
+	sent := 1
+	if resends > 0 {
+		sent, err = client.CallResend(rpcKind, route.Service, route.VersionedMethod(), session.Entity.ID(), reply, args, callTimeout, trace, meta, resends)
+		if sent < 1 {
+			sent = 1
+		}
+	} else {
+		err = client.CallTrace(rpcKind, route.Service, route.VersionedMethod(), session.Entity.ID(), reply, args, callTimeout, trace, meta)
+	}
+	if err != nil {
+		return nil, sent, err
+	}
+	return *reply, sent, nil
+}
+
+// traceOf returns the trace of the calls of session
+func traceOf(session *session.Session) rpc.Trace {
+	return rpc.Trace{TraceID: session.TraceID, SpanID: session.SpanID}
+}
+
+// metadataOf returns the metadata of the calls of session, which carries the
+// client connection and the servers of the session picked by frontend
+func metadataOf(session *session.Session) rpc.Metadata {
+	meta := session.Meta()
+	return rpc.Metadata{
+		ClientAddr: meta.RemoteAddr,
+		Serializer: meta.Serializer,
+		Affinity:   session.ServerIDs(),
+	}
+}
+
+// Notify send one-way request, the remote server never responses
+func Notify(rpcKind rpc.RpcKind, route *route.Route, session *session.Session, args []byte) error {
+	client, err := ClientByType(route.ServerType, session)
+	if err != nil {
+		log.Infof(err.Error())
+		return err
+	}
+	mirror(rpcKind, route, session, args)
+	return client.Notify(rpcKind, route.Service, route.VersionedMethod(), session.Entity.ID(), args)
+}
+
+// Stream send request, recv will be invoked with every incremental reply, and
+// returns the final reply
+func Stream(rpcKind rpc.RpcKind, route *route.Route, session *session.Session, args []byte, recv func([]byte)) ([]byte, error) {
 	client, err := ClientByType(route.ServerType, session)
 	if err != nil {
 		log.Infof(err.Error())
 		return nil, err
 	}
 	reply := new([]byte)
-	err = client.Call(rpcKind, route.Service, route.Method, session.Entity.ID(), reply, args)
+	err = client.Stream(rpcKind, route.Service, route.VersionedMethod(), session.Entity.ID(), reply, args, recv)
 	if err != nil {
 		return nil, errors.New(err.Error())
 	}
 	return *reply, nil
 }
 
-func SessionClosed(session *session.Session) {
+// OpenStream opens a bidirectional stream to the remote method
+func OpenStream(rpcKind rpc.RpcKind, route *route.Route, session *session.Session) (*rpc.BidiStream, error) {
+	client, err := ClientByType(route.ServerType, session)
+	if err != nil {
+		log.Infof(err.Error())
+		return nil, err
+	}
+	return client.OpenStream(rpcKind, route.Service, route.VersionedMethod(), session.Entity.ID())
+}
+
+// AsyncCall send request without blocking the caller, callback will be
+// invoked with the reply when the call completes
+func AsyncCall(rpcKind rpc.RpcKind, route *route.Route, session *session.Session, args []byte, callback func([]byte, error)) {
+	client, err := ClientByType(route.ServerType, session)
+	if err != nil {
+		log.Infof(err.Error())
+		callback(nil, err)
+		return
+	}
+	mirror(rpcKind, route, session, args)
+	client.AsyncCall(rpcKind, route.Service, route.VersionedMethod(), session.Entity.ID(), args, func(call *rpc.Call) {
+		if call.Error != nil {
+			callback(nil, call.Error)
+			return
+		}
+		callback(*call.Reply, nil)
+	})
+}
+
+// Batch packs calls of a session to the same server into one frame
+type Batch struct {
+	session *session.Session
+	batch   *rpc.CallBatch
+}
+
+// NewBatch returns an empty batch of calls to the server of the type, which
+// is selected like Call
+func NewBatch(rpcKind rpc.RpcKind, svrType string, session *session.Session) (*Batch, error) {
+	client, err := ClientByType(svrType, session)
+	if err != nil {
+		log.Infof(err.Error())
+		return nil, err
+	}
+	return &Batch{session: session, batch: client.NewBatch(rpcKind)}, nil
+}
+
+// Add a call to the batch, the reply is available when call.Done strobed
+func (b *Batch) Add(route *route.Route, args []byte) *rpc.Call {
+	call := b.batch.Add(route.Service, route.VersionedMethod(), b.session.Entity.ID(), args)
+	call.Trace, call.Meta = traceOf(b.session), metadataOf(b.session)
+	return call
+}
+
+// Send all calls in one frame
+func (b *Batch) Send() error {
+	return b.batch.Send()
+}
+
+// SyncSession replicates the changed attributes of frontend session to the
+// backend servers, data is encoded by session.EncodeChanges
+func SyncSession(session *session.Session, data []byte) {
 	for _, t := range svrTypes {
 		client, err := ClientByType(t, session)
 		if err != nil {
 			continue
 		}
+		client.Notify(rpc.Sys, sessionSyncRoute.Service, sessionSyncRoute.Method, session.Entity.ID(), data)
+	}
+}
+
+// forwardChanges replicates the changes made by a backend server to the other
+// backend servers handled the session, the applied changes are not marked
+// changed on frontend, so they are not carried by the next SyncSession
+func forwardChanges(session *session.Session, from string, data []byte) {
+	sid := sid(session)
+	for _, id := range handledBy(sid, from) {
+		client, err := Client(id)
+		if err != nil {
+			continue
+		}
+		client.Notify(rpc.Sys, sessionSyncRoute.Service, sessionSyncRoute.Method, sid, data)
+	}
+}
+
+// SessionClosed notifies the backend servers which handled the session that
+// it closed, with the uid bound, so the stateful servers can clean up the
+// state of the player
+func SessionClosed(session *session.Session) {
+	sid := session.Entity.ID()
+	uid := []byte(strconv.FormatInt(session.Uid, 10))
+	for _, id := range handlers(sid) {
+		client, err := Client(id)
+		if err != nil {
+			continue
+		}
 
-		client.Call(rpc.Sys, sessionClosedRoute.Service, sessionClosedRoute.Method, session.Entity.ID(), nil, nil)
+		// nobody waits for the calls of the closed session
+		client.CancelSession(sid)
+		client.Notify(rpc.Sys, sessionClosedRoute.Service, sessionClosedRoute.Method, sid, uid)
 	}
+	forgetSession(sid)
 }
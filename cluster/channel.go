@@ -0,0 +1,191 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/gob"
+	"hash/fnv"
+	"sync"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	channelJoinRoute      = &route.Route{Service: "__Channel", Method: "Join"}
+	channelLeaveRoute     = &route.Route{Service: "__Channel", Method: "Leave"}
+	channelBroadcastRoute = &route.Route{Service: "__Channel", Method: "Broadcast"}
+)
+
+var (
+	channelLock    sync.RWMutex
+	channelHandler func(*ChannelMessage) // expands the broadcast on frontend
+	trackerHandler func(string)          // announces the channels moved to other servers
+
+	channelExpands = make(chan []byte, channelExpandBacklog) // broadcasts waiting to be expanded
+	startExpander  sync.Once
+)
+
+// channelExpandBacklog is the max count of broadcasts waiting to be expanded,
+// the responses of rpc connections wait when it is full
+const channelExpandBacklog = 1024
+
+// ChannelMessage is the broadcast of a cluster channel, which is sent to
+// every frontend server with members once, and expanded to the members there
+type ChannelMessage struct {
+	Channel string  // name of the channel
+	Route   string  // route of push
+	Data    []byte  // serialized data of push
+	Except  []int64 // ids of the frontend sessions excluded
+	From    int64   // uid of the sender, the members muting it are excluded, zero means none
+	Seq     uint64  // sequence number assigned by the server tracking the channel, zero means unordered
+	Epoch   int64   // identifies the sequence, which restarts when the channel tracked again, e.g: by another server
+
+	Channels []string // names of the channels multicast, the session in several of them is pushed once
+	Id       string   // identifies the multicast, whose copies sent by several tracking servers are expanded once
+}
+
+// SetChannelHandler sets the function expanding the broadcast of cluster
+// channel to the members of current frontend server
+func SetChannelHandler(fn func(*ChannelMessage)) {
+	channelLock.Lock()
+	defer channelLock.Unlock()
+
+	channelHandler = fn
+}
+
+// SetTrackerHandler sets the function called when a server of the type is
+// registered or removed, the channels tracked by the servers of the type may
+// be moved to another server, which should be told the members again
+func SetTrackerHandler(fn func(svrType string)) {
+	channelLock.Lock()
+	defer channelLock.Unlock()
+
+	trackerHandler = fn
+}
+
+// trackersChanged calls the tracker handler, it should be called without
+// svrLock held
+func trackersChanged(svrType string) {
+	channelLock.RLock()
+	fn := trackerHandler
+	channelLock.RUnlock()
+	if fn != nil {
+		fn(svrType)
+	}
+}
+
+// ChannelServer returns the id of the server of the type tracking the members
+// of the channel, every channel is tracked by one server, which is picked by
+// rendezvous hashing of the name, so only the channels of the server removed,
+// or a part of channels moved to the server added, change their servers
+func ChannelServer(svrType, name string) (string, error) {
+	svrLock.RLock()
+	ids := append([]string(nil), svrTypeMaps[svrType]...)
+	svrLock.RUnlock()
+
+	if len(ids) == 0 {
+		return "", ErrNoServer
+	}
+	var picked string
+	var max uint64
+	for _, id := range ids {
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(id))
+		if w := h.Sum64(); picked == "" || w > max || (w == max && id < picked) {
+			picked, max = id, w
+		}
+	}
+	return picked, nil
+}
+
+// JoinChannel asks the server tracking the channel to add the frontend
+// session to the channel, the server is notified when the session closed
+func JoinChannel(svrType, name string, session *session.Session) error {
+	return notifyChannel(svrType, channelJoinRoute, name, session)
+}
+
+// LeaveChannel asks the server tracking the channel to remove the frontend
+// session from the channel
+func LeaveChannel(svrType, name string, session *session.Session) error {
+	return notifyChannel(svrType, channelLeaveRoute, name, session)
+}
+
+func notifyChannel(svrType string, r *route.Route, name string, session *session.Session) error {
+	id, err := ChannelServer(svrType, name)
+	if err != nil {
+		return err
+	}
+	client, err := Client(id)
+	if err != nil {
+		return err
+	}
+	handle(session, id)
+	return client.Notify(rpc.Sys, r.Service, r.Method, session.Entity.ID(), []byte(name))
+}
+
+// BroadcastChannel forwards the broadcast to the server of id tracking the
+// channel, which sends it to the frontend servers with members once
+func BroadcastChannel(id string, m *ChannelMessage) error {
+	data, err := EncodeChannelMessage(m)
+	if err != nil {
+		return err
+	}
+	client, err := Client(id)
+	if err != nil {
+		return err
+	}
+	return client.Call(rpc.Sys, channelBroadcastRoute.Service, channelBroadcastRoute.Method, 0, new([]byte), data)
+}
+
+// EncodeChannelMessage encodes the broadcast of cluster channel
+func EncodeChannelMessage(m *ChannelMessage) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeChannelMessage decodes the broadcast of cluster channel
+func DecodeChannelMessage(data []byte) (*ChannelMessage, error) {
+	m := &ChannelMessage{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// expandChannel hands the broadcast sent by the server tracking the channel to
+// the worker expanding it, so the fan-out to members does not hold up the
+// responses of the connection, the broadcasts are expanded in the order
+// received
+func expandChannel(data []byte) {
+	startExpander.Do(func() { go expandLoop() })
+	channelExpands <- data
+}
+
+func expandLoop() {
+	for data := range channelExpands {
+		expand(data)
+	}
+}
+
+// expand expands the broadcast to the members of current frontend server
+func expand(data []byte) {
+	m, err := DecodeChannelMessage(data)
+	if err != nil {
+		log.Errorf("invalid channel broadcast: %s", err.Error())
+		return
+	}
+
+	channelLock.RLock()
+	fn := channelHandler
+	channelLock.RUnlock()
+	if fn != nil {
+		fn(m)
+	}
+}
@@ -18,7 +18,7 @@ var (
 	svrIdMaps   map[string]*ServerConfig // all servers id maps
 
 	mutex        sync.RWMutex           // protect ClientIdMaps
-	clientIdMaps map[string]*rpc.Client // all rpc clients
+	clientIdMaps map[string]*clientPool // all rpc client pools
 	appConfig    *ServerConfig          // current app config
 
 	sessionManager SessionManager //get session instance
@@ -35,7 +35,9 @@ type SessionManager interface {
 func init() {
 	svrTypeMaps = make(map[string][]string)
 	svrIdMaps = make(map[string]*ServerConfig)
-	clientIdMaps = make(map[string]*rpc.Client)
+	clientIdMaps = make(map[string]*clientPool)
+	router = make(map[string]func(*session.Session) string)
+	strategies = make(map[string]Strategy)
 }
 
 func DumpSvrIdMaps() {
@@ -91,6 +93,7 @@ func Register(server *ServerConfig) {
 
 	svrIdMaps[svr.Id] = svr
 	svrTypeMaps[svr.Type] = append(svrTypeMaps[svr.Type], svr.Id)
+	go trackersChanged(svr.Type)
 }
 
 func RemoveServer(svrId string) {
@@ -129,6 +132,7 @@ func RemoveServer(svrId string) {
 	// remove from ServerIdMaps
 	delete(svrIdMaps, svrId)
 	CloseClient(svrId)
+	go trackersChanged(typ)
 }
 
 func Server(id string) (*ServerConfig, error) {
@@ -158,29 +162,53 @@ func UpdateServer(newSvr *ServerConfig) {
 
 func CloseClient(svrId string) {
 	mutex.Lock()
-	defer mutex.Unlock()
-
-	client, ok := clientIdMaps[svrId]
+	pool, ok := clientIdMaps[svrId]
 	if !ok {
+		mutex.Unlock()
 		log.Infof("%s not found in rpc client list", svrId)
 		return
 	}
 
 	delete(clientIdMaps, svrId)
-	client.Close()
+	mutex.Unlock()
+	pool.close()
 
 	log.Infof("%s rpc client has been removed.", svrId)
 	DumpClientIdMaps()
 }
 
 func ClientByType(svrType string, session *session.Session) (*rpc.Client, error) {
+	id, err := serverByType(svrType, session)
+	if err != nil {
+		return nil, err
+	}
+	return Client(id)
+}
+
+// serverByType returns the id of the server of the type to serve the session,
+// which is notified when the session closed
+func serverByType(svrType string, session *session.Session) (string, error) {
+	id, err := pickServer(svrType, session)
+	if err != nil {
+		return "", err
+	}
+	handle(session, id)
+	return id, nil
+}
+
+func pickServer(svrType string, session *session.Session) (string, error) {
 	if svrType == appConfig.Type {
-		return nil, errors.New(fmt.Sprintf("current server has the same type(Type: %s)", svrType))
+		return "", errors.New(fmt.Sprintf("current server has the same type(Type: %s)", svrType))
+	}
+
+	// balance every call when strategy specified
+	if s := strategyOf(svrType); s != nil {
+		return balance(s, svrType, session)
 	}
 
 	// fast mode
 	if id := session.ServerID(svrType); id != "" {
-		return Client(id)
+		return id, nil
 	}
 
 	// slow mode
@@ -197,23 +225,25 @@ func ClientByType(svrType string, session *session.Session) (*rpc.Client, error)
 		}
 
 		session.SetServerID(svrType, id)
-		return Client(id)
+		return id, nil
 	}
 
-	return nil, errors.New("not found rpc client")
+	return "", errors.New("not found rpc client")
 }
 
 // Get RPC client by server id(`connector-server-1`), and return the client if
 // remote server connection has established already, or try to connect the
 // remote server when remote server network connections have not made by now,
 // and return a nil value when server id not found or target machine refuse it.
+// Every remote server holds a pool of connections, which are picked in
+// round-robin order.
 func Client(svrId string) (*rpc.Client, error) {
 	mutex.RLock()
-	client, ok := clientIdMaps[svrId]
+	pool, ok := clientIdMaps[svrId]
 	mutex.RUnlock()
 
-	if ok && client != nil {
-		return client, nil
+	if ok && pool != nil {
+		return pool.pick()
 	}
 
 	svr, ok := svrIdMaps[svrId]
@@ -232,42 +262,59 @@ func Client(svrId string) (*rpc.Client, error) {
 		return nil, errors.New(svr.Id + " is frontend server, can handle rpc request")
 	}
 
-	client, err := rpc.Dial("tcp4", fmt.Sprintf("%s:%d", svr.Host, svr.Port))
-	if err != nil {
-		return nil, err
+	mutex.Lock()
+	pool, ok = clientIdMaps[svr.Id]
+	if !ok || pool == nil {
+		pool = newClientPool(svr)
+		clientIdMaps[svr.Id] = pool
 	}
-	log.Infof("%s establish rpc client successful.", svr.Id)
+	mutex.Unlock()
 
-	// on client shutdown
-	client.OnShutdown(func() {
-		RemoveServer(svr.Id)
-	})
+	return pool.pick()
+}
 
-	mutex.Lock()
-	clientIdMaps[svr.Id] = client
-	mutex.Unlock()
+// handle sys rpc push/response
+func handleResponse(client *rpc.Client, svrId string) {
+	for resp := range client.ResponseChan {
+		// the broadcast is expanded to the members of current server
+		if resp.Kind == rpc.HandlerBroadcast {
+			expandChannel(resp.Data)
+			rpc.FreeResponse(resp)
+			continue
+		}
 
-	// handle sys rpc push/response
-	go func() {
-		for resp := range client.ResponseChan {
-			s, err := sessionManager.Session(resp.Sid)
-			if err != nil {
-				log.Errorf(err.Error())
-				continue
-			}
+		s, err := sessionManager.Session(resp.Sid)
+		if err != nil {
+			log.Errorf(err.Error())
+			rpc.FreeResponse(resp)
+			continue
+		}
 
-			switch resp.Kind {
-			case rpc.HandlerPush:
-				s.Push(resp.Route, resp.Data)
-			case rpc.HandlerResponse:
-				s.Response(resp.Data)
-			default:
-				log.Errorf("invalid response kind")
+		switch resp.Kind {
+		case rpc.HandlerPush:
+			s.Push(resp.Route, resp.Data)
+		case rpc.HandlerResponse:
+			s.ResponseWithCode(uint(resp.ErrorCode), resp.Data)
+		case rpc.HandlerKick:
+			s.Kick(resp.Data)
+		case rpc.HandlerSession:
+			if err := s.ApplyChanges(resp.Data); err != nil {
+				log.Errorf("apply session changes failed: %s", err.Error())
+			} else {
+				forwardChanges(s, svrId, resp.Data)
 			}
+		default:
+			log.Errorf("invalid response kind")
 		}
-	}()
+		rpc.FreeResponse(resp)
+	}
+}
 
-	return client, nil
+// discard the pushes and responses of shadow server
+func discardResponse(client *rpc.Client) {
+	for resp := range client.ResponseChan {
+		rpc.FreeResponse(resp)
+	}
 }
 
 // Dump all clients that has established netword connection with remote server
@@ -286,9 +333,9 @@ func Close() {
 
 	// close all RPC clients
 	log.Infof("close all of socket connections")
-	for id, client := range clientIdMaps {
+	for id, pool := range clientIdMaps {
 		delete(clientIdMaps, id)
-		client.Close()
+		pool.close()
 	}
 }
 
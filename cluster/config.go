@@ -1,6 +1,10 @@
 package cluster
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
 
 type ServerConfig struct {
 	Type        string `json:"type"`
@@ -12,6 +16,15 @@ type ServerConfig struct {
 	IsWebsocket bool   `json:"is_websocket"`
 }
 
+// Address returns the address of the server, the host with unix:// scheme
+// means unix domain socket, and the port is ignored
+func (c *ServerConfig) Address() string {
+	if rpc.IsUnixAddress(c.Host) {
+		return c.Host
+	}
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
 func (c *ServerConfig) String() string {
 	return fmt.Sprintf("Type: %s, Id: %s, Host: %s, Port: %d, IsFrontend: %t, IsMaster: %t, IsWebsocket: %t",
 		c.Type,
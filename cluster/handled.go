@@ -0,0 +1,59 @@
+package cluster
+
+import (
+	"sync"
+
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	handledLock sync.Mutex
+	handled     = make(map[int64]map[string]struct{}) // session id -> ids of servers handled the session
+)
+
+// handle records the server handles the requests of the session, which is
+// notified when the session closed, only frontend servers record, since the
+// sessions of backend servers are closed by their frontend servers
+func handle(session *session.Session, svrId string) {
+	if appConfig == nil || !appConfig.IsFrontend {
+		return
+	}
+	sid := sid(session)
+
+	handledLock.Lock()
+	defer handledLock.Unlock()
+
+	servers, ok := handled[sid]
+	if !ok {
+		servers = make(map[string]struct{})
+		handled[sid] = servers
+	}
+	servers[svrId] = struct{}{}
+}
+
+// handlers returns and forgets the servers handled the session
+func handlers(sid int64) []string {
+	handledLock.Lock()
+	defer handledLock.Unlock()
+
+	ids := make([]string, 0, len(handled[sid]))
+	for id := range handled[sid] {
+		ids = append(ids, id)
+	}
+	delete(handled, sid)
+	return ids
+}
+
+// handledBy returns the servers handled the session, except the server
+func handledBy(sid int64, except string) []string {
+	handledLock.Lock()
+	defer handledLock.Unlock()
+
+	ids := make([]string, 0, len(handled[sid]))
+	for id := range handled[sid] {
+		if id != except {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,205 @@
+package cluster
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/session"
+)
+
+// listenRequests starts a server which records the requests received
+func listenRequests(t *testing.T) (net.Listener, chan *rpc.Request) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := make(chan *rpc.Request, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 0)
+		tmp := make([]byte, 512)
+		for {
+			n, err := conn.Read(tmp)
+			if err != nil {
+				return
+			}
+			buf = append(buf, tmp[:n]...)
+			req, rest, err := rpc.DecodeRequest(buf)
+			if err != nil || req == nil {
+				continue
+			}
+			buf = rest
+			requests <- req
+		}
+	}()
+	return l, requests
+}
+
+func TestSessionClosed(t *testing.T) {
+	l, requests := listenRequests(t)
+	defer l.Close()
+
+	old := appConfig
+	SetAppConfig(&ServerConfig{Type: "connector", Id: "connector-1", IsFrontend: true})
+	defer SetAppConfig(old)
+
+	addr := l.Addr().(*net.TCPAddr)
+	Register(&ServerConfig{Type: "closed-game", Id: "closed-game-1", Host: "127.0.0.1", Port: addr.Port})
+	defer RemoveServer("closed-game-1")
+	Register(&ServerConfig{Type: "closed-chat", Id: "closed-chat-1", Host: "127.0.0.1", Port: 1})
+	defer RemoveServer("closed-chat-1")
+
+	s := session.New(&mockEntity{id: 12})
+	s.Uid = 5
+	if id, err := serverByType("closed-game", s); err != nil || id != "closed-game-1" {
+		t.Fatalf("unexpected server %s, err=%v", id, err)
+	}
+	SessionClosed(s)
+
+	select {
+	case req := <-requests:
+		if req.ServiceMethod != "__Session.Closed" || req.Sid != 12 || string(req.Data) != "5" {
+			t.Fatalf("unexpected notification: %+v", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server handled the session should be notified")
+	}
+	if ids := handlers(12); len(ids) != 0 {
+		t.Fatalf("servers of closed session should be forgotten, got %v", ids)
+	}
+}
+
+func TestForwardChanges(t *testing.T) {
+	l, requests := listenRequests(t)
+	defer l.Close()
+
+	old := appConfig
+	SetAppConfig(&ServerConfig{Type: "connector", Id: "connector-1", IsFrontend: true})
+	defer SetAppConfig(old)
+
+	addr := l.Addr().(*net.TCPAddr)
+	Register(&ServerConfig{Type: "sync-game", Id: "sync-game-1", Host: "127.0.0.1", Port: addr.Port})
+	defer RemoveServer("sync-game-1")
+	Register(&ServerConfig{Type: "sync-chat", Id: "sync-chat-1", Host: "127.0.0.1", Port: 1})
+	defer RemoveServer("sync-chat-1")
+
+	s := session.New(&mockEntity{id: 13})
+	handle(s, "sync-game-1")
+	handle(s, "sync-chat-1")
+	defer handlers(13)
+
+	// the changes made by chat server are forwarded to game server only
+	forwardChanges(s, "sync-chat-1", []byte("changes"))
+	select {
+	case req := <-requests:
+		if req.ServiceMethod != "__Session.Sync" || req.Sid != 13 || string(req.Data) != "changes" {
+			t.Fatalf("unexpected sync: %+v", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("changes should be forwarded to the other servers of the session")
+	}
+}
+
+func TestChannelServer(t *testing.T) {
+	if _, err := ChannelServer("channel-none", "world"); err != ErrNoServer {
+		t.Fatalf("expect ErrNoServer, got %v", err)
+	}
+
+	Register(&ServerConfig{Type: "channel-reg", Id: "channel-reg-2", Host: "127.0.0.1", Port: 1})
+	defer RemoveServer("channel-reg-2")
+	Register(&ServerConfig{Type: "channel-reg", Id: "channel-reg-1", Host: "127.0.0.1", Port: 1})
+	defer RemoveServer("channel-reg-1")
+
+	picks := make(map[string]bool)
+	for _, name := range []string{"world", "guild:1", "guild:2", "room:7", "room:8", "room:9"} {
+		id, err := ChannelServer("channel-reg", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again, _ := ChannelServer("channel-reg", name); again != id {
+			t.Fatalf("channel %s should be tracked by the same server", name)
+		}
+		picks[id] = true
+	}
+	if len(picks) != 2 {
+		t.Fatalf("channels should be spread over the servers, got %v", picks)
+	}
+}
+
+func TestChannelServer_Consistent(t *testing.T) {
+	for _, id := range []string{"channel-hash-1", "channel-hash-2", "channel-hash-3"} {
+		Register(&ServerConfig{Type: "channel-hash", Id: id, Host: "127.0.0.1", Port: 1})
+		defer RemoveServer(id)
+	}
+
+	picks := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		name := "room:" + strconv.Itoa(i)
+		picks[name], _ = ChannelServer("channel-hash", name)
+	}
+
+	// only the channels of the server removed move
+	RemoveServer("channel-hash-3")
+	for name, old := range picks {
+		id, _ := ChannelServer("channel-hash", name)
+		if old != "channel-hash-3" && id != old {
+			t.Fatalf("channel %s moved from %s to %s", name, old, id)
+		}
+		if id == "channel-hash-3" {
+			t.Fatalf("channel %s tracked by the removed server", name)
+		}
+	}
+}
+
+func TestTrackerHandler(t *testing.T) {
+	changed := make(chan string, 16)
+	SetTrackerHandler(func(svrType string) {
+		select {
+		case changed <- svrType:
+		default:
+		}
+	})
+	defer SetTrackerHandler(nil)
+
+	Register(&ServerConfig{Type: "channel-tracker", Id: "channel-tracker-1", Host: "127.0.0.1", Port: 1})
+	RemoveServer("channel-tracker-1")
+	// the servers of other types removed by the tests before may be notified
+	for n := 0; n < 2; {
+		select {
+		case svrType := <-changed:
+			if svrType == "channel-tracker" {
+				n++
+			}
+		case <-time.After(time.Second):
+			t.Fatal("tracker handler should be called when servers changed")
+		}
+	}
+}
+
+func TestExpandChannel(t *testing.T) {
+	expanded := make(chan *ChannelMessage, 1)
+	SetChannelHandler(func(m *ChannelMessage) { expanded <- m })
+	defer SetChannelHandler(nil)
+
+	data, err := EncodeChannelMessage(&ChannelMessage{Channel: "world", Seq: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expandChannel(data)
+	select {
+	case m := <-expanded:
+		if m.Channel != "world" || m.Seq != 7 {
+			t.Fatalf("unexpected broadcast %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("broadcast should be expanded by the worker")
+	}
+}
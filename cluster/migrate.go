@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	sessionParkRoute  = &route.Route{Service: "__Session", Method: "Park"}
+	sessionAdoptRoute = &route.Route{Service: "__Session", Method: "Adopt"}
+)
+
+// ParkSession detaches the session from the backend servers before it
+// migrates to another frontend server, the backend servers keep the state of
+// the session under the token until adopted, returns the ids of the servers
+// holding the session keyed by server type
+func ParkSession(session *session.Session, token string) (map[string]string, error) {
+	sid := session.Entity.ID()
+	servers := make(map[string]string)
+	for _, t := range svrTypes {
+		id, err := serverByType(t, session)
+		if err != nil {
+			continue
+		}
+		client, err := Client(id)
+		if err != nil {
+			continue
+		}
+
+		// the calls in flight belong to the old frontend session
+		client.CancelSession(sid)
+		if err := client.Call(rpc.Sys, sessionParkRoute.Service, sessionParkRoute.Method, sid, new([]byte), []byte(token)); err != nil {
+			return nil, err
+		}
+		servers[t] = id
+	}
+	handlers(sid)
+	forgetSession(sid)
+	return servers, nil
+}
+
+// AdoptSession attaches the session parked by ParkSession to the session of
+// current frontend server, the later calls of the server type are routed to
+// the server holding the session, except the server types balanced by
+// strategy, which route the calls by their strategy
+func AdoptSession(session *session.Session, token string, servers map[string]string) error {
+	sid := session.Entity.ID()
+	for t, id := range servers {
+		client, err := Client(id)
+		if err != nil {
+			return err
+		}
+		if err := client.Call(rpc.Sys, sessionAdoptRoute.Service, sessionAdoptRoute.Method, sid, new([]byte), []byte(token)); err != nil {
+			return err
+		}
+		session.SetServerID(t, id)
+		handle(session, id)
+	}
+	return nil
+}
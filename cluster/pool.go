@@ -0,0 +1,293 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+)
+
+// poolSize is the count of connections established to every remote server
+var poolSize = 1
+
+// breakerConfig is the circuit breaker config of every remote server, nil
+// means circuit breaker disabled
+var breakerConfig = &rpc.DefaultBreakerConfig
+
+// compression is the encoding of payloads between current server and remote
+// servers
+var compression = rpc.Identity
+
+// tlsConfig is the tls config of connections to remote servers, nil means
+// plain tcp, connections over unix domain socket are never encrypted
+var tlsConfig *tls.Config
+
+// transport of connections to remote servers, nil means tcp
+var transport rpc.Transport
+
+// keepalive of connections to remote servers, zero interval means disabled
+var (
+	keepaliveInterval time.Duration
+	keepaliveMisses   int
+)
+
+// size limits of payloads of connections to remote servers, zero means
+// unlimited
+var (
+	maxArgs  int
+	maxReply int
+)
+
+var ErrEmptyPool = errors.New("no available rpc client in pool")
+
+// SetPoolSize set the count of connections established to every remote
+// server, requests will be sent on them in round-robin order, the size less
+// than one is ignored
+func SetPoolSize(n int) {
+	if n < 1 {
+		log.Errorf("invalid rpc pool size %d, keep %d", n, poolSize)
+		return
+	}
+	poolSize = n
+}
+
+// SetBreakerConfig set the circuit breaker config of remote servers, nil
+// config disables circuit breaker, it only applies to the servers which have
+// not been connected
+func SetBreakerConfig(c *rpc.BreakerConfig) {
+	breakerConfig = c
+}
+
+// SetCompression set the encoding of payloads between current server and
+// remote servers, large payloads will be compressed, it only applies to the
+// connections which have not been established
+func SetCompression(enc rpc.Encoding) {
+	compression = enc
+}
+
+// SetTLSConfig set the tls config of connections to remote servers, nil
+// config means plain tcp
+func SetTLSConfig(c *tls.Config) {
+	tlsConfig = c
+}
+
+// SetTransport set the transport of connections to remote servers, nil
+// transport means tcp, tls config only applies to tcp, it only applies to the
+// connections which have not been established
+func SetTransport(t rpc.Transport) {
+	transport = t
+}
+
+// SetKeepalive set the keepalive of connections to remote servers, a ping is
+// sent every interval, and the connection is closed when the remote server
+// does not respond in misses intervals, zero interval disables keepalive, it
+// only applies to the connections which have not been established
+func SetKeepalive(interval time.Duration, misses int) {
+	keepaliveInterval, keepaliveMisses = interval, misses
+}
+
+// SetMaxPayload set the size limits of the arguments sent to remote servers
+// and the replies received, zero means unlimited, it only applies to the
+// connections which have not been established
+func SetMaxPayload(args, reply int) {
+	maxArgs, maxReply = args, reply
+}
+
+// clientPool holds the connections to a remote server
+type clientPool struct {
+	sync.Mutex
+	svr     *ServerConfig
+	clients []*rpc.Client
+	next    int
+	breaker *rpc.Breaker // shared by all clients, nil means disabled
+	shadow  bool         // whether the server is a shadow server, which is not registered
+	dialing int          // connections being established without the lock
+	dialErr error        // error of the last failed dial
+	dialed  *sync.Cond   // signaled when a connection being established is done
+	closed  bool         // connections established after closed are closed
+}
+
+func newClientPool(svr *ServerConfig) *clientPool {
+	p := &clientPool{svr: svr}
+	p.dialed = sync.NewCond(&p.Mutex)
+	if c := breakerConfig; c != nil {
+		p.breaker = rpc.NewBreaker(*c)
+	}
+	return p
+}
+
+// pick a healthy client in round-robin order, unhealthy clients will be
+// removed, and new connections will be established when the pool is not full,
+// the connections are reserved under the lock and dialed without it, so the
+// callers never wait for a slow dial while healthy clients remain
+func (p *clientPool) pick() (*rpc.Client, error) {
+	p.Lock()
+	healthy := p.clients[:0]
+	for _, c := range p.clients {
+		if c.Available() {
+			healthy = append(healthy, c)
+		}
+	}
+	p.clients = healthy
+
+	n := poolSize - len(p.clients) - p.dialing
+	if n < 0 {
+		n = 0
+	}
+	p.dialing += n
+	p.Unlock()
+
+	for ; n > 0; n-- {
+		client, err := p.dial()
+		if err != nil {
+			p.failed(n, err)
+			break
+		}
+		p.publish(client)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	// no client available, wait for the connections being established by
+	// other callers
+	for len(p.clients) == 0 && p.dialing > 0 {
+		p.dialed.Wait()
+	}
+	if len(p.clients) == 0 {
+		err := p.dialErr
+		if err == nil {
+			err = ErrEmptyPool
+		}
+		return nil, err
+	}
+
+	p.next = (p.next + 1) % len(p.clients)
+	return p.clients[p.next], nil
+}
+
+// publish adds the client established to pool
+func (p *clientPool) publish(client *rpc.Client) {
+	p.Lock()
+	p.dialing--
+	closed := p.closed
+	if !closed {
+		p.clients = append(p.clients, client)
+		p.dialErr = nil
+	}
+	p.dialed.Broadcast()
+	p.Unlock()
+
+	if closed {
+		client.Close()
+	}
+}
+
+// failed gives up the n connections reserved after the dial failed
+func (p *clientPool) failed(n int, err error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.dialing -= n
+	p.dialErr = err
+	p.dialed.Broadcast()
+}
+
+func (p *clientPool) dial() (*rpc.Client, error) {
+	svr := p.svr
+	// fail fast when remote server is unhealthy, instead of waiting for
+	// dial timeout
+	if p.breaker != nil {
+		if err := p.breaker.Allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		client *rpc.Client
+		err    error
+		addr   = svr.Address()
+	)
+	if transport != nil {
+		client, err = rpc.DialTransport(transport, addr)
+	} else if tlsConfig != nil && !rpc.IsUnixAddress(addr) {
+		client, err = rpc.DialTLS("tcp4", addr, tlsConfig)
+	} else {
+		client, err = rpc.DialTransport(rpc.TCP, addr)
+	}
+	if p.breaker != nil {
+		if err != nil {
+			p.breaker.Failure()
+		} else {
+			p.breaker.Success()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	client.SetBreaker(p.breaker)
+	client.SetCompression(compression)
+	if appConfig != nil {
+		client.SetCaller(appConfig.Id)
+	}
+	client.Keepalive(keepaliveInterval, keepaliveMisses)
+	client.SetMaxPayload(maxArgs, maxReply)
+	log.Infof("%s establish rpc client successful.", svr.Id)
+
+	// on client shutdown, remove the server when all connections lost
+	client.OnShutdown(func() {
+		if p.remove(client) == 0 && !p.shadow {
+			RemoveServer(svr.Id)
+		}
+	})
+
+	// handle sys rpc push/response, which are discarded for shadow server
+	if p.shadow {
+		go discardResponse(client)
+	} else {
+		go handleResponse(client, svr.Id)
+	}
+
+	return client, nil
+}
+
+// remove the client from pool, and returns the count of remaining clients
+func (p *clientPool) remove(client *rpc.Client) int {
+	p.Lock()
+	defer p.Unlock()
+
+	for i, c := range p.clients {
+		if c == client {
+			p.clients = append(p.clients[:i], p.clients[i+1:]...)
+			break
+		}
+	}
+	return len(p.clients)
+}
+
+// inflight returns the count of calls waiting for response on all clients
+func (p *clientPool) inflight() int {
+	p.Lock()
+	defer p.Unlock()
+
+	n := 0
+	for _, c := range p.clients {
+		n += c.InFlight()
+	}
+	return n
+}
+
+func (p *clientPool) close() {
+	p.Lock()
+	clients := p.clients
+	p.clients = nil
+	p.closed = true
+	p.Unlock()
+
+	for _, c := range clients {
+		c.Close()
+	}
+}
@@ -0,0 +1,147 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+)
+
+func TestMain(m *testing.M) {
+	log.SetLevel(log.LevelClose)
+	m.Run()
+}
+
+func TestClientPool_Pick(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go ioutil.ReadAll(conn)
+		}
+	}()
+
+	SetPoolSize(3)
+	defer SetPoolSize(1)
+
+	addr := l.Addr().(*net.TCPAddr)
+	pool := newClientPool(&ServerConfig{Id: "test-pool", Host: "127.0.0.1", Port: addr.Port})
+	defer pool.close()
+
+	picked := make(map[*rpc.Client]int)
+	for i := 0; i < 6; i++ {
+		c, err := pool.pick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		picked[c]++
+	}
+
+	if len(picked) != 3 {
+		t.Fatalf("expect 3 connections, got %d", len(picked))
+	}
+	for c, n := range picked {
+		if n != 2 {
+			t.Fatalf("expect round-robin pick, got %d", n)
+		}
+		// unhealthy connection should be replaced
+		c.Close()
+		break
+	}
+
+	c, err := pool.pick()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Available() {
+		t.Fatal("picked unavailable client")
+	}
+
+	pool.Lock()
+	n := len(pool.clients)
+	pool.Unlock()
+	if n != 3 {
+		t.Fatalf("expect 3 connections after replaced, got %d", n)
+	}
+}
+
+// slowTransport blocks the dials after the first until released
+type slowTransport struct {
+	dials   chan struct{}
+	release chan struct{}
+}
+
+func (t *slowTransport) Dial(address string) (net.Conn, error) {
+	select {
+	case t.dials <- struct{}{}:
+	default:
+		<-t.release
+	}
+	c, s := net.Pipe()
+	go ioutil.ReadAll(s)
+	return c, nil
+}
+
+func (t *slowTransport) Listen(address string) (net.Listener, error) {
+	return nil, net.UnknownNetworkError("slow")
+}
+
+func TestClientPool_SlowDial(t *testing.T) {
+	tr := &slowTransport{dials: make(chan struct{}, 1), release: make(chan struct{})}
+	SetTransport(tr)
+	defer SetTransport(nil)
+	SetPoolSize(2)
+	defer SetPoolSize(1)
+
+	pool := newClientPool(&ServerConfig{Id: "test-slow-pool", Host: "127.0.0.1", Port: 1})
+	defer pool.close()
+
+	// the first caller establishes a connection, and waits for the second
+	done := make(chan struct{})
+	go func() {
+		pool.pick()
+		close(done)
+	}()
+	<-tr.dials
+
+	picked := make(chan error, 1)
+	go func() {
+		_, err := pool.pick()
+		picked <- err
+	}()
+	select {
+	case err := <-picked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pick should not wait for a slow dial while a client is healthy")
+	}
+
+	close(tr.release)
+	<-done
+	pool.Lock()
+	n := len(pool.clients)
+	pool.Unlock()
+	if n != 2 {
+		t.Fatalf("expect 2 connections, got %d", n)
+	}
+}
+
+func TestSetPoolSize_Invalid(t *testing.T) {
+	SetPoolSize(0)
+	if poolSize != 1 {
+		t.Fatalf("invalid pool size should be ignored, got %d", poolSize)
+	}
+}
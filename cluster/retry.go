@@ -0,0 +1,122 @@
+package cluster
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/route"
+)
+
+const (
+	defaultInitialBackoff = 50 * time.Millisecond
+	defaultMaxBackoff     = time.Second
+)
+
+// RetryPolicy describes how the failed remote calls to a server type will be
+// retried, it only applies to the idempotent methods listed, since a call
+// timed out may have run on the server
+type RetryPolicy struct {
+	MaxAttempts    int              // max attempts, including the first call
+	InitialBackoff time.Duration    // backoff before the first retry, doubled for every retry
+	MaxBackoff     time.Duration    // upper bound of backoff
+	Retryable      func(error) bool // reports whether the error is transient, default: IsTransient
+	Methods        []string         // idempotent methods("Service.Method") the policy applies to, empty means none
+	Resend         bool             // resend the timed out calls with the same sequence, which are deduplicated by the server
+}
+
+var (
+	retryLock     sync.RWMutex            // protects retryPolicies
+	retryPolicies map[string]*RetryPolicy // server type -> retry policy
+)
+
+func init() {
+	retryPolicies = make(map[string]*RetryPolicy)
+}
+
+// SetRetryPolicy set the retry policy of the server type, nil policy means
+// never retry
+func SetRetryPolicy(svrType string, policy *RetryPolicy) {
+	retryLock.Lock()
+	defer retryLock.Unlock()
+
+	if policy == nil {
+		delete(retryPolicies, svrType)
+		return
+	}
+	retryPolicies[svrType] = policy
+}
+
+// IsTransient reports whether the error caused by the connection between
+// servers, rather than returned by the remote method
+func IsTransient(err error) bool {
+	switch err {
+	case rpc.ErrShutdown, io.EOF, io.ErrUnexpectedEOF, ErrEmptyPool:
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return rpc.Code(err) == rpc.CodeUnavailable
+}
+
+// retryPolicyOf returns the retry policy applies to the route, or nil
+func retryPolicyOf(r *route.Route) *RetryPolicy {
+	retryLock.RLock()
+	policy, ok := retryPolicies[r.ServerType]
+	retryLock.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	serviceMethod := r.Service + "." + r.Method
+	for _, m := range policy.Methods {
+		if m == serviceMethod {
+			return policy
+		}
+	}
+	return nil
+}
+
+// shouldRetry reports whether the call failed after the attempts should be
+// retried, the call canceled is never retried
+func (p *RetryPolicy) shouldRetry(attempt int, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts || err == rpc.ErrCanceled {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+// resends returns the max times a timed out call resent after the attempts
+// made, the server should enable deduplication, so the resent calls to
+// non-idempotent methods are safe
+func (p *RetryPolicy) resends(attempts int) int {
+	if p == nil || !p.Resend || p.MaxAttempts-attempts <= 1 {
+		return 0
+	}
+	return p.MaxAttempts - attempts - 1
+}
+
+// backoff returns the duration to wait before the next attempt
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d, max := p.InitialBackoff, p.MaxBackoff
+	if d <= 0 {
+		d = defaultInitialBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/route"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	expect := []time.Duration{10, 20, 40, 50, 50}
+	for i, d := range expect {
+		if b := p.backoff(i + 1); b != d*time.Millisecond {
+			t.Fatalf("attempt %d: expect %v, got %v", i+1, d*time.Millisecond, b)
+		}
+	}
+}
+
+func TestRetryPolicy_ShouldRetry(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3}
+	if !p.shouldRetry(1, rpc.ErrShutdown) {
+		t.Fatal("connection error should be retried")
+	}
+	if p.shouldRetry(3, rpc.ErrShutdown) {
+		t.Fatal("should not retry after max attempts")
+	}
+	if p.shouldRetry(1, rpc.ServerError("method error")) {
+		t.Fatal("error returned by remote method should not be retried")
+	}
+
+	if (&RetryPolicy{MaxAttempts: 3, Retryable: func(error) bool { return true }}).shouldRetry(1, rpc.ErrCanceled) {
+		t.Fatal("canceled call should not be retried")
+	}
+
+	var nilPolicy *RetryPolicy
+	if nilPolicy.shouldRetry(1, errors.New("error")) {
+		t.Fatal("nil policy should never retry")
+	}
+}
+
+func TestRetryPolicy_Resends(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3, Resend: true}
+	for attempts, expect := range []int{2, 1, 0, 0} {
+		if n := p.resends(attempts); n != expect {
+			t.Fatalf("after %d attempts: expect %d resends, got %d", attempts, expect, n)
+		}
+	}
+}
+
+func TestRetryPolicyOf(t *testing.T) {
+	SetRetryPolicy("retry", &RetryPolicy{MaxAttempts: 3, Methods: []string{"Catalog.Query"}})
+	defer SetRetryPolicy("retry", nil)
+
+	if retryPolicyOf(route.NewRoute("retry", "Catalog", "Query")) == nil {
+		t.Fatal("policy should apply to idempotent method")
+	}
+	if retryPolicyOf(route.NewRoute("retry", "Catalog", "Buy")) != nil {
+		t.Fatal("policy should not apply to other methods")
+	}
+	if retryPolicyOf(route.NewRoute("other", "Catalog", "Query")) != nil {
+		t.Fatal("policy should not apply to other server type")
+	}
+
+	SetRetryPolicy("retry", &RetryPolicy{MaxAttempts: 3})
+	if retryPolicyOf(route.NewRoute("retry", "Catalog", "Query")) != nil {
+		t.Fatal("policy without methods should not apply to any method")
+	}
+}
@@ -0,0 +1,92 @@
+package rpc
+
+// CallBatch packs many calls to the same server into one frame, per-call framing
+// overhead dominates for small messages, every call in the batch completes
+// independently
+type CallBatch struct {
+	client  *Client
+	rpcKind RpcKind
+	calls   []*Call
+}
+
+// NewBatch returns an empty batch of the client
+func (client *Client) NewBatch(rpcKind RpcKind) *CallBatch {
+	return &CallBatch{client: client, rpcKind: rpcKind}
+}
+
+// Add a call to the batch, the call will be sent on Send, and its Done will
+// be strobed when it completes
+func (b *CallBatch) Add(service string, method string, sid int64, args []byte) *Call {
+	call := newCall(service, method, sid, new([]byte), make(chan *Call, 1), args)
+	b.calls = append(b.calls, call)
+	return call
+}
+
+// Len returns the count of calls in the batch
+func (b *CallBatch) Len() int {
+	return len(b.calls)
+}
+
+// Send all calls in one frame, the calls fail with the error when the frame
+// can not be sent
+func (b *CallBatch) Send() error {
+	client := b.client
+	client.reqMutex.Lock()
+	defer client.reqMutex.Unlock()
+
+	// Register all calls.
+	client.mutex.Lock()
+	if client.shutdown || client.closing {
+		client.mutex.Unlock()
+		b.fail(ErrShutdown)
+		return ErrShutdown
+	}
+
+	batch := BatchRequest{Requests: make([]Request, len(b.calls))}
+	for i, call := range b.calls {
+		call.seq = client.seq
+		client.pending[call.seq] = call
+		client.seq++
+
+		batch.Requests[i] = Request{
+			ServiceMethod:  call.ServiceMethod,
+			Seq:            call.seq,
+			Sid:            call.Sid,
+			Data:           call.Args,
+			Kind:           b.rpcKind,
+			AcceptEncoding: client.encoding,
+			TraceID:        call.Trace.TraceID,
+			ParentSpanID:   call.Trace.SpanID,
+			Caller:         client.caller,
+			Meta:           call.Meta,
+		}
+	}
+	client.mutex.Unlock()
+
+	data, err := batch.MarshalMsg(nil)
+	if err == nil {
+		err = client.checkArgs(data)
+	}
+	if err == nil {
+		req := &Request{Kind: Batch, Data: data, AcceptEncoding: client.encoding, Caller: client.caller}
+		req.EncodeData(client.encoding)
+		err = writeMsg(client.codec.rw, req)
+	}
+
+	if err != nil {
+		client.mutex.Lock()
+		for _, call := range b.calls {
+			delete(client.pending, call.seq)
+		}
+		client.mutex.Unlock()
+		b.fail(err)
+	}
+	return err
+}
+
+func (b *CallBatch) fail(err error) {
+	for _, call := range b.calls {
+		call.Error = err
+		call.done()
+	}
+}
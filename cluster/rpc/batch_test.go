@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"testing"
+)
+
+// batchServer responses every call in batch with the call data
+func batchServer(t *testing.T, conn net.Conn) {
+	buf := make([]byte, 0)
+	tmp := make([]byte, 512)
+	for {
+		n, err := conn.Read(tmp)
+		if err != nil {
+			return
+		}
+		buf = append(buf, tmp[:n]...)
+		for {
+			req, rest, err := DecodeRequest(buf)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			buf = rest
+			if req == nil {
+				break
+			}
+			if req.Kind != Batch {
+				t.Errorf("expect batch request, got %s", req.Kind)
+				return
+			}
+
+			var batch BatchRequest
+			if _, err := batch.UnmarshalMsg(req.Data); err != nil {
+				t.Error(err)
+				return
+			}
+			responses := BatchResponse{}
+			for _, r := range batch.Requests {
+				responses.Responses = append(responses.Responses, Response{
+					Kind: RemoteResponse,
+					Seq:  r.Seq,
+					Data: r.Data,
+				})
+			}
+			data, _ := responses.MarshalMsg(nil)
+			WriteResponse(conn, &Response{Kind: RemoteBatch, Data: data})
+		}
+	}
+}
+
+func TestCallBatch(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+	go batchServer(t, s)
+
+	client := NewClient(c)
+	defer client.Close()
+
+	// the frame is larger than a single read of the server and client
+	batch := client.NewBatch(User)
+	var calls []*Call
+	for i := 0; i < 100; i++ {
+		args := []byte("args-" + strconv.Itoa(i))
+		calls = append(calls, batch.Add("Service", "Method", 1, args))
+	}
+	if err := batch.Send(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, call := range calls {
+		call = <-call.Done
+		if call.Error != nil {
+			t.Fatal(call.Error)
+		}
+		if !bytes.Equal(*call.Reply, []byte("args-"+strconv.Itoa(i))) {
+			t.Fatalf("unexpected reply: %s", *call.Reply)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Package bench measures the throughput and latency of rpc calls, it drives
+// the calls on a client with the payload and concurrency of config, so the
+// performance regressions in dispatch and pooling can be caught
+package bench
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+// Config is the workload of benchmark
+type Config struct {
+	Kind        rpc.RpcKind // namespace of calls
+	Service     string      // service called
+	Method      string      // method called
+	Args        []byte      // encoded arguments of every call
+	Calls       int         // total calls
+	Concurrency int         // goroutines calling simultaneously, default 1
+}
+
+// Result is the statistics of benchmark
+type Result struct {
+	Calls      int           // calls completed
+	Errors     int           // calls failed
+	Duration   time.Duration // wall time of all calls
+	Throughput float64       // calls per second
+	Mean       time.Duration // mean latency
+	P50        time.Duration // median latency
+	P99        time.Duration // 99th percentile latency
+	Max        time.Duration // max latency
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("calls: %d, errors: %d, duration: %s, throughput: %.0f/s, mean: %s, p50: %s, p99: %s, max: %s",
+		r.Calls, r.Errors, r.Duration, r.Throughput, r.Mean, r.P50, r.P99, r.Max)
+}
+
+// Run calls the method on the client as config, and returns the statistics
+func Run(client *rpc.Client, c Config) Result {
+	workers := c.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		next      int64 = -1
+		errs      int64
+		latencies = make([]time.Duration, c.Calls)
+		wg        sync.WaitGroup
+	)
+
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply := new([]byte)
+			for {
+				n := atomic.AddInt64(&next, 1)
+				if n >= int64(c.Calls) {
+					return
+				}
+				begin := time.Now()
+				if err := client.Call(c.Kind, c.Service, c.Method, n, reply, c.Args); err != nil {
+					atomic.AddInt64(&errs, 1)
+				}
+				latencies[n] = time.Since(begin)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return summarize(latencies, int(errs), time.Since(start))
+}
+
+func summarize(latencies []time.Duration, errs int, elapsed time.Duration) Result {
+	r := Result{Calls: len(latencies), Errors: errs, Duration: elapsed}
+	if len(latencies) == 0 {
+		return r
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	r.Throughput = float64(len(latencies)) / elapsed.Seconds()
+	r.Mean = total / time.Duration(len(latencies))
+	r.P50 = percentile(latencies, 50)
+	r.P99 = percentile(latencies, 99)
+	r.Max = latencies[len(latencies)-1]
+	return r
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
@@ -0,0 +1,98 @@
+package bench
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+// echoServer responses every request with the request data
+func echoServer(conn net.Conn) {
+	buf := make([]byte, 0)
+	tmp := make([]byte, 4096)
+	for {
+		n, err := conn.Read(tmp)
+		if err != nil {
+			return
+		}
+		buf = append(buf, tmp[:n]...)
+		for {
+			req, rest, err := rpc.DecodeRequest(buf)
+			if err != nil || req == nil {
+				break
+			}
+			buf = rest
+			rpc.WriteResponse(conn, &rpc.Response{
+				Kind:          rpc.RemoteResponse,
+				ServiceMethod: req.ServiceMethod,
+				Seq:           req.Seq,
+				Sid:           req.Sid,
+				Data:          req.Data,
+				Encoding:      req.Encoding,
+			})
+			rpc.FreeRequest(req)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+	go echoServer(s)
+
+	client := rpc.NewClient(c)
+	defer client.Close()
+
+	r := Run(client, Config{Kind: rpc.User, Service: "Echo", Method: "Echo", Args: []byte("hello"), Calls: 100, Concurrency: 4})
+	if r.Calls != 100 || r.Errors != 0 {
+		t.Fatalf("expect 100 calls without error, got %s", r)
+	}
+	if r.P50 > r.P99 || r.P99 > r.Max || r.Throughput <= 0 {
+		t.Fatalf("invalid statistics: %s", r)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[i] = time.Duration(i + 1)
+	}
+	if p := percentile(latencies, 50); p != 50 {
+		t.Fatalf("expect p50 50, got %d", p)
+	}
+	if p := percentile(latencies, 99); p != 99 {
+		t.Fatalf("expect p99 99, got %d", p)
+	}
+}
+
+func BenchmarkClient_Call(b *testing.B) {
+	for _, size := range []int{64, 1024, 16 * 1024} {
+		for _, enc := range []rpc.Encoding{rpc.Identity, rpc.Zlib} {
+			b.Run(enc.String()+"/"+sizeName(size), func(b *testing.B) {
+				c, s := net.Pipe()
+				defer s.Close()
+				go echoServer(s)
+
+				client := rpc.NewClient(c)
+				defer client.Close()
+				client.SetCompression(enc)
+
+				args := make([]byte, size)
+				b.SetBytes(int64(size))
+				b.ResetTimer()
+				r := Run(client, Config{Kind: rpc.User, Service: "Echo", Method: "Echo", Args: args, Calls: b.N, Concurrency: 8})
+				b.ReportMetric(float64(r.P99.Nanoseconds()), "p99-ns")
+			})
+		}
+	}
+}
+
+func sizeName(n int) string {
+	if n >= 1024 {
+		return strconv.Itoa(n/1024) + "KB"
+	}
+	return strconv.Itoa(n) + "B"
+}
@@ -0,0 +1,124 @@
+package rpc
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// BreakerConfig describes when the breaker of a remote server opens
+type BreakerConfig struct {
+	FailureRatio float64       // open the breaker when failure ratio reaches it
+	MinRequests  int           // min requests in window before the ratio is evaluated
+	Window       time.Duration // the interval failures counted in
+	Cooldown     time.Duration // duration the breaker keeps open before a probe
+}
+
+var DefaultBreakerConfig = BreakerConfig{
+	FailureRatio: 0.5,
+	MinRequests:  20,
+	Window:       10 * time.Second,
+	Cooldown:     5 * time.Second,
+}
+
+// Breaker tracks the error rate of a remote server, fails fast when the
+// server is unhealthy, and lets a single probe through once cooldown elapsed,
+// the breaker closes when the probe succeeds, and opens again when it fails
+type Breaker struct {
+	sync.Mutex
+	config   BreakerConfig
+	state    breakerState
+	requests int
+	failures int
+	since    time.Time // start of current window, or time of state change
+}
+
+func NewBreaker(config BreakerConfig) *Breaker {
+	return &Breaker{config: config, since: time.Now()}
+}
+
+// Allow reports whether a request can be sent to remote server, every
+// allowed request should be followed by Success or Failure
+func (b *Breaker) Allow() error {
+	b.Lock()
+	defer b.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case breakerClosed:
+		if now.Sub(b.since) > b.config.Window {
+			b.requests, b.failures, b.since = 0, 0, now
+		}
+		return nil
+	case breakerOpen:
+		if now.Sub(b.since) < b.config.Cooldown {
+			return ErrBreakerOpen
+		}
+	case breakerHalfOpen:
+		// only a probe is in flight, another probe is allowed if the
+		// previous one did not report in a cooldown
+		if now.Sub(b.since) < b.config.Cooldown {
+			return ErrBreakerOpen
+		}
+	}
+	b.state, b.since = breakerHalfOpen, now
+	return nil
+}
+
+// Success records a successful request
+func (b *Breaker) Success() {
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		b.requests++
+	case breakerHalfOpen:
+		b.state, b.requests, b.failures, b.since = breakerClosed, 0, 0, time.Now()
+	}
+}
+
+// Failure records a failed request
+func (b *Breaker) Failure() {
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		b.requests++
+		b.failures++
+		if b.requests >= b.config.MinRequests &&
+			float64(b.failures) >= b.config.FailureRatio*float64(b.requests) {
+			b.state, b.since = breakerOpen, time.Now()
+		}
+	case breakerHalfOpen:
+		b.state, b.since = breakerOpen, time.Now()
+	}
+}
+
+// record the result of request, errors returned by remote method do not
+// indicate the server is unhealthy, except the server is unavailable
+func (b *Breaker) record(err error) {
+	switch e := err.(type) {
+	case nil, ServerError:
+		b.Success()
+	case *Error:
+		if e.Code == CodeUnavailable {
+			b.Failure()
+		} else {
+			b.Success()
+		}
+	default:
+		b.Failure()
+	}
+}
@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker(BreakerConfig{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		Window:       time.Minute,
+		Cooldown:     20 * time.Millisecond,
+	})
+
+	// errors returned by remote method do not open the breaker
+	for i := 0; i < 4; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatal(err)
+		}
+		b.record(ServerError("method error"))
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatal(err)
+		}
+		b.record(errors.New("dial timeout"))
+	}
+	if err := b.Allow(); err != ErrBreakerOpen {
+		t.Fatalf("expect breaker open, got %v", err)
+	}
+
+	// half-open, only one probe allowed
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Allow(); err != ErrBreakerOpen {
+		t.Fatalf("expect only one probe, got %v", err)
+	}
+	b.Failure()
+	if err := b.Allow(); err != ErrBreakerOpen {
+		t.Fatalf("expect breaker open again, got %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Success()
+	if err := b.Allow(); err != nil {
+		t.Fatalf("expect breaker closed, got %v", err)
+	}
+}
@@ -1,11 +1,13 @@
 package rpc
 
 import (
+	"crypto/tls"
 	"errors"
-	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/lonnng/starx/log"
 )
@@ -23,10 +25,10 @@ var (
 	ErrRequestOverFlow = errors.New("request too long")
 	ErrEmptyBuffer     = errors.New("empty buffer")
 	ErrTruncedBuffer   = errors.New("buffer length less than response length")
+	ErrCanceled        = errors.New("rpc call canceled")
 )
 
 var debugLog = false
-var emptyBytes = make([]byte, 0)
 
 // Call represents an active RPC.
 type Call struct {
@@ -34,8 +36,20 @@ type Call struct {
 	Args          []byte     // The argument to the function.
 	Sid           int64      // Frontend server session id
 	Reply         *[]byte    // The reply from the function.
+	Deadline      time.Time  // The deadline of the call, zero means no deadline.
+	Trace         Trace      // The trace of the call, zero means not traced.
+	Meta          Metadata   // The client session of the call.
 	Error         error      // After completion, the error status.
 	Done          chan *Call // Strobes when call is complete.
+	seq           uint64     // sequence number assigned by client
+	resend        bool       // whether the call is resent with the assigned sequence
+	canceled      bool       // whether the call is abandoned while waiting to be resent, protected by client mutex
+
+	recv func([]byte) // receives incremental replies of a stream call
+
+	mu        sync.Mutex    // protects following
+	completed bool          // whether the call has completed
+	callbacks []func(*Call) // callbacks on call complete
 }
 
 // Client represents an RPC Client.
@@ -51,10 +65,22 @@ type Client struct {
 	mutex            sync.Mutex // protects following
 	seq              uint64
 	pending          map[uint64]*Call
-	closing          bool           // user has called Close
-	shutdown         bool           // server has told us to stop
-	shutdownCallback func()         // callback on client shutdown
-	ResponseChan     chan *Response // rpc response handler
+	resending        map[uint64]*Call // calls timed out, which are going to be resent
+	closing          bool             // user has called Close
+	shutdown         bool             // server has told us to stop
+	shutdownCallback func()           // callback on client shutdown
+	ResponseChan     chan *Response   // rpc response handler
+
+	streams map[uint64]*BidiStream // opened bidirectional streams, protected by mutex
+	breaker *Breaker               // circuit breaker of remote server, nil means disabled
+
+	encoding Encoding // compression of payloads, protected by reqMutex
+	caller   string   // server id of current server, protected by reqMutex
+	maxArgs  int      // size limit of arguments, zero means unlimited, protected by reqMutex
+	maxReply int64    // size limit of replies, zero means unlimited, accessed atomically
+
+	lastRecv int64 // unix nano time of the last frame received, accessed atomically
+	dead     int32 // whether the peer is detected dead by keepalive, accessed atomically
 }
 
 // A ClientCodec implements writing of RPC requests and
@@ -75,19 +101,19 @@ func (codec *clientCodec) close() error {
 }
 
 func (client *Client) writeRequest() error {
-	data, err := client.request.MarshalMsg(emptyBytes)
-	if err != nil {
-		log.Errorf(err.Error())
-		return err
-	}
-	_, err = client.codec.rw.Write(data)
-	return err
+	return writeMsg(client.codec.rw, &client.request)
 }
 
 func (client *Client) send(rpcKind RpcKind, call *Call) {
 	client.reqMutex.Lock()
 	defer client.reqMutex.Unlock()
 
+	if err := client.checkArgs(call.Args); err != nil {
+		call.Error = err
+		call.done()
+		return
+	}
+
 	// Register this call.
 	client.mutex.Lock()
 	if client.shutdown || client.closing {
@@ -96,21 +122,56 @@ func (client *Client) send(rpcKind RpcKind, call *Call) {
 		call.done()
 		return
 	}
-	seq := client.seq
-	if call.Reply != nil {
-		client.seq++
+	// notification does not allocate sequence
+	var seq uint64
+	notify := call.Reply == nil
+	if !notify {
+		if call.resend {
+			seq = call.seq
+			delete(client.resending, seq)
+			if call.canceled {
+				call.Error = ErrCanceled
+				client.mutex.Unlock()
+				call.done()
+				return
+			}
+		} else {
+			seq = client.seq
+			client.seq++
+		}
 		client.pending[seq] = call
 	}
+	call.seq = seq
 	client.mutex.Unlock()
 
 	// Encode and send the request.
 	client.request.Seq = seq
 	client.request.ServiceMethod = call.ServiceMethod
 	client.request.Data = call.Args
+	client.request.AcceptEncoding = client.encoding
+	client.request.EncodeData(client.encoding)
 	client.request.Kind = rpcKind
 	client.request.Sid = call.Sid
+	client.request.Deadline = 0
+	client.request.TraceID = call.Trace.TraceID
+	client.request.ParentSpanID = call.Trace.SpanID
+	client.request.Notify = notify
+	client.request.Caller = client.caller
+	client.request.Meta = call.Meta
+	if !call.Deadline.IsZero() {
+		client.request.Deadline = call.Deadline.UnixNano()
+	}
+
+	err := client.writeRequest()
+
+	// notification completes once written
+	if notify {
+		call.Error = err
+		call.done()
+		return
+	}
 
-	if err := client.writeRequest(); err != nil {
+	if err != nil {
 		log.Errorf(err.Error())
 		client.mutex.Lock()
 		call = client.pending[seq]
@@ -125,56 +186,59 @@ func (client *Client) send(rpcKind RpcKind, call *Call) {
 
 func (client *Client) input() {
 	var err error
-	var response *Response
 	var tmp = make([]byte, 512)
-	for err == nil {
-		n, err := client.codec.rw.Read(tmp)
-		if err != nil {
-			fmt.Println(err.Error())
+	for {
+		var n int
+		if n, err = client.codec.rw.Read(tmp); err != nil {
 			break
 		}
+		atomic.StoreInt64(&client.lastRecv, time.Now().UnixNano())
 		client.codec.buf = append(client.codec.buf, tmp[:n]...)
+		maxReply := int(atomic.LoadInt64(&client.maxReply))
 		for {
-			response = &Response{}
-			client.codec.buf, err = response.UnmarshalMsg(client.codec.buf)
-			if err != nil {
-				//log.Error(err.Error())
+			response := GetResponse()
+			rest, e := wireCodec().ReadResponse(client.codec.buf, response)
+			if e != nil {
+				FreeResponse(response)
+				// wait for the rest of the response
+				if e != ErrShortFrame {
+					log.Errorf(e.Error())
+					client.codec.buf = client.codec.buf[:0]
+				}
+				// the peer sends an oversized frame, which can not be
+				// skipped without reading
+				if max := MaxFrame(maxReply); max > 0 && len(client.codec.buf) > max {
+					err = PayloadTooLarge("reply frame", len(client.codec.buf), maxReply)
+				}
 				break
 			}
-			if response.Kind == HandlerPush || response.Kind == HandlerResponse {
-				client.ResponseChan <- response
-				continue
+			client.codec.buf = rest
+
+			// batch replies are limited one by one after dispatched
+			limit := maxReply
+			if response.Kind == RemoteBatch {
+				limit = 0
 			}
-			seq := response.Seq
-			client.mutex.Lock()
-			call := client.pending[seq]
-			delete(client.pending, seq)
-			client.mutex.Unlock()
-
-			switch {
-			case call == nil:
-				// We've got no pending call. That usually means that
-				// WriteRequest partially failed, and call was already
-				// removed; response is a server telling us about an
-				// error reading request body. We should still attempt
-				// to read error body, but there's no one to give it to.
-				// err = errors.New("reading error body")
-			case response.Error != "":
-				// We've got an error response. Give this to the request;
-				// any subsequent requests will get the ReadResponseBody
-				// error if there is one.
-				call.Error = ServerError(response.Error)
-				if err != nil {
-					err = errors.New("reading error body: " + err.Error())
-				}
-				call.done()
-			default:
-				if err != nil {
-					call.Error = errors.New("reading body " + err.Error())
-				}
-				*call.Reply = response.Data
-				call.done()
+			if err := response.DecodeDataLimit(limit); err != nil {
+				log.Errorf(err.Error())
+				response.Data = nil
+				response.SetError(err)
+			}
+			if maxReply > 0 && len(response.Data) > maxReply && response.Kind != RemoteBatch {
+				response.SetError(PayloadTooLarge("reply", len(response.Data), maxReply))
+				response.Data = nil
+			}
+			if response.Kind == RemoteBatch {
+				client.dispatchBatch(response)
+				FreeResponse(response)
+				continue
 			}
+			client.dispatch(response)
+		}
+		if err != nil {
+			log.Errorf(err.Error())
+			client.codec.close()
+			break
 		}
 	}
 	// Terminate pending calls.
@@ -182,7 +246,9 @@ func (client *Client) input() {
 	client.mutex.Lock()
 	client.shutdown = true
 	closing := client.closing
-	if err == io.EOF {
+	if atomic.LoadInt32(&client.dead) == 1 {
+		err = ErrPeerDead
+	} else if err == io.EOF {
 		if closing {
 			err = ErrShutdown
 		} else {
@@ -193,6 +259,10 @@ func (client *Client) input() {
 		call.Error = err
 		call.done()
 	}
+	for seq, stream := range client.streams {
+		delete(client.streams, seq)
+		stream.Abort()
+	}
 	client.mutex.Unlock()
 	client.reqMutex.Unlock()
 	if debugLog && err != io.EOF && !closing {
@@ -203,7 +273,109 @@ func (client *Client) input() {
 	}
 }
 
+// dispatch the response to the receiver, the response will be freed or taken
+// over by the receiver
+func (client *Client) dispatch(response *Response) {
+	// the receiver of ResponseChan takes over the response
+	if response.Kind == HandlerPush || response.Kind == HandlerResponse ||
+		response.Kind == HandlerSession || response.Kind == HandlerKick ||
+		response.Kind == HandlerBroadcast {
+		client.ResponseChan <- response
+		return
+	}
+	defer FreeResponse(response)
+
+	// keepalive pong is only used to refresh the time of last frame
+	if response.Kind == RemotePong {
+		return
+	}
+
+	if response.Kind == RemoteStream && response.Stream != 0 {
+		client.mutex.Lock()
+		stream := client.streams[response.Seq]
+		if response.Stream == StreamClose {
+			delete(client.streams, response.Seq)
+		}
+		client.mutex.Unlock()
+		if stream != nil {
+			stream.Deliver(response.Stream, response.Data)
+		}
+		return
+	}
+	if response.Kind == RemoteStream {
+		client.mutex.Lock()
+		call := client.pending[response.Seq]
+		client.mutex.Unlock()
+		if call != nil && call.recv != nil {
+			call.recv(response.Data)
+		}
+		return
+	}
+
+	seq := response.Seq
+	client.mutex.Lock()
+	call := client.pending[seq]
+	delete(client.pending, seq)
+	client.mutex.Unlock()
+
+	switch {
+	case call == nil:
+		// We've got no pending call. That usually means that
+		// WriteRequest partially failed, and call was already
+		// removed; response is a server telling us about an
+		// error reading request body. We should still attempt
+		// to read error body, but there's no one to give it to.
+	case response.Error != "" || response.ErrorCode != CodeOK:
+		// We've got an error response. Give this to the request.
+		call.Error = response.error()
+		call.done()
+	default:
+		*call.Reply = response.Data
+		call.done()
+	}
+}
+
+// dispatchBatch unpacks the responses of a batch, and dispatches every one
+func (client *Client) dispatchBatch(response *Response) {
+	var batch BatchResponse
+	if _, err := batch.UnmarshalMsg(response.Data); err != nil {
+		log.Errorf(err.Error())
+		return
+	}
+	for i := range batch.Responses {
+		r := GetResponse()
+		*r = batch.Responses[i]
+		client.dispatch(r)
+	}
+}
+
+// OnComplete registers a callback which will be invoked once the call
+// completes, the callback will be invoked immediately if the call has
+// completed already. Callbacks are invoked in the goroutine that reads
+// responses from the connection, so they must not block.
+func (call *Call) OnComplete(fn func(*Call)) *Call {
+	call.mu.Lock()
+	if !call.completed {
+		call.callbacks = append(call.callbacks, fn)
+		call.mu.Unlock()
+		return call
+	}
+	call.mu.Unlock()
+	fn(call)
+	return call
+}
+
 func (call *Call) done() {
+	call.mu.Lock()
+	call.completed = true
+	callbacks := call.callbacks
+	call.callbacks = nil
+	call.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(call)
+	}
+
 	select {
 	case call.Done <- call:
 		// ok
@@ -227,6 +399,8 @@ func NewClient(conn io.ReadWriteCloser) *Client {
 			buf: make([]byte, 0),
 		},
 		pending:      make(map[uint64]*Call),
+		resending:    make(map[uint64]*Call),
+		streams:      make(map[uint64]*BidiStream),
 		ResponseChan: make(chan *Response, 2<<10),
 	}
 	go client.input()
@@ -242,11 +416,37 @@ func Dial(network, address string) (*Client, error) {
 	return NewClient(conn), nil
 }
 
+// DialTLS connects to an RPC server at the specified network address using
+// tls, the server certificate will be verified by config.
+func DialTLS(network, address string, config *tls.Config) (*Client, error) {
+	conn, err := tls.Dial(network, address, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
 // client shutdown callback function
 func (client *Client) OnShutdown(callback func()) {
 	client.shutdownCallback = callback
 }
 
+// Available reports whether the client can send requests
+func (client *Client) Available() bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return !client.shutdown && !client.closing
+}
+
+// InFlight returns the count of calls waiting for response
+func (client *Client) InFlight() int {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return len(client.pending)
+}
+
 func (client *Client) Close() error {
 	client.mutex.Lock()
 	if client.closing {
@@ -263,6 +463,12 @@ func (client *Client) Close() error {
 // the same Call object.  If done is nil, Go will allocate a new channel.
 // If non-nil, done must be buffered or Go will deliberately crash.
 func (client *Client) Go(rpcKind RpcKind, service string, method string, sid int64, reply *[]byte, done chan *Call, args []byte) *Call {
+	call := newCall(service, method, sid, reply, done, args)
+	client.send(rpcKind, call)
+	return call
+}
+
+func newCall(service string, method string, sid int64, reply *[]byte, done chan *Call, args []byte) *Call {
 	call := new(Call)
 	call.ServiceMethod = service + "." + method
 	call.Args = args
@@ -280,12 +486,277 @@ func (client *Client) Go(rpcKind RpcKind, service string, method string, sid int
 		}
 	}
 	call.Done = done
+	return call
+}
+
+// AsyncCall invokes the function asynchronously without blocking the caller,
+// the callback will be invoked when the call completes. It returns the Call
+// structure as a future, which can also be waited on via its Done channel.
+func (client *Client) AsyncCall(rpcKind RpcKind, service string, method string, sid int64, args []byte, callback func(*Call)) *Call {
+	call := newCall(service, method, sid, new([]byte), make(chan *Call, 1), args)
+	if callback != nil {
+		call.OnComplete(callback)
+	}
 	client.send(rpcKind, call)
 	return call
 }
 
+// Stream invokes the named function, waits for it to complete, and returns its
+// error status, recv will be invoked with every incremental reply the remote
+// method streams before the final reply.
+func (client *Client) Stream(rpcKind RpcKind, service string, method string, sid int64, reply *[]byte, args []byte, recv func([]byte)) error {
+	call := newCall(service, method, sid, reply, make(chan *Call, 1), args)
+	call.recv = recv
+	client.send(rpcKind, call)
+	call = <-call.Done
+	return call.Error
+}
+
+// OpenStream opens a bidirectional stream to the named function, which
+// exchanges ordered frames with the caller until both sides closed.
+func (client *Client) OpenStream(rpcKind RpcKind, service string, method string, sid int64) (*BidiStream, error) {
+	serviceMethod := service + "." + method
+
+	client.mutex.Lock()
+	if client.shutdown || client.closing {
+		client.mutex.Unlock()
+		return nil, ErrShutdown
+	}
+	seq := client.seq
+	client.seq++
+	stream := NewBidiStream(seq, func(flag StreamFlag, data []byte) error {
+		return client.writeFrame(&Request{
+			ServiceMethod: serviceMethod,
+			Seq:           seq,
+			Sid:           sid,
+			Kind:          rpcKind,
+			Stream:        flag,
+			Data:          data,
+		})
+	})
+	client.streams[seq] = stream
+	client.mutex.Unlock()
+
+	err := client.writeFrame(&Request{
+		ServiceMethod: serviceMethod,
+		Seq:           seq,
+		Sid:           sid,
+		Kind:          rpcKind,
+		Stream:        StreamOpen,
+	})
+	if err != nil {
+		client.mutex.Lock()
+		delete(client.streams, seq)
+		client.mutex.Unlock()
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (client *Client) writeFrame(req *Request) error {
+	client.reqMutex.Lock()
+	defer client.reqMutex.Unlock()
+
+	req.Caller = client.caller
+	return writeMsg(client.codec.rw, req)
+}
+
+// Notify invokes the named function without waiting for reply, no sequence
+// is allocated and the server never responses, it returns once the request
+// has been written.
+func (client *Client) Notify(rpcKind RpcKind, service string, method string, sid int64, args []byte) error {
+	call := newCall(service, method, sid, nil, make(chan *Call, 1), args)
+	client.send(rpcKind, call)
+	return (<-call.Done).Error
+}
+
 // Call invokes the named function, waits for it to complete, and returns its error status.
 func (client *Client) Call(rpcKind RpcKind, service string, method string, sid int64, reply *[]byte, args []byte) error {
 	call := <-client.Go(rpcKind, service, method, sid, reply, make(chan *Call, 1), args).Done
 	return call.Error
 }
+
+// CallTimeout invokes the named function like Call, the deadline is carried in
+// the request header so that the server can drop the call once nobody waits
+// for it, and ErrDeadlineExceeded returned when the call does not complete in
+// time.
+func (client *Client) CallTimeout(rpcKind RpcKind, service string, method string, sid int64, reply *[]byte, args []byte, timeout time.Duration) error {
+	return client.CallTrace(rpcKind, service, method, sid, reply, args, timeout, Trace{}, Metadata{})
+}
+
+// CallTrace invokes the named function like CallTimeout, and the trace and
+// the metadata of client session are carried in the request header, so that
+// the call can be correlated with the client action which causes it.
+func (client *Client) CallTrace(rpcKind RpcKind, service string, method string, sid int64, reply *[]byte, args []byte, timeout time.Duration, trace Trace, meta Metadata) error {
+	call := newCall(service, method, sid, reply, make(chan *Call, 1), args)
+	call.Trace, call.Meta = trace, meta
+	if b := client.breaker; b != nil {
+		if err := b.Allow(); err != nil {
+			return err
+		}
+		err := client.invoke(rpcKind, call, timeout)
+		b.record(err)
+		return err
+	}
+	return client.invoke(rpcKind, call, timeout)
+}
+
+// CallResend invokes the named function like CallTrace, and resends the call
+// with the same sequence when it does not complete in timeout, at most resends
+// times, the server with deduplication responses the stored reply of the call
+// it has processed, so resending is safe for non-idempotent methods. The
+// server is not told to cancel the call timed out unless it is the last one,
+// and the call canceled by Cancel or CancelSession is not resent. It returns
+// the times the call sent
+func (client *Client) CallResend(rpcKind RpcKind, service string, method string, sid int64, reply *[]byte, args []byte, timeout time.Duration, trace Trace, meta Metadata, resends int) (int, error) {
+	if b := client.breaker; b != nil {
+		if err := b.Allow(); err != nil {
+			return 0, err
+		}
+	}
+
+	call := newCall(service, method, sid, reply, make(chan *Call, 1), args)
+	call.Trace, call.Meta = trace, meta
+	for sent := 1; ; sent++ {
+		last := sent > resends
+		err := client.invokeWait(rpcKind, call, timeout, last)
+		if err != ErrDeadlineExceeded || last {
+			if b := client.breaker; b != nil {
+				b.record(err)
+			}
+			return sent, err
+		}
+		call.resend = true
+	}
+}
+
+// SetCompression set the encoding of payloads, large arguments are compressed,
+// and the server is told to compress large replies and pushes on this
+// connection, Identity disables compression
+func (client *Client) SetCompression(enc Encoding) {
+	client.reqMutex.Lock()
+	defer client.reqMutex.Unlock()
+
+	client.encoding = enc
+}
+
+// SetCaller set the server id sent in every request, so the server can
+// identify the caller, e.g: throttle the requests of every caller
+func (client *Client) SetCaller(id string) {
+	client.reqMutex.Lock()
+	defer client.reqMutex.Unlock()
+
+	client.caller = id
+}
+
+// SetBreaker set the circuit breaker which tracks the calls of client, the
+// breaker can be shared by all clients connected to the same server
+func (client *Client) SetBreaker(b *Breaker) {
+	client.breaker = b
+}
+
+// invoke sends the call and waits for it to complete, ErrDeadlineExceeded
+// returned when the call does not complete in timeout
+func (client *Client) invoke(rpcKind RpcKind, call *Call, timeout time.Duration) error {
+	return client.invokeWait(rpcKind, call, timeout, true)
+}
+
+// invokeWait sends the call and waits for it like invoke, the call timed out
+// is kept for resending when abandon is false, and the server is not told to
+// cancel it
+func (client *Client) invokeWait(rpcKind RpcKind, call *Call, timeout time.Duration, abandon bool) error {
+	if timeout <= 0 {
+		client.send(rpcKind, call)
+		return (<-call.Done).Error
+	}
+
+	call.Deadline = time.Now().Add(timeout)
+	client.send(rpcKind, call)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case call = <-call.Done:
+		return call.Error
+	case <-timer.C:
+		client.mutex.Lock()
+		_, ok := client.pending[call.seq]
+		delete(client.pending, call.seq)
+		if ok && !abandon {
+			client.resending[call.seq] = call
+		}
+		client.mutex.Unlock()
+		if ok && abandon {
+			client.sendCancel(call.seq)
+		}
+		return ErrDeadlineExceeded
+	}
+}
+
+// Cancel abandons the call, the call completes with ErrCanceled, and the
+// server is told to stop the work and skip the response
+func (client *Client) Cancel(call *Call) {
+	client.mutex.Lock()
+	if c, ok := client.resending[call.seq]; ok && c == call {
+		delete(client.resending, call.seq)
+		call.canceled = true
+		client.mutex.Unlock()
+		client.sendCancel(call.seq)
+		return
+	}
+	if c, ok := client.pending[call.seq]; !ok || c != call {
+		client.mutex.Unlock()
+		return
+	}
+	delete(client.pending, call.seq)
+	client.mutex.Unlock()
+
+	client.sendCancel(call.seq)
+	call.Error = ErrCanceled
+	call.done()
+}
+
+// CancelSession abandons the calls of the session, which is useful when the
+// session disconnected
+func (client *Client) CancelSession(sid int64) {
+	var calls, resending []*Call
+	client.mutex.Lock()
+	for seq, call := range client.pending {
+		if call.Sid == sid {
+			delete(client.pending, seq)
+			calls = append(calls, call)
+		}
+	}
+	for seq, call := range client.resending {
+		if call.Sid == sid {
+			delete(client.resending, seq)
+			call.canceled = true
+			resending = append(resending, call)
+		}
+	}
+	client.mutex.Unlock()
+
+	for _, call := range calls {
+		client.sendCancel(call.seq)
+		call.Error = ErrCanceled
+		call.done()
+	}
+	for _, call := range resending {
+		client.sendCancel(call.seq)
+	}
+}
+
+// sendCancel tells the server the call of seq is abandoned
+func (client *Client) sendCancel(seq uint64) {
+	client.reqMutex.Lock()
+	defer client.reqMutex.Unlock()
+
+	req := GetRequest()
+	req.Kind = Cancel
+	req.Seq = seq
+	if err := writeMsg(client.codec.rw, req); err != nil {
+		log.Errorf(err.Error())
+	}
+	FreeRequest(req)
+}
@@ -0,0 +1,385 @@
+package rpc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClient_CallTimeout(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	// drain all requests and never response
+	go ioutil.ReadAll(s)
+
+	client := NewClient(c)
+	defer client.Close()
+
+	reply := new([]byte)
+	err := client.CallTimeout(User, "Service", "Method", 1, reply, nil, 10*time.Millisecond)
+	if err != ErrDeadlineExceeded {
+		t.Fatalf("expect ErrDeadlineExceeded, got: %v", err)
+	}
+
+	client.mutex.Lock()
+	n := len(client.pending)
+	client.mutex.Unlock()
+	if n != 0 {
+		t.Fatalf("expect no pending call, got: %d", n)
+	}
+}
+
+// echoServer responses every request with the request data
+func echoServer(conn net.Conn) {
+	buf := make([]byte, 0)
+	tmp := make([]byte, 512)
+	for {
+		n, err := conn.Read(tmp)
+		if err != nil {
+			return
+		}
+		buf = append(buf, tmp[:n]...)
+		for {
+			req, rest, err := DecodeRequest(buf)
+			if err != nil || req == nil {
+				break
+			}
+			buf = rest
+			WriteResponse(conn, &Response{
+				Kind:          RemoteResponse,
+				ServiceMethod: req.ServiceMethod,
+				Seq:           req.Seq,
+				Sid:           req.Sid,
+				Data:          req.Data,
+			})
+		}
+	}
+}
+
+func TestClient_AsyncCall(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+	go echoServer(s)
+
+	client := NewClient(c)
+	defer client.Close()
+
+	result := make(chan []byte, 1)
+	call := client.AsyncCall(User, "Service", "Method", 1, []byte("hello"), func(call *Call) {
+		if call.Error != nil {
+			t.Error(call.Error)
+		}
+		result <- *call.Reply
+	})
+
+	if data := <-result; !bytes.Equal(data, []byte("hello")) {
+		t.Fatalf("expect hello, got: %s", data)
+	}
+
+	// callback registered after completion should be invoked immediately
+	<-call.Done
+	invoked := false
+	call.OnComplete(func(*Call) { invoked = true })
+	if !invoked {
+		t.Fatal("callback should be invoked on completed call")
+	}
+}
+
+func TestClient_Stream(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	go func() {
+		buf := make([]byte, 512)
+		n, _ := s.Read(buf)
+		req := &Request{}
+		if _, err := req.UnmarshalMsg(buf[:n]); err != nil {
+			t.Error(err)
+			return
+		}
+		for _, frame := range []string{"1", "2", "3"} {
+			WriteResponse(s, &Response{Kind: RemoteStream, Seq: req.Seq, Data: []byte(frame)})
+		}
+		WriteResponse(s, &Response{Kind: RemoteResponse, Seq: req.Seq, Data: []byte("done")})
+	}()
+
+	client := NewClient(c)
+	defer client.Close()
+
+	var frames []string
+	reply := new([]byte)
+	err := client.Stream(User, "Service", "Method", 1, reply, nil, func(data []byte) {
+		frames = append(frames, string(data))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(*reply) != "done" {
+		t.Fatalf("expect done, got: %s", *reply)
+	}
+
+	if len(frames) != 3 || frames[0] != "1" || frames[2] != "3" {
+		t.Fatalf("unexpected frames: %v", frames)
+	}
+}
+
+func TestClient_CallTrace(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	requests := make(chan *Request, 1)
+	go func() {
+		buf := make([]byte, 0)
+		tmp := make([]byte, 512)
+		for {
+			n, err := s.Read(tmp)
+			if err != nil {
+				return
+			}
+			buf = append(buf, tmp[:n]...)
+			req := &Request{}
+			if buf, err = req.UnmarshalMsg(buf); err != nil {
+				continue
+			}
+			requests <- req
+			WriteResponse(s, &Response{Kind: RemoteResponse, Seq: req.Seq, TraceID: req.TraceID})
+		}
+	}()
+
+	client := NewClient(c)
+	defer client.Close()
+
+	trace := Trace{TraceID: NewTraceID(), SpanID: NewSpanID()}
+	meta := Metadata{ClientAddr: "10.0.0.1:3250", Affinity: map[string]string{"chat": "chat-1"}}
+	reply := new([]byte)
+	if err := client.CallTrace(User, "Service", "Method", 1, reply, nil, time.Second, trace, meta); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if got := (Trace{TraceID: req.TraceID, SpanID: req.ParentSpanID}); got != trace {
+		t.Fatalf("expect trace %+v, got %+v", trace, got)
+	}
+	if !reflect.DeepEqual(req.Meta, meta) {
+		t.Fatalf("expect metadata %+v, got %+v", meta, req.Meta)
+	}
+}
+
+func TestClient_Notify(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	requests := make(chan *Request, 1)
+	go func() {
+		buf := make([]byte, 0)
+		tmp := make([]byte, 512)
+		for {
+			n, err := s.Read(tmp)
+			if err != nil {
+				return
+			}
+			buf = append(buf, tmp[:n]...)
+			req, rest, err := DecodeRequest(buf)
+			if err != nil || req == nil {
+				continue
+			}
+			buf = rest
+			requests <- req
+		}
+	}()
+
+	client := NewClient(c)
+	defer client.Close()
+
+	if err := client.Notify(User, "Service", "Method", 1, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if !req.Notify || string(req.Data) != "ping" {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+
+	client.mutex.Lock()
+	seq, pending := client.seq, len(client.pending)
+	client.mutex.Unlock()
+	if seq != 0 || pending != 0 {
+		t.Fatalf("notification should not allocate sequence, seq: %d, pending: %d", seq, pending)
+	}
+}
+
+func TestClient_Cancel(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	requests := make(chan *Request, 8)
+	go func() {
+		buf := make([]byte, 0)
+		tmp := make([]byte, 512)
+		for {
+			n, err := s.Read(tmp)
+			if err != nil {
+				return
+			}
+			buf = append(buf, tmp[:n]...)
+			for {
+				req, rest, err := DecodeRequest(buf)
+				if err != nil || req == nil {
+					break
+				}
+				buf = rest
+				requests <- req
+			}
+		}
+	}()
+
+	client := NewClient(c)
+	defer client.Close()
+
+	call := client.AsyncCall(User, "Service", "Method", 1, nil, nil)
+	<-requests
+	client.Cancel(call)
+	if req := <-requests; req.Kind != Cancel || req.Seq != call.seq {
+		t.Fatalf("expect cancel of seq %d, got %+v", call.seq, req)
+	}
+	if call = <-call.Done; call.Error != ErrCanceled {
+		t.Fatalf("expect ErrCanceled, got %v", call.Error)
+	}
+
+	calls := []*Call{
+		client.AsyncCall(User, "Service", "Method", 2, nil, nil),
+		client.AsyncCall(Sys, "Service", "Method", 2, nil, nil),
+		client.AsyncCall(User, "Service", "Method", 3, nil, nil),
+	}
+	for range calls {
+		<-requests
+	}
+	client.CancelSession(2)
+	canceled := map[uint64]bool{}
+	for i := 0; i < 2; i++ {
+		req := <-requests
+		if req.Kind != Cancel {
+			t.Fatalf("expect cancel, got %+v", req)
+		}
+		canceled[req.Seq] = true
+	}
+	if !canceled[calls[0].seq] || !canceled[calls[1].seq] {
+		t.Fatalf("calls of session 2 should be canceled, got %v", canceled)
+	}
+
+	client.mutex.Lock()
+	_, pending := client.pending[calls[2].seq]
+	client.mutex.Unlock()
+	if !pending {
+		t.Fatal("calls of other sessions should be pending")
+	}
+}
+
+func TestClient_CallResend(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	// ignore the first request, and response the resent one
+	seqs := make(chan uint64, 2)
+	go func() {
+		buf := make([]byte, 0)
+		tmp := make([]byte, 512)
+		for {
+			n, err := s.Read(tmp)
+			if err != nil {
+				return
+			}
+			buf = append(buf, tmp[:n]...)
+			for {
+				req, rest, err := DecodeRequest(buf)
+				if err != nil || req == nil {
+					break
+				}
+				buf = rest
+				if req.Kind == Cancel {
+					continue
+				}
+				seqs <- req.Seq
+				if len(seqs) == 2 {
+					WriteResponse(s, &Response{Kind: RemoteResponse, Seq: req.Seq, Data: []byte("ok")})
+				}
+			}
+		}
+	}()
+
+	client := NewClient(c)
+	defer client.Close()
+
+	reply := new([]byte)
+	sent, err := client.CallResend(User, "Service", "Method", 1, reply, nil, 20*time.Millisecond, Trace{}, Metadata{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 2 {
+		t.Fatalf("expect sent twice, got %d", sent)
+	}
+	if string(*reply) != "ok" {
+		t.Fatalf("expect ok, got %q", *reply)
+	}
+	if first, second := <-seqs, <-seqs; first != second {
+		t.Fatalf("resent call should keep the sequence, got %d and %d", first, second)
+	}
+}
+
+func TestClient_CallResendCanceled(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	// never response, and count the requests
+	requests, cancels := make(chan uint64, 16), make(chan uint64, 16)
+	go func() {
+		buf := make([]byte, 0)
+		tmp := make([]byte, 512)
+		for {
+			n, err := s.Read(tmp)
+			if err != nil {
+				return
+			}
+			buf = append(buf, tmp[:n]...)
+			for {
+				req, rest, err := DecodeRequest(buf)
+				if err != nil || req == nil {
+					break
+				}
+				buf = rest
+				if req.Kind == Cancel {
+					cancels <- req.Seq
+				} else {
+					requests <- req.Seq
+				}
+			}
+		}
+	}()
+
+	client := NewClient(c)
+	defer client.Close()
+
+	go func() {
+		<-requests
+		<-requests
+		client.CancelSession(1)
+	}()
+	sent, err := client.CallResend(User, "Service", "Method", 1, new([]byte), nil, 20*time.Millisecond, Trace{}, Metadata{}, 10)
+	if err != ErrCanceled {
+		t.Fatalf("expect %v, got %v", ErrCanceled, err)
+	}
+	if sent > 3 {
+		t.Fatalf("canceled call should not be resent, sent %d times", sent)
+	}
+	select {
+	case <-cancels:
+	case <-time.After(time.Second):
+		t.Fatal("server should be told the call canceled")
+	}
+	if len(cancels) != 0 {
+		t.Fatal("calls timed out should not be canceled before resent")
+	}
+}
@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// ErrShortFrame is returned by codec when the buffer does not hold a complete
+// frame, the rest of frame should be read
+var ErrShortFrame = errors.New("rpc: short frame")
+
+// Codec is the framing of requests and responses on the wire, all servers in
+// cluster must use the same codec
+type Codec interface {
+	// AppendRequest appends the frame of request to buf
+	AppendRequest(buf []byte, req *Request) ([]byte, error)
+
+	// AppendResponse appends the frame of response to buf
+	AppendResponse(buf []byte, resp *Response) ([]byte, error)
+
+	// ReadRequest decodes the frame at the head of buf into req, and returns
+	// the rest of buf, or ErrShortFrame when the frame is truncated
+	ReadRequest(buf []byte, req *Request) ([]byte, error)
+
+	// ReadResponse decodes the frame at the head of buf into resp, and
+	// returns the rest of buf, or ErrShortFrame when the frame is truncated
+	ReadResponse(buf []byte, resp *Response) ([]byte, error)
+}
+
+var (
+	// Msgp frames the messages in MessagePack, which is the default codec
+	Msgp Codec = msgpCodec{}
+
+	// JSONLines frames every message as a line of json, which is readable
+	// when debugging
+	JSONLines Codec = jsonLinesCodec{}
+)
+
+// wire holds the codec of all connections
+var wire atomic.Value
+
+func init() {
+	wire.Store(&Msgp)
+}
+
+// SetCodec set the codec of all connections, which should be called before
+// any connection established, nil means Msgp
+func SetCodec(c Codec) {
+	if c == nil {
+		c = Msgp
+	}
+	wire.Store(&c)
+}
+
+func wireCodec() Codec {
+	return *wire.Load().(*Codec)
+}
+
+type msgpCodec struct{}
+
+func (msgpCodec) AppendRequest(buf []byte, req *Request) ([]byte, error) {
+	return req.MarshalMsg(buf)
+}
+
+func (msgpCodec) AppendResponse(buf []byte, resp *Response) ([]byte, error) {
+	return resp.MarshalMsg(buf)
+}
+
+func (msgpCodec) ReadRequest(buf []byte, req *Request) ([]byte, error) {
+	rest, err := req.UnmarshalMsg(buf)
+	if err == msgp.ErrShortBytes {
+		return buf, ErrShortFrame
+	}
+	return rest, err
+}
+
+func (msgpCodec) ReadResponse(buf []byte, resp *Response) ([]byte, error) {
+	rest, err := resp.UnmarshalMsg(buf)
+	if err == msgp.ErrShortBytes {
+		return buf, ErrShortFrame
+	}
+	return rest, err
+}
+
+type jsonLinesCodec struct{}
+
+func (jsonLinesCodec) AppendRequest(buf []byte, req *Request) ([]byte, error) {
+	return appendLine(buf, req)
+}
+
+func (jsonLinesCodec) AppendResponse(buf []byte, resp *Response) ([]byte, error) {
+	return appendLine(buf, resp)
+}
+
+func (jsonLinesCodec) ReadRequest(buf []byte, req *Request) ([]byte, error) {
+	return readLine(buf, req)
+}
+
+func (jsonLinesCodec) ReadResponse(buf []byte, resp *Response) ([]byte, error) {
+	return readLine(buf, resp)
+}
+
+func appendLine(buf []byte, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return buf, err
+	}
+	buf = append(buf, data...)
+	return append(buf, '\n'), nil
+}
+
+func readLine(buf []byte, v interface{}) ([]byte, error) {
+	i := bytes.IndexByte(buf, '\n')
+	if i < 0 {
+		return buf, ErrShortFrame
+	}
+	if err := json.Unmarshal(buf[:i], v); err != nil {
+		return buf[i+1:], err
+	}
+	return buf[i+1:], nil
+}
@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	for name, c := range map[string]Codec{"msgp": Msgp, "jsonlines": JSONLines} {
+		req := &Request{ServiceMethod: "Room.Join", Seq: 3, Sid: 7, Data: []byte("hello"), Kind: User}
+		buf, err := c.AppendRequest(nil, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := &Response{Kind: RemoteResponse, Seq: 3, Data: []byte("world")}
+		if buf, err = c.AppendResponse(buf, resp); err != nil {
+			t.Fatal(err)
+		}
+
+		got := &Request{}
+		if _, err := c.ReadRequest(buf[:len(buf)/3], got); err != ErrShortFrame {
+			t.Fatalf("%s: expect ErrShortFrame, got %v", name, err)
+		}
+		rest, err := c.ReadRequest(buf, got)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.ServiceMethod != req.ServiceMethod || got.Seq != req.Seq || got.Sid != req.Sid || !bytes.Equal(got.Data, req.Data) {
+			t.Fatalf("%s: expect %+v, got %+v", name, req, got)
+		}
+
+		gotResp := &Response{}
+		if rest, err = c.ReadResponse(rest, gotResp); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(rest) != 0 || gotResp.Seq != resp.Seq || string(gotResp.Data) != "world" {
+			t.Fatalf("%s: expect %+v, got %+v", name, resp, gotResp)
+		}
+	}
+}
+
+func TestSetCodec(t *testing.T) {
+	SetCodec(JSONLines)
+	defer SetCodec(nil)
+
+	c, s := net.Pipe()
+	defer s.Close()
+	go echoServer(s)
+
+	client := NewClient(c)
+	defer client.Close()
+
+	reply := new([]byte)
+	if err := client.Call(User, "Service", "Method", 1, reply, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if string(*reply) != "hello" {
+		t.Fatalf("expect hello, got %q", *reply)
+	}
+}
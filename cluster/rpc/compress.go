@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+var ErrUnknownEncoding = errors.New("unknown payload encoding")
+
+// compressThreshold is the min payload size to be compressed, small payloads
+// are not worth the cpu
+var compressThreshold = 1024
+
+var zlibWriters = sync.Pool{New: func() interface{} { return zlib.NewWriter(nil) }}
+
+// SetCompressThreshold set the min payload size to be compressed
+func SetCompressThreshold(n int) {
+	compressThreshold = n
+}
+
+func (e Encoding) String() string {
+	switch e {
+	case Identity:
+		return "identity"
+	case Zlib:
+		return "zlib"
+	}
+	return "unknown"
+}
+
+// encode compresses the data with the encoding when it is large enough, and
+// returns the data and its actual encoding
+func encode(data []byte, enc Encoding) ([]byte, Encoding) {
+	if enc != Zlib || len(data) < compressThreshold {
+		return data, Identity
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+	w := zlibWriters.Get().(*zlib.Writer)
+	w.Reset(buf)
+	_, err := w.Write(data)
+	if err == nil {
+		err = w.Close()
+	}
+	zlibWriters.Put(w)
+
+	// incompressible payload is sent as it is
+	if err != nil || buf.Len() >= len(data) {
+		return data, Identity
+	}
+	return buf.Bytes(), Zlib
+}
+
+// decode decompresses the data, the data larger than max is rejected without
+// decompressed any further, zero max means unlimited
+func decode(data []byte, enc Encoding, max int) ([]byte, error) {
+	switch enc {
+	case Identity:
+		return data, nil
+	case Zlib:
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		if max <= 0 {
+			return ioutil.ReadAll(r)
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(r, int64(max)+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > max {
+			return nil, PayloadTooLarge("decompressed payload", len(data), max)
+		}
+		return data, nil
+	}
+	return nil, ErrUnknownEncoding
+}
+
+// EncodeData compresses the payload with the encoding, if it is large enough
+func (r *Request) EncodeData(enc Encoding) {
+	r.Data, r.Encoding = encode(r.Data, enc)
+}
+
+// DecodeData decompresses the payload
+func (r *Request) DecodeData() error {
+	return r.DecodeDataLimit(0)
+}
+
+// DecodeDataLimit decompresses the payload, and fails when it is larger than
+// max, zero max means unlimited
+func (r *Request) DecodeDataLimit(max int) error {
+	data, err := decode(r.Data, r.Encoding, max)
+	if err != nil {
+		return err
+	}
+	r.Data, r.Encoding = data, Identity
+	return nil
+}
+
+// EncodeData compresses the payload with the encoding, if it is large enough
+func (r *Response) EncodeData(enc Encoding) {
+	r.Data, r.Encoding = encode(r.Data, enc)
+}
+
+// DecodeData decompresses the payload
+func (r *Response) DecodeData() error {
+	return r.DecodeDataLimit(0)
+}
+
+// DecodeDataLimit decompresses the payload, and fails when it is larger than
+// max, zero max means unlimited
+func (r *Response) DecodeDataLimit(max int) error {
+	data, err := decode(r.Data, r.Encoding, max)
+	if err != nil {
+		return err
+	}
+	r.Data, r.Encoding = data, Identity
+	return nil
+}
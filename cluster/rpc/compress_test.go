@@ -0,0 +1,92 @@
+package rpc
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	small := []byte("small payload")
+	if data, enc := encode(small, Zlib); enc != Identity || !bytes.Equal(data, small) {
+		t.Fatal("small payload should not be compressed")
+	}
+
+	large := bytes.Repeat([]byte("starx"), 1024)
+	data, enc := encode(large, Zlib)
+	if enc != Zlib || len(data) >= len(large) {
+		t.Fatal("large payload should be compressed")
+	}
+
+	decoded, err := decode(data, enc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, large) {
+		t.Fatal("decoded payload mismatch")
+	}
+
+	if _, err := decode(data, Encoding(0xff), 0); err != ErrUnknownEncoding {
+		t.Fatalf("expect ErrUnknownEncoding, got %v", err)
+	}
+}
+
+func TestDecode_Limit(t *testing.T) {
+	large := bytes.Repeat([]byte("starx"), 1024)
+	data, enc := encode(large, Zlib)
+
+	if _, err := decode(data, enc, len(large)-1); Code(err) != CodePayloadTooLarge {
+		t.Fatalf("expect payload too large, got %v", err)
+	}
+	decoded, err := decode(data, enc, len(large))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, large) {
+		t.Fatal("decoded payload mismatch")
+	}
+}
+
+func TestClient_SetCompression(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	encodings := make(chan Encoding, 1)
+	go func() {
+		buf := make([]byte, 0)
+		tmp := make([]byte, 512)
+		for {
+			n, err := s.Read(tmp)
+			if err != nil {
+				return
+			}
+			buf = append(buf, tmp[:n]...)
+			req := &Request{}
+			if buf, err = req.UnmarshalMsg(buf); err != nil {
+				continue
+			}
+			encodings <- req.Encoding
+			req.DecodeData()
+
+			resp := &Response{Kind: RemoteResponse, Seq: req.Seq, Data: req.Data}
+			resp.EncodeData(req.AcceptEncoding)
+			WriteResponse(s, resp)
+		}
+	}()
+
+	client := NewClient(c)
+	client.SetCompression(Zlib)
+	defer client.Close()
+
+	args := bytes.Repeat([]byte("starx"), 1024)
+	reply := new([]byte)
+	if err := client.Call(User, "Service", "Method", 1, reply, args); err != nil {
+		t.Fatal(err)
+	}
+	if enc := <-encodings; enc != Zlib {
+		t.Fatalf("expect compressed request, got %s", enc)
+	}
+	if !bytes.Equal(*reply, args) {
+		t.Fatal("reply mismatch")
+	}
+}
@@ -0,0 +1,20 @@
+package rpc
+
+import "context"
+
+// contextKey is the key type of the request header stored in a context
+type contextKey struct{}
+
+// NewContext returns a copy of ctx which carries the request header, handler
+// methods that accept a context.Context can observe the per-request metadata
+// via FromContext
+func NewContext(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, contextKey{}, req)
+}
+
+// FromContext returns the request header stored in ctx, if any, the request
+// is pooled, and only valid before the method returns
+func FromContext(ctx context.Context) (*Request, bool) {
+	req, ok := ctx.Value(contextKey{}).(*Request)
+	return req, ok
+}
@@ -0,0 +1,69 @@
+package rpc
+
+import "fmt"
+
+// Error codes, applications can define their own codes, which should not
+// conflict with the following
+const (
+	CodeOK                int32 = iota // not an error
+	CodeUnknown                        // error without code
+	CodeNotFound                       // service or method not found
+	CodeInvalidArgument                // arguments can not be decoded
+	CodeDeadlineExceeded               // call does not complete in time
+	CodeUnavailable                    // server can not handle the call for now, e.g: shutting down
+	CodeInternal                       // server internal error, e.g: method panics
+	CodePermissionDenied               // caller is not allowed to call the method
+	CodeResourceExhausted              // caller exceeds its rate limit
+	CodePayloadTooLarge                // arguments or reply exceeds the payload limit
+)
+
+// Error is an error with code, which survives across the rpc boundary, so
+// that callers can check the code instead of parsing message
+type Error struct {
+	Code    int32  // error code
+	Message string // error message
+	Detail  []byte // optional detail, e.g: serialized struct
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf returns an error with the code, and formats the message according to
+// the format specifier
+func Errorf(code int32, format string, args ...interface{}) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Code returns the code of the error, CodeOK for nil error, and CodeUnknown
+// for the errors without code
+func Code(err error) int32 {
+	switch e := err.(type) {
+	case nil:
+		return CodeOK
+	case *Error:
+		return e.Code
+	}
+	if err == ErrDeadlineExceeded {
+		return CodeDeadlineExceeded
+	}
+	return CodeUnknown
+}
+
+// SetError set the error of response, the code and detail are kept if err
+// is an *Error
+func (r *Response) SetError(err error) {
+	r.Error = err.Error()
+	if e, ok := err.(*Error); ok {
+		r.ErrorCode = e.Code
+		r.ErrorDetail = e.Detail
+	}
+}
+
+// error returns the error carried by the response
+func (r *Response) error() error {
+	if r.ErrorCode != CodeOK {
+		return &Error{Code: r.ErrorCode, Message: r.Error, Detail: r.ErrorDetail}
+	}
+	return ServerError(r.Error)
+}
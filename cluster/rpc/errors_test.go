@@ -0,0 +1,53 @@
+package rpc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		code int32
+	}{
+		{nil, CodeOK},
+		{errors.New("plain"), CodeUnknown},
+		{ErrDeadlineExceeded, CodeDeadlineExceeded},
+		{Errorf(CodeNotFound, "route %s not found", "chat.Room"), CodeNotFound},
+		{Errorf(100, "application defined"), 100},
+	}
+	for _, c := range cases {
+		if code := Code(c.err); code != c.code {
+			t.Fatalf("error %v: expect code %d, got %d", c.err, c.code, code)
+		}
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	r := &Response{}
+	r.SetError(&Error{Code: CodeInvalidArgument, Message: "bad argument", Detail: []byte("field")})
+
+	data, err := r.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Response{}
+	if _, err := decoded.UnmarshalMsg(data); err != nil {
+		t.Fatal(err)
+	}
+
+	e, ok := decoded.error().(*Error)
+	if !ok {
+		t.Fatalf("expect *Error, got %T", decoded.error())
+	}
+	if e.Code != CodeInvalidArgument || e.Message != "bad argument" || !bytes.Equal(e.Detail, []byte("field")) {
+		t.Fatalf("unexpected error: %+v", e)
+	}
+
+	r = &Response{}
+	r.SetError(errors.New("plain"))
+	if _, ok := r.error().(ServerError); !ok || Code(r.error()) != CodeUnknown {
+		t.Fatalf("plain error should be a ServerError without code, got %T", r.error())
+	}
+}
@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonnng/starx/log"
+)
+
+// ErrPeerDead is the error of pending calls when the connection is closed
+// because the peer does not respond keepalive pings
+var ErrPeerDead = errors.New("rpc peer does not respond keepalive")
+
+// Keepalive sends a ping every interval, and closes the connection when no
+// frame received from the peer in misses intervals, so that half-open
+// connections are detected, and the pending calls fail fast with ErrPeerDead
+func (client *Client) Keepalive(interval time.Duration, misses int) {
+	if interval <= 0 || misses <= 0 {
+		return
+	}
+	atomic.StoreInt64(&client.lastRecv, time.Now().UnixNano())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		timeout := interval * time.Duration(misses)
+		for range ticker.C {
+			if !client.Available() {
+				return
+			}
+			last := time.Unix(0, atomic.LoadInt64(&client.lastRecv))
+			if time.Since(last) > timeout {
+				log.Errorf("rpc peer does not respond in %s, close the connection", timeout)
+				atomic.StoreInt32(&client.dead, 1)
+				client.codec.close()
+				return
+			}
+			client.ping()
+		}
+	}()
+}
+
+func (client *Client) ping() {
+	client.reqMutex.Lock()
+	defer client.reqMutex.Unlock()
+
+	req := GetRequest()
+	req.Kind = Ping
+	if err := writeMsg(client.codec.rw, req); err != nil {
+		log.Errorf(err.Error())
+	}
+	FreeRequest(req)
+}
@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClient_KeepaliveDeadPeer(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	// drain all requests and never response, include pings
+	go ioutil.ReadAll(s)
+
+	client := NewClient(c)
+	defer client.Close()
+	client.Keepalive(10*time.Millisecond, 2)
+
+	call := client.AsyncCall(User, "Service", "Method", 1, nil, nil)
+	select {
+	case call = <-call.Done:
+		if call.Error != ErrPeerDead {
+			t.Fatalf("expect ErrPeerDead, got: %v", call.Error)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending call should fail when peer is dead")
+	}
+	if client.Available() {
+		t.Fatal("client should be unavailable when peer is dead")
+	}
+}
+
+func TestClient_KeepalivePong(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	go func() {
+		buf := make([]byte, 0)
+		tmp := make([]byte, 512)
+		for {
+			n, err := s.Read(tmp)
+			if err != nil {
+				return
+			}
+			buf = append(buf, tmp[:n]...)
+			for {
+				req, rest, err := DecodeRequest(buf)
+				if err != nil || req == nil {
+					break
+				}
+				buf = rest
+				if req.Kind == Ping {
+					WriteResponse(s, &Response{Kind: RemotePong})
+				}
+			}
+		}
+	}()
+
+	client := NewClient(c)
+	defer client.Close()
+	client.Keepalive(10*time.Millisecond, 2)
+
+	time.Sleep(100 * time.Millisecond)
+	if !client.Available() {
+		t.Fatal("client should be available when peer responses pings")
+	}
+}
@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"errors"
+	"sync"
+)
+
+// MinCustomKind is the least value of the kinds registered by frameworks built
+// on starx, the values less than it are reserved
+const MinCustomKind RpcKind = 32
+
+var (
+	ErrKindReserved   = errors.New("rpc kind is reserved")
+	ErrKindRegistered = errors.New("rpc kind already registered")
+)
+
+var (
+	kindLock    sync.RWMutex
+	customKinds = make(map[RpcKind]string) // custom kind -> name
+)
+
+// RegisterKind registers the custom rpc kind with the name, e.g: AdminRpc,
+// the kind should not be less than MinCustomKind
+func RegisterKind(kind RpcKind, name string) error {
+	if kind < MinCustomKind {
+		return ErrKindReserved
+	}
+
+	kindLock.Lock()
+	defer kindLock.Unlock()
+
+	if _, ok := customKinds[kind]; ok {
+		return ErrKindRegistered
+	}
+	customKinds[kind] = name
+	return nil
+}
+
+// UnregisterKind removes the custom rpc kind, e.g: when the framework
+// registered it is unloaded
+func UnregisterKind(kind RpcKind) {
+	kindLock.Lock()
+	defer kindLock.Unlock()
+
+	delete(customKinds, kind)
+}
+
+// IsCustomKind reports whether the kind is a registered custom kind
+func IsCustomKind(kind RpcKind) bool {
+	_, ok := customKindName(kind)
+	return ok
+}
+
+func customKindName(kind RpcKind) (string, bool) {
+	kindLock.RLock()
+	defer kindLock.RUnlock()
+
+	name, ok := customKinds[kind]
+	return name, ok
+}
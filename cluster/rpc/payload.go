@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// frameOverhead is the max size of the fields other than payload in a frame,
+// e.g: service method, trace id and caller
+const frameOverhead = 4 << 10
+
+// MaxFrame returns the max buffered size of a truncated frame, whose payload
+// does not exceed limit, the peer sends a larger frame should be disconnected,
+// zero limit means unlimited
+func MaxFrame(limit int) int {
+	if limit <= 0 {
+		return 0
+	}
+	return limit + frameOverhead
+}
+
+// PayloadTooLarge returns the error of payload exceeds the limit
+func PayloadTooLarge(what string, size, limit int) *Error {
+	return &Error{
+		Code:    CodePayloadTooLarge,
+		Message: "rpc: " + what + " too large: " + strconv.Itoa(size) + " bytes, limit " + strconv.Itoa(limit),
+	}
+}
+
+// SetMaxPayload set the size limits of the arguments sent and the replies
+// received, the call with large arguments fails without sending, and the
+// large replies fail the calls, zero means unlimited
+func (client *Client) SetMaxPayload(args, reply int) {
+	client.reqMutex.Lock()
+	client.maxArgs = args
+	client.reqMutex.Unlock()
+	atomic.StoreInt64(&client.maxReply, int64(reply))
+}
+
+// checkArgs returns the error when the arguments exceed the limit, it should
+// be called with reqMutex held
+func (client *Client) checkArgs(args []byte) error {
+	if client.maxArgs > 0 && len(args) > client.maxArgs {
+		return PayloadTooLarge("arguments", len(args), client.maxArgs)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package rpc
+
+import (
+	"net"
+	"testing"
+)
+
+func TestClient_MaxPayload(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+	go echoServer(s)
+
+	client := NewClient(c)
+	defer client.Close()
+	client.SetMaxPayload(8, 4)
+
+	reply := new([]byte)
+	err := client.Call(User, "Service", "Method", 1, reply, make([]byte, 16))
+	if Code(err) != CodePayloadTooLarge {
+		t.Fatalf("expect oversized arguments rejected, got: %v", err)
+	}
+
+	// the echoed reply exceeds the limit
+	err = client.Call(User, "Service", "Method", 1, reply, make([]byte, 6))
+	if Code(err) != CodePayloadTooLarge {
+		t.Fatalf("expect oversized reply rejected, got: %v", err)
+	}
+
+	if err := client.Call(User, "Service", "Method", 1, reply, []byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if string(*reply) != "abc" {
+		t.Fatalf("expect abc, got: %s", *reply)
+	}
+}
@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"io"
+	"sync"
+
+	"github.com/lonnng/starx/log"
+)
+
+// maxPooledBuffer is the max capacity of buffer put back to pool, large
+// buffers are left to gc, so that a huge payload does not pin memory
+const maxPooledBuffer = 64 * 1024
+
+var (
+	requestPool  = sync.Pool{New: func() interface{} { return new(Request) }}
+	responsePool = sync.Pool{New: func() interface{} { return new(Response) }}
+	bufferPool   = sync.Pool{New: func() interface{} { b := make([]byte, 0, 512); return &b }}
+)
+
+// GetRequest returns a zeroed request, which should be freed by FreeRequest
+// when nobody references it
+func GetRequest() *Request {
+	return requestPool.Get().(*Request)
+}
+
+// FreeRequest puts the request back to pool, the payload is not reused, so
+// that it is safe to keep the payload after request freed
+func FreeRequest(r *Request) {
+	r.reset()
+	requestPool.Put(r)
+}
+
+// reset zeroes the request, the payload is dropped rather than truncated
+func (r *Request) reset() {
+	*r = Request{}
+}
+
+// GetResponse returns a zeroed response, which should be freed by
+// FreeResponse when nobody references it
+func GetResponse() *Response {
+	return responsePool.Get().(*Response)
+}
+
+// FreeResponse puts the response back to pool, the payload is not reused, so
+// that it is safe to keep the payload after response freed
+func FreeResponse(r *Response) {
+	*r = Response{}
+	responsePool.Put(r)
+}
+
+// writeMsg encodes the request or response with the codec in a pooled buffer,
+// and writes it to w
+func writeMsg(w io.Writer, m interface{}) error {
+	buf := bufferPool.Get().(*[]byte)
+	defer func() {
+		if cap(*buf) <= maxPooledBuffer {
+			*buf = (*buf)[:0]
+			bufferPool.Put(buf)
+		}
+	}()
+
+	var (
+		data []byte
+		err  error
+	)
+	switch m := m.(type) {
+	case *Request:
+		data, err = wireCodec().AppendRequest((*buf)[:0], m)
+	case *Response:
+		data, err = wireCodec().AppendResponse((*buf)[:0], m)
+	default:
+		panic("rpc: write unknown message")
+	}
+	if err != nil {
+		log.Errorf(err.Error())
+		return err
+	}
+	*buf = data
+
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFreeRequest(t *testing.T) {
+	r := GetRequest()
+	r.Seq = 10
+	r.ServiceMethod = "Test.Method"
+	r.Data = []byte("payload")
+	data := r.Data
+
+	// the request can not be read after put back to pool, which may be got
+	// by the servers of other tests
+	r.reset()
+	if r.Seq != 0 || r.ServiceMethod != "" || r.Data != nil {
+		t.Fatalf("freed request should be zeroed: %+v", r)
+	}
+	FreeRequest(r)
+	if string(data) != "payload" {
+		t.Fatal("payload should not be reused")
+	}
+}
+
+func TestWriteResponse(t *testing.T) {
+	resp := &Response{Seq: 1, ServiceMethod: "Test.Method", Data: []byte("reply")}
+	buf := &bytes.Buffer{}
+	for i := 0; i < 2; i++ {
+		if err := WriteResponse(buf, resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data := buf.Bytes()
+	for i := 0; i < 2; i++ {
+		r := GetResponse()
+		var err error
+		if data, err = r.UnmarshalMsg(data); err != nil {
+			t.Fatal(err)
+		}
+		if r.Seq != 1 || string(r.Data) != "reply" {
+			t.Fatalf("unexpected response: %+v", r)
+		}
+		FreeResponse(r)
+	}
+}
+
+func BenchmarkRequestAlloc(b *testing.B) {
+	data, _ := (&Request{ServiceMethod: "Test.Method", Data: make([]byte, 128)}).MarshalMsg(nil)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r := &Request{}
+			r.UnmarshalMsg(data)
+		}
+	})
+}
+
+func BenchmarkRequestPool(b *testing.B) {
+	data, _ := (&Request{ServiceMethod: "Test.Method", Data: make([]byte, 128)}).MarshalMsg(nil)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r := GetRequest()
+			r.UnmarshalMsg(data)
+			FreeRequest(r)
+		}
+	})
+}
+
+func BenchmarkWriteResponse(b *testing.B) {
+	resp := &Response{ServiceMethod: "Test.Method", Data: make([]byte, 128)}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			WriteResponse(ioutil.Discard, resp)
+		}
+	})
+}
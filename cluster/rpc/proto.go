@@ -4,29 +4,82 @@ package rpc
 type ResponseKind byte
 
 const (
-	HandlerResponse ResponseKind = 0x1 // handler session response
-	HandlerPush                  = 0x2 // handler session push
-	RemoteResponse               = 0x3 // remote request normal response, represent whether rpc call successfully
-	RemotePush                   = 0x4 // using remote server push message to current server
+	HandlerResponse  ResponseKind = 0x1 // handler session response
+	HandlerPush                   = 0x2 // handler session push
+	RemoteResponse                = 0x3 // remote request normal response, represent whether rpc call successfully
+	RemotePush                    = 0x4 // using remote server push message to current server
+	RemoteStream                  = 0x5 // remote request incremental response, the call completes on RemoteResponse
+	RemoteBatch                   = 0x6 // responses of a batch, Data is an encoded BatchResponse
+	RemotePong                    = 0x7 // response of keepalive ping
+	HandlerSession                = 0x8 // changed attributes of backend session, Data is encoded by session.EncodeChanges
+	HandlerKick                   = 0x9 // kick the session with the reason in Data
+	HandlerBroadcast              = 0xa // broadcast of cluster channel, Data is an encoded ChannelMessage
 )
 
 type RpcKind byte
 
 const (
-	_    RpcKind = iota
-	Sys          // sys namespace rpc
-	User         // user namespace rpc
+	_      RpcKind = iota
+	Sys            // sys namespace rpc
+	User           // user namespace rpc
+	Batch          // batch of calls, Data is an encoded BatchRequest
+	Cancel         // cancel the call of the Seq, the server skips the response
+	Ping           // keepalive ping, the server responses RemotePong
+)
+
+// StreamFlag represents the frame type of bidirectional stream
+type StreamFlag byte
+
+const (
+	_           StreamFlag = iota
+	StreamOpen             // open a bidirectional stream, keyed by the Seq
+	StreamData             // a frame of the opened stream
+	StreamAck              // acknowledge consumed frames, grant the peer send window
+	StreamClose            // peer will not send frames anymore
+)
+
+// Encoding represents the encoding of payload
+type Encoding byte
+
+const (
+	Identity Encoding = iota // payload is not compressed
+	Zlib                     // payload is compressed by zlib
 )
 
 // Request is a header written before every RPC call.  It is used internally
 // but documented here as an aid to debugging, such as when analyzing
 // network traffic.
 type Request struct {
-	ServiceMethod string  // format: "Service.Method"
-	Seq           uint64  // sequence number chosen by client
-	Sid           int64   // frontend session id
-	Data          []byte  // for args
-	Kind          RpcKind // namespace
+	ServiceMethod string     // format: "Service.Method"
+	Seq           uint64     // sequence number chosen by client
+	Sid           int64      // frontend session id
+	Data          []byte     // for args
+	Kind          RpcKind    // namespace
+	Deadline      int64      // unix nano deadline of the call, zero means no deadline
+	Stream        StreamFlag // bidirectional stream frame type, zero means normal call
+
+	Encoding       Encoding // encoding of Data
+	AcceptEncoding Encoding // encoding of replies the caller accepts
+
+	TraceID      string // correlation id of the client action, generated by frontend
+	ParentSpanID string // span id of the caller
+
+	Notify bool // one-way call, no sequence allocated, and the server never responses
+
+	Caller string // server id of the caller
+
+	Meta Metadata // client session of the call, forwarded by frontend
+}
+
+// Metadata describes the client session which a call is made for, it is
+// forwarded by frontend with every call of the session
+type Metadata struct {
+	ClientAddr string // remote address of the client, for logging and risk checks
+	Serializer string // serializer of client payloads negotiated in handshake
+
+	// servers of the session picked by frontend, server type -> server id, so
+	// the calls of the session from backend are routed to the same servers
+	Affinity map[string]string
 }
 
 // Response is a header written before every RPC return.  It is used internally
@@ -40,4 +93,23 @@ type Response struct {
 	Data          []byte       // save response value
 	Error         string       // error, if any.
 	Route         string       // exists when ResponseType equal RPC_HANDLER_PUSH
+	Stream        StreamFlag   // bidirectional stream frame type, zero means normal response
+
+	Encoding Encoding // encoding of Data
+	TraceID  string   // echoes that of the request
+
+	ErrorCode   int32  // code of error, zero means error without code
+	ErrorDetail []byte // optional detail of error
+}
+
+// BatchRequest packs many calls to the same server into one frame, which is
+// carried in the Data of a Request of Batch kind
+type BatchRequest struct {
+	Requests []Request
+}
+
+// BatchResponse packs the responses of a BatchRequest into one frame, which
+// is carried in the Data of a Response of RemoteBatch kind
+type BatchResponse struct {
+	Responses []Response
 }
@@ -8,17 +8,530 @@ import (
 	"github.com/tinylib/msgp/msgp"
 )
 
+// DecodeMsg implements msgp.Decodable
+func (z *BatchRequest) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zobw uint32
+	zobw, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zobw > 0 {
+		zobw--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Requests":
+			var zxcg uint32
+			zxcg, err = dc.ReadArrayHeader()
+			if err != nil {
+				return
+			}
+			if cap(z.Requests) >= int(zxcg) {
+				z.Requests = z.Requests[:zxcg]
+			} else {
+				z.Requests = make([]Request, zxcg)
+			}
+			for zpsb := range z.Requests {
+				err = z.Requests[zpsb].DecodeMsg(dc)
+				if err != nil {
+					return
+				}
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *BatchRequest) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 1
+	// write "Requests"
+	err = en.Append(0x81, 0xa8, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x73)
+	if err != nil {
+		return err
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Requests)))
+	if err != nil {
+		return
+	}
+	for zpsb := range z.Requests {
+		err = z.Requests[zpsb].EncodeMsg(en)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *BatchRequest) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 1
+	// string "Requests"
+	o = append(o, 0x81, 0xa8, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Requests)))
+	for zpsb := range z.Requests {
+		o, err = z.Requests[zpsb].MarshalMsg(o)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *BatchRequest) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zhed uint32
+	zhed, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zhed > 0 {
+		zhed--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Requests":
+			var zoyl uint32
+			zoyl, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if cap(z.Requests) >= int(zoyl) {
+				z.Requests = z.Requests[:zoyl]
+			} else {
+				z.Requests = make([]Request, zoyl)
+			}
+			for zpsb := range z.Requests {
+				bts, err = z.Requests[zpsb].UnmarshalMsg(bts)
+				if err != nil {
+					return
+				}
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+func (z *BatchRequest) Msgsize() (s int) {
+	s = 1 + 9 + msgp.ArrayHeaderSize
+	for zpsb := range z.Requests {
+		s += z.Requests[zpsb].Msgsize()
+	}
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *BatchResponse) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zzas uint32
+	zzas, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zzas > 0 {
+		zzas--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Responses":
+			var znnl uint32
+			znnl, err = dc.ReadArrayHeader()
+			if err != nil {
+				return
+			}
+			if cap(z.Responses) >= int(znnl) {
+				z.Responses = z.Responses[:znnl]
+			} else {
+				z.Responses = make([]Response, znnl)
+			}
+			for zwch := range z.Responses {
+				err = z.Responses[zwch].DecodeMsg(dc)
+				if err != nil {
+					return
+				}
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *BatchResponse) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 1
+	// write "Responses"
+	err = en.Append(0x81, 0xa9, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x73)
+	if err != nil {
+		return err
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Responses)))
+	if err != nil {
+		return
+	}
+	for zwch := range z.Responses {
+		err = z.Responses[zwch].EncodeMsg(en)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *BatchResponse) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 1
+	// string "Responses"
+	o = append(o, 0x81, 0xa9, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Responses)))
+	for zwch := range z.Responses {
+		o, err = z.Responses[zwch].MarshalMsg(o)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *BatchResponse) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var znjg uint32
+	znjg, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for znjg > 0 {
+		znjg--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Responses":
+			var zfhx uint32
+			zfhx, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if cap(z.Responses) >= int(zfhx) {
+				z.Responses = z.Responses[:zfhx]
+			} else {
+				z.Responses = make([]Response, zfhx)
+			}
+			for zwch := range z.Responses {
+				bts, err = z.Responses[zwch].UnmarshalMsg(bts)
+				if err != nil {
+					return
+				}
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+func (z *BatchResponse) Msgsize() (s int) {
+	s = 1 + 10 + msgp.ArrayHeaderSize
+	for zwch := range z.Responses {
+		s += z.Responses[zwch].Msgsize()
+	}
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Encoding) DecodeMsg(dc *msgp.Reader) (err error) {
+	{
+		var zkhs byte
+		zkhs, err = dc.ReadByte()
+		(*z) = Encoding(zkhs)
+	}
+	if err != nil {
+		return
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z Encoding) EncodeMsg(en *msgp.Writer) (err error) {
+	err = en.WriteByte(byte(z))
+	if err != nil {
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z Encoding) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	o = msgp.AppendByte(o, byte(z))
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Encoding) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	{
+		var zwno byte
+		zwno, bts, err = msgp.ReadByteBytes(bts)
+		(*z) = Encoding(zwno)
+	}
+	if err != nil {
+		return
+	}
+	o = bts
+	return
+}
+
+func (z Encoding) Msgsize() (s int) {
+	s = msgp.ByteSize
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *Metadata) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zxys uint32
+	zxys, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zxys > 0 {
+		zxys--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "ClientAddr":
+			z.ClientAddr, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "Serializer":
+			z.Serializer, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "Affinity":
+			var zqlv uint32
+			zqlv, err = dc.ReadMapHeader()
+			if err != nil {
+				return
+			}
+			if z.Affinity == nil && zqlv > 0 {
+				z.Affinity = make(map[string]string, zqlv)
+			} else if len(z.Affinity) > 0 {
+				for key, _ := range z.Affinity {
+					delete(z.Affinity, key)
+				}
+			}
+			for zqlv > 0 {
+				zqlv--
+				var zaft string
+				var zrod string
+				zaft, err = dc.ReadString()
+				if err != nil {
+					return
+				}
+				zrod, err = dc.ReadString()
+				if err != nil {
+					return
+				}
+				z.Affinity[zaft] = zrod
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Metadata) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "ClientAddr"
+	err = en.Append(0x83, 0xaa, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x41, 0x64, 0x64, 0x72)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.ClientAddr)
+	if err != nil {
+		return
+	}
+	// write "Serializer"
+	err = en.Append(0xaa, 0x53, 0x65, 0x72, 0x69, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.Serializer)
+	if err != nil {
+		return
+	}
+	// write "Affinity"
+	err = en.Append(0xa8, 0x41, 0x66, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x79)
+	if err != nil {
+		return err
+	}
+	err = en.WriteMapHeader(uint32(len(z.Affinity)))
+	if err != nil {
+		return
+	}
+	for zaft, zrod := range z.Affinity {
+		err = en.WriteString(zaft)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(zrod)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Metadata) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "ClientAddr"
+	o = append(o, 0x83, 0xaa, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x41, 0x64, 0x64, 0x72)
+	o = msgp.AppendString(o, z.ClientAddr)
+	// string "Serializer"
+	o = append(o, 0xaa, 0x53, 0x65, 0x72, 0x69, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72)
+	o = msgp.AppendString(o, z.Serializer)
+	// string "Affinity"
+	o = append(o, 0xa8, 0x41, 0x66, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x79)
+	o = msgp.AppendMapHeader(o, uint32(len(z.Affinity)))
+	for zaft, zrod := range z.Affinity {
+		o = msgp.AppendString(o, zaft)
+		o = msgp.AppendString(o, zrod)
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Metadata) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zrul uint32
+	zrul, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zrul > 0 {
+		zrul--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "ClientAddr":
+			z.ClientAddr, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Serializer":
+			z.Serializer, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Affinity":
+			var zrtj uint32
+			zrtj, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if z.Affinity == nil && zrtj > 0 {
+				z.Affinity = make(map[string]string, zrtj)
+			} else if len(z.Affinity) > 0 {
+				for key, _ := range z.Affinity {
+					delete(z.Affinity, key)
+				}
+			}
+			for zrtj > 0 {
+				var zaft string
+				var zrod string
+				zrtj--
+				zaft, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					return
+				}
+				zrod, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Affinity[zaft] = zrod
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+func (z *Metadata) Msgsize() (s int) {
+	s = 1 + 11 + msgp.StringPrefixSize + len(z.ClientAddr) + 11 + msgp.StringPrefixSize + len(z.Serializer) + 9 + msgp.MapHeaderSize
+	if z.Affinity != nil {
+		for zaft, zrod := range z.Affinity {
+			_ = zrod
+			s += msgp.StringPrefixSize + len(zaft) + msgp.StringPrefixSize + len(zrod)
+		}
+	}
+	return
+}
+
 // DecodeMsg implements msgp.Decodable
 func (z *Request) DecodeMsg(dc *msgp.Reader) (err error) {
 	var field []byte
 	_ = field
-	var zxvk uint32
-	zxvk, err = dc.ReadMapHeader()
+	var zomr uint32
+	zomr, err = dc.ReadMapHeader()
 	if err != nil {
 		return
 	}
-	for zxvk > 0 {
-		zxvk--
+	for zomr > 0 {
+		zomr--
 		field, err = dc.ReadMapKeyPtr()
 		if err != nil {
 			return
@@ -46,10 +559,67 @@ func (z *Request) DecodeMsg(dc *msgp.Reader) (err error) {
 			}
 		case "Kind":
 			{
-				var zbzg byte
-				zbzg, err = dc.ReadByte()
-				z.Kind = RpcKind(zbzg)
+				var zjaj byte
+				zjaj, err = dc.ReadByte()
+				z.Kind = RpcKind(zjaj)
+			}
+			if err != nil {
+				return
+			}
+		case "Deadline":
+			z.Deadline, err = dc.ReadInt64()
+			if err != nil {
+				return
+			}
+		case "Stream":
+			{
+				var zmcb byte
+				zmcb, err = dc.ReadByte()
+				z.Stream = StreamFlag(zmcb)
+			}
+			if err != nil {
+				return
+			}
+		case "Encoding":
+			{
+				var zndn byte
+				zndn, err = dc.ReadByte()
+				z.Encoding = Encoding(zndn)
+			}
+			if err != nil {
+				return
+			}
+		case "AcceptEncoding":
+			{
+				var znfg byte
+				znfg, err = dc.ReadByte()
+				z.AcceptEncoding = Encoding(znfg)
+			}
+			if err != nil {
+				return
+			}
+		case "TraceID":
+			z.TraceID, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "ParentSpanID":
+			z.ParentSpanID, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "Notify":
+			z.Notify, err = dc.ReadBool()
+			if err != nil {
+				return
+			}
+		case "Caller":
+			z.Caller, err = dc.ReadString()
+			if err != nil {
+				return
 			}
+		case "Meta":
+			err = z.Meta.DecodeMsg(dc)
 			if err != nil {
 				return
 			}
@@ -65,9 +635,9 @@ func (z *Request) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *Request) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 5
+	// map header, size 14
 	// write "ServiceMethod"
-	err = en.Append(0x85, 0xad, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
+	err = en.Append(0x8e, 0xad, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
 	if err != nil {
 		return err
 	}
@@ -111,15 +681,96 @@ func (z *Request) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	// write "Deadline"
+	err = en.Append(0xa8, 0x44, 0x65, 0x61, 0x64, 0x6c, 0x69, 0x6e, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt64(z.Deadline)
+	if err != nil {
+		return
+	}
+	// write "Stream"
+	err = en.Append(0xa6, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d)
+	if err != nil {
+		return err
+	}
+	err = en.WriteByte(byte(z.Stream))
+	if err != nil {
+		return
+	}
+	// write "Encoding"
+	err = en.Append(0xa8, 0x45, 0x6e, 0x63, 0x6f, 0x64, 0x69, 0x6e, 0x67)
+	if err != nil {
+		return err
+	}
+	err = en.WriteByte(byte(z.Encoding))
+	if err != nil {
+		return
+	}
+	// write "AcceptEncoding"
+	err = en.Append(0xae, 0x41, 0x63, 0x63, 0x65, 0x70, 0x74, 0x45, 0x6e, 0x63, 0x6f, 0x64, 0x69, 0x6e, 0x67)
+	if err != nil {
+		return err
+	}
+	err = en.WriteByte(byte(z.AcceptEncoding))
+	if err != nil {
+		return
+	}
+	// write "TraceID"
+	err = en.Append(0xa7, 0x54, 0x72, 0x61, 0x63, 0x65, 0x49, 0x44)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.TraceID)
+	if err != nil {
+		return
+	}
+	// write "ParentSpanID"
+	err = en.Append(0xac, 0x50, 0x61, 0x72, 0x65, 0x6e, 0x74, 0x53, 0x70, 0x61, 0x6e, 0x49, 0x44)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.ParentSpanID)
+	if err != nil {
+		return
+	}
+	// write "Notify"
+	err = en.Append(0xa6, 0x4e, 0x6f, 0x74, 0x69, 0x66, 0x79)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBool(z.Notify)
+	if err != nil {
+		return
+	}
+	// write "Caller"
+	err = en.Append(0xa6, 0x43, 0x61, 0x6c, 0x6c, 0x65, 0x72)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.Caller)
+	if err != nil {
+		return
+	}
+	// write "Meta"
+	err = en.Append(0xa4, 0x4d, 0x65, 0x74, 0x61)
+	if err != nil {
+		return err
+	}
+	err = z.Meta.EncodeMsg(en)
+	if err != nil {
+		return
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
 func (z *Request) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 5
+	// map header, size 14
 	// string "ServiceMethod"
-	o = append(o, 0x85, 0xad, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
+	o = append(o, 0x8e, 0xad, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
 	o = msgp.AppendString(o, z.ServiceMethod)
 	// string "Seq"
 	o = append(o, 0xa3, 0x53, 0x65, 0x71)
@@ -133,6 +784,36 @@ func (z *Request) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "Kind"
 	o = append(o, 0xa4, 0x4b, 0x69, 0x6e, 0x64)
 	o = msgp.AppendByte(o, byte(z.Kind))
+	// string "Deadline"
+	o = append(o, 0xa8, 0x44, 0x65, 0x61, 0x64, 0x6c, 0x69, 0x6e, 0x65)
+	o = msgp.AppendInt64(o, z.Deadline)
+	// string "Stream"
+	o = append(o, 0xa6, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d)
+	o = msgp.AppendByte(o, byte(z.Stream))
+	// string "Encoding"
+	o = append(o, 0xa8, 0x45, 0x6e, 0x63, 0x6f, 0x64, 0x69, 0x6e, 0x67)
+	o = msgp.AppendByte(o, byte(z.Encoding))
+	// string "AcceptEncoding"
+	o = append(o, 0xae, 0x41, 0x63, 0x63, 0x65, 0x70, 0x74, 0x45, 0x6e, 0x63, 0x6f, 0x64, 0x69, 0x6e, 0x67)
+	o = msgp.AppendByte(o, byte(z.AcceptEncoding))
+	// string "TraceID"
+	o = append(o, 0xa7, 0x54, 0x72, 0x61, 0x63, 0x65, 0x49, 0x44)
+	o = msgp.AppendString(o, z.TraceID)
+	// string "ParentSpanID"
+	o = append(o, 0xac, 0x50, 0x61, 0x72, 0x65, 0x6e, 0x74, 0x53, 0x70, 0x61, 0x6e, 0x49, 0x44)
+	o = msgp.AppendString(o, z.ParentSpanID)
+	// string "Notify"
+	o = append(o, 0xa6, 0x4e, 0x6f, 0x74, 0x69, 0x66, 0x79)
+	o = msgp.AppendBool(o, z.Notify)
+	// string "Caller"
+	o = append(o, 0xa6, 0x43, 0x61, 0x6c, 0x6c, 0x65, 0x72)
+	o = msgp.AppendString(o, z.Caller)
+	// string "Meta"
+	o = append(o, 0xa4, 0x4d, 0x65, 0x74, 0x61)
+	o, err = z.Meta.MarshalMsg(o)
+	if err != nil {
+		return
+	}
 	return
 }
 
@@ -140,13 +821,13 @@ func (z *Request) MarshalMsg(b []byte) (o []byte, err error) {
 func (z *Request) UnmarshalMsg(bts []byte) (o []byte, err error) {
 	var field []byte
 	_ = field
-	var zbai uint32
-	zbai, bts, err = msgp.ReadMapHeaderBytes(bts)
+	var zqux uint32
+	zqux, bts, err = msgp.ReadMapHeaderBytes(bts)
 	if err != nil {
 		return
 	}
-	for zbai > 0 {
-		zbai--
+	for zqux > 0 {
+		zqux--
 		field, bts, err = msgp.ReadMapKeyZC(bts)
 		if err != nil {
 			return
@@ -174,10 +855,67 @@ func (z *Request) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			}
 		case "Kind":
 			{
-				var zcmr byte
-				zcmr, bts, err = msgp.ReadByteBytes(bts)
-				z.Kind = RpcKind(zcmr)
+				var zquo byte
+				zquo, bts, err = msgp.ReadByteBytes(bts)
+				z.Kind = RpcKind(zquo)
+			}
+			if err != nil {
+				return
+			}
+		case "Deadline":
+			z.Deadline, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "Stream":
+			{
+				var zzfh byte
+				zzfh, bts, err = msgp.ReadByteBytes(bts)
+				z.Stream = StreamFlag(zzfh)
+			}
+			if err != nil {
+				return
+			}
+		case "Encoding":
+			{
+				var zjdj byte
+				zjdj, bts, err = msgp.ReadByteBytes(bts)
+				z.Encoding = Encoding(zjdj)
+			}
+			if err != nil {
+				return
+			}
+		case "AcceptEncoding":
+			{
+				var zirr byte
+				zirr, bts, err = msgp.ReadByteBytes(bts)
+				z.AcceptEncoding = Encoding(zirr)
+			}
+			if err != nil {
+				return
+			}
+		case "TraceID":
+			z.TraceID, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "ParentSpanID":
+			z.ParentSpanID, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Notify":
+			z.Notify, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
 			}
+		case "Caller":
+			z.Caller, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Meta":
+			bts, err = z.Meta.UnmarshalMsg(bts)
 			if err != nil {
 				return
 			}
@@ -193,7 +931,7 @@ func (z *Request) UnmarshalMsg(bts []byte) (o []byte, err error) {
 }
 
 func (z *Request) Msgsize() (s int) {
-	s = 1 + 14 + msgp.StringPrefixSize + len(z.ServiceMethod) + 4 + msgp.Uint64Size + 4 + msgp.Int64Size + 5 + msgp.BytesPrefixSize + len(z.Data) + 5 + msgp.ByteSize
+	s = 1 + 14 + msgp.StringPrefixSize + len(z.ServiceMethod) + 4 + msgp.Uint64Size + 4 + msgp.Int64Size + 5 + msgp.BytesPrefixSize + len(z.Data) + 5 + msgp.ByteSize + 9 + msgp.Int64Size + 7 + msgp.ByteSize + 9 + msgp.ByteSize + 15 + msgp.ByteSize + 8 + msgp.StringPrefixSize + len(z.TraceID) + 13 + msgp.StringPrefixSize + len(z.ParentSpanID) + 7 + msgp.BoolSize + 7 + msgp.StringPrefixSize + len(z.Caller) + 5 + z.Meta.Msgsize()
 	return
 }
 
@@ -201,13 +939,13 @@ func (z *Request) Msgsize() (s int) {
 func (z *Response) DecodeMsg(dc *msgp.Reader) (err error) {
 	var field []byte
 	_ = field
-	var zajw uint32
-	zajw, err = dc.ReadMapHeader()
+	var zzem uint32
+	zzem, err = dc.ReadMapHeader()
 	if err != nil {
 		return
 	}
-	for zajw > 0 {
-		zajw--
+	for zzem > 0 {
+		zzem--
 		field, err = dc.ReadMapKeyPtr()
 		if err != nil {
 			return
@@ -215,9 +953,9 @@ func (z *Response) DecodeMsg(dc *msgp.Reader) (err error) {
 		switch msgp.UnsafeString(field) {
 		case "Kind":
 			{
-				var zwht byte
-				zwht, err = dc.ReadByte()
-				z.Kind = ResponseKind(zwht)
+				var zkyg byte
+				zkyg, err = dc.ReadByte()
+				z.Kind = ResponseKind(zkyg)
 			}
 			if err != nil {
 				return
@@ -252,6 +990,39 @@ func (z *Response) DecodeMsg(dc *msgp.Reader) (err error) {
 			if err != nil {
 				return
 			}
+		case "Stream":
+			{
+				var znle byte
+				znle, err = dc.ReadByte()
+				z.Stream = StreamFlag(znle)
+			}
+			if err != nil {
+				return
+			}
+		case "Encoding":
+			{
+				var zkvl byte
+				zkvl, err = dc.ReadByte()
+				z.Encoding = Encoding(zkvl)
+			}
+			if err != nil {
+				return
+			}
+		case "TraceID":
+			z.TraceID, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "ErrorCode":
+			z.ErrorCode, err = dc.ReadInt32()
+			if err != nil {
+				return
+			}
+		case "ErrorDetail":
+			z.ErrorDetail, err = dc.ReadBytes(z.ErrorDetail)
+			if err != nil {
+				return
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -264,9 +1035,9 @@ func (z *Response) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *Response) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 7
+	// map header, size 12
 	// write "Kind"
-	err = en.Append(0x87, 0xa4, 0x4b, 0x69, 0x6e, 0x64)
+	err = en.Append(0x8c, 0xa4, 0x4b, 0x69, 0x6e, 0x64)
 	if err != nil {
 		return err
 	}
@@ -328,15 +1099,60 @@ func (z *Response) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	// write "Stream"
+	err = en.Append(0xa6, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d)
+	if err != nil {
+		return err
+	}
+	err = en.WriteByte(byte(z.Stream))
+	if err != nil {
+		return
+	}
+	// write "Encoding"
+	err = en.Append(0xa8, 0x45, 0x6e, 0x63, 0x6f, 0x64, 0x69, 0x6e, 0x67)
+	if err != nil {
+		return err
+	}
+	err = en.WriteByte(byte(z.Encoding))
+	if err != nil {
+		return
+	}
+	// write "TraceID"
+	err = en.Append(0xa7, 0x54, 0x72, 0x61, 0x63, 0x65, 0x49, 0x44)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.TraceID)
+	if err != nil {
+		return
+	}
+	// write "ErrorCode"
+	err = en.Append(0xa9, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x43, 0x6f, 0x64, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt32(z.ErrorCode)
+	if err != nil {
+		return
+	}
+	// write "ErrorDetail"
+	err = en.Append(0xab, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x44, 0x65, 0x74, 0x61, 0x69, 0x6c)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBytes(z.ErrorDetail)
+	if err != nil {
+		return
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
 func (z *Response) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 7
+	// map header, size 12
 	// string "Kind"
-	o = append(o, 0x87, 0xa4, 0x4b, 0x69, 0x6e, 0x64)
+	o = append(o, 0x8c, 0xa4, 0x4b, 0x69, 0x6e, 0x64)
 	o = msgp.AppendByte(o, byte(z.Kind))
 	// string "ServiceMethod"
 	o = append(o, 0xad, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64)
@@ -356,6 +1172,21 @@ func (z *Response) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "Route"
 	o = append(o, 0xa5, 0x52, 0x6f, 0x75, 0x74, 0x65)
 	o = msgp.AppendString(o, z.Route)
+	// string "Stream"
+	o = append(o, 0xa6, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d)
+	o = msgp.AppendByte(o, byte(z.Stream))
+	// string "Encoding"
+	o = append(o, 0xa8, 0x45, 0x6e, 0x63, 0x6f, 0x64, 0x69, 0x6e, 0x67)
+	o = msgp.AppendByte(o, byte(z.Encoding))
+	// string "TraceID"
+	o = append(o, 0xa7, 0x54, 0x72, 0x61, 0x63, 0x65, 0x49, 0x44)
+	o = msgp.AppendString(o, z.TraceID)
+	// string "ErrorCode"
+	o = append(o, 0xa9, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x43, 0x6f, 0x64, 0x65)
+	o = msgp.AppendInt32(o, z.ErrorCode)
+	// string "ErrorDetail"
+	o = append(o, 0xab, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x44, 0x65, 0x74, 0x61, 0x69, 0x6c)
+	o = msgp.AppendBytes(o, z.ErrorDetail)
 	return
 }
 
@@ -363,13 +1194,13 @@ func (z *Response) MarshalMsg(b []byte) (o []byte, err error) {
 func (z *Response) UnmarshalMsg(bts []byte) (o []byte, err error) {
 	var field []byte
 	_ = field
-	var zhct uint32
-	zhct, bts, err = msgp.ReadMapHeaderBytes(bts)
+	var zigu uint32
+	zigu, bts, err = msgp.ReadMapHeaderBytes(bts)
 	if err != nil {
 		return
 	}
-	for zhct > 0 {
-		zhct--
+	for zigu > 0 {
+		zigu--
 		field, bts, err = msgp.ReadMapKeyZC(bts)
 		if err != nil {
 			return
@@ -377,9 +1208,9 @@ func (z *Response) UnmarshalMsg(bts []byte) (o []byte, err error) {
 		switch msgp.UnsafeString(field) {
 		case "Kind":
 			{
-				var zcua byte
-				zcua, bts, err = msgp.ReadByteBytes(bts)
-				z.Kind = ResponseKind(zcua)
+				var zzsd byte
+				zzsd, bts, err = msgp.ReadByteBytes(bts)
+				z.Kind = ResponseKind(zzsd)
 			}
 			if err != nil {
 				return
@@ -414,6 +1245,39 @@ func (z *Response) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			if err != nil {
 				return
 			}
+		case "Stream":
+			{
+				var zwgh byte
+				zwgh, bts, err = msgp.ReadByteBytes(bts)
+				z.Stream = StreamFlag(zwgh)
+			}
+			if err != nil {
+				return
+			}
+		case "Encoding":
+			{
+				var zhmh byte
+				zhmh, bts, err = msgp.ReadByteBytes(bts)
+				z.Encoding = Encoding(zhmh)
+			}
+			if err != nil {
+				return
+			}
+		case "TraceID":
+			z.TraceID, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "ErrorCode":
+			z.ErrorCode, bts, err = msgp.ReadInt32Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "ErrorDetail":
+			z.ErrorDetail, bts, err = msgp.ReadBytesBytes(bts, z.ErrorDetail)
+			if err != nil {
+				return
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -426,16 +1290,16 @@ func (z *Response) UnmarshalMsg(bts []byte) (o []byte, err error) {
 }
 
 func (z *Response) Msgsize() (s int) {
-	s = 1 + 5 + msgp.ByteSize + 14 + msgp.StringPrefixSize + len(z.ServiceMethod) + 4 + msgp.Uint64Size + 4 + msgp.Int64Size + 5 + msgp.BytesPrefixSize + len(z.Data) + 6 + msgp.StringPrefixSize + len(z.Error) + 6 + msgp.StringPrefixSize + len(z.Route)
+	s = 1 + 5 + msgp.ByteSize + 14 + msgp.StringPrefixSize + len(z.ServiceMethod) + 4 + msgp.Uint64Size + 4 + msgp.Int64Size + 5 + msgp.BytesPrefixSize + len(z.Data) + 6 + msgp.StringPrefixSize + len(z.Error) + 6 + msgp.StringPrefixSize + len(z.Route) + 7 + msgp.ByteSize + 9 + msgp.ByteSize + 8 + msgp.StringPrefixSize + len(z.TraceID) + 10 + msgp.Int32Size + 12 + msgp.BytesPrefixSize + len(z.ErrorDetail)
 	return
 }
 
 // DecodeMsg implements msgp.Decodable
 func (z *ResponseKind) DecodeMsg(dc *msgp.Reader) (err error) {
 	{
-		var zxhx byte
-		zxhx, err = dc.ReadByte()
-		(*z) = ResponseKind(zxhx)
+		var zauo byte
+		zauo, err = dc.ReadByte()
+		(*z) = ResponseKind(zauo)
 	}
 	if err != nil {
 		return
@@ -462,9 +1326,9 @@ func (z ResponseKind) MarshalMsg(b []byte) (o []byte, err error) {
 // UnmarshalMsg implements msgp.Unmarshaler
 func (z *ResponseKind) UnmarshalMsg(bts []byte) (o []byte, err error) {
 	{
-		var zlqf byte
-		zlqf, bts, err = msgp.ReadByteBytes(bts)
-		(*z) = ResponseKind(zlqf)
+		var zjoq byte
+		zjoq, bts, err = msgp.ReadByteBytes(bts)
+		(*z) = ResponseKind(zjoq)
 	}
 	if err != nil {
 		return
@@ -481,9 +1345,9 @@ func (z ResponseKind) Msgsize() (s int) {
 // DecodeMsg implements msgp.Decodable
 func (z *RpcKind) DecodeMsg(dc *msgp.Reader) (err error) {
 	{
-		var zdaf byte
-		zdaf, err = dc.ReadByte()
-		(*z) = RpcKind(zdaf)
+		var zhyy byte
+		zhyy, err = dc.ReadByte()
+		(*z) = RpcKind(zhyy)
 	}
 	if err != nil {
 		return
@@ -510,9 +1374,9 @@ func (z RpcKind) MarshalMsg(b []byte) (o []byte, err error) {
 // UnmarshalMsg implements msgp.Unmarshaler
 func (z *RpcKind) UnmarshalMsg(bts []byte) (o []byte, err error) {
 	{
-		var zpks byte
-		zpks, bts, err = msgp.ReadByteBytes(bts)
-		(*z) = RpcKind(zpks)
+		var zfcm byte
+		zfcm, bts, err = msgp.ReadByteBytes(bts)
+		(*z) = RpcKind(zfcm)
 	}
 	if err != nil {
 		return
@@ -525,3 +1389,51 @@ func (z RpcKind) Msgsize() (s int) {
 	s = msgp.ByteSize
 	return
 }
+
+// DecodeMsg implements msgp.Decodable
+func (z *StreamFlag) DecodeMsg(dc *msgp.Reader) (err error) {
+	{
+		var zfgm byte
+		zfgm, err = dc.ReadByte()
+		(*z) = StreamFlag(zfgm)
+	}
+	if err != nil {
+		return
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z StreamFlag) EncodeMsg(en *msgp.Writer) (err error) {
+	err = en.WriteByte(byte(z))
+	if err != nil {
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z StreamFlag) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	o = msgp.AppendByte(o, byte(z))
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *StreamFlag) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	{
+		var zrdn byte
+		zrdn, bts, err = msgp.ReadByteBytes(bts)
+		(*z) = StreamFlag(zrdn)
+	}
+	if err != nil {
+		return
+	}
+	o = bts
+	return
+}
+
+func (z StreamFlag) Msgsize() (s int) {
+	s = msgp.ByteSize
+	return
+}
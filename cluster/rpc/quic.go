@@ -0,0 +1,398 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// ErrQUICConfig is returned when the quic transport dials or listens without
+// tls config, quic connections are always secured
+var ErrQUICConfig = errors.New("rpc: quic transport requires tls config")
+
+const (
+	quicProto      = "starx-rpc"      // application protocol negotiated by quic connections
+	quicMaxStreams = 1 << 14          // max calls in flight on a quic connection, a call holds a stream until responded
+	quicKeepalive  = 15 * time.Second // keeps the idle connections in pool alive
+)
+
+// QUIC returns the transport carrying every call on its own quic stream, so
+// the response of a call is not blocked behind the lost packets of others,
+// and the connections survive the address changes of the peers. The server
+// config applies to the rpc listener, and the client config applies to the
+// connections to remote servers.
+//
+// The requests are delivered to the server in the order they were written,
+// the responses of a call, including its incremental responses, are written
+// on the stream of the call, and other frames from the server, e.g: pushes
+// and pongs, are written in order on a stream opened by the server
+func QUIC(server, client *tls.Config) Transport {
+	return &quicTransport{server: quicTLS(server), client: quicTLS(client)}
+}
+
+type quicTransport struct {
+	server *tls.Config
+	client *tls.Config
+}
+
+// quicTLS returns a copy of the config negotiating the rpc protocol
+func quicTLS(c *tls.Config) *tls.Config {
+	if c == nil {
+		return nil
+	}
+	c = c.Clone()
+	if len(c.NextProtos) == 0 {
+		c.NextProtos = []string{quicProto}
+	}
+	return c
+}
+
+func quicConfig() *quic.Config {
+	return &quic.Config{
+		MaxIncomingStreams: quicMaxStreams,
+		KeepAlivePeriod:    quicKeepalive,
+	}
+}
+
+func (t *quicTransport) Dial(address string) (net.Conn, error) {
+	if t.client == nil {
+		return nil, ErrQUICConfig
+	}
+	conn, err := quic.DialAddr(context.Background(), address, t.client, quicConfig())
+	if err != nil {
+		return nil, err
+	}
+	c := newQUICConn(conn, false)
+	go c.acceptControl()
+	return c, nil
+}
+
+func (t *quicTransport) Listen(address string) (net.Listener, error) {
+	if t.server == nil {
+		return nil, ErrQUICConfig
+	}
+	l, err := quic.ListenAddr(address, t.server, quicConfig())
+	if err != nil {
+		return nil, err
+	}
+	return &quicListener{l: l}, nil
+}
+
+type quicListener struct {
+	l *quic.Listener
+}
+
+func (l *quicListener) Accept() (net.Conn, error) {
+	conn, err := l.l.Accept(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	c := newQUICConn(conn, true)
+	go c.acceptCalls()
+	return c, nil
+}
+
+func (l *quicListener) Close() error {
+	return l.l.Close()
+}
+
+func (l *quicListener) Addr() net.Addr {
+	return l.l.Addr()
+}
+
+// quicConn carries the frames on quic streams as a net.Conn, so the client
+// and the server read and write the frames like on tcp, the frames written
+// are split and sent on their streams, and the frames received from all
+// streams are read in turn
+type quicConn struct {
+	conn *quic.Conn
+
+	frames chan []byte   // complete frames received
+	unread []byte        // rest of the frame partially read
+	done   chan struct{} // closed when the connection closed
+	once   sync.Once
+
+	deadlineLock sync.Mutex
+	deadline     time.Time // read deadline, zero means none
+
+	writeLock sync.Mutex              // protects following
+	written   []byte                  // bytes of the frame partially written
+	calls     map[uint64]*quic.Stream // server only, stream of the call waiting for response
+	control   *quic.SendStream        // server only, carries the frames not responding a call
+}
+
+func newQUICConn(conn *quic.Conn, server bool) *quicConn {
+	c := &quicConn{
+		conn:   conn,
+		frames: make(chan []byte),
+		done:   make(chan struct{}),
+	}
+	if server {
+		c.calls = make(map[uint64]*quic.Stream)
+	}
+	go func() {
+		<-conn.Context().Done()
+		c.shut()
+	}()
+	return c
+}
+
+func (c *quicConn) shut() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// deliver queues the frame received to be read, returns false when the
+// connection closed
+func (c *quicConn) deliver(frame []byte) bool {
+	select {
+	case c.frames <- frame:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// readFrames delivers the frames read from the stream until it ends, split
+// reads the frame at the head of buf, and returns the rest
+func (c *quicConn) readFrames(r io.Reader, split func(buf []byte) ([]byte, error)) {
+	var buf []byte
+	tmp := make([]byte, 512)
+	for {
+		n, err := r.Read(tmp)
+		buf = append(buf, tmp[:n]...)
+		for len(buf) > 0 {
+			rest, e := split(buf)
+			if e == ErrShortFrame {
+				break
+			}
+			if e != nil {
+				return
+			}
+			frame := make([]byte, len(buf)-len(rest))
+			copy(frame, buf)
+			if !c.deliver(frame) {
+				return
+			}
+			buf = rest
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func splitResponse(buf []byte) ([]byte, error) {
+	var resp Response
+	return wireCodec().ReadResponse(buf, &resp)
+}
+
+// acceptControl reads the frames written by server not responding a call
+func (c *quicConn) acceptControl() {
+	for {
+		s, err := c.conn.AcceptUniStream(context.Background())
+		if err != nil {
+			return
+		}
+		c.readFrames(s, splitResponse)
+	}
+}
+
+// acceptCalls reads the requests from the streams in the order opened by
+// client, which is the order they were written
+func (c *quicConn) acceptCalls() {
+	for {
+		s, err := c.conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		call := false
+		c.readFrames(s, func(buf []byte) ([]byte, error) {
+			var req Request
+			rest, err := wireCodec().ReadRequest(buf, &req)
+			if err == nil && c.track(s, &req) {
+				call = true
+			}
+			return rest, err
+		})
+		// nothing is responded on the stream of notifications, pings and
+		// cancellations
+		if !call {
+			s.Close()
+		}
+	}
+}
+
+// track binds the call to the stream its responses are written on, returns
+// false when the request is not responded on its stream
+func (c *quicConn) track(s *quic.Stream, req *Request) bool {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	switch {
+	case req.Kind == Cancel:
+		// the response of canceled call is skipped by server
+		if call, ok := c.calls[req.Seq]; ok {
+			delete(c.calls, req.Seq)
+			call.Close()
+		}
+		return false
+	case req.Kind == Batch || req.Kind == Ping || req.Notify || req.Stream != 0:
+		return false
+	}
+	// the call resent, its response is written on the latest stream
+	if call, ok := c.calls[req.Seq]; ok {
+		call.Close()
+	}
+	c.calls[req.Seq] = s
+	return true
+}
+
+func (c *quicConn) Read(b []byte) (int, error) {
+	if len(c.unread) == 0 {
+		var timeout <-chan time.Time
+		if d := c.readDeadline(); !d.IsZero() {
+			timer := time.NewTimer(time.Until(d))
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case c.unread = <-c.frames:
+		case <-c.done:
+			return 0, io.EOF
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+	n := copy(b, c.unread)
+	c.unread = c.unread[n:]
+	return n, nil
+}
+
+func (c *quicConn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.written = append(c.written, b...)
+	buf := c.written
+	for len(buf) > 0 {
+		var (
+			rest []byte
+			err  error
+		)
+		if c.calls != nil {
+			var resp Response
+			if rest, err = wireCodec().ReadResponse(buf, &resp); err == nil {
+				err = c.respond(&resp, buf[:len(buf)-len(rest)])
+			}
+		} else {
+			var req Request
+			if rest, err = wireCodec().ReadRequest(buf, &req); err == nil {
+				err = c.call(buf[:len(buf)-len(rest)])
+			}
+		}
+		if err == ErrShortFrame {
+			break
+		}
+		if err != nil {
+			c.written = c.written[:0]
+			return 0, err
+		}
+		buf = rest
+	}
+	c.written = append(c.written[:0], buf...)
+	return len(b), nil
+}
+
+// call sends the request on a new stream, and delivers the responses read
+// from the stream
+func (c *quicConn) call(frame []byte) error {
+	s, err := c.conn.OpenStreamSync(context.Background())
+	if err != nil {
+		return err
+	}
+	if _, err := s.Write(frame); err != nil {
+		s.CancelRead(0)
+		return err
+	}
+	s.Close()
+	go c.readFrames(s, splitResponse)
+	return nil
+}
+
+// respond writes the response of a call on the stream of the call, which is
+// closed after the call completed, other frames are written on the control
+// stream
+func (c *quicConn) respond(resp *Response, frame []byte) error {
+	if resp.Stream == 0 && (resp.Kind == RemoteResponse || resp.Kind == RemoteStream) {
+		if s, ok := c.calls[resp.Seq]; ok {
+			// the caller abandoned the stream, nobody waits for the response
+			_, err := s.Write(frame)
+			if err != nil || resp.Kind == RemoteResponse {
+				delete(c.calls, resp.Seq)
+				s.Close()
+			}
+			return nil
+		}
+	}
+
+	if c.control == nil {
+		s, err := c.conn.OpenUniStreamSync(context.Background())
+		if err != nil {
+			return err
+		}
+		c.control = s
+	}
+	_, err := c.control.Write(frame)
+	return err
+}
+
+func (c *quicConn) Close() error {
+	c.shut()
+	return c.conn.CloseWithError(0, "")
+}
+
+// ConnectionState returns the tls state of the connection, e.g: the
+// certificates of the peer with mutual TLS
+func (c *quicConn) ConnectionState() tls.ConnectionState {
+	return c.conn.ConnectionState().TLS
+}
+
+func (c *quicConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *quicConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *quicConn) readDeadline() time.Time {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+
+	return c.deadline
+}
+
+// SetDeadline only sets the read deadline, writes are bounded by the flow
+// control of quic
+func (c *quicConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *quicConn) SetReadDeadline(t time.Time) error {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+
+	c.deadline = t
+	return nil
+}
+
+func (c *quicConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,156 @@
+package rpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// quicTestTransport returns the quic transport with a self-signed certificate
+func quicTestTransport(t *testing.T) Transport {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "starx"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client := &tls.Config{RootCAs: pool}
+	return QUIC(server, client)
+}
+
+// listenQUIC serves the connections of the listener until the test ends
+func listenQUIC(t *testing.T, tr Transport, serve func(net.Conn)) net.Listener {
+	l, err := tr.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return l
+}
+
+func TestQUIC_Call(t *testing.T) {
+	tr := quicTestTransport(t)
+	l := listenQUIC(t, tr, echoServer)
+
+	client, err := DialTransport(tr, l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		reply := new([]byte)
+		if err := client.Call(User, "Service", "Method", 1, reply, []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if string(*reply) != "hello" {
+			t.Fatalf("expect hello, got %s", *reply)
+		}
+	}
+}
+
+func TestQUIC_StreamPerCall(t *testing.T) {
+	tr := quicTestTransport(t)
+	tracked := make(chan int, 1)
+	l := listenQUIC(t, tr, func(conn net.Conn) {
+		// reads both calls, then responds them in reverse order with a push
+		// in between
+		var (
+			buf  []byte
+			reqs []*Request
+		)
+		tmp := make([]byte, 512)
+		for len(reqs) < 2 {
+			n, err := conn.Read(tmp)
+			if err != nil {
+				return
+			}
+			buf = append(buf, tmp[:n]...)
+			for {
+				req, rest, err := DecodeRequest(buf)
+				if err != nil || req == nil {
+					break
+				}
+				buf = rest
+				reqs = append(reqs, req)
+			}
+		}
+		c := conn.(*quicConn)
+		c.writeLock.Lock()
+		tracked <- len(c.calls)
+		c.writeLock.Unlock()
+
+		WriteResponse(conn, &Response{Kind: RemoteResponse, Seq: reqs[1].Seq, Data: reqs[1].Data})
+		WriteResponse(conn, &Response{Kind: HandlerPush, Sid: 1, Route: "onPush", Data: []byte("push")})
+		WriteResponse(conn, &Response{Kind: RemoteResponse, Seq: reqs[0].Seq, Data: reqs[0].Data})
+	})
+
+	client, err := DialTransport(tr, l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	first := client.AsyncCall(User, "Service", "Method", 1, []byte("first"), nil)
+	second := client.AsyncCall(User, "Service", "Method", 1, []byte("second"), nil)
+
+	if n := <-tracked; n != 2 {
+		t.Fatalf("every call should be carried on its own stream, got %d streams", n)
+	}
+	for _, call := range []*Call{second, first} {
+		select {
+		case call = <-call.Done:
+			if call.Error != nil {
+				t.Fatal(call.Error)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("call should be responded on its stream")
+		}
+	}
+	if string(*first.Reply) != "first" || string(*second.Reply) != "second" {
+		t.Fatalf("unexpected replies %s %s", *first.Reply, *second.Reply)
+	}
+	select {
+	case resp := <-client.ResponseChan:
+		if resp.Kind != HandlerPush || string(resp.Data) != "push" {
+			t.Fatalf("unexpected push %v %s", resp.Kind, resp.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("push should be carried on the control stream")
+	}
+}
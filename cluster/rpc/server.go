@@ -1,18 +1,19 @@
 package rpc
 
 import (
+	"crypto/x509"
 	"errors"
 	"io"
+	"net"
 	"strconv"
 	"sync"
 	"unicode"
 	"unicode/utf8"
-
-	"github.com/lonnng/starx/log"
 )
 
 var (
-	ErrNilResponse = errors.New("nil response")
+	ErrNilResponse      = errors.New("nil response")
+	ErrDeadlineExceeded = errors.New("rpc call deadline exceeded")
 )
 
 // Server represents an RPC Server.
@@ -26,6 +27,57 @@ func NewServer(kind RpcKind) *Server {
 	return &Server{Kind: kind}
 }
 
+// Handler dispatches a request and returns its response
+type Handler func(req *Request) (*Response, error)
+
+// Interceptor wraps the dispatch of every request, it can inspect or modify
+// the request and the response, or reject the request with an error instead
+// of calling next
+type Interceptor func(req *Request, next Handler) (*Response, error)
+
+// PanicHandler is called with the request, the recovered value and the stack
+// when the method panics, the returned error is responded to the caller, and
+// the handler can panic again to crash the server
+type PanicHandler func(req *Request, rec interface{}, stack []byte) error
+
+// FallbackHandler handles the request whose service or method does not exist,
+// and returns the serialized reply, which is useful for the dynamic scripting
+// layer, or returning a structured "route not found" error
+type FallbackHandler func(req *Request) ([]byte, error)
+
+// Peer is the identity of the caller server
+type Peer struct {
+	Addr         net.Addr            // remote address of the caller
+	Certificates []*x509.Certificate // verified certificates of the caller with mutual TLS
+}
+
+// AccessController is consulted before dispatching every request, so that
+// deployments can restrict which servers may call which methods, the request
+// is rejected with the returned error, which should be CodePermissionDenied
+type AccessController interface {
+	Allow(kind RpcKind, serviceMethod string, sid int64, peer *Peer) error
+}
+
+// AccessControllerFunc is an adapter to allow the use of ordinary function as
+// AccessController
+type AccessControllerFunc func(kind RpcKind, serviceMethod string, sid int64, peer *Peer) error
+
+// Allow calls f(kind, serviceMethod, sid, peer)
+func (f AccessControllerFunc) Allow(kind RpcKind, serviceMethod string, sid int64, peer *Peer) error {
+	return f(kind, serviceMethod, sid, peer)
+}
+
+// Chain returns a handler which calls the interceptors in order, and h at last
+func Chain(h Handler, interceptors ...Interceptor) Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], h
+		h = func(req *Request) (*Response, error) {
+			return interceptor(req, next)
+		}
+	}
+	return h
+}
+
 // SysRpcServer is the system namespace rpc instance of *Server.
 
 // UserRpcServer is the user namespace rpc instance of *Server
@@ -40,6 +92,12 @@ var rpcResponseKindNames = []string{
 	HandlerResponse: "HandlerResponse",
 	HandlerPush:     "HandlerPush",
 	RemoteResponse:  "RemoteResponse",
+	RemotePush:      "RemotePush",
+	RemoteStream:    "RemoteStream",
+	RemoteBatch:     "RemoteBatch",
+	RemotePong:      "RemotePong",
+	HandlerSession:  "HandlerSession",
+	HandlerKick:     "HandlerKick",
 }
 
 func (k ResponseKind) String() string {
@@ -50,24 +108,38 @@ func (k ResponseKind) String() string {
 }
 
 var rpcKindNames = []string{
-	Sys:  "SysRpc",  // system rpc
-	User: "UserRpc", // user rpc
+	Sys:    "SysRpc",    // system rpc
+	User:   "UserRpc",   // user rpc
+	Batch:  "BatchRpc",  // batch of rpc
+	Cancel: "CancelRpc", // cancel of rpc
+	Ping:   "PingRpc",   // keepalive ping
 }
 
 func (k RpcKind) String() string {
 	if int(k) < len(rpcKindNames) {
 		return rpcKindNames[k]
 	}
+	if name, ok := customKindName(k); ok {
+		return name
+	}
 	return strconv.Itoa(int(k))
 }
 
-func WriteResponse(w io.Writer, resp *Response) error {
-	data, err := resp.MarshalMsg(emptyBytes)
+// DecodeRequest decodes a request from the head of buf, and returns the rest
+// of buf, a nil request returned when buf does not hold a complete request
+func DecodeRequest(buf []byte) (*Request, []byte, error) {
+	req := GetRequest()
+	rest, err := wireCodec().ReadRequest(buf, req)
 	if err != nil {
-		log.Errorf(err.Error())
-		return err
+		FreeRequest(req)
+		if err == ErrShortFrame {
+			return nil, buf, nil
+		}
+		return nil, nil, err
 	}
-	// TODO: n
-	_, err = w.Write(data)
-	return err
+	return req, rest, nil
+}
+
+func WriteResponse(w io.Writer, resp *Response) error {
+	return writeMsg(w, resp)
 }
@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	var trace []string
+	record := func(name string) Interceptor {
+		return func(req *Request, next Handler) (*Response, error) {
+			trace = append(trace, name)
+			return next(req)
+		}
+	}
+
+	h := Chain(func(req *Request) (*Response, error) {
+		trace = append(trace, "handler")
+		return &Response{Seq: req.Seq}, nil
+	}, record("first"), record("second"))
+
+	resp, err := h(&Request{Seq: 10})
+	if err != nil || resp.Seq != 10 {
+		t.Fatalf("unexpected response: %+v, %v", resp, err)
+	}
+
+	if expect := []string{"first", "second", "handler"}; !reflect.DeepEqual(trace, expect) {
+		t.Fatalf("expect %v, got %v", expect, trace)
+	}
+}
+
+func TestChain_Reject(t *testing.T) {
+	errReject := errors.New("reject")
+	h := Chain(func(req *Request) (*Response, error) {
+		t.Fatal("handler should not be called")
+		return nil, nil
+	}, func(req *Request, next Handler) (*Response, error) {
+		return nil, errReject
+	})
+
+	if _, err := h(&Request{}); err != errReject {
+		t.Fatalf("expect errReject, got %v", err)
+	}
+}
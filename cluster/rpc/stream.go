@@ -0,0 +1,186 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/lonnng/starx/log"
+)
+
+// StreamWindow is the count of frames that can be sent without being
+// acknowledged, the sender blocks when the window exhausted
+const StreamWindow = 64
+
+var (
+	ErrStreamClosed = errors.New("stream closed")
+)
+
+// BidiStream represents an ordered sequence of frames exchanged in both
+// directions over the inter-server connection, keyed by the Seq of the
+// request which opened it. It is flow controlled, Send blocks until the
+// peer consumes frames, so a slow receiver can not be flooded.
+type BidiStream struct {
+	Seq uint64 // sequence number of the request which opened the stream
+
+	write   func(flag StreamFlag, data []byte) error // write frame to peer
+	frames  chan []byte                              // received frames
+	credits chan struct{}                            // send window
+	die     chan struct{}                            // closed when stream aborted
+
+	mu           sync.Mutex // protects following
+	consumed     int        // consumed frames have not been acknowledged
+	closed       bool       // local side closed
+	remoteClosed bool       // remote side closed
+	aborted      bool       // stream aborted
+	err          error      // error reported by peer
+}
+
+// NewBidiStream returns a new stream, write is used to send frames to peer
+func NewBidiStream(seq uint64, write func(flag StreamFlag, data []byte) error) *BidiStream {
+	s := &BidiStream{
+		Seq:     seq,
+		write:   write,
+		frames:  make(chan []byte, StreamWindow),
+		credits: make(chan struct{}, StreamWindow),
+		die:     make(chan struct{}),
+	}
+	for i := 0; i < StreamWindow; i++ {
+		s.credits <- struct{}{}
+	}
+	return s
+}
+
+// Send a frame to peer, it blocks when the send window exhausted
+func (s *BidiStream) Send(data []byte) error {
+	select {
+	case <-s.credits:
+	case <-s.die:
+		return ErrStreamClosed
+	}
+
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return ErrStreamClosed
+	}
+
+	return s.write(StreamData, data)
+}
+
+// Recv returns the next frame from peer, io.EOF will be returned after peer
+// closed the stream normally
+func (s *BidiStream) Recv() ([]byte, error) {
+	data, ok := <-s.frames
+	if !ok {
+		s.mu.Lock()
+		err := s.err
+		s.mu.Unlock()
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+
+	// acknowledge consumed frames per half window
+	s.mu.Lock()
+	s.consumed++
+	n := s.consumed
+	if n >= StreamWindow/2 {
+		s.consumed = 0
+	} else {
+		n = 0
+	}
+	s.mu.Unlock()
+
+	if n > 0 {
+		buf := make([]byte, binary.MaxVarintLen64)
+		if err := s.write(StreamAck, buf[:binary.PutUvarint(buf, uint64(n))]); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// Close the local side of the stream, peer will receive io.EOF after all
+// sent frames
+func (s *BidiStream) Close() error {
+	return s.CloseWithError(nil)
+}
+
+// CloseWithError close the local side of the stream, and peer will receive
+// the error after all sent frames
+func (s *BidiStream) CloseWithError(err error) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrStreamClosed
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	var data []byte
+	if err != nil {
+		data = []byte(err.Error())
+	}
+	return s.write(StreamClose, data)
+}
+
+// Deliver a frame received from peer, it is called by the goroutine that
+// reads the connection
+func (s *BidiStream) Deliver(flag StreamFlag, data []byte) {
+	switch flag {
+	case StreamData:
+		// frames arrived after the stream closed or aborted are dropped,
+		// the frames channel has been closed
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.remoteClosed || s.aborted {
+			log.Debugf("rpc: stream %d closed, late frame dropped", s.Seq)
+			return
+		}
+		select {
+		case s.frames <- data:
+		default:
+			log.Errorf("rpc: stream %d receive window overflow, frame dropped", s.Seq)
+		}
+	case StreamAck:
+		n, _ := binary.Uvarint(data)
+		for i := uint64(0); i < n; i++ {
+			select {
+			case s.credits <- struct{}{}:
+			default:
+			}
+		}
+	case StreamClose:
+		s.mu.Lock()
+		if !s.remoteClosed && !s.aborted {
+			s.remoteClosed = true
+			if len(data) > 0 {
+				s.err = ServerError(data)
+			}
+			close(s.frames)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Abort the stream when the connection lost, blocked Send and Recv will
+// return immediately
+func (s *BidiStream) Abort() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.aborted {
+		return
+	}
+	s.aborted = true
+	close(s.die)
+	if !s.remoteClosed {
+		s.remoteClosed = true
+		s.err = ErrShutdown
+		close(s.frames)
+	}
+}
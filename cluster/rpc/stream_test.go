@@ -0,0 +1,109 @@
+package rpc
+
+import (
+	"io"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// pipeStreams returns two streams connected to each other
+func pipeStreams() (*BidiStream, *BidiStream) {
+	var a, b *BidiStream
+	a = NewBidiStream(1, func(flag StreamFlag, data []byte) error {
+		b.Deliver(flag, data)
+		return nil
+	})
+	b = NewBidiStream(1, func(flag StreamFlag, data []byte) error {
+		a.Deliver(flag, data)
+		return nil
+	})
+	return a, b
+}
+
+func TestBidiStream_Ordered(t *testing.T) {
+	a, b := pipeStreams()
+
+	const count = StreamWindow * 4
+	go func() {
+		for i := 0; i < count; i++ {
+			if err := a.Send([]byte(strconv.Itoa(i))); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		a.Close()
+	}()
+
+	for i := 0; i < count; i++ {
+		data, err := b.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != strconv.Itoa(i) {
+			t.Fatalf("expect frame %d, got %s", i, data)
+		}
+	}
+
+	if _, err := b.Recv(); err != io.EOF {
+		t.Fatalf("expect io.EOF, got %v", err)
+	}
+}
+
+func TestBidiStream_FlowControl(t *testing.T) {
+	a, b := pipeStreams()
+
+	for i := 0; i < StreamWindow; i++ {
+		a.Send([]byte("frame"))
+	}
+
+	sent := make(chan bool, 1)
+	go func() {
+		a.Send([]byte("overflow"))
+		sent <- true
+	}()
+
+	select {
+	case <-sent:
+		t.Fatal("send should block when window exhausted")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// consume half window, which grants the sender credits
+	for i := 0; i < StreamWindow/2; i++ {
+		b.Recv()
+	}
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("send should continue after frames consumed")
+	}
+}
+
+func TestBidiStream_Abort(t *testing.T) {
+	a, _ := pipeStreams()
+	a.Abort()
+
+	if _, err := a.Recv(); err != ErrShutdown {
+		t.Fatalf("expect ErrShutdown, got %v", err)
+	}
+}
+
+func TestBidiStream_LateFrame(t *testing.T) {
+	a, _ := pipeStreams()
+	a.Deliver(StreamData, []byte("frame"))
+	a.Deliver(StreamClose, nil)
+	a.Deliver(StreamData, []byte("late"))
+
+	if data, err := a.Recv(); err != nil || string(data) != "frame" {
+		t.Fatalf("expect frame, got %s %v", data, err)
+	}
+	if _, err := a.Recv(); err != io.EOF {
+		t.Fatalf("expect io.EOF, got %v", err)
+	}
+
+	b, _ := pipeStreams()
+	b.Abort()
+	b.Deliver(StreamData, []byte("late"))
+}
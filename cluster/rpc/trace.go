@@ -0,0 +1,24 @@
+package rpc
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Trace correlates a call with the client action which causes it, a client
+// action is traced across frontend -> backend -> remote hops by the trace id,
+// and every hop is a span whose parent is the span of caller
+type Trace struct {
+	TraceID string // correlation id of the client action
+	SpanID  string // span id of the caller
+}
+
+// NewTraceID returns a random 128-bit trace id in hex
+func NewTraceID() string {
+	return fmt.Sprintf("%016x%016x", rand.Uint64(), rand.Uint64())
+}
+
+// NewSpanID returns a random 64-bit span id in hex
+func NewSpanID() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
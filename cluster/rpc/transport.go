@@ -0,0 +1,63 @@
+package rpc
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// Transport establishes the connections between servers, requests and
+// responses are framed on the connection, so any reliable ordered stream can
+// carry them, transports other than tcp should secure the connections
+// themselves, e.g: QUIC
+type Transport interface {
+	// Dial connects to the rpc server at the address
+	Dial(address string) (net.Conn, error)
+
+	// Listen announces on the address for rpc connections
+	Listen(address string) (net.Listener, error)
+}
+
+// unixScheme is the scheme of unix domain socket address, e.g:
+// unix:///var/run/starx/game-1.sock
+const unixScheme = "unix://"
+
+// IsUnixAddress reports whether the address is a unix domain socket address
+func IsUnixAddress(address string) bool {
+	return strings.HasPrefix(address, unixScheme)
+}
+
+// TCP is the default transport, addresses with unix:// scheme are connected
+// over unix domain socket, which avoids tcp stack overhead between the servers
+// on the same host
+var TCP Transport = tcpTransport{}
+
+type tcpTransport struct{}
+
+func (tcpTransport) Dial(address string) (net.Conn, error) {
+	if IsUnixAddress(address) {
+		return net.Dial("unix", strings.TrimPrefix(address, unixScheme))
+	}
+	return net.Dial("tcp4", address)
+}
+
+func (tcpTransport) Listen(address string) (net.Listener, error) {
+	if IsUnixAddress(address) {
+		path := strings.TrimPrefix(address, unixScheme)
+		// remove the socket file left by last process
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", address)
+}
+
+// DialTransport connects to an RPC server at the address with the transport
+func DialTransport(t Transport, address string) (*Client, error) {
+	conn, err := t.Dial(address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
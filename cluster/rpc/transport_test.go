@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pipeTransport connects the clients to the server over in-memory pipes
+type pipeTransport struct {
+	serve func(net.Conn)
+}
+
+func (t pipeTransport) Dial(address string) (net.Conn, error) {
+	c, s := net.Pipe()
+	go t.serve(s)
+	return c, nil
+}
+
+func (t pipeTransport) Listen(address string) (net.Listener, error) {
+	return nil, net.UnknownNetworkError("pipe")
+}
+
+func TestDialTransport(t *testing.T) {
+	client, err := DialTransport(pipeTransport{serve: echoServer}, "pipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	reply := new([]byte)
+	if err := client.Call(User, "Service", "Method", 1, reply, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if string(*reply) != "hello" {
+		t.Fatalf("expect hello, got %s", *reply)
+	}
+}
+
+func TestTCP_Unix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addr := "unix://" + filepath.Join(dir, "rpc.sock")
+	l, err := TCP.Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go echoServer(conn)
+		}
+	}()
+
+	client, err := DialTransport(TCP, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	reply := new([]byte)
+	if err := client.Call(User, "Service", "Method", 1, reply, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if string(*reply) != "hello" {
+		t.Fatalf("expect hello, got %s", *reply)
+	}
+}
@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+)
+
+// shadow is the secondary server which receives the mirrored requests
+type shadow struct {
+	pool    *clientPool
+	percent int // percentage of requests mirrored
+}
+
+var (
+	shadowLock sync.RWMutex       // protects shadows
+	shadows    map[string]*shadow // server type -> shadow server
+)
+
+func init() {
+	shadows = make(map[string]*shadow)
+}
+
+// SetShadow mirrors percent of requests to the server type to the shadow
+// server asynchronously, the shadow server should not be registered in
+// cluster, and its responses are discarded, so a new build can be validated
+// against real traffic, nil server or zero percent disables mirroring
+func SetShadow(svrType string, svr *ServerConfig, percent int) {
+	shadowLock.Lock()
+	old := shadows[svrType]
+	if svr == nil || percent <= 0 {
+		delete(shadows, svrType)
+	} else {
+		pool := newClientPool(svr)
+		pool.shadow = true
+		shadows[svrType] = &shadow{pool: pool, percent: percent}
+	}
+	shadowLock.Unlock()
+
+	if old != nil {
+		old.pool.close()
+	}
+}
+
+// mirror sends the request to the shadow server of the route as notification,
+// so the shadow server never responses
+func mirror(rpcKind rpc.RpcKind, route *route.Route, session *session.Session, args []byte) {
+	shadowLock.RLock()
+	s := shadows[route.ServerType]
+	shadowLock.RUnlock()
+
+	if s == nil || rand.Intn(100) >= s.percent {
+		return
+	}
+
+	sid := session.Entity.ID()
+	go func() {
+		client, err := s.pool.pick()
+		if err != nil {
+			log.Debugf("mirror request to shadow server failed(%s)", err.Error())
+			return
+		}
+		if err := client.Notify(rpcKind, route.Service, route.VersionedMethod(), sid, args); err != nil {
+			log.Debugf("mirror request to shadow server failed(%s)", err.Error())
+		}
+	}()
+}
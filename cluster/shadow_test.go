@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+)
+
+type mockEntity struct {
+	id int64
+}
+
+func (e *mockEntity) ID() int64                                                        { return e.id }
+func (e *mockEntity) Send([]byte) error                                                { return nil }
+func (e *mockEntity) Push(*session.Session, string, interface{}) error                 { return nil }
+func (e *mockEntity) Response(*session.Session, interface{}) error                     { return nil }
+func (e *mockEntity) Call(*session.Session, string, interface{}, ...interface{}) error { return nil }
+func (e *mockEntity) ResponseWithCode(*session.Session, uint, interface{}) error       { return nil }
+func (e *mockEntity) Kick(*session.Session, interface{}) error                         { return nil }
+func (e *mockEntity) Close()                                                           {}
+
+func TestMirror(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	requests := make(chan *rpc.Request, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		buf := make([]byte, 0)
+		tmp := make([]byte, 512)
+		for {
+			n, err := conn.Read(tmp)
+			if err != nil {
+				return
+			}
+			buf = append(buf, tmp[:n]...)
+			req, rest, err := rpc.DecodeRequest(buf)
+			if err != nil || req == nil {
+				continue
+			}
+			buf = rest
+			requests <- req
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	SetShadow("shadow-game", &ServerConfig{Id: "shadow-game-1", Host: "127.0.0.1", Port: addr.Port}, 100)
+	defer SetShadow("shadow-game", nil, 0)
+
+	r := &route.Route{ServerType: "shadow-game", Service: "Room", Method: "Join"}
+	mirror(rpc.User, r, &session.Session{Entity: &mockEntity{id: 9}}, []byte("hello"))
+
+	select {
+	case req := <-requests:
+		if req.ServiceMethod != "Room.Join" || req.Sid != 9 || !req.Notify || string(req.Data) != "hello" {
+			t.Fatalf("unexpected mirrored request: %+v", req)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request should be mirrored to shadow server")
+	}
+}
@@ -0,0 +1,80 @@
+package cluster
+
+import (
+	"sync"
+
+	"github.com/lonnng/starx/session"
+)
+
+// RemapFunc is called when the server of a session is changed because servers
+// join or leave, the state of the session can be migrated from the old server,
+// from is empty when the old server has left
+type RemapFunc func(sid int64, from, to string)
+
+type sticky struct {
+	hash  *consistentHash
+	remap RemapFunc
+
+	sync.Mutex
+	servers map[int64]string // session id -> server id
+}
+
+// Sticky returns a strategy which routes all calls of a session to a stable
+// server, so the stateful servers can hold the state of the player, the
+// session id is hashed to the server with consistent hashing, remap is called
+// before the first call routed to a different server after topology changed,
+// the calls are routed after remap returns
+func Sticky(replicas int, remap RemapFunc) Strategy {
+	return &sticky{
+		hash:    ConsistentHash(replicas).(*consistentHash),
+		remap:   remap,
+		servers: make(map[int64]string),
+	}
+}
+
+func (s *sticky) Pick(svrIds []string, session *session.Session) string {
+	id := s.hash.Pick(svrIds, session)
+	sid := sid(session)
+
+	s.Lock()
+	from, ok := s.servers[sid]
+	s.servers[sid] = id
+	s.Unlock()
+
+	if ok && from != id && s.remap != nil {
+		if !contains(svrIds, from) {
+			from = ""
+		}
+		s.remap(sid, from, id)
+	}
+	return id
+}
+
+// forget the server of the closed session
+func (s *sticky) forget(sid int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.servers, sid)
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetSession removes the session from all sticky strategies
+func forgetSession(sid int64) {
+	strategyLock.RLock()
+	defer strategyLock.RUnlock()
+
+	for _, s := range strategies {
+		if st, ok := s.(*sticky); ok {
+			st.forget(sid)
+		}
+	}
+}
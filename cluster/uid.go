@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/route"
+)
+
+var (
+	uidPushRoute = &route.Route{Service: "__Session", Method: "PushUID"}
+	uidKickRoute = &route.Route{Service: "__Session", Method: "KickUID"}
+)
+
+// UIDMessage is the push or kick forwarded to the servers holding the sessions
+// bound to the uid
+type UIDMessage struct {
+	Uid   int64  // uid the sessions bound to
+	Route string // route of push, empty for kick
+	Data  []byte // serialized data of push, or reason of kick
+}
+
+// PushUID forwards the push to every server of the type except current
+// server, e.g: the registry of unique binding, whose backend sessions bound to
+// the uid push to the frontend servers owning the uid, it returns the first
+// error, and the push is still forwarded to the other servers
+func PushUID(svrType string, uid int64, route string, data []byte) error {
+	return forwardUID(svrType, uidPushRoute, &UIDMessage{Uid: uid, Route: route, Data: data})
+}
+
+// KickUID forwards the kick to every server of the type except current server
+// like PushUID
+func KickUID(svrType string, uid int64, reason []byte) error {
+	return forwardUID(svrType, uidKickRoute, &UIDMessage{Uid: uid, Data: reason})
+}
+
+func forwardUID(svrType string, r *route.Route, m *UIDMessage) error {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(m); err != nil {
+		return err
+	}
+
+	svrLock.RLock()
+	ids := append([]string(nil), svrTypeMaps[svrType]...)
+	svrLock.RUnlock()
+
+	var first error
+	for _, id := range ids {
+		if id == appConfig.Id {
+			continue
+		}
+		client, err := Client(id)
+		if err == nil {
+			err = client.Call(rpc.Sys, r.Service, r.Method, 0, new([]byte), buf.Bytes())
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// DecodeUIDMessage decodes the message forwarded by PushUID or KickUID
+func DecodeUIDMessage(data []byte) (*UIDMessage, error) {
+	m := &UIDMessage{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,587 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	channelTypeLock sync.RWMutex
+	channelType     string // type of the servers tracking the members of cluster channels
+)
+
+// SetClusterChannels makes the channels span the frontend servers, the
+// sessions added on frontend servers join the channel of the same name in
+// the cluster, whose members are tracked by a server of svrType picked by the
+// hash of the name, e.g: the master or a chat server. A broadcast on any
+// server is sent to every frontend server with members once, and expanded to
+// the members there. Empty svrType disables it. It should be called on all
+// servers, and the values broadcast are serialized by the default serializer
+func SetClusterChannels(svrType string) {
+	channelTypeLock.Lock()
+	defer channelTypeLock.Unlock()
+
+	channelType = svrType
+}
+
+func channelTypeOf() string {
+	channelTypeLock.RLock()
+	defer channelTypeLock.RUnlock()
+
+	return channelType
+}
+
+// track notifies the server tracking the cluster channel, only the sessions
+// of frontend server are tracked
+func (c *Channel) track(s *session.Session, notify func(string, string, *session.Session) error) {
+	svrType := channelTypeOf()
+	if svrType == "" {
+		return
+	}
+	if _, ok := s.Entity.(*agent); !ok {
+		return
+	}
+	if id, err := cluster.ChannelServer(svrType, c.name); err == nil {
+		c.seqLock.Lock()
+		c.tracker = id
+		c.seqLock.Unlock()
+	}
+	if err := notify(svrType, c.name, s); err != nil {
+		log.Errorf("track channel %s failed: %s", c.name, err.Error())
+	}
+}
+
+// reannounceChannels joins the members of current frontend server again to
+// the cluster channels moved to another server, when a server of svrType
+// registered or removed
+func reannounceChannels(svrType string) {
+	if svrType == "" || svrType != channelTypeOf() {
+		return
+	}
+	for _, name := range ChannelService.Channels() {
+		if ch, ok := ChannelService.Channel(name); ok {
+			ch.reannounce(svrType)
+		}
+	}
+}
+
+// reannounce joins the members to the server tracking the channel now, if it
+// differs from the one they joined
+func (c *Channel) reannounce(svrType string) {
+	id, err := cluster.ChannelServer(svrType, c.name)
+	if err != nil {
+		return
+	}
+	c.seqLock.Lock()
+	moved := c.tracker != "" && c.tracker != id
+	if moved {
+		c.tracker = id
+	}
+	c.seqLock.Unlock()
+	if !moved {
+		return
+	}
+
+	c.RLock()
+	sessions := make([]*session.Session, 0, len(c.uidMap))
+	for _, s := range c.uidMap {
+		sessions = append(sessions, s)
+	}
+	c.RUnlock()
+
+	log.Infof("Channel=%s moved to %s, announces %d members", c.name, id, len(sessions))
+	for _, s := range sessions {
+		if _, ok := s.Entity.(*agent); !ok {
+			continue
+		}
+		if err := cluster.JoinChannel(svrType, c.name, s); err != nil {
+			log.Errorf("announce channel %s failed: %s", c.name, err.Error())
+		}
+	}
+}
+
+// broadcastCluster sends the broadcast to the server tracking the channel
+func (c *Channel) broadcastCluster(svrType, route string, v interface{}, except []int64, from int64) error {
+	data, err := serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+	m := &cluster.ChannelMessage{Channel: c.name, Route: route, Data: data, Except: except, From: from}
+
+	id, err := cluster.ChannelServer(svrType, c.name)
+	if err != nil {
+		return err
+	}
+	if id == app.config.Id {
+		return channelMembers.broadcast(m)
+	}
+	return cluster.BroadcastChannel(id, m)
+}
+
+var (
+	multicastEpoch = strconv.FormatInt(time.Now().UnixNano(), 36) // distinguishes the multicast ids from the ones before restart
+	multicastSeq   uint64
+)
+
+// multicastCluster sends one multicast listing the channels to every server
+// tracking some of them, the copies reach a frontend server through several
+// tracking servers are expanded once
+func multicastCluster(svrType string, names []string, route string, v interface{}) error {
+	data, err := serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+	id := app.config.Id + "-" + multicastEpoch + "-" + strconv.FormatUint(atomic.AddUint64(&multicastSeq, 1), 10)
+	m := &cluster.ChannelMessage{Channels: names, Route: route, Data: data, Id: id}
+
+	trackers := make(map[string]bool)
+	for _, name := range names {
+		svrId, err := cluster.ChannelServer(svrType, name)
+		if err != nil {
+			return err
+		}
+		trackers[svrId] = true
+	}
+
+	var first error
+	for svrId := range trackers {
+		if svrId == app.config.Id {
+			err = channelMembers.multicast(m)
+		} else {
+			err = cluster.BroadcastChannel(svrId, m)
+		}
+		if err != nil {
+			log.Errorf("multicast channels %v via %s failed: %s", names, svrId, err.Error())
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+const (
+	reorderWindow = 100 * time.Millisecond // max time a broadcast waits for the earlier ones
+	reorderLimit  = 64                     // max broadcasts waiting, the missing ones are skipped beyond it
+
+	multicastWindow = 10 * time.Second // time the multicast ids expanded are remembered
+)
+
+// multicasts are the ids of the multicasts expanded recently
+var multicasts = struct {
+	sync.Mutex
+	ids   map[string]time.Time
+	swept time.Time
+}{ids: make(map[string]time.Time)}
+
+// expandMulticast pushes the multicast to the members of the channels of
+// current frontend server once, the copies of it are dropped
+func expandMulticast(m *cluster.ChannelMessage) {
+	now := time.Now()
+	multicasts.Lock()
+	if now.Sub(multicasts.swept) >= multicastWindow {
+		for id, t := range multicasts.ids {
+			if now.Sub(t) >= multicastWindow {
+				delete(multicasts.ids, id)
+			}
+		}
+		multicasts.swept = now
+	}
+	_, dup := multicasts.ids[m.Id]
+	multicasts.ids[m.Id] = now
+	multicasts.Unlock()
+	if dup {
+		return
+	}
+
+	var channels []*Channel
+	for _, name := range m.Channels {
+		if ch, ok := ChannelService.Channel(name); ok {
+			channels = append(channels, ch)
+		}
+	}
+	multicast(channels, m.Route, m.Data)
+}
+
+// expandChannel pushes the broadcast of cluster channel to the members of
+// current frontend server in the order of sequence numbers, the broadcast
+// arrived early waits for the earlier ones, and the one sent again is dropped
+func expandChannel(m *cluster.ChannelMessage) {
+	if len(m.Channels) > 0 {
+		expandMulticast(m)
+		return
+	}
+	ch, ok := ChannelService.Channel(m.Channel)
+	if !ok {
+		return
+	}
+
+	ch.seqLock.Lock()
+	defer ch.seqLock.Unlock()
+
+	if m.Seq == 0 {
+		ch.broadcast(m.Route, m.Data, m.Except, m.From)
+		return
+	}
+	// the sequence restarted by the server tracking the channel now
+	if m.Epoch != ch.epoch {
+		ch.restartSeq(m.Epoch)
+	}
+	if ch.seq != 0 && m.Seq <= ch.seq {
+		log.Debugf("Channel=%s drops broadcast Seq=%d, delivered Seq=%d", m.Channel, m.Seq, ch.seq)
+		return
+	}
+	if ch.seq != 0 && m.Seq > ch.seq+1 {
+		if ch.reorder == nil {
+			ch.reorder = make(map[uint64]*cluster.ChannelMessage)
+		}
+		ch.reorder[m.Seq] = m
+		if len(ch.reorder) > reorderLimit {
+			ch.skipGap()
+		}
+		ch.armReorder()
+		return
+	}
+	ch.expandInOrder(m)
+}
+
+// expandInOrder expands the broadcast in sequence, and the ones waiting for
+// it, it should be called with seqLock held
+func (c *Channel) expandInOrder(m *cluster.ChannelMessage) {
+	for m != nil {
+		c.seq = m.Seq
+		c.broadcast(m.Route, m.Data, m.Except, m.From)
+		m = c.reorder[c.seq+1]
+		delete(c.reorder, c.seq+1)
+	}
+	if len(c.reorder) == 0 && c.reorderTimer != nil {
+		c.reorderTimer.Stop()
+		c.reorderTimer = nil
+	}
+}
+
+// skipGap gives up the missing broadcasts, and expands the earliest one
+// waiting, it should be called with seqLock held
+func (c *Channel) skipGap() {
+	var next *cluster.ChannelMessage
+	for _, m := range c.reorder {
+		if next == nil || m.Seq < next.Seq {
+			next = m
+		}
+	}
+	if next == nil {
+		return
+	}
+	delete(c.reorder, next.Seq)
+	log.Warnf("Channel=%s skips missing broadcasts Seq=%d-%d", c.name, c.seq+1, next.Seq-1)
+	c.expandInOrder(next)
+}
+
+// armReorder starts the timer skipping the missing broadcasts, when some
+// broadcasts are waiting for them, it should be called with seqLock held
+func (c *Channel) armReorder() {
+	if len(c.reorder) == 0 || c.reorderTimer != nil {
+		return
+	}
+	var t *time.Timer
+	t = time.AfterFunc(reorderWindow, func() {
+		c.seqLock.Lock()
+		defer c.seqLock.Unlock()
+
+		if c.reorderTimer != t {
+			return
+		}
+		c.reorderTimer = nil
+		c.skipGap()
+		c.armReorder()
+	})
+	c.reorderTimer = t
+}
+
+// restartSeq forgets the sequence and the broadcasts waiting, it should be
+// called with seqLock held
+func (c *Channel) restartSeq(epoch int64) {
+	c.seq, c.epoch, c.reorder = 0, epoch, nil
+	if c.reorderTimer != nil {
+		c.reorderTimer.Stop()
+		c.reorderTimer = nil
+	}
+}
+
+// Seq returns the sequence number of the last cluster broadcast delivered,
+// which is assigned by the server tracking the channel, so the members on
+// all frontend servers observe the broadcasts in the same order, e.g: for
+// authoritative chat logs and turn announcements. It is reset when the
+// channel of current server becomes empty
+func (c *Channel) Seq() uint64 {
+	c.seqLock.Lock()
+	defer c.seqLock.Unlock()
+
+	return c.seq
+}
+
+// resetSeq forgets the sequence number when the channel becomes empty, the
+// server tracking it restarts the sequence when all members left
+func (c *Channel) resetSeq() {
+	c.seqLock.Lock()
+	defer c.seqLock.Unlock()
+
+	if c.Count() == 0 {
+		c.restartSeq(0)
+	}
+}
+
+// channelRegistry tracks the members of cluster channels by their frontend
+// servers, on the servers of channel type
+type channelRegistry struct {
+	sync.RWMutex
+	channels map[string]map[string]map[int64]*session.Session // channel -> frontend server id -> backend session id -> session
+	orders   map[string]*channelOrder                         // channel -> order of broadcasts
+}
+
+// channelOrder sequences the broadcasts of a cluster channel, which are sent
+// to all frontend servers with the lock held, so that every frontend server
+// receives them in the same order
+type channelOrder struct {
+	sync.Mutex
+	seq    uint64
+	epoch  int64                // distinguishes the sequence from the ones restarted
+	routes map[string]*acceptor // frontend server id -> connection the broadcasts sent through
+}
+
+var channelMembers = &channelRegistry{
+	channels: make(map[string]map[string]map[int64]*session.Session),
+	orders:   make(map[string]*channelOrder),
+}
+
+func (r *channelRegistry) join(name, frontend string, s *session.Session) {
+	r.Lock()
+	defer r.Unlock()
+
+	servers, ok := r.channels[name]
+	if !ok {
+		servers = make(map[string]map[int64]*session.Session)
+		r.channels[name] = servers
+	}
+	members, ok := servers[frontend]
+	if !ok {
+		members = make(map[int64]*session.Session)
+		servers[frontend] = members
+	}
+	members[s.ID] = s
+}
+
+func (r *channelRegistry) leave(name, frontend string, s *session.Session) {
+	r.Lock()
+	defer r.Unlock()
+
+	servers := r.channels[name]
+	delete(servers[frontend], s.ID)
+	if len(servers[frontend]) == 0 {
+		delete(servers, frontend)
+	}
+	if len(servers) == 0 {
+		delete(r.channels, name)
+		delete(r.orders, name)
+	}
+}
+
+// forget removes the closed session from all channels
+func (r *channelRegistry) forget(s *session.Session) {
+	r.Lock()
+	defer r.Unlock()
+
+	for name, servers := range r.channels {
+		for frontend, members := range servers {
+			if members[s.ID] != s {
+				continue
+			}
+			delete(members, s.ID)
+			if len(members) == 0 {
+				delete(servers, frontend)
+			}
+		}
+		if len(servers) == 0 {
+			delete(r.channels, name)
+			delete(r.orders, name)
+		}
+	}
+}
+
+// broadcast sends the broadcast to every frontend server with members once,
+// through the connection of any member, in the order of sequence numbers
+func (r *channelRegistry) broadcast(m *cluster.ChannelMessage) error {
+	r.Lock()
+	if _, ok := r.channels[m.Channel]; !ok {
+		r.Unlock()
+		log.Debugf("Channel=%s has no members tracked, broadcast dropped", m.Channel)
+		return nil
+	}
+	order, ok := r.orders[m.Channel]
+	if !ok {
+		order = &channelOrder{epoch: time.Now().UnixNano(), routes: make(map[string]*acceptor)}
+		r.orders[m.Channel] = order
+	}
+	r.Unlock()
+
+	order.Lock()
+	defer order.Unlock()
+
+	order.seq++
+	m.Seq, m.Epoch = order.seq, order.epoch
+	data, err := cluster.EncodeChannelMessage(m)
+	if err != nil {
+		return err
+	}
+
+	r.RLock()
+	targets := make(map[string][]*acceptor)
+	for frontend, members := range r.channels[m.Channel] {
+		var acceptors []*acceptor
+		for _, s := range members {
+			if ac, ok := s.Entity.(*acceptor); ok {
+				acceptors = append(acceptors, ac)
+			}
+		}
+		targets[frontend] = acceptors
+	}
+	r.RUnlock()
+
+	for frontend := range order.routes {
+		if _, ok := targets[frontend]; !ok {
+			delete(order.routes, frontend)
+		}
+	}
+	var first error
+	for frontend, acceptors := range targets {
+		if err := order.send(frontend, acceptors, data); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// multicast sends the multicast to every frontend server with members of any
+// channel listed once, the channels tracked by other servers are skipped
+func (r *channelRegistry) multicast(m *cluster.ChannelMessage) error {
+	data, err := cluster.EncodeChannelMessage(m)
+	if err != nil {
+		return err
+	}
+
+	r.RLock()
+	targets := make(map[string][]*acceptor)
+	for _, name := range m.Channels {
+		for frontend, members := range r.channels[name] {
+			for _, s := range members {
+				if ac, ok := s.Entity.(*acceptor); ok {
+					targets[frontend] = append(targets[frontend], ac)
+				}
+			}
+		}
+	}
+	r.RUnlock()
+
+	var first error
+	for _, acceptors := range targets {
+		for _, ac := range acceptors {
+			if err = ac.broadcast(data); err == nil {
+				break
+			}
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// send sends the broadcast to the frontend server, through the connection of
+// the last broadcast, so the broadcasts arrive in order when the frontend
+// server connects with several connections, another connection is picked
+// from the members only when it failed
+func (o *channelOrder) send(frontend string, acceptors []*acceptor, data []byte) error {
+	if ac, ok := o.routes[frontend]; ok {
+		if ac.broadcast(data) == nil {
+			return nil
+		}
+		delete(o.routes, frontend)
+	}
+	var err error
+	for _, ac := range acceptors {
+		if err = ac.broadcast(data); err == nil {
+			o.routes[frontend] = ac
+			return nil
+		}
+	}
+	return err
+}
+
+// trackChannel adds the session to or removes it from the cluster channel,
+// which is notified by the frontend server
+func trackChannel(ac *acceptor, s *session.Session, rr *rpc.Request) {
+	if err := rr.DecodeData(); err != nil {
+		log.Errorf(err.Error())
+		return
+	}
+	frontend := rr.Caller
+	if frontend == "" {
+		frontend = "acceptor-" + strconv.FormatInt(ac.id, 10)
+	}
+	if rr.ServiceMethod == channelJoinRoute {
+		channelMembers.join(string(rr.Data), frontend, s)
+	} else {
+		channelMembers.leave(string(rr.Data), frontend, s)
+	}
+}
+
+// forwardedBroadcast sends the broadcast of the cluster channel tracked by
+// current server, which is forwarded by other servers
+func forwardedBroadcast(rr *rpc.Request) *rpc.Response {
+	response := newResponse(rr)
+	var m *cluster.ChannelMessage
+	err := rr.DecodeData()
+	if err == nil {
+		m, err = cluster.DecodeChannelMessage(rr.Data)
+	}
+	if err != nil {
+		response.SetError(&rpc.Error{Code: rpc.CodeInvalidArgument, Message: err.Error()})
+		return response
+	}
+	if len(m.Channels) > 0 {
+		err = channelMembers.multicast(m)
+	} else {
+		err = channelMembers.broadcast(m)
+	}
+	if err != nil {
+		response.SetError(err)
+	}
+	return response
+}
@@ -0,0 +1,337 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+func TestClusterChannel_Registry(t *testing.T) {
+	conn, peer := net.Pipe()
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	rs := newRemote()
+	for _, sid := range []int64{31, 32} {
+		rr := &rpc.Request{Kind: rpc.Sys, ServiceMethod: channelJoinRoute, Sid: sid, Notify: true, Caller: "connector-1", Data: []byte("world")}
+		if response := rs.handleRequest(ac, rr); response != nil {
+			t.Fatalf("join should not be responded: %+v", response)
+		}
+	}
+
+	m := &cluster.ChannelMessage{Channel: "world", Route: "onNotice", Data: []byte("hi"), Except: []int64{31}}
+	data, err := cluster.EncodeChannelMessage(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go rs.handleRequest(ac, &rpc.Request{Kind: rpc.Sys, ServiceMethod: channelBroadcastRoute, Data: data})
+
+	select {
+	case resp := <-client.ResponseChan:
+		got, err := cluster.DecodeChannelMessage(resp.Data)
+		if resp.Kind != rpc.HandlerBroadcast || err != nil || got.Route != "onNotice" || len(got.Except) != 1 {
+			t.Fatalf("unexpected broadcast %v, err=%v", resp.Kind, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("broadcast should be sent to the frontend server")
+	}
+	select {
+	case resp := <-client.ResponseChan:
+		t.Fatalf("broadcast should be sent to a frontend server once, got %v", resp.Kind)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the broadcasts are sequenced by the server tracking the channel
+	for seq := uint64(2); seq <= 3; seq++ {
+		go channelMembers.broadcast(&cluster.ChannelMessage{Channel: "world", Route: "onNotice"})
+		select {
+		case resp := <-client.ResponseChan:
+			if got, err := cluster.DecodeChannelMessage(resp.Data); err != nil || got.Seq != seq {
+				t.Fatalf("expect Seq=%d, got %+v, err=%v", seq, got, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("broadcast should be sent to the frontend server")
+		}
+	}
+
+	// the closed sessions leave the channel
+	transporter.closeSession(ac.Session(31), CloseByFrontend)
+	transporter.closeSession(ac.Session(32), CloseByFrontend)
+	if _, ok := channelMembers.channels["world"]; ok {
+		t.Fatal("channel without members should be forgotten")
+	}
+}
+
+func TestClusterChannel_Expand(t *testing.T) {
+	c := ChannelService.NewChannel("test_expand")
+	defer c.Destroy()
+
+	var agents []*agent
+	for i := 0; i < 2; i++ {
+		conn, peer := net.Pipe()
+		defer peer.Close()
+		a := transporter.createAgent(conn)
+		defer a.closeWith(CloseDisconnected)
+		a.session.Uid = int64(i + 1)
+		c.Add(a.session)
+		agents = append(agents, a)
+	}
+
+	expandChannel(&cluster.ChannelMessage{Channel: "test_expand", Route: "onNotice", Data: []byte("hi"), Except: []int64{agents[0].session.ID}})
+	select {
+	case <-agents[0].sendBuffer:
+		t.Fatal("the excluded session should not be pushed")
+	default:
+	}
+	select {
+	case data := <-agents[1].sendBuffer:
+		if !bytes.Contains(data, []byte("hi")) {
+			t.Fatalf("unexpected push: %q", data)
+		}
+	default:
+		t.Fatal("broadcast should be expanded to the members")
+	}
+}
+
+func TestClusterChannel_Multicast(t *testing.T) {
+	conn, peer := net.Pipe()
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	rs := newRemote()
+	for sid, name := range map[int64]string{41: "multicast1", 42: "multicast2"} {
+		rr := &rpc.Request{Kind: rpc.Sys, ServiceMethod: channelJoinRoute, Sid: sid, Notify: true, Caller: "connector-1", Data: []byte(name)}
+		rs.handleRequest(ac, rr)
+	}
+	defer transporter.closeSession(ac.Session(41), CloseByFrontend)
+	defer transporter.closeSession(ac.Session(42), CloseByFrontend)
+
+	m := &cluster.ChannelMessage{Channels: []string{"multicast1", "multicast2"}, Route: "onNotice", Data: []byte("hi"), Id: "multicast-1"}
+	data, err := cluster.EncodeChannelMessage(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go rs.handleRequest(ac, &rpc.Request{Kind: rpc.Sys, ServiceMethod: channelBroadcastRoute, Data: data})
+
+	select {
+	case resp := <-client.ResponseChan:
+		got, err := cluster.DecodeChannelMessage(resp.Data)
+		if err != nil || len(got.Channels) != 2 || got.Id != "multicast-1" {
+			t.Fatalf("unexpected multicast %+v, err=%v", got, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("multicast should be sent to the frontend server")
+	}
+	select {
+	case resp := <-client.ResponseChan:
+		t.Fatalf("multicast should be sent to a frontend server once, got %v", resp.Kind)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestClusterChannel_BroadcastAccessController(t *testing.T) {
+	conn, peer := net.Pipe()
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	rs := newRemote()
+	rr := &rpc.Request{Kind: rpc.Sys, ServiceMethod: channelJoinRoute, Sid: 43, Notify: true, Caller: "connector-1", Data: []byte("denied1")}
+	rs.handleRequest(ac, rr)
+	defer transporter.closeSession(ac.Session(43), CloseByFrontend)
+
+	rs.access = rpc.AccessControllerFunc(func(kind rpc.RpcKind, serviceMethod string, sid int64, p *rpc.Peer) error {
+		return rpc.Errorf(rpc.CodePermissionDenied, "%s is not allowed", serviceMethod)
+	})
+	data, err := cluster.EncodeChannelMessage(&cluster.ChannelMessage{Channel: "denied1", Route: "onNotice", Data: []byte("hi")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := rs.handleRequest(ac, &rpc.Request{Kind: rpc.Sys, ServiceMethod: channelBroadcastRoute, Data: data})
+	if response.ErrorCode != rpc.CodePermissionDenied {
+		t.Fatalf("broadcast should be checked by access controller, got %d", response.ErrorCode)
+	}
+	select {
+	case resp := <-client.ResponseChan:
+		t.Fatalf("denied broadcast should not be sent, got %v", resp.Kind)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestClusterChannel_ExpandMulticast(t *testing.T) {
+	room1 := ChannelService.NewChannel("test_expand_multicast1")
+	defer room1.Destroy()
+	room2 := ChannelService.NewChannel("test_expand_multicast2")
+	defer room2.Destroy()
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := transporter.createAgent(conn)
+	defer a.closeWith(CloseDisconnected)
+	a.session.Uid = 1
+	room1.Add(a.session)
+	room2.Add(a.session)
+
+	// the copies sent by two tracking servers, the id is unique to every run
+	// as the ids expanded are remembered by the process
+	id := fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+	for i := 0; i < 2; i++ {
+		expandChannel(&cluster.ChannelMessage{Channels: []string{room1.name, room2.name}, Route: "onNotice", Data: []byte("hi"), Id: id})
+	}
+	if len(a.sendBuffer) != 1 {
+		t.Fatalf("multicast should be expanded once, got %d pushes", len(a.sendBuffer))
+	}
+	if room1.BroadcastStats().Delivered != 1 || room2.BroadcastStats().Broadcasts != 1 {
+		t.Fatalf("fanout should be recorded, got %+v %+v", room1.BroadcastStats(), room2.BroadcastStats())
+	}
+}
+
+func TestClusterChannel_Seq(t *testing.T) {
+	c := ChannelService.NewChannel("test_seq")
+	defer c.Destroy()
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := transporter.createAgent(conn)
+	defer a.closeWith(CloseDisconnected)
+	a.session.Uid = 1
+	c.Add(a.session)
+
+	for _, seq := range []uint64{2, 1, 2, 3} {
+		expandChannel(&cluster.ChannelMessage{Channel: "test_seq", Route: "onNotice", Data: []byte("hi"), Seq: seq})
+	}
+	if len(a.sendBuffer) != 2 {
+		t.Fatalf("the broadcasts delivered should be dropped, expect 2 pushes, got %d", len(a.sendBuffer))
+	}
+	if c.Seq() != 3 {
+		t.Fatalf("expect Seq=3, got %d", c.Seq())
+	}
+
+	c.Leave(1)
+	if c.Seq() != 0 {
+		t.Fatal("sequence should be reset when the channel becomes empty")
+	}
+}
+
+func TestClusterChannel_Reorder(t *testing.T) {
+	c := ChannelService.NewChannel("test_reorder")
+	defer c.Destroy()
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := transporter.createAgent(conn)
+	defer a.closeWith(CloseDisconnected)
+	a.session.Uid = 1
+	c.Add(a.session)
+
+	expand := func(seq uint64, epoch int64) {
+		data := []byte{'#', byte('0' + seq)}
+		expandChannel(&cluster.ChannelMessage{Channel: "test_reorder", Route: "onNotice", Data: data, Seq: seq, Epoch: epoch})
+	}
+	expect := func(seqs ...uint64) {
+		for _, seq := range seqs {
+			select {
+			case data := <-a.sendBuffer:
+				if !bytes.Contains(data, []byte{'#', byte('0' + seq)}) {
+					t.Fatalf("expect broadcast Seq=%d, got %q", seq, data)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("broadcast Seq=%d should be expanded", seq)
+			}
+		}
+		if len(a.sendBuffer) != 0 {
+			t.Fatalf("unexpected %d pushes", len(a.sendBuffer))
+		}
+	}
+
+	// the broadcast arrived early waits for the earlier one
+	expand(1, 1)
+	expand(3, 1)
+	expand(2, 1)
+	expect(1, 2, 3)
+
+	// the missing broadcast is skipped after the window
+	expand(5, 1)
+	if len(a.sendBuffer) != 0 {
+		t.Fatal("broadcast should wait for the missing one")
+	}
+	expect(5)
+
+	// the sequence restarted by another server tracking the channel
+	expand(1, 2)
+	expect(1)
+	if c.Seq() != 1 {
+		t.Fatalf("expect Seq=1, got %d", c.Seq())
+	}
+}
+
+func TestClusterChannel_Route(t *testing.T) {
+	var clients []*rpc.Client
+	rs := newRemote()
+	for _, sid := range []int64{41, 42, 43} {
+		conn, peer := net.Pipe()
+		ac := transporter.createAcceptor(conn)
+		defer transporter.removeAcceptor(ac)
+		client := rpc.NewClient(peer)
+		defer client.Close()
+		clients = append(clients, client)
+
+		// the members of a frontend server joined through several connections
+		rr := &rpc.Request{Kind: rpc.Sys, ServiceMethod: channelJoinRoute, Sid: sid, Notify: true, Caller: "connector-1", Data: []byte("route")}
+		rs.handleRequest(ac, rr)
+	}
+	defer func() {
+		channelMembers.Lock()
+		delete(channelMembers.channels, "route")
+		delete(channelMembers.orders, "route")
+		channelMembers.Unlock()
+	}()
+
+	received := make(map[*rpc.Client]int)
+	for i := 0; i < 10; i++ {
+		go channelMembers.broadcast(&cluster.ChannelMessage{Channel: "route", Route: "onNotice"})
+		select {
+		case <-clients[0].ResponseChan:
+			received[clients[0]]++
+		case <-clients[1].ResponseChan:
+			received[clients[1]]++
+		case <-clients[2].ResponseChan:
+			received[clients[2]]++
+		case <-time.After(time.Second):
+			t.Fatal("broadcast should be sent to the frontend server")
+		}
+	}
+	if len(received) != 1 {
+		t.Fatalf("broadcasts should be sent through one connection, got %v", received)
+	}
+}
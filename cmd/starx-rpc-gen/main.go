@@ -0,0 +1,367 @@
+// Command starx-rpc-gen generates static dispatch stubs for the remote methods
+// of starx components, the stubs deserialize arguments and call the methods
+// directly, so the server avoids reflect.Value.Call on the hot path.
+//
+// Usage:
+//
+//	starx-rpc-gen -type Room,Manager [-dir .] [-output starx_stub.go]
+//
+// Or with go generate:
+//
+//	//go:generate starx-rpc-gen -type Room
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const defaultOutput = "starx_stub.go"
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of component type names; must be set")
+	dir       = flag.String("dir", ".", "directory of the package")
+	output    = flag.String("output", defaultOutput, "output file name")
+)
+
+// param is a parameter of remote method
+type param struct {
+	Type string // type expression of the parameter
+	Ptr  bool   // whether the parameter is a pointer
+}
+
+// Elem returns the type expression of the element of pointer parameter
+func (p param) Elem() string {
+	return strings.TrimPrefix(p.Type, "*")
+}
+
+type method struct {
+	Name    string
+	Params  []param
+	Imports map[string]string // imports used by parameters, name => path
+}
+
+type component struct {
+	Name    string
+	Methods []method
+}
+
+// stubImport is an import of the generated file, the name is empty when the
+// package is imported by its own name
+type stubImport struct {
+	Name string
+	Path string
+}
+
+// stubPackages are the packages used by the stubs, name => path, they are
+// imported with the prefix "starx" when a parameter package takes the name
+var stubPackages = map[string]string{
+	"rpc":       "github.com/lonnng/starx/cluster/rpc",
+	"component": "github.com/lonnng/starx/component",
+	"serialize": "github.com/lonnng/starx/serialize",
+}
+
+// streamTypes are the parameter types of stream methods, import path => type
+// name, which are dispatched by reflection
+var streamTypes = map[string]string{
+	"github.com/lonnng/starx":             "Stream",
+	"github.com/lonnng/starx/cluster/rpc": "BidiStream",
+}
+
+func main() {
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, err := generate(*dir, strings.Split(*typeNames, ","), *output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "starx-rpc-gen:", err)
+		os.Exit(1)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(*dir, *output), data, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "starx-rpc-gen:", err)
+		os.Exit(1)
+	}
+}
+
+// generate parses the package in dir, and returns the stubs source of the
+// named types
+func generate(dir string, names []string, output string) ([]byte, error) {
+	fset := token.NewFileSet()
+	filter := func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != output
+	}
+	pkgs, err := parser.ParseDir(fset, dir, filter, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expect one package in %s, got %d", dir, len(pkgs))
+	}
+
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+	return generatePackage(pkg, names)
+}
+
+func generatePackage(pkg *ast.Package, names []string) ([]byte, error) {
+	comps := make([]component, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		methods := remoteMethods(pkg, name)
+		if len(methods) == 0 {
+			return nil, fmt.Errorf("type %s has no remote methods", name)
+		}
+		comps = append(comps, component{Name: name, Methods: methods})
+	}
+	if len(comps) == 0 {
+		return nil, errors.New("no type specified")
+	}
+
+	imports := make(map[string]string)
+	for _, c := range comps {
+		for _, m := range c.Methods {
+			for name, path := range m.Imports {
+				imports[name] = path
+			}
+		}
+	}
+
+	// the stub packages imported by parameters are imported once, and they
+	// are renamed when the names are taken by other packages
+	aliases := make(map[string]string)
+	var stubImports []stubImport
+	for name, path := range stubPackages {
+		aliases[name] = name
+		if p, ok := imports[name]; ok {
+			if p == path {
+				delete(imports, name)
+			} else {
+				aliases[name] = "starx" + name
+				stubImports = append(stubImports, stubImport{Name: aliases[name], Path: path})
+				continue
+			}
+		}
+		stubImports = append(stubImports, stubImport{Path: path})
+	}
+	for name, path := range imports {
+		stubImports = append(stubImports, stubImport{Name: name, Path: path})
+	}
+	sort.Slice(stubImports, func(i, j int) bool { return stubImports[i].Path < stubImports[j].Path })
+
+	buf := &bytes.Buffer{}
+	if err := stubTemplate.Execute(buf, struct {
+		Package    string
+		Imports    []stubImport
+		RPC        string
+		Component  string
+		Serialize  string
+		Components []component
+	}{pkg.Name, stubImports, aliases["rpc"], aliases["component"], aliases["serialize"], comps}); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// remoteMethods returns the methods of the named type, which are suitable
+// remote methods, stream methods are ignored and still dispatched by
+// reflection
+func remoteMethods(pkg *ast.Package, name string) []method {
+	var methods []method
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || !fn.Name.IsExported() {
+				continue
+			}
+			if receiverName(fn.Recv.List[0].Type) != name {
+				continue
+			}
+			if m, ok := remoteMethod(file, fn); ok {
+				methods = append(methods, m)
+			}
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+	return methods
+}
+
+func receiverName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// remoteMethod reports whether the method returns (reply, error), and all
+// arguments can be transferred from the caller
+func remoteMethod(file *ast.File, fn *ast.FuncDecl) (method, bool) {
+	results := fn.Type.Results
+	if results == nil || results.NumFields() != 2 {
+		return method{}, false
+	}
+	fields := results.List
+	if len(fields) == 1 {
+		// (a, b T) never matches (reply, error)
+		return method{}, false
+	}
+	if isError(fields[0].Type) || !isError(fields[1].Type) {
+		return method{}, false
+	}
+
+	m := method{Name: fn.Name.Name, Imports: make(map[string]string)}
+	for _, field := range fn.Type.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			return method{}, false
+		}
+		if isStream(file, field.Type) {
+			return method{}, false
+		}
+		typ := types.ExprString(field.Type)
+		for _, pkg := range packageNames(field.Type) {
+			path, ok := importPath(file, pkg)
+			if !ok {
+				return method{}, false
+			}
+			m.Imports[pkg] = path
+		}
+		_, ptr := field.Type.(*ast.StarExpr)
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			m.Params = append(m.Params, param{Type: typ, Ptr: ptr})
+		}
+	}
+	return m, true
+}
+
+func isError(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == "error"
+}
+
+// isStream reports whether the type expression is a pointer to a stream type,
+// the package is matched by its import path, so the types of other packages
+// named like streams are not mistaken
+func isStream(file *ast.File, expr ast.Expr) bool {
+	star, ok := expr.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	path, ok := importPath(file, ident.Name)
+	return ok && streamTypes[path] == sel.Sel.Name
+}
+
+// packageNames returns the names of packages referred by the type expression
+func packageNames(expr ast.Expr) []string {
+	var names []string
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				names = append(names, ident.Name)
+			}
+			return false
+		}
+		return true
+	})
+	return names
+}
+
+// importPath returns the path of the package imported as name in the file
+func importPath(file *ast.File, name string) (string, bool) {
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		if spec.Name != nil {
+			if spec.Name.Name == name {
+				return path, true
+			}
+			continue
+		}
+		if path == name || strings.HasSuffix(path, "/"+name) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+var stubTemplate = template.Must(template.New("stub").Parse(`// Code generated by starx-rpc-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	{{- range .Imports}}
+	{{if .Name}}{{.Name}} {{end}}"{{.Path}}"
+	{{- end}}
+)
+{{range $c := .Components}}
+// StarxStubMethods implements component.RemoteStub
+func (c *{{$c.Name}}) StarxStubMethods() []string {
+	return []string{ {{- range $c.Methods}}"{{.Name}}", {{end -}} }
+}
+
+// StarxDispatch implements component.RemoteStub
+func (c *{{$c.Name}}) StarxDispatch(method string, seri {{$.Serialize}}.Serializer, args [][]byte) (interface{}, error) {
+	switch method {
+	{{- range $c.Methods}}
+	case "{{.Name}}":
+		if len(args) != {{len .Params}} {
+			return nil, {{$.RPC}}.Errorf({{$.RPC}}.CodeInvalidArgument, "remote: method needs %d arguments, but got %d", {{len .Params}}, len(args))
+		}
+		{{- range $i, $p := .Params}}
+		{{- if $p.Ptr}}
+		a{{$i}} := new({{$p.Elem}})
+		if err := seri.Deserialize(args[{{$i}}], a{{$i}}); err != nil {
+			return nil, &{{$.RPC}}.Error{Code: {{$.RPC}}.CodeInvalidArgument, Message: err.Error()}
+		}
+		{{- else}}
+		var a{{$i}} {{$p.Type}}
+		if err := seri.Deserialize(args[{{$i}}], &a{{$i}}); err != nil {
+			return nil, &{{$.RPC}}.Error{Code: {{$.RPC}}.CodeInvalidArgument, Message: err.Error()}
+		}
+		{{- end}}
+		{{- end}}
+		reply, err := c.{{.Name}}({{range $i, $p := .Params}}{{if $i}}, {{end}}a{{$i}}{{end}})
+		return reply, err
+	{{- end}}
+	}
+	return nil, {{$.Component}}.ErrNoStubMethod
+}
+{{end}}`))
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+const source = `package room
+
+import (
+	"github.com/lonnng/starx"
+	"github.com/lonnng/starx/cluster/rpc"
+	pb "github.com/lonnng/starx/examples/proto"
+)
+
+type Room struct{}
+
+type Args struct{ Name string }
+
+func (r *Room) Join(uid int64, args *Args) (interface{}, error) { return nil, nil }
+
+func (r *Room) Kick(a, b string, msg *pb.Message) (*pb.Reply, error) { return nil, nil }
+
+func (r *Room) Watch(uid int64, stream *starx.Stream) (interface{}, error) { return nil, nil }
+
+func (r *Room) Chat(stream *rpc.BidiStream) (interface{}, error) { return nil, nil }
+
+func (r *Room) Replay(events *pb.EventStream) (interface{}, error) { return nil, nil }
+
+func (r *Room) Broadcast(msg string) error { return nil }
+
+func (r *Room) members() (interface{}, error) { return nil, nil }
+
+func (r *Room) Errors() (error, error) { return nil, nil }
+`
+
+func TestGeneratePackage(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "room.go", source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := &ast.Package{Name: "room", Files: map[string]*ast.File{"room.go": file}}
+
+	data, err := generatePackage(pkg, []string{"Room"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(data)
+
+	for _, s := range []string{
+		`pb "github.com/lonnng/starx/examples/proto"`,
+		`return []string{"Join", "Kick", "Replay"}`,
+		`var a0 int64`,
+		`a1 := new(Args)`,
+		`a2 := new(pb.Message)`,
+		`reply, err := c.Join(a0, a1)`,
+		`reply, err := c.Kick(a0, a1, a2)`,
+		`a0 := new(pb.EventStream)`,
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("generated code should contain %q:\n%s", s, code)
+		}
+	}
+	for _, s := range []string{"Watch", "Chat", "Broadcast", "members", "Errors"} {
+		if strings.Contains(code, s) {
+			t.Fatalf("method %s should not be generated:\n%s", s, code)
+		}
+	}
+
+	if _, err := generatePackage(pkg, []string{"Args"}); err == nil {
+		t.Fatal("type without remote methods should fail")
+	}
+}
+
+const collideSource = `package game
+
+import (
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/serialize"
+	rpc "example.com/game/rpc"
+)
+
+type Hall struct{}
+
+func (h *Hall) Enter(opts *component.Options, mode serialize.Mode, req *rpc.Request) (interface{}, error) {
+	return nil, nil
+}
+`
+
+func TestGeneratePackage_Imports(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "hall.go", collideSource, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := &ast.Package{Name: "game", Files: map[string]*ast.File{"hall.go": file}}
+
+	data, err := generatePackage(pkg, []string{"Hall"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(data)
+
+	// the stub packages are imported once, and renamed when the name is
+	// taken by another package
+	for path, n := range map[string]int{
+		`"github.com/lonnng/starx/component"`:   1,
+		`"github.com/lonnng/starx/serialize"`:   1,
+		`"github.com/lonnng/starx/cluster/rpc"`: 1,
+		`"example.com/game/rpc"`:                1,
+	} {
+		if c := strings.Count(code, path); c != n {
+			t.Fatalf("%s should be imported %d times, got %d:\n%s", path, n, c, code)
+		}
+	}
+	for _, s := range []string{
+		`starxrpc "github.com/lonnng/starx/cluster/rpc"`,
+		`rpc "example.com/game/rpc"`,
+		`a2 := new(rpc.Request)`,
+		`starxrpc.Errorf(starxrpc.CodeInvalidArgument`,
+		`component.ErrNoStubMethod`,
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("generated code should contain %q:\n%s", s, code)
+		}
+	}
+}
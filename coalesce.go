@@ -0,0 +1,84 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+)
+
+// maxBatchSize is the max bytes of the pushes coalesced, the batch is
+// flushed immediately when exceeded
+const maxBatchSize = 64 * 1024
+
+// SetPushCoalescing enables accumulating the pushes to a client, and flushing
+// them every interval in one write, which reduces the syscalls and packets
+// for high-frequency state updates, the other packets, e.g: responses, are
+// written immediately with the pushes accumulated before them, zero disables
+// it, it should be called before server started
+func SetPushCoalescing(interval time.Duration) {
+	env.coalesceInterval = interval
+}
+
+// pushBatch accumulates the pushes to a client, the packets are kept in
+// plain text until written
+type pushBatch struct {
+	sync.Mutex
+	packets [][]byte
+	size    int
+}
+
+// add returns the packets to write now in order, or nil when the packet is
+// accumulated
+func (b *pushBatch) add(data []byte) [][]byte {
+	b.Lock()
+	defer b.Unlock()
+
+	if isPush(data) && b.size+len(data) <= maxBatchSize {
+		b.packets = append(b.packets, data)
+		b.size += len(data)
+		return nil
+	}
+	packets := append(b.packets, data)
+	b.packets, b.size = nil, 0
+	return packets
+}
+
+// take returns the pushes accumulated
+func (b *pushBatch) take() [][]byte {
+	b.Lock()
+	defer b.Unlock()
+
+	packets := b.packets
+	b.packets, b.size = nil, 0
+	return packets
+}
+
+func isPush(data []byte) bool {
+	if len(data) <= packet.HeadLength || data[0] != packet.Data {
+		return false
+	}
+	flag := data[packet.HeadLength]
+	return message.MessageType((flag>>1)&0x07) == message.Push
+}
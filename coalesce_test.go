@@ -0,0 +1,67 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+)
+
+func encodePacket(t *testing.T, m *message.Message) []byte {
+	data, err := message.Encode(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := packet.Pack(&packet.Packet{Type: packet.Data, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPushBatch(t *testing.T) {
+	push1 := encodePacket(t, &message.Message{Type: message.Push, Route: "onMove", Data: []byte("1")})
+	push2 := encodePacket(t, &message.Message{Type: message.Push, Route: "onMove", Data: []byte("2")})
+	resp := encodePacket(t, &message.Message{Type: message.Response, ID: 3, Data: []byte("ok")})
+
+	var b pushBatch
+	if b.add(push1) != nil || b.add(push2) != nil {
+		t.Fatal("pushes should be accumulated")
+	}
+	if data := bytes.Join(b.take(), nil); !bytes.Equal(data, append(append([]byte{}, push1...), push2...)) {
+		t.Fatal("pushes should be flushed in one batch")
+	}
+
+	// response is written with the pushes before it in order
+	b.add(push1)
+	if data := bytes.Join(b.add(resp), nil); !bytes.Equal(data, append(append([]byte{}, push1...), resp...)) {
+		t.Fatal("response should be written after the pushes accumulated")
+	}
+	if len(b.take()) != 0 {
+		t.Fatal("batch should be empty after written")
+	}
+	if data := bytes.Join(b.add(heartbeatPacket), nil); !bytes.Equal(data, heartbeatPacket) {
+		t.Fatal("heartbeat should be written immediately")
+	}
+}
@@ -0,0 +1,62 @@
+package component
+
+import (
+	"reflect"
+	"sort"
+)
+
+// MethodInfo describes a registered method
+type MethodInfo struct {
+	Name   string   // method name
+	Remote bool     // whether the method is a remote method, or a handler method
+	Args   []string // type names of arguments
+	Reply  string   // type name of reply, empty for handler methods
+	Calls  uint     // completed calls
+}
+
+// ServiceInfo describes a registered service and its methods
+type ServiceInfo struct {
+	Name    string       // name of service
+	Version string       // version of service, empty for unversioned
+	Methods []MethodInfo // methods sorted by name, handler methods first
+}
+
+// Info returns the description of the service
+func (s *Service) Info() ServiceInfo {
+	info := ServiceInfo{Name: s.Name, Version: s.Version}
+	handlers := make([]MethodInfo, 0, len(s.HandlerMethods))
+	for name, m := range s.HandlerMethods {
+		handlers = append(handlers, MethodInfo{
+			Name:  name,
+			Args:  argTypes(m.Method.Type),
+			Calls: m.NumCalls(),
+		})
+	}
+	remotes := make([]MethodInfo, 0, len(s.RemoteMethods))
+	for name, m := range s.RemoteMethods {
+		remotes = append(remotes, MethodInfo{
+			Name:   name,
+			Remote: true,
+			Args:   argTypes(m.Method.Type),
+			Reply:  m.Method.Type.Out(0).String(),
+			Calls:  m.NumCalls(),
+		})
+	}
+	sortMethods(handlers)
+	sortMethods(remotes)
+	info.Methods = append(handlers, remotes...)
+	return info
+}
+
+// argTypes returns the type names of the arguments, except the receiver
+func argTypes(mt reflect.Type) []string {
+	args := make([]string, 0, mt.NumIn()-1)
+	for i := 1; i < mt.NumIn(); i++ {
+		args = append(args, mt.In(i).String())
+	}
+	return args
+}
+
+func sortMethods(methods []MethodInfo) {
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+}
@@ -0,0 +1,83 @@
+package component
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/session"
+)
+
+// Validator decides whether the method is suitable for the custom rpc kind
+type Validator func(method reflect.Method) bool
+
+// Invoker calls the method of the custom rpc kind with the request data, and
+// returns the serialized reply, rcvr is the receiver of the method
+type Invoker func(rcvr reflect.Value, method reflect.Method, s *session.Session, data []byte) ([]byte, error)
+
+// KindMethod is a method of custom rpc kind
+type KindMethod struct {
+	Method reflect.Method
+	Invoke Invoker
+	callStats
+}
+
+type kind struct {
+	validate Validator
+	invoke   Invoker
+}
+
+var (
+	kindLock sync.RWMutex
+	kinds    = make(map[rpc.RpcKind]kind)
+)
+
+// RegisterKind registers the custom rpc kind, e.g: AdminRpc, so frameworks
+// built on starx can add their own namespaces, the methods of components
+// satisfy validate are published in the namespace, and dispatched by invoke,
+// kinds should be registered before components
+func RegisterKind(k rpc.RpcKind, name string, validate Validator, invoke Invoker) error {
+	if err := rpc.RegisterKind(k, name); err != nil {
+		return err
+	}
+
+	kindLock.Lock()
+	defer kindLock.Unlock()
+
+	kinds[k] = kind{validate: validate, invoke: invoke}
+	return nil
+}
+
+// UnregisterKind removes the custom rpc kind, the components registered
+// before keep the methods of the kind
+func UnregisterKind(k rpc.RpcKind) {
+	rpc.UnregisterKind(k)
+
+	kindLock.Lock()
+	defer kindLock.Unlock()
+
+	delete(kinds, k)
+}
+
+// scanKinds installs the methods of registered custom kinds
+func (s *Service) scanKinds() {
+	kindLock.RLock()
+	defer kindLock.RUnlock()
+
+	if len(kinds) == 0 {
+		return
+	}
+	s.KindMethods = make(map[rpc.RpcKind]map[string]*KindMethod)
+	for k, v := range kinds {
+		methods := make(map[string]*KindMethod)
+		for m := 0; m < s.Type.NumMethod(); m++ {
+			method := s.Type.Method(m)
+			if method.PkgPath == "" && v.validate(method) {
+				methods[method.Name] = &KindMethod{Method: method, Invoke: v.invoke}
+			}
+		}
+		if len(methods) > 0 {
+			s.KindMethods[k] = methods
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package component
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/session"
+)
+
+const adminKind = rpc.MinCustomKind + 1
+
+type AdminComp struct {
+	Base
+}
+
+func (c *AdminComp) Hello(s *session.Session, msg *TestMessage) error {
+	return nil
+}
+
+func (c *AdminComp) AdminReload(data []byte) error {
+	return nil
+}
+
+func TestService_ScanKinds(t *testing.T) {
+	validate := func(method reflect.Method) bool {
+		return strings.HasPrefix(method.Name, "Admin")
+	}
+	invoke := func(rcvr reflect.Value, method reflect.Method, s *session.Session, data []byte) ([]byte, error) {
+		return nil, nil
+	}
+	if err := RegisterKind(adminKind, "AdminRpc", validate, invoke); err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterKind(adminKind)
+	if err := RegisterKind(adminKind, "AdminRpc", validate, invoke); err != rpc.ErrKindRegistered {
+		t.Fatalf("expect ErrKindRegistered, got %v", err)
+	}
+	if err := RegisterKind(rpc.User, "UserRpc", validate, invoke); err != rpc.ErrKindReserved {
+		t.Fatalf("expect ErrKindReserved, got %v", err)
+	}
+	if adminKind.String() != "AdminRpc" {
+		t.Fatalf("unexpected kind name %s", adminKind)
+	}
+
+	c := &AdminComp{}
+	s := &Service{Name: "AdminComp", Type: reflect.TypeOf(c), Rcvr: reflect.ValueOf(c)}
+	if err := s.ScanHandler(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ScanRemote(); err != nil {
+		t.Fatal(err)
+	}
+	methods := s.KindMethods[adminKind]
+	if len(methods) != 1 || methods["AdminReload"] == nil {
+		t.Fatalf("unexpected methods of custom kind: %v", methods)
+	}
+}
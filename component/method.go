@@ -1,6 +1,7 @@
 package component
 
 import (
+	"context"
 	"reflect"
 	"unicode"
 	"unicode/utf8"
@@ -12,6 +13,7 @@ var (
 	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
 	typeOfBytes   = reflect.TypeOf(([]byte)(nil))
 	typeOfSession = reflect.TypeOf(session.New(nil))
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
 )
 
 func isExported(name string) bool {
@@ -37,8 +39,14 @@ func isHandlerMethod(method reflect.Method) bool {
 		return false
 	}
 
-	// Method needs three ins: receiver, *Session, []byte or pointer.
-	if mt.NumIn() != 3 {
+	// Method needs three ins: receiver, *Session, []byte or pointer, or
+	// four ins when a context.Context is placed after the receiver.
+	n := mt.NumIn()
+	if n != 3 && n != 4 {
+		return false
+	}
+
+	if n == 4 && mt.In(1) != typeOfContext {
 		return false
 	}
 
@@ -47,11 +55,11 @@ func isHandlerMethod(method reflect.Method) bool {
 		return false
 	}
 
-	if t1 := mt.In(1); t1.Kind() != reflect.Ptr || t1 != typeOfSession {
+	if t1 := mt.In(n - 2); t1.Kind() != reflect.Ptr || t1 != typeOfSession {
 		return false
 	}
 
-	if (mt.In(2).Kind() != reflect.Ptr && mt.In(2) != typeOfBytes) || mt.Out(0) != typeOfError {
+	if (mt.In(n-1).Kind() != reflect.Ptr && mt.In(n-1) != typeOfBytes) || mt.Out(0) != typeOfError {
 		return false
 	}
 	return true
@@ -67,12 +75,17 @@ func isRemoteMethod(method reflect.Method) bool {
 		return false
 	}
 
-	// Method needs one outs: []byte, error
+	// Method needs two outs: reply, error, the reply can be an interface or
+	// any type that the serializer can encode
 	if mt.NumOut() != 2 {
 		return false
 	}
 
-	if mt.Out(0).Kind() != reflect.Interface || mt.Out(1) != typeOfError {
+	if mt.Out(1) != typeOfError || mt.Out(0) == typeOfError {
+		return false
+	}
+
+	if t := mt.Out(0); t.Kind() != reflect.Interface && !isExportedOrBuiltinType(t) {
 		return false
 	}
 
@@ -88,11 +101,12 @@ func suitableHandlerMethods(typ reflect.Type, reportErr bool) map[string]*Handle
 		mt := method.Type
 		mn := method.Name
 		if isHandlerMethod(method) {
+			n := mt.NumIn()
 			raw := false
-			if mt.In(2) == typeOfBytes {
+			if mt.In(n-1) == typeOfBytes {
 				raw = true
 			}
-			methods[mn] = &HandlerMethod{Method: method, Type: mt.In(2), Raw: raw}
+			methods[mn] = &HandlerMethod{Method: method, Type: mt.In(n - 1), Raw: raw, Context: n == 4}
 		}
 	}
 	return methods
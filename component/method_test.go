@@ -0,0 +1,103 @@
+package component
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/lonnng/starx/session"
+)
+
+type TestComp struct {
+	Base
+}
+
+type TestMessage struct {
+	Content string
+}
+
+func (t *TestComp) Raw(s *session.Session, data []byte) error {
+	return nil
+}
+
+func (t *TestComp) Pointer(s *session.Session, msg *TestMessage) error {
+	return nil
+}
+
+func (t *TestComp) WithContext(ctx context.Context, s *session.Session, msg *TestMessage) error {
+	return nil
+}
+
+func (t *TestComp) WrongContext(ctx int, s *session.Session, msg *TestMessage) error {
+	return nil
+}
+
+func TestSuitableHandlerMethods(t *testing.T) {
+	methods := suitableHandlerMethods(reflect.TypeOf(&TestComp{}), false)
+
+	if m, ok := methods["Raw"]; !ok || !m.Raw || m.Context {
+		t.Error("Raw should be a raw handler method without context")
+	}
+
+	if m, ok := methods["Pointer"]; !ok || m.Raw || m.Context {
+		t.Error("Pointer should be a handler method without context")
+	}
+
+	m, ok := methods["WithContext"]
+	if !ok || !m.Context {
+		t.Fatal("WithContext should be a handler method with context")
+	}
+	if m.Type != reflect.TypeOf(&TestMessage{}) {
+		t.Error("wrong argument type of WithContext")
+	}
+
+	if _, ok := methods["WrongContext"]; ok {
+		t.Error("WrongContext should not be a handler method")
+	}
+}
+
+type RemoteComp struct {
+	Base
+}
+
+type RemoteReply struct {
+	Sum int
+}
+
+type remoteReply struct{}
+
+func (r *RemoteComp) Interface(a, b int) (interface{}, error) {
+	return a + b, nil
+}
+
+func (r *RemoteComp) Typed(args *TestMessage) (*RemoteReply, error) {
+	return &RemoteReply{}, nil
+}
+
+func (r *RemoteComp) Builtin(a, b int) (int, error) {
+	return a + b, nil
+}
+
+func (r *RemoteComp) Unexported() (*remoteReply, error) {
+	return nil, nil
+}
+
+func (r *RemoteComp) Errors() (error, error) {
+	return nil, nil
+}
+
+func TestSuitableRemoteMethods(t *testing.T) {
+	methods := suitableRemoteMethods(reflect.TypeOf(&RemoteComp{}), false)
+
+	for _, name := range []string{"Interface", "Typed", "Builtin"} {
+		if _, ok := methods[name]; !ok {
+			t.Errorf("%s should be a remote method", name)
+		}
+	}
+
+	for _, name := range []string{"Unexported", "Errors", "Init"} {
+		if _, ok := methods[name]; ok {
+			t.Errorf("%s should not be a remote method", name)
+		}
+	}
+}
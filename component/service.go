@@ -4,35 +4,61 @@ import (
 	"errors"
 	"reflect"
 	"sync"
+
+	"github.com/lonnng/starx/cluster/rpc"
 )
 
 type HandlerMethod struct {
 	sync.Mutex
-	Method   reflect.Method
-	Type     reflect.Type
-	Raw      bool //Whether the data need to serialize
-	numCalls uint
+	Method  reflect.Method
+	Type    reflect.Type
+	Raw     bool //Whether the data need to serialize
+	Context bool //Whether the method accepts a context.Context
+	callStats
 }
 
 type RemoteMethod struct {
 	sync.Mutex
-	Method   reflect.Method
-	Type     reflect.Type
-	numCalls uint
+	Method reflect.Method
+	Type   reflect.Type
+	Stub   bool //Whether the method is dispatched by generated stub
+	callStats
 }
 
 type Service struct {
-	Name           string                    // name of service
-	Rcvr           reflect.Value             // receiver of methods for the service
-	Type           reflect.Type              // type of the receiver
-	HandlerMethods map[string]*HandlerMethod // registered methods
-	RemoteMethods  map[string]*RemoteMethod  // registered methods
+	Name           string                                 // name of service
+	Version        string                                 // version of service, empty for unversioned
+	Rcvr           reflect.Value                          // receiver of methods for the service
+	Type           reflect.Type                           // type of the receiver
+	HandlerMethods map[string]*HandlerMethod              // registered methods
+	RemoteMethods  map[string]*RemoteMethod               // registered methods
+	KindMethods    map[rpc.RpcKind]map[string]*KindMethod // methods of custom rpc kinds
+
+	calls sync.WaitGroup // calls holding the service
+}
+
+// Hold marks a call entering the service, which must be released by Release
+// after the call completed
+func (s *Service) Hold() {
+	s.calls.Add(1)
+}
+
+// Release marks the call held completed
+func (s *Service) Release() {
+	s.calls.Done()
+}
+
+// Drain waits for the calls holding the service to complete, the service
+// should be removed before, so no call holds it any more
+func (s *Service) Drain() {
+	s.calls.Wait()
 }
 
 // Register publishes in the service the set of methods of the
 // receiver value that satisfy the following conditions:
 // - exported method of exported type
 // - two arguments, both of exported type
+// - an optional context.Context placed before the two arguments
 // - the first argument is *session.Session
 // - the second argument is []byte or a pointer
 func (s *Service) ScanHandler() error {
@@ -75,6 +101,8 @@ func (s *Service) ScanRemote() error {
 
 	// Install the remote methods
 	s.RemoteMethods = suitableRemoteMethods(s.Type, true)
+	s.scanStubs()
+	s.scanKinds()
 	if len(s.HandlerMethods) == 0 {
 		str := ""
 
@@ -89,17 +117,3 @@ func (s *Service) ScanRemote() error {
 	}
 	return nil
 }
-
-func (m *HandlerMethod) NumCalls() (n uint) {
-	m.Lock()
-	n = m.numCalls
-	m.Unlock()
-	return n
-}
-
-func (m *RemoteMethod) NumCalls() (n uint) {
-	m.Lock()
-	n = m.numCalls
-	m.Unlock()
-	return n
-}
@@ -0,0 +1,109 @@
+package component
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencySamples is the count of recent latencies kept for percentiles
+const latencySamples = 1024
+
+// MethodStats is a snapshot of the call statistics of a method
+type MethodStats struct {
+	Calls    uint          // completed calls
+	Errors   uint          // completed calls which returned error
+	InFlight int           // calls in processing
+	P50      time.Duration // latency percentiles of recent calls
+	P90      time.Duration
+	P99      time.Duration
+}
+
+// callStats tracks the calls of a method
+type callStats struct {
+	statsLock sync.Mutex // protects following
+	numCalls  uint
+	numErrors uint
+	inFlight  int
+	latencies []time.Duration // ring buffer of recent latencies
+	next      int
+}
+
+// Begin marks a call starts, and returns the start time, which should be
+// passed to End when the call completes
+func (c *callStats) Begin() time.Time {
+	c.statsLock.Lock()
+	c.inFlight++
+	c.statsLock.Unlock()
+	return time.Now()
+}
+
+// End marks a call started at start completes
+func (c *callStats) End(start time.Time, failed bool) {
+	elapsed := time.Since(start)
+
+	c.statsLock.Lock()
+	defer c.statsLock.Unlock()
+
+	c.inFlight--
+	c.numCalls++
+	if failed {
+		c.numErrors++
+	}
+
+	if len(c.latencies) < latencySamples {
+		c.latencies = append(c.latencies, elapsed)
+	} else {
+		c.latencies[c.next] = elapsed
+		c.next = (c.next + 1) % latencySamples
+	}
+}
+
+func (c *callStats) NumCalls() (n uint) {
+	c.statsLock.Lock()
+	n = c.numCalls
+	c.statsLock.Unlock()
+	return n
+}
+
+// Stats returns a snapshot of the call statistics
+func (c *callStats) Stats() MethodStats {
+	c.statsLock.Lock()
+	stats := MethodStats{
+		Calls:    c.numCalls,
+		Errors:   c.numErrors,
+		InFlight: c.inFlight,
+	}
+	latencies := make([]time.Duration, len(c.latencies))
+	copy(latencies, c.latencies)
+	c.statsLock.Unlock()
+
+	if n := len(latencies); n > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		stats.P50 = latencies[(n-1)*50/100]
+		stats.P90 = latencies[(n-1)*90/100]
+		stats.P99 = latencies[(n-1)*99/100]
+	}
+	return stats
+}
+
+// Stats returns the call statistics snapshot of all methods of the service,
+// keyed by "Service.Method", or "Service.Method@version" for versioned service
+func (s *Service) Stats() map[string]MethodStats {
+	stats := make(map[string]MethodStats)
+	for name, m := range s.HandlerMethods {
+		stats[s.route(name)] = m.Stats()
+	}
+	for name, m := range s.RemoteMethods {
+		stats[s.route(name)] = m.Stats()
+	}
+	return stats
+}
+
+// route returns the route of the method, e.g: Room.Join@v2
+func (s *Service) route(method string) string {
+	if s.Version == "" {
+		return s.Name + "." + method
+	}
+	return s.Name + "." + method + "@" + s.Version
+}
@@ -0,0 +1,68 @@
+package component
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCallStats(t *testing.T) {
+	var c callStats
+
+	start := c.Begin()
+	if st := c.Stats(); st.InFlight != 1 {
+		t.Fatalf("expect 1 call in flight, got %d", st.InFlight)
+	}
+	c.End(start, false)
+
+	for i := 1; i <= 100; i++ {
+		c.Begin()
+		c.End(time.Now().Add(-time.Duration(i)*time.Millisecond), i%10 == 0)
+	}
+
+	st := c.Stats()
+	if st.Calls != 101 || c.NumCalls() != 101 {
+		t.Fatalf("expect 101 calls, got %d", st.Calls)
+	}
+	if st.Errors != 10 {
+		t.Fatalf("expect 10 errors, got %d", st.Errors)
+	}
+	if st.InFlight != 0 {
+		t.Fatalf("expect no call in flight, got %d", st.InFlight)
+	}
+	if st.P50 < 49*time.Millisecond || st.P50 > st.P90 || st.P90 > st.P99 {
+		t.Fatalf("invalid percentiles: %v, %v, %v", st.P50, st.P90, st.P99)
+	}
+}
+
+func TestServiceInfo(t *testing.T) {
+	s := &Service{Name: "RemoteComp", Version: "v1", Type: reflect.TypeOf(&RemoteComp{})}
+	s.HandlerMethods = suitableHandlerMethods(reflect.TypeOf(&TestComp{}), false)
+	s.RemoteMethods = suitableRemoteMethods(s.Type, false)
+
+	m := s.RemoteMethods["Typed"]
+	m.End(m.Begin(), false)
+
+	info := s.Info()
+	if info.Name != "RemoteComp" || info.Version != "v1" {
+		t.Fatalf("unexpected service info: %+v", info)
+	}
+	if len(info.Methods) != len(s.HandlerMethods)+len(s.RemoteMethods) {
+		t.Fatalf("unexpected methods: %+v", info.Methods)
+	}
+	if first := info.Methods[0]; first.Remote || first.Name != "Pointer" {
+		t.Fatalf("handler methods should be sorted first, got %+v", first)
+	}
+
+	for _, mi := range info.Methods {
+		if mi.Name != "Typed" {
+			continue
+		}
+		if !mi.Remote || mi.Calls != 1 || mi.Reply != "*component.RemoteReply" ||
+			!reflect.DeepEqual(mi.Args, []string{"*component.TestMessage"}) {
+			t.Fatalf("unexpected method info: %+v", mi)
+		}
+		return
+	}
+	t.Fatal("Typed should be described")
+}
@@ -0,0 +1,42 @@
+package component
+
+import (
+	"errors"
+
+	"github.com/lonnng/starx/serialize"
+)
+
+// ErrNoStubMethod is returned by the generated stub when the method is not
+// generated
+var ErrNoStubMethod = errors.New("component: method has no generated stub")
+
+// RemoteStub is implemented by the code generated with starx-rpc-gen, which
+// dispatches remote calls with a switch on the method name and direct typed
+// calls, instead of reflect.Value.Call
+type RemoteStub interface {
+	// StarxStubMethods returns the names of the generated remote methods
+	StarxStubMethods() []string
+
+	// StarxDispatch deserializes the arguments of the remote call and
+	// calls the method
+	StarxDispatch(method string, seri serialize.Serializer, args [][]byte) (interface{}, error)
+}
+
+// scanStubs marks the remote methods which have generated stub
+func (s *Service) scanStubs() {
+	if !s.Rcvr.IsValid() {
+		return
+	}
+	stub, ok := s.Rcvr.Interface().(RemoteStub)
+	if !ok {
+		return
+	}
+
+	// the dispatcher itself is not a remote method
+	delete(s.RemoteMethods, "StarxDispatch")
+	for _, name := range stub.StarxStubMethods() {
+		if m, ok := s.RemoteMethods[name]; ok {
+			m.Stub = true
+		}
+	}
+}
@@ -21,26 +21,57 @@
 package starx
 
 import (
+	"reflect"
+	"sync"
+
 	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/log"
 )
 
 var (
-	comps = make([]component.Component, 0)
+	compsLock sync.Mutex // protects comps, compVersions and compAliases
+	comps     = make([]component.Component, 0)
+
+	// versions of the components registered with version
+	compVersions = make(map[component.Component]string)
+
+	// aliases of the components registered with aliases
+	compAliases = make(map[component.Component][]string)
 )
 
 func startupComps() {
-	for _, c := range comps {
+	// the components are initialized without the lock held, which may
+	// register other components
+	compsLock.Lock()
+	list := append([]component.Component(nil), comps...)
+	compsLock.Unlock()
+
+	for _, c := range list {
 		c.Init()
 	}
-	for _, c := range comps {
+	for _, c := range list {
 		c.AfterInit()
 	}
 
-	for _, c := range comps {
+	for _, c := range list {
+		compsLock.Lock()
+		version, names := compVersions[c], compAliases[c]
+		compsLock.Unlock()
+
+		var err error
 		if app.config.IsFrontend {
-			handler.register(c)
+			handler.registerVersion(c, version)
+			if len(names) > 0 {
+				err = handler.alias(names, typeName(c))
+			}
 		} else {
-			remote.register(c)
+			remote.registerVersion(c, version)
+			if len(names) > 0 {
+				err = remote.alias(names, typeName(c))
+			}
+		}
+		if err != nil {
+			log.Errorf(err.Error())
 		}
 	}
 
@@ -49,6 +80,9 @@ func startupComps() {
 }
 
 func shutdownComps() {
+	compsLock.Lock()
+	defer compsLock.Unlock()
+
 	for _, c := range comps {
 		c.BeforeShutdown()
 	}
@@ -56,3 +90,140 @@ func shutdownComps() {
 		c.Shutdown()
 	}
 }
+
+// serviceName returns the name of service that the component registered as,
+// the version is included for the component registered with version, it
+// should be called with compsLock held
+func serviceName(c component.Component) string {
+	return serviceKey(typeName(c), compVersions[c])
+}
+
+// typeName returns the name of the component type
+func typeName(c component.Component) string {
+	return reflect.Indirect(reflect.ValueOf(c)).Type().Name()
+}
+
+func shutdownComp(c component.Component) {
+	c.BeforeShutdown()
+	c.Shutdown()
+}
+
+func unregisterComp(name string) error {
+	var (
+		s   *component.Service
+		err error
+	)
+	if app.config.IsFrontend {
+		s, err = handler.unregister(name)
+	} else {
+		s, err = remote.unregister(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	compsLock.Lock()
+	for i, c := range comps {
+		if serviceName(c) == name {
+			comps = append(comps[:i], comps[i+1:]...)
+			delete(compVersions, c)
+			delete(compAliases, c)
+			break
+		}
+	}
+	compsLock.Unlock()
+
+	// requests in flight complete before the component shut down
+	s.Drain()
+	shutdownComp(s.Rcvr.Interface().(component.Component))
+	return nil
+}
+
+func reregisterComp(c component.Component, version string) error {
+	c.Init()
+	c.AfterInit()
+
+	var (
+		old *component.Service
+		err error
+	)
+	if app.config.IsFrontend {
+		old, err = handler.reregister(c, version)
+	} else {
+		old, err = remote.reregister(c, version)
+	}
+	if err != nil {
+		shutdownComp(c)
+		return err
+	}
+
+	compsLock.Lock()
+	name := serviceKey(typeName(c), version)
+	replaced := false
+	for i, comp := range comps {
+		if serviceName(comp) == name {
+			comps[i], replaced = c, true
+			delete(compVersions, comp)
+			if a, ok := compAliases[comp]; ok {
+				compAliases[c] = a
+				delete(compAliases, comp)
+			}
+			break
+		}
+	}
+	if !replaced {
+		comps = append(comps, c)
+	}
+	if version != "" {
+		compVersions[c] = version
+	}
+	compsLock.Unlock()
+
+	if old != nil {
+		old.Drain()
+		shutdownComp(old.Rcvr.Interface().(component.Component))
+	}
+	return nil
+}
+
+func swapComp(name string, c component.Component) error {
+	c.Init()
+	c.AfterInit()
+
+	var (
+		old *component.Service
+		err error
+	)
+	if app.config.IsFrontend {
+		old, err = handler.swap(name, c)
+	} else {
+		old, err = remote.swap(name, c)
+	}
+	if err != nil {
+		shutdownComp(c)
+		return err
+	}
+
+	prev := old.Rcvr.Interface().(component.Component)
+	compsLock.Lock()
+	for i, comp := range comps {
+		if comp == prev {
+			comps[i] = c
+			break
+		}
+	}
+	if v, ok := compVersions[prev]; ok {
+		compVersions[c] = v
+		delete(compVersions, prev)
+	}
+	if a, ok := compAliases[prev]; ok {
+		compAliases[c] = a
+		delete(compAliases, prev)
+	}
+	compsLock.Unlock()
+
+	// the calls in flight complete on the old receiver
+	old.Drain()
+	shutdownComp(prev)
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/session"
+)
+
+type DrainComp struct {
+	component.Base
+	release  chan struct{}
+	entered  chan struct{}
+	shutdown chan struct{}
+}
+
+func newDrainComp() *DrainComp {
+	return &DrainComp{
+		release:  make(chan struct{}),
+		entered:  make(chan struct{}, 1),
+		shutdown: make(chan struct{}),
+	}
+}
+
+func (c *DrainComp) Hello(s *session.Session, data []byte) error {
+	return nil
+}
+
+func (c *DrainComp) Wait(block bool) (bool, error) {
+	c.entered <- struct{}{}
+	if block {
+		<-c.release
+	}
+	return block, nil
+}
+
+func (c *DrainComp) Shutdown() {
+	close(c.shutdown)
+}
+
+// callDrainComp calls the blocking method of the component registered in the
+// remote service, and returns when the call entered
+func callDrainComp(t *testing.T, c *DrainComp) chan error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := remote.callTyped("DrainComp.Wait", true)
+		done <- err
+	}()
+	select {
+	case <-c.entered:
+	case <-time.After(time.Second):
+		t.Fatal("call should enter the component")
+	}
+	return done
+}
+
+func TestUnregisterComp_Drain(t *testing.T) {
+	c := newDrainComp()
+	if err := remote.register(c); err != nil {
+		t.Fatal(err)
+	}
+	call := callDrainComp(t, c)
+
+	unregistered := make(chan error, 1)
+	go func() { unregistered <- unregisterComp("DrainComp") }()
+
+	// the component is shut down after the call in flight completed
+	select {
+	case <-c.shutdown:
+		t.Fatal("component should not be shut down with calls in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(c.release)
+	if err := <-call; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-unregistered; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-c.shutdown:
+	default:
+		t.Fatal("component should be shut down after unregistered")
+	}
+}
+
+func TestReregisterComp_Drain(t *testing.T) {
+	old := newDrainComp()
+	if err := remote.register(old); err != nil {
+		t.Fatal(err)
+	}
+	defer unregisterComp("DrainComp")
+	call := callDrainComp(t, old)
+
+	c := newDrainComp()
+	reregistered := make(chan error, 1)
+	go func() { reregistered <- reregisterComp(c, "") }()
+
+	select {
+	case <-old.shutdown:
+		t.Fatal("replaced component should not be shut down with calls in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(old.release)
+	if err := <-call; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-reregistered; err != nil {
+		t.Fatal(err)
+	}
+	<-old.shutdown
+}
+
+func TestSwapComp_Drain(t *testing.T) {
+	old := newDrainComp()
+	if err := remote.register(old); err != nil {
+		t.Fatal(err)
+	}
+	defer unregisterComp("DrainComp")
+	call := callDrainComp(t, old)
+
+	c := newDrainComp()
+	swapped := make(chan error, 1)
+	go func() { swapped <- swapComp("DrainComp", c) }()
+
+	select {
+	case <-old.shutdown:
+		t.Fatal("swapped receiver should not be shut down with calls in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the calls after swapped are dispatched to the new receiver
+	go remote.callTyped("DrainComp.Wait", false)
+	select {
+	case <-c.entered:
+	case <-time.After(time.Second):
+		t.Fatal("call should be dispatched to the new receiver")
+	}
+
+	close(old.release)
+	if err := <-call; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-swapped; err != nil {
+		t.Fatal(err)
+	}
+	<-old.shutdown
+}
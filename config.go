@@ -21,8 +21,10 @@
 package starx
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path"
@@ -31,6 +33,7 @@ import (
 	"time"
 
 	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
 	"github.com/lonnng/starx/log"
 	"github.com/lonnng/starx/timer"
 )
@@ -45,6 +48,7 @@ var (
 		name       string                // current application name
 		standalone bool                  // current server is running in standalone mode
 		startAt    time.Time             // startup time
+		listener   net.Listener          // listener of current server
 	}{}
 
 	// env represents the environment of the current process, includes
@@ -58,7 +62,18 @@ var (
 		heartbeatInternal time.Duration               // heartbeat internal
 		die               chan bool                   // wait for end application
 
-		checkOrigin func(*http.Request) bool // check origin when websocket enabled
+		checkOrigin  func(*http.Request) bool // check origin when websocket enabled
+		rpcTLS       *tls.Config              // tls config of rpc listener, nil means plain tcp
+		rpcTransport rpc.Transport            // transport of rpc listener, nil means tcp
+
+		sendBufferSize int        // packets buffered for every client, zero means packetBufferSize
+		sendPolicy     SendPolicy // how to handle the packets sent to a full buffer
+
+		coalesceInterval time.Duration // interval of flushing the pushes coalesced, zero means disabled
+
+		encryption PayloadEncryption // whether the message payloads are encrypted
+
+		resumeGrace time.Duration // how long the session of disconnected client is kept, zero means disabled
 	}{}
 )
 
@@ -68,6 +83,8 @@ type ServerInitFunc func()
 func init() {
 	// register session manager for cluster
 	cluster.SetSessionManager(transporter)
+	cluster.SetChannelHandler(expandChannel)
+	cluster.SetTrackerHandler(reannounceChannels)
 
 	// application initialize
 	app.name = strings.TrimLeft(path.Base(os.Args[0]), "/")
@@ -0,0 +1,139 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package starx
+
+import (
+	"context"
+	"sync"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+)
+
+// dedupWindow remembers the recently received calls of a connection, and the
+// responses of the completed ones, sequences are never reused by a client, so
+// a call received again is a retransmission after timeout, which should not be
+// executed twice
+type dedupWindow struct {
+	sync.Mutex
+	size    int
+	order   []uint64               // sequences in arrival order, the oldest is evicted first
+	entries map[uint64]*dedupEntry // sequence => entry
+}
+
+type dedupEntry struct {
+	done     bool
+	response *rpc.Response // stored response, nil when the call has no response
+}
+
+func newDedupWindow(size int) *dedupWindow {
+	return &dedupWindow{
+		size:    size,
+		order:   make([]uint64, 0, size),
+		entries: make(map[uint64]*dedupEntry),
+	}
+}
+
+// lookup returns the entry of the call received before
+func (w *dedupWindow) lookup(seq uint64) (dedupEntry, bool) {
+	w.Lock()
+	defer w.Unlock()
+
+	if e, ok := w.entries[seq]; ok {
+		return *e, true
+	}
+	return dedupEntry{}, false
+}
+
+// begin records the call accepted for processing
+func (w *dedupWindow) begin(seq uint64) {
+	w.Lock()
+	defer w.Unlock()
+
+	if len(w.order) >= w.size {
+		delete(w.entries, w.order[0])
+		w.order = w.order[1:]
+	}
+	w.order = append(w.order, seq)
+	w.entries[seq] = &dedupEntry{}
+}
+
+// complete stores a copy of the response of the call
+func (w *dedupWindow) complete(seq uint64, response *rpc.Response) {
+	w.Lock()
+	defer w.Unlock()
+
+	e, ok := w.entries[seq]
+	if !ok {
+		return
+	}
+	e.done = true
+	if response != nil {
+		stored := *response
+		stored.Data = append([]byte(nil), response.Data...)
+		e.response = &stored
+	}
+}
+
+// forget removes the call which is not executed, so the retransmission will be
+// executed
+func (w *dedupWindow) forget(seq uint64) {
+	w.Lock()
+	defer w.Unlock()
+
+	delete(w.entries, seq)
+}
+
+// duplicate reports whether the request is a retransmission of a received
+// call, the stored response is written for the completed call, and the call in
+// processing will be responded when it completes
+func (rs *remoteService) duplicate(ac *acceptor, rr *rpc.Request) bool {
+	if ac.dedup == nil || !cancellable(rr) {
+		return false
+	}
+	e, ok := ac.dedup.lookup(rr.Seq)
+	if !ok {
+		return false
+	}
+	if !e.done {
+		// the caller waits for the response again
+		ac.revive(rr.Seq)
+		return true
+	}
+	if e.response != nil {
+		response := *e.response
+		if err := ac.writeResponse(&response); err != nil {
+			log.Errorf(err.Error())
+		}
+	}
+	return true
+}
+
+// revive renews the context of the call canceled by the caller, which is
+// retransmitted later
+func (a *acceptor) revive(seq uint64) {
+	a.callLock.Lock()
+	defer a.callLock.Unlock()
+
+	if call, ok := a.calls[seq]; ok && call.ctx.Err() != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		a.calls[seq] = &inflightCall{ctx: ctx, cancel: cancel}
+	}
+}
@@ -0,0 +1,90 @@
+package starx
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/session"
+)
+
+func TestDedupWindow(t *testing.T) {
+	w := newDedupWindow(2)
+	w.begin(1)
+	if e, ok := w.lookup(1); !ok || e.done {
+		t.Fatal("call in processing should be found")
+	}
+	w.complete(1, &rpc.Response{Seq: 1, Data: []byte("reply")})
+	if e, ok := w.lookup(1); !ok || !e.done || string(e.response.Data) != "reply" {
+		t.Fatalf("expect stored response, got %+v", e)
+	}
+
+	w.begin(2)
+	w.begin(3)
+	if _, ok := w.lookup(1); ok {
+		t.Fatal("oldest call should be evicted")
+	}
+
+	w.forget(3)
+	if _, ok := w.lookup(3); ok {
+		t.Fatal("forgotten call should not be found")
+	}
+}
+
+type CounterComp struct {
+	component.Base
+	count int32
+}
+
+func (c *CounterComp) Hello(s *session.Session, data []byte) error {
+	return nil
+}
+
+func (c *CounterComp) Incr(delay int) (int32, error) {
+	time.Sleep(time.Duration(delay) * time.Millisecond)
+	return atomic.AddInt32(&c.count, 1), nil
+}
+
+func TestRemoteService_Dedup(t *testing.T) {
+	rs := newRemote()
+	rs.dedupWindow = 16
+	comp := &CounterComp{}
+	if err := rs.register(comp); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer := net.Pipe()
+	go rs.handle(conn)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	seri := serializerOf("CounterComp")
+	args, _ := encodeArgs(seri, 100)
+	reply := new([]byte)
+	_, err := client.CallResend(rpc.User, "CounterComp", "Incr", 1, reply, args, 40*time.Millisecond, rpc.Trace{}, rpc.Metadata{}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int32
+	if err := seri.Deserialize(*reply, &n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expect 1, got %d", n)
+	}
+
+	// the next call of the session is processed after the resent ones
+	args, _ = encodeArgs(seri, 0)
+	if err := client.Call(rpc.User, "CounterComp", "Incr", 1, reply, args); err != nil {
+		t.Fatal(err)
+	}
+	if err := seri.Deserialize(*reply, &n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("resent call should be executed once, got %d executions", n-1)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package starx
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+)
+
+// PayloadEncryption decides whether the message payloads of sessions are
+// encrypted with the key negotiated in handshake, for plain tcp connections
+// where tls is not available
+type PayloadEncryption int
+
+const (
+	// EncryptionOff sends the payloads in plain text
+	EncryptionOff PayloadEncryption = iota
+
+	// EncryptionOptional encrypts the payloads of sessions whose client
+	// sends its public key in handshake
+	EncryptionOptional
+
+	// EncryptionRequired refuses the clients not sending public key
+	EncryptionRequired
+)
+
+// info of hkdf, binds the derived keys to their usage, each direction has
+// its own key
+const (
+	clientKeyInfo = "starx payload c2s"
+	serverKeyInfo = "starx payload s2c"
+)
+
+var (
+	ErrEncryptionRequired = errors.New("payload encryption required")
+	ErrInvalidCiphertext  = errors.New("invalid ciphertext")
+	ErrReplayedPayload    = errors.New("payload replayed")
+)
+
+// SetPayloadEncryption sets whether the message payloads are encrypted, the
+// client sends its X25519 public key in base64 as sys.key of handshake, and
+// the server replies its own in the same field, both sides derive two AES-GCM
+// keys from the shared secret with HKDF-SHA256, info "starx payload c2s" for
+// the payloads sent by client, and "starx payload s2c" for the payloads sent
+// by server. The payload is sealed as the 12 bytes nonce followed by the
+// ciphertext, the nonce is a big endian counter starting from 1 in every
+// direction, the payloads whose counter does not increase are refused. The
+// packet type, message type, message id in 8 bytes big endian and the route
+// are authenticated as additional data. It should be called before server
+// started
+func SetPayloadEncryption(mode PayloadEncryption) {
+	env.encryption = mode
+}
+
+// payloadKeys are the ciphers of a session negotiated in handshake
+type payloadKeys struct {
+	c2s      cipher.AEAD // opens the payloads from client
+	s2c      cipher.AEAD // seals the payloads to client
+	sent     uint64      // counter of the payloads sealed, accessed atomically
+	received uint64      // counter of the last payload opened
+}
+
+// newPayloadKeys derives the ciphers of payloads from the shared secret
+func newPayloadKeys(secret []byte) (*payloadKeys, error) {
+	c2s, err := newPayloadCipher(secret, clientKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	s2c, err := newPayloadCipher(secret, serverKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &payloadKeys{c2s: c2s, s2c: s2c}, nil
+}
+
+func newPayloadCipher(secret []byte, info string) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, secret, nil, info, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// payloadAAD returns the additional data authenticated with the payload of
+// packet type t, m is nil for the packets other than data
+func payloadAAD(t packet.PacketType, m *message.Message) []byte {
+	if m == nil {
+		return []byte{byte(t)}
+	}
+	aad := make([]byte, 0, 10+len(m.Route))
+	aad = append(aad, byte(t), byte(m.Type))
+	aad = binary.BigEndian.AppendUint64(aad, uint64(m.ID))
+	return append(aad, m.Route...)
+}
+
+// negotiateKey derives the key of session from the public key of client in
+// handshake payload, returns the public key of server encoded in base64, or
+// empty string when the session is not encrypted
+func (a *agent) negotiateKey(data []byte) (string, error) {
+	if env.encryption == EncryptionOff {
+		return "", nil
+	}
+
+	hs := struct {
+		Sys struct {
+			Key string `json:"key"`
+		} `json:"sys"`
+	}{}
+	if len(data) > 0 {
+		json.Unmarshal(data, &hs)
+	}
+	if hs.Sys.Key == "" {
+		if env.encryption == EncryptionRequired {
+			return "", ErrEncryptionRequired
+		}
+		return "", nil
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(hs.Sys.Key)
+	if err != nil {
+		return "", err
+	}
+	curve := ecdh.X25519()
+	remote, err := curve.NewPublicKey(buf)
+	if err != nil {
+		return "", err
+	}
+	local, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	secret, err := local.ECDH(remote)
+	if err != nil {
+		return "", err
+	}
+	keys, err := newPayloadKeys(secret)
+	if err != nil {
+		return "", err
+	}
+
+	a.keys.Store(keys)
+	return base64.StdEncoding.EncodeToString(local.PublicKey().Bytes()), nil
+}
+
+func (a *agent) payloadKeys() *payloadKeys {
+	keys, _ := a.keys.Load().(*payloadKeys)
+	return keys
+}
+
+// seal encrypts the payload sent to client, if a key negotiated
+func (a *agent) seal(data []byte, aad []byte) []byte {
+	keys := a.payloadKeys()
+	if keys == nil {
+		return data
+	}
+
+	aead := keys.s2c
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], atomic.AddUint64(&keys.sent, 1))
+	return aead.Seal(nonce, nonce, data, aad)
+}
+
+// open decrypts the payload received from client, if a key negotiated, it is
+// called by the goroutine processing the packets of client
+func (a *agent) open(data []byte, aad []byte) ([]byte, error) {
+	keys := a.payloadKeys()
+	if keys == nil {
+		return data, nil
+	}
+
+	aead := keys.c2s
+	size := aead.NonceSize()
+	if len(data) < size {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, ciphertext := data[:size], data[size:]
+	plain, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	counter := binary.BigEndian.Uint64(nonce[size-8:])
+	if counter <= keys.received {
+		return nil, ErrReplayedPayload
+	}
+	keys.received = counter
+	return plain, nil
+}
+
+// sealPacket encrypts the payload of the packed data or kick packet sent to
+// client, the packets are buffered in plain text, and sealed just before
+// written, so the packets not sent can be resent with another key
+func (a *agent) sealPacket(data []byte) ([]byte, error) {
+	if a.payloadKeys() == nil || len(data) < packet.HeadLength {
+		return data, nil
+	}
+
+	p, _, err := packet.Unpack(data)
+	if err != nil || p == nil {
+		return data, err
+	}
+	switch p.Type {
+	case packet.Data:
+		m, err := message.Decode(p.Data)
+		if err != nil {
+			return nil, err
+		}
+		m.Data = a.seal(m.Data, payloadAAD(p.Type, m))
+		if p.Data, err = message.Encode(m); err != nil {
+			return nil, err
+		}
+	case packet.Kick:
+		p.Data = a.seal(p.Data, payloadAAD(p.Type, nil))
+	default:
+		return data, nil
+	}
+	return p.Pack()
+}
@@ -0,0 +1,125 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package starx
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/message"
+	"github.com/lonnng/starx/packet"
+)
+
+func TestAgent_NegotiateKey(t *testing.T) {
+	defer SetPayloadEncryption(EncryptionOff)
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	defer conn.Close()
+	a := newAgent(conn)
+
+	SetPayloadEncryption(EncryptionRequired)
+	if _, err := a.negotiateKey([]byte(`{"sys":{}}`)); err != ErrEncryptionRequired {
+		t.Fatalf("expect encryption required, got %v", err)
+	}
+
+	SetPayloadEncryption(EncryptionOptional)
+	if key, err := a.negotiateKey(nil); err != nil || key != "" {
+		t.Fatalf("optional encryption should accept plain client, key=%q err=%v", key, err)
+	}
+	if plain := []byte("plain"); !bytes.Equal(a.seal(plain, nil), plain) {
+		t.Fatal("payload should not be sealed without key")
+	}
+
+	// client side of the key exchange
+	local, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := base64.StdEncoding.EncodeToString(local.PublicKey().Bytes())
+	key, err := a.negotiateKey([]byte(`{"sys":{"key":"` + pub + `"}}`))
+	if err != nil || key == "" {
+		t.Fatalf("key should be negotiated, err=%v", err)
+	}
+	buf, _ := base64.StdEncoding.DecodeString(key)
+	remote, err := ecdh.X25519().NewPublicKey(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := local.ECDH(remote)
+	s2c, err := newPayloadCipher(secret, serverKeyInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2s, err := newPayloadCipher(secret, clientKeyInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// server to client, the route is authenticated
+	if err := transporter.push(a.session, "chat.message", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := a.sealPacket(<-a.sendBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _, _ := packet.Unpack(sealed)
+	m, err := message.Decode(p.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := s2c.NonceSize()
+	plain, err := s2c.Open(nil, m.Data[:size], m.Data[size:], payloadAAD(packet.Data, m))
+	if err != nil || string(plain) != "hello" {
+		t.Fatalf("client should open the payload, got %q err=%v", plain, err)
+	}
+	if _, err := c2s.Open(nil, m.Data[:size], m.Data[size:], payloadAAD(packet.Data, m)); err == nil {
+		t.Fatal("the keys of both directions should differ")
+	}
+	m.Route = "chat.other"
+	if _, err := s2c.Open(nil, m.Data[:size], m.Data[size:], payloadAAD(packet.Data, m)); err == nil {
+		t.Fatal("payload moved to another route should be refused")
+	}
+
+	// client to server
+	req := &message.Message{Type: message.Request, ID: 1, Route: "chat.send"}
+	seal := func(counter uint64, data string) []byte {
+		nonce := make([]byte, size)
+		binary.BigEndian.PutUint64(nonce[size-8:], counter)
+		return c2s.Seal(nonce, nonce, []byte(data), payloadAAD(packet.Data, req))
+	}
+	if plain, err = a.open(seal(1, "world"), payloadAAD(packet.Data, req)); err != nil || string(plain) != "world" {
+		t.Fatalf("server should open the payload, got %q err=%v", plain, err)
+	}
+	if _, err = a.open(seal(1, "world"), payloadAAD(packet.Data, req)); err != ErrReplayedPayload {
+		t.Fatalf("replayed payload should be refused, got %v", err)
+	}
+	sealed = seal(2, "world")
+	sealed[len(sealed)-1] ^= 0xff
+	if _, err = a.open(sealed, payloadAAD(packet.Data, req)); err != ErrInvalidCiphertext {
+		t.Fatalf("tampered payload should be refused, got %v", err)
+	}
+}
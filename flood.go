@@ -0,0 +1,110 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package starx
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/log"
+)
+
+// RequestPolicy decides how to handle the requests of a client beyond its
+// rate limit
+type RequestPolicy int
+
+const (
+	// RequestDelay stops reading the client until a token is available, the
+	// requests are dropped when QPS is zero
+	RequestDelay RequestPolicy = iota
+
+	// RequestDrop drops the requests
+	RequestDrop
+
+	// RequestKick kicks the client
+	RequestKick
+)
+
+// RequestLimit limits the requests received from every client with token
+// bucket, so a single spamming client can not saturate the handler dispatch,
+// notifies count as requests, heartbeats do not
+type RequestLimit struct {
+	RateLimit               // requests allowed per second and in a burst of every client
+	Policy    RequestPolicy // how to handle the requests beyond the limit
+	Reason    interface{}   // delivered to the client kicked, nil means closed without kick packet
+}
+
+var (
+	requestLock  sync.RWMutex
+	requestLimit *RequestLimit // nil means the requests of clients are not limited
+)
+
+// SetRequestLimit limits the requests of every client, nil disables it, it
+// works on frontend server
+func SetRequestLimit(l *RequestLimit) {
+	requestLock.Lock()
+	defer requestLock.Unlock()
+
+	requestLimit = l
+}
+
+func requestLimitOf() *RequestLimit {
+	requestLock.RLock()
+	defer requestLock.RUnlock()
+
+	return requestLimit
+}
+
+// admit reports whether the request received is processed, it is called by
+// the goroutine reading the client, so the delayed client is not read until
+// a token is available, returns false when the request is dropped or the
+// client is kicked
+func (a *agent) admit(l *RequestLimit, now time.Time) bool {
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if a.requests == nil {
+		a.requests = &bucket{tokens: burst, last: now}
+	}
+	if a.requests.take(now, l.QPS, burst) {
+		return true
+	}
+
+	switch {
+	case l.Policy == RequestDelay && l.QPS > 0:
+		wait := time.Duration((1 - a.requests.tokens) / l.QPS * float64(time.Second))
+		time.Sleep(wait)
+		a.requests.take(now.Add(wait), l.QPS, burst)
+		return true
+	case l.Policy != RequestKick:
+		log.Debugf("Session Id=%d sends requests too fast, request dropped", a.id)
+		return false
+	}
+
+	log.Infof("Session Id=%d sends requests too fast, kicked", a.id)
+	if l.Reason == nil {
+		a.closeWith(CloseTooManyRequests)
+	} else if err := a.kick(a.session, l.Reason, CloseTooManyRequests); err != nil {
+		log.Errorf(err.Error())
+		a.closeWith(CloseTooManyRequests)
+	}
+	return false
+}
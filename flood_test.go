@@ -0,0 +1,90 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package starx
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/packet"
+)
+
+func TestAgent_AdmitDrop(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := newAgent(conn)
+
+	l := &RequestLimit{RateLimit: RateLimit{QPS: 1, Burst: 2}, Policy: RequestDrop}
+	now := time.Now()
+	if !a.admit(l, now) || !a.admit(l, now) {
+		t.Fatal("requests in burst should be admitted")
+	}
+	if a.admit(l, now) {
+		t.Fatal("request beyond the limit should be dropped")
+	}
+	if !a.admit(l, now.Add(time.Second)) {
+		t.Fatal("request should be admitted after tokens refilled")
+	}
+}
+
+func TestAgent_AdmitDelay(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := newAgent(conn)
+
+	l := &RequestLimit{RateLimit: RateLimit{QPS: 50, Burst: 1}, Policy: RequestDelay}
+	a.admit(l, time.Now())
+	start := time.Now()
+	if !a.admit(l, start) {
+		t.Fatal("delayed request should be admitted")
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Fatalf("request beyond the limit should be delayed, elapsed %v", elapsed)
+	}
+}
+
+func TestAgent_AdmitKick(t *testing.T) {
+	conn, peer := net.Pipe()
+	a := newAgent(conn)
+	go handler.serve(a)
+
+	reason := []byte(`{"code":429}`)
+	l := &RequestLimit{RateLimit: RateLimit{QPS: 1, Burst: 1}, Policy: RequestKick, Reason: reason}
+	now := time.Now()
+	a.admit(l, now)
+	go a.admit(l, now)
+
+	data, err := ioutil.ReadAll(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _, err := packet.Unpack(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != packet.Kick || string(p.Data) != string(reason) {
+		t.Fatalf("unexpected packet %v: %s", p.Type, p.Data)
+	}
+	if a.status != statusClosed {
+		t.Fatal("client beyond the limit should be kicked")
+	}
+}
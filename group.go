@@ -80,10 +80,8 @@ func (c *Group) Multicast(route string, v interface{}, filter SessionFilter) err
 		return ErrClosedGroup
 	}
 
-	data, err := serializeOrRaw(v)
-	if err != nil {
-		return err
-	}
+	payloads := newPayloads(v)
+	var err error
 
 	log.Debugf("Type=Multicast Route=%s, Data=%+v", route, v)
 
@@ -94,7 +92,10 @@ func (c *Group) Multicast(route string, v interface{}, filter SessionFilter) err
 		if !filter(s) {
 			continue
 		}
-		err = transporter.push(s, route, data)
+		var data []byte
+		if data, err = payloads.of(s); err == nil {
+			err = transporter.push(s, route, data)
+		}
 		if err != nil {
 			log.Error(err.Error())
 		}
@@ -103,16 +104,14 @@ func (c *Group) Multicast(route string, v interface{}, filter SessionFilter) err
 	return nil
 }
 
-// Push message to all client
-func (c *Group) Broadcast(route string, v interface{}) error {
+// Push message to all client, except the sessions of the ids
+func (c *Group) Broadcast(route string, v interface{}, except ...int64) error {
 	if c.isClosed() {
 		return ErrClosedGroup
 	}
 
-	data, err := serializeOrRaw(v)
-	if err != nil {
-		return err
-	}
+	payloads := newPayloads(v)
+	var err error
 
 	log.Debugf("Type=broadcast Route=%s, Data=%+v", route, v)
 
@@ -120,7 +119,13 @@ func (c *Group) Broadcast(route string, v interface{}) error {
 	defer c.RUnlock()
 
 	for _, s := range c.uids {
-		err = transporter.push(s, route, data)
+		if excluded(s.ID, except) {
+			continue
+		}
+		var data []byte
+		if data, err = payloads.of(s); err == nil {
+			err = transporter.push(s, route, data)
+		}
 		if err != nil {
 			log.Error(err.Error())
 		}
@@ -222,3 +227,13 @@ func (c *Group) Close() error {
 
 	return nil
 }
+
+// excluded reports whether the session id is in the ids excluded
+func excluded(sid int64, except []int64) bool {
+	for _, id := range except {
+		if id == sid {
+			return true
+		}
+	}
+	return false
+}
@@ -7,10 +7,11 @@ import (
 	"github.com/lonnng/starx/session"
 )
 
-func TestChannel_Add(t *testing.T) {
+func TestGroup_Add(t *testing.T) {
 	c := NewGroup("test_add")
 
 	var paraCount = 100
+	defer unbindAll(paraCount)
 	w := make(chan bool, paraCount)
 	for i := 0; i < paraCount; i++ {
 		go func(id int) {
@@ -50,3 +51,12 @@ func TestChannel_Add(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// unbindAll unbinds the sessions bound to uid 1 to n, which are not closed
+func unbindAll(n int) {
+	for uid := int64(1); uid <= int64(n); uid++ {
+		for _, s := range session.SessionsOf(uid) {
+			s.Unbind()
+		}
+	}
+}
@@ -21,14 +21,15 @@
 package starx
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"net"
 	"reflect"
+	"sync/atomic"
+	"time"
 
 	"github.com/lonnng/starx/cluster"
 	"github.com/lonnng/starx/cluster/rpc"
-	"github.com/lonnng/starx/component"
 	"github.com/lonnng/starx/log"
 	"github.com/lonnng/starx/message"
 	"github.com/lonnng/starx/packet"
@@ -45,37 +46,11 @@ const (
 var handler = newHandlerService()
 
 type handlerService struct {
-	serviceMap map[string]*component.Service
+	services
 }
 
 func newHandlerService() *handlerService {
-	return &handlerService{
-		serviceMap: make(map[string]*component.Service),
-	}
-}
-
-func (hs *handlerService) register(rcvr component.Component) error {
-	if hs.serviceMap == nil {
-		hs.serviceMap = make(map[string]*component.Service)
-	}
-
-	s := &component.Service{
-		Type: reflect.TypeOf(rcvr),
-		Rcvr: reflect.ValueOf(rcvr),
-	}
-	s.Name = reflect.Indirect(s.Rcvr).Type().Name()
-
-	if _, ok := hs.serviceMap[s.Name]; ok {
-		return errors.New("handler: service already defined: " + s.Name)
-	}
-
-	if err := s.ScanHandler(); err != nil {
-		return err
-	}
-
-	hs.serviceMap[s.Name] = s
-
-	return nil
+	return &handlerService{services: newServices("handler", false)}
 }
 
 // Handle network connection
@@ -90,29 +65,7 @@ func (hs *handlerService) handle(conn net.Conn) {
 
 	// all user logic will be handled in single goroutine
 	// synchronized in below routine
-	go func() {
-		for {
-			select {
-			case p, ok := <-agent.recvBuffer:
-				if ok && p != nil {
-					hs.processPacket(agent, p)
-				}
-			case m, ok := <-agent.sendBuffer:
-				if ok && m != nil {
-					_, err := agent.socket.Write(m)
-					if err != nil {
-						log.Error(err)
-						agent.Close()
-					}
-				}
-			case <-agent.die:
-				return
-
-			case <-env.die:
-				return
-			}
-		}
-	}()
+	go hs.serve(agent)
 
 	tmp := make([]byte, 0) // save truncated data
 	buf := make([]byte, 2048)
@@ -120,9 +73,10 @@ func (hs *handlerService) handle(conn net.Conn) {
 		n, err := conn.Read(buf)
 		if err != nil {
 			log.Errorf("Read message error: %s, session will be closed immediately", err.Error())
-			agent.Close()
+			agent.closeWith(CloseDisconnected)
 			break // break read packet loop
 		}
+		agent.recordIn(n)
 		tmp = append(tmp, buf[:n]...)
 
 		// save decoded packet
@@ -130,25 +84,142 @@ func (hs *handlerService) handle(conn net.Conn) {
 		for len(tmp) >= packet.HeadLength {
 			p, tmp, err = packet.Unpack(tmp)
 			if err != nil {
-				agent.Close()
+				agent.closeWith(CloseProtocolError)
 				break
 			}
 
 			if p == nil {
 				break
 			}
+			if l := requestLimitOf(); l != nil && p.Type == packet.Data && !agent.admit(l, time.Now()) {
+				if agent.status == statusClosed {
+					break
+				}
+				continue
+			}
 			agent.recvBuffer <- p
 		}
 	}
 }
 
+// serve processes the packets received and writes the packets sent, until
+// the agent closed
+func (hs *handlerService) serve(agent *agent) {
+	// the packets are sealed just before written, and written in one
+	// syscall
+	write := func(packets ...[]byte) {
+		var data []byte
+		for _, p := range packets {
+			sealed, err := agent.sealPacket(p)
+			if err != nil {
+				log.Errorf(err.Error())
+				continue
+			}
+			if len(packets) == 1 {
+				data = sealed
+			} else {
+				data = append(data, sealed...)
+			}
+		}
+		if len(data) == 0 {
+			return
+		}
+		if _, err := agent.socket.Write(data); err != nil {
+			log.Error(err)
+			agent.closeWith(CloseDisconnected)
+			return
+		}
+		agent.recordOut(len(data))
+	}
+
+	// shut writes the kick packet after the packets queued, and closes the
+	// session
+	shut := func(req closeRequest) {
+		if req.kick != nil {
+			write(append(agent.pending(), req.kick)...)
+		}
+		agent.closeWith(req.reason)
+	}
+
+	// pushes coalesced are flushed every tick
+	var flush <-chan time.Time
+	if d := env.coalesceInterval; d > 0 {
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+
+	for {
+		// the close requested is handled before writing the packets queued,
+		// e.g: the slow client disconnected by SendDisconnect
+		select {
+		case req := <-agent.closing:
+			shut(req)
+			return
+		default:
+		}
+
+		select {
+		case p, ok := <-agent.recvBuffer:
+			if ok && p != nil {
+				hs.processPacket(agent, p)
+			}
+		case m, ok := <-agent.sendBuffer:
+			if ok && m != nil {
+				if flush == nil {
+					write(m)
+				} else if packets := agent.batch.add(m); packets != nil {
+					write(packets...)
+				}
+			}
+		case <-flush:
+			if packets := agent.batch.take(); len(packets) > 0 {
+				write(packets...)
+			}
+		case req := <-agent.closing:
+			shut(req)
+			return
+		case <-agent.die:
+			return
+
+		case <-env.die:
+			return
+		}
+	}
+}
+
 func (hs *handlerService) processPacket(a *agent, p *packet.Packet) {
 	switch p.Type {
 	case packet.Handshake:
-		a.status = statusHandshake
+		transporter.setStatus(a, statusHandshake)
+		heartbeat := env.heartbeatInternal.Seconds()
+		sys := map[string]interface{}{"heartbeat": heartbeat}
+		key, err := a.negotiateKey(p.Data)
+		if err != nil {
+			log.Errorf("Session handshake Id=%d failed: %s", a.id, err.Error())
+			a.closeWith(CloseProtocolError)
+			return
+		}
+		if key != "" {
+			sys["key"] = key
+		}
+		token, resumed, err := a.reconnect(p.Data)
+		if err != nil {
+			log.Errorf("Session handshake Id=%d failed: %s", a.id, err.Error())
+			a.closeWith(CloseProtocolError)
+			return
+		}
+		if token != "" {
+			sys["resume"] = token
+			sys["resumed"] = resumed != nil
+		}
+		seri := negotiateSerializer(p.Data)
+		if seri != "" {
+			sys["serializer"] = seri
+		}
 		data, err := json.Marshal(map[string]interface{}{
 			"code": 200,
-			"sys":  map[string]float64{"heartbeat": env.heartbeatInternal.Seconds()},
+			"sys":  sys,
 		})
 		if err != nil {
 			log.Infof(err.Error())
@@ -163,33 +234,75 @@ func (hs *handlerService) processPacket(a *agent, p *packet.Packet) {
 		resp, err := rp.Pack()
 		if err != nil {
 			log.Errorf(err.Error())
-			a.Close()
+			a.closeWith(CloseProtocolError)
 		}
 
 		if err := a.Send(resp); err != nil {
 			log.Errorf(err.Error())
-			a.Close()
+			a.closeWith(CloseDisconnected)
 		}
+		if resumed != nil {
+			transporter.resume(a, resumed)
+		}
+
+		meta := a.session.Meta()
+		meta.Handshake = p.Data
+		meta.Options = handshakeOptions(p.Data, heartbeat)
+		meta.Serializer = seri
+		a.session.SetMeta(meta)
 		log.Debugf("Session handshake Id=%d, Remote=%s", a.id, a.socket.RemoteAddr())
 	case packet.HandshakeAck:
-		a.status = statusWorking
+		transporter.setStatus(a, statusWorking)
 		log.Debugf("Receive handshake ACK Id=%d, Remote=%s", a.id, a.socket.RemoteAddr())
 	case packet.Data:
+		// the messages of migrating session would recreate the sessions
+		// parked on backend servers
+		if atomic.LoadInt32(&a.migrating) == 1 {
+			return
+		}
 		m, err := message.Decode(p.Data)
 		if err != nil {
 			log.Errorf(err.Error())
 			return
 		}
+		if m.Data, err = a.open(m.Data, payloadAAD(p.Type, m)); err != nil {
+			log.Errorf("Session Id=%d: %s", a.id, err.Error())
+			a.closeWith(CloseProtocolError)
+			return
+		}
+		a.session.MarkActive()
+		a.recordRequest()
 		hs.processMessage(a.session, m)
+		persist(a)
 		fallthrough
 	case packet.Heartbeat:
 		go a.heartbeat()
 	default:
 		log.Infof("invalid packet type")
-		a.Close()
+		a.closeWith(CloseProtocolError)
 	}
 }
 
+// handshakeOptions returns the protocol options negotiated in handshake, the
+// sys fields sent by client and the heartbeat of server
+func handshakeOptions(data []byte, heartbeat float64) map[string]interface{} {
+	hs := struct {
+		Sys map[string]interface{} `json:"sys"`
+	}{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &hs); err != nil {
+			log.Debugf("invalid handshake payload: %s", err.Error())
+		}
+	}
+
+	options := make(map[string]interface{}, len(hs.Sys)+1)
+	for k, v := range hs.Sys {
+		options[k] = v
+	}
+	options["heartbeat"] = heartbeat
+	return options
+}
+
 func (hs *handlerService) processMessage(session *session.Session, msg *message.Message) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -207,6 +320,10 @@ func (hs *handlerService) processMessage(session *session.Session, msg *message.
 		return
 	}
 
+	// every message starts a trace, which is propagated to remote servers
+	session.TraceID = rpc.NewTraceID()
+	session.SpanID = rpc.NewSpanID()
+
 	r, err := route.Decode(msg.Route)
 	if err != nil {
 		log.Errorf(err.Error())
@@ -228,11 +345,12 @@ func (hs *handlerService) processMessage(session *session.Session, msg *message.
 
 // current message handle in local server
 func (hs *handlerService) localProcess(session *session.Session, route *route.Route, msg *message.Message) {
-	s, ok := hs.serviceMap[route.Service]
+	s, ok := hs.enter(route.Service, route.Version)
 	if !ok || s == nil {
 		log.Infof("handler: service: " + route.Service + " not found")
 		return
 	}
+	defer s.Release()
 
 	m, ok := s.HandlerMethods[route.Method]
 	if !ok || m == nil {
@@ -245,7 +363,7 @@ func (hs *handlerService) localProcess(session *session.Session, route *route.Ro
 		data = msg.Data
 	} else {
 		data = reflect.New(m.Type.Elem()).Interface()
-		err := serializer.Deserialize(msg.Data, data)
+		err := serializerFor(session).Deserialize(msg.Data, data)
 		if err != nil {
 			log.Errorf("deserialize error: %s", err.Error())
 			return
@@ -254,13 +372,23 @@ func (hs *handlerService) localProcess(session *session.Session, route *route.Ro
 
 	log.Debugf("Uid=%d, Message={%s}, Data=%+v", session.Uid, msg.String(), data)
 
-	ret := m.Method.Func.Call([]reflect.Value{s.Rcvr, reflect.ValueOf(session), reflect.ValueOf(data)})
+	args := []reflect.Value{s.Rcvr}
+	if m.Context {
+		args = append(args, reflect.ValueOf(context.Background()))
+	}
+	args = append(args, reflect.ValueOf(session), reflect.ValueOf(data))
+
+	start := m.Begin()
+	ret := m.Method.Func.Call(args)
+	failed := false
 	if len(ret) > 0 {
 		err := ret[0].Interface()
 		if err != nil {
+			failed = true
 			log.Errorf(err.(error).Error())
 		}
 	}
+	m.End(start, failed)
 }
 
 // current message handle in remote server
@@ -271,6 +399,9 @@ func (hs *handlerService) remoteProcess(session *session.Session, route *route.R
 }
 
 func (hs *handlerService) dumpServiceMap() {
+	hs.RLock()
+	defer hs.RUnlock()
+
 	for sname, s := range hs.serviceMap {
 		for mname := range s.HandlerMethods {
 			log.Infof("registered service: %s.%s", sname, mname)
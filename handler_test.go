@@ -218,3 +218,13 @@ func BenchmarkHandlerCallProtobuf(b *testing.B) {
 	}
 	b.ReportAllocs()
 }
+
+func TestHandshakeOptions(t *testing.T) {
+	options := handshakeOptions([]byte(`{"sys":{"type":"js-websocket","version":"0.0.1"}}`), 30)
+	if options["type"] != "js-websocket" || options["version"] != "0.0.1" || options["heartbeat"] != float64(30) {
+		t.Fatalf("unexpected options: %v", options)
+	}
+	if options = handshakeOptions(nil, 30); len(options) != 1 {
+		t.Fatalf("unexpected options: %v", options)
+	}
+}
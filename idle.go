@@ -0,0 +1,86 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/log"
+)
+
+// IdlePolicy closes the sessions which send no request beyond the limit, the
+// heartbeats do not count, the sessions are checked once per heartbeat
+// interval
+type IdlePolicy struct {
+	Limit   time.Duration // sessions idle beyond the limit are closed
+	Grace   time.Duration // warning pushed the grace period before closed, zero means no warning
+	Route   string        // route of the warning, default: onIdle
+	Warning interface{}   // data of the warning
+}
+
+var (
+	idleLock   sync.RWMutex
+	idlePolicy *IdlePolicy // nil means idle sessions are never closed
+)
+
+// SetIdlePolicy enables closing the idle sessions with the policy, nil
+// disables it, it works on frontend server
+func SetIdlePolicy(p *IdlePolicy) {
+	if p != nil && p.Route == "" {
+		c := *p
+		c.Route = "onIdle"
+		p = &c
+	}
+
+	idleLock.Lock()
+	defer idleLock.Unlock()
+
+	idlePolicy = p
+}
+
+func idlePolicyOf() *IdlePolicy {
+	idleLock.RLock()
+	defer idleLock.RUnlock()
+
+	return idlePolicy
+}
+
+// evictIdle pushes the warning to the idle session once in the grace period,
+// and asks the goroutine writing client to close it beyond the limit, returns
+// true when the close requested
+func (a *agent) evictIdle(now time.Time, p *IdlePolicy) bool {
+	active := a.session.LastActive()
+	idle := now.Sub(active)
+	if idle >= p.Limit {
+		log.Debugf("Session idle timeout, Id=%d, LastActive=%s", a.id, active)
+		a.requestClose(closeRequest{reason: CloseIdle})
+		return true
+	}
+
+	if p.Grace > 0 && idle >= p.Limit-p.Grace && a.warnedAt != active.UnixNano() {
+		a.warnedAt = active.UnixNano()
+		if err := a.session.Push(p.Route, p.Warning); err != nil {
+			log.Errorf("push idle warning failed: %s", err.Error())
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAgent_EvictIdle(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := newAgent(conn)
+	a.status = statusWorking
+
+	p := &IdlePolicy{Limit: 10 * time.Second, Grace: 3 * time.Second, Route: "onIdle", Warning: []byte("idle")}
+	active := a.session.LastActive()
+
+	if a.evictIdle(active.Add(5*time.Second), p) || len(a.sendBuffer) != 0 {
+		t.Fatal("active session should not be warned")
+	}
+	if a.evictIdle(active.Add(8*time.Second), p) || len(a.sendBuffer) != 1 {
+		t.Fatal("warning should be pushed in the grace period")
+	}
+	if a.evictIdle(active.Add(9*time.Second), p) || len(a.sendBuffer) != 1 {
+		t.Fatal("warning should be pushed once")
+	}
+	if !a.evictIdle(active.Add(10*time.Second), p) {
+		t.Fatal("session idle beyond the limit should be closed")
+	}
+	select {
+	case req := <-a.closing:
+		if req.reason != CloseIdle || a.status == statusClosed {
+			t.Fatalf("idle session should be closed by the goroutine writing it, got %v", req.reason)
+		}
+	default:
+		t.Fatal("idle session should be closed")
+	}
+}
@@ -21,12 +21,16 @@
 package starx
 
 import (
+	"context"
+	"crypto/tls"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
 	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/log"
 	"github.com/lonnng/starx/session"
 )
 
@@ -63,10 +67,100 @@ func SetRouter(svrType string, fn func(*session.Session) string) {
 	cluster.Router(svrType, fn)
 }
 
+// SetStrategy set the load balancing strategy of the server type, e.g:
+// cluster.RoundRobin(), cluster.LeastInFlight() or cluster.ConsistentHash(0),
+// the strategy picks a server on every call, instead of binding the session to
+// a random server on first call
+func SetStrategy(svrType string, s cluster.Strategy) {
+	cluster.SetStrategy(svrType, s)
+}
+
+// SetSticky routes all calls of a session to a stable server of the type, so
+// the stateful servers can hold the state of players, remap is called when the
+// server of a session is changed because servers join or leave
+func SetSticky(svrType string, remap cluster.RemapFunc) {
+	cluster.SetStrategy(svrType, cluster.Sticky(0, remap))
+}
+
+// SetShadow mirrors percent of requests to the server type to the shadow
+// server asynchronously, its responses are discarded, which is useful to
+// validate a new build against real traffic, nil server disables mirroring
+func SetShadow(svrType string, svr *cluster.ServerConfig, percent int) {
+	cluster.SetShadow(svrType, svr, percent)
+}
+
 func Register(c component.Component) {
+	compsLock.Lock()
+	defer compsLock.Unlock()
+
+	comps = append(comps, c)
+}
+
+// RegisterVersion registers the component as the version of the service,
+// e.g: v2, different versions of the same service are live simultaneously,
+// and the route like "Service.Method@v2" is dispatched to the best matching
+// version, which is the latest version that not newer than v2, routes
+// without version are dispatched to the unversioned service if registered,
+// or the latest version
+func RegisterVersion(c component.Component, version string) {
+	compsLock.Lock()
+	defer compsLock.Unlock()
+
+	compVersions[c] = version
 	comps = append(comps, c)
 }
 
+// RegisterAlias registers the component, and the names as the aliases of the
+// service, so that the same component answers both the legacy route and the
+// new one during protocol migrations
+func RegisterAlias(names []string, c component.Component) {
+	compsLock.Lock()
+	defer compsLock.Unlock()
+
+	compAliases[c] = names
+	comps = append(comps, c)
+}
+
+// Unregister removes the service from running server, and shuts the component
+// down after the requests in flight completed, later requests to the service
+// fail, the name of versioned service looks like "Service@v2". It waits for the
+// requests, so it must not be called by the methods of the service
+func Unregister(name string) error {
+	return unregisterComp(name)
+}
+
+// Reregister replaces the running service which has the same name with the
+// component, which is useful to hot-patch game logic, requests in flight
+// complete on the old component, which is shut down after them. It must not be
+// called by the methods of the service
+func Reregister(c component.Component) error {
+	return reregisterComp(c, "")
+}
+
+// ReregisterVersion replaces the running version of the service like
+// Reregister, other versions of the service are not affected
+func ReregisterVersion(c component.Component, version string) error {
+	return reregisterComp(c, version)
+}
+
+// Swap replaces the receiver of the running service with the component
+// atomically, the service keeps its name, version and aliases, so there is no
+// registration gap, which is useful to replace stateful services after loading
+// new data, the name of versioned service looks like "Service@v2". The old
+// component is shut down after the calls in flight on it completed, so Swap
+// must not be called by the methods of the service
+func Swap(name string, c component.Component) error {
+	return swapComp(name, c)
+}
+
+// CallTyped calls the remote method of the component registered in this server
+// in process, e.g: CallTyped("Room.Join", uid, &JoinArgs{}), the arguments are
+// plain values, encoded arguments, []byte, are deserialized by the serializer
+// of the service, and the reply is returned without serialization
+func CallTyped(serviceMethod string, args ...interface{}) (interface{}, error) {
+	return remote.callTyped(serviceMethod, args...)
+}
+
 func SetServerID(id string) {
 	id = strings.TrimSpace(id)
 	if id == "" {
@@ -89,6 +183,238 @@ func SetHeartbeatInternal(d time.Duration) {
 	env.heartbeatInternal = d
 }
 
+// SetRPCTimeout set the deadline of remote calls, calls that can not complete
+// in time will fail with a timeout error, and will be dropped by the remote
+// server if the deadline exceeded before dispatch
+func SetRPCTimeout(d time.Duration) {
+	cluster.SetCallTimeout(d)
+}
+
+// SetRPCPoolSize set the count of connections established to every remote
+// server, remote calls will be sent on them in round-robin order
+func SetRPCPoolSize(n int) {
+	cluster.SetPoolSize(n)
+}
+
+// Stats returns the call statistics snapshot of all handler and remote
+// methods registered in current server, keyed by "Service.Method"
+func Stats() map[string]component.MethodStats {
+	stats := make(map[string]component.MethodStats)
+	handler.RLock()
+	for _, s := range handler.serviceMap {
+		for name, st := range s.Stats() {
+			stats[name] = st
+		}
+	}
+	handler.RUnlock()
+
+	remote.RLock()
+	for _, s := range remote.serviceMap {
+		for name, st := range s.Stats() {
+			stats[name] = st
+		}
+	}
+	remote.RUnlock()
+	return stats
+}
+
+// SetRPCBreaker set the circuit breaker config of remote servers, calls to
+// an unhealthy server fail fast with rpc.ErrBreakerOpen, nil config disables
+// circuit breaker
+func SetRPCBreaker(c *rpc.BreakerConfig) {
+	cluster.SetBreakerConfig(c)
+}
+
+// SetRPCCompression set the encoding of payloads between servers, payloads
+// larger than threshold will be compressed, rpc.Identity disables compression
+func SetRPCCompression(enc rpc.Encoding, threshold int) {
+	cluster.SetCompression(enc)
+	rpc.SetCompressThreshold(threshold)
+}
+
+// SetRPCTLSConfig set the tls configs of rpc connections between servers, the
+// server config applies to the rpc listener of backend server, and the client
+// config applies to the connections to remote servers, nil means plain tcp
+func SetRPCTLSConfig(server, client *tls.Config) {
+	env.rpcTLS = server
+	cluster.SetTLSConfig(client)
+}
+
+// SetRPCTLS enable tls of rpc connections between servers, every server
+// presents the certificate, and verifies the peer with the CA, servers also
+// verify the client certificate when mutual is true
+func SetRPCTLS(certFile, keyFile, caFile string, mutual bool) error {
+	server, client, err := loadTLSConfig(certFile, keyFile, caFile, mutual)
+	if err != nil {
+		return err
+	}
+	SetRPCTLSConfig(server, client)
+	return nil
+}
+
+// SetRPCWorkers set the count of goroutines processing the requests of every
+// rpc connection, the requests of different sessions are processed
+// concurrently, and the requests of a session are still processed in order,
+// components should be safe for concurrent use when n greater than 1, default 1
+func SetRPCWorkers(n int) {
+	if n < 1 {
+		panic("rpc workers must be greater than zero")
+	}
+	remote.workers = n
+}
+
+// SetServiceWorkers set the count of goroutines processing the requests of the
+// service, e.g: "Pathfinder", the requests are processed by the pool of the
+// service instead of the connection workers, so heavy services can not starve
+// the light ones, the requests of a session to the service are processed in
+// order, but concurrently with its requests to other services, so the service
+// should not share session state with others, requests are rejected with
+// ErrServerBusy when the pool is full, zero processes the requests on
+// connection workers again
+func SetServiceWorkers(service string, n int) {
+	if n < 0 {
+		panic("service workers must not be negative")
+	}
+	remote.setWorkers(service, n)
+}
+
+// SetRPCCodec set the wire framing of rpc requests and responses, e.g:
+// rpc.JSONLines for debugging, all servers in cluster must use the same codec,
+// default rpc.Msgp
+func SetRPCCodec(c rpc.Codec) {
+	rpc.SetCodec(c)
+}
+
+// SetRPCTransport set the transport of rpc connections between servers, the
+// transport applies to both rpc listener of backend server and the connections
+// to remote servers, tls configs are ignored, the transport should secure the
+// connections itself, e.g: rpc.QUIC, nil means tcp
+func SetRPCTransport(t rpc.Transport) {
+	env.rpcTransport = t
+	cluster.SetTransport(t)
+}
+
+// SetRetryPolicy set the retry policy of remote calls to the server type,
+// which only applies to the idempotent methods listed in the policy
+func SetRetryPolicy(svrType string, policy *cluster.RetryPolicy) {
+	cluster.SetRetryPolicy(svrType, policy)
+}
+
+// UseInterceptor append interceptors which wrap the dispatch of every remote
+// request, interceptors are called in the order they were added
+func UseInterceptor(interceptors ...rpc.Interceptor) {
+	remote.interceptors = append(remote.interceptors, interceptors...)
+}
+
+// SetPanicHandler set the handler of panics in remote methods, the handler
+// decides the error responded to the caller, or panics again to crash the
+// server, panics are logged and responded as internal errors by default
+func SetPanicHandler(h rpc.PanicHandler) {
+	remote.panicHandler = h
+}
+
+// SetConcurrencyLimit set the limit of requests dispatched by remote server
+// concurrently, which should be called before the server starts, nil limit
+// disables the limit
+func SetConcurrencyLimit(limit *ConcurrencyLimit) {
+	if limit == nil || limit.MaxInFlight <= 0 {
+		remote.limiter = nil
+		return
+	}
+	remote.limiter = newLimiter(limit)
+}
+
+// SetMaxQueueDelay set the max time the requests wait in queue, e.g: queued
+// behind the concurrency limit, the requests wait longer, or whose deadline
+// has passed before dispatched, are dropped and responded with
+// rpc.CodeDeadlineExceeded, zero means unlimited
+func SetMaxQueueDelay(d time.Duration) {
+	remote.queueDelay = d
+}
+
+// SetCacheable marks the remote method idempotent, e.g: "Catalog.Items", the
+// replies are cached by arguments, and repeated calls are served from cache
+// without invoking the method until ttl expired, zero ttl disables the cache
+func SetCacheable(serviceMethod string, ttl time.Duration) {
+	remote.cache.setTTL(serviceMethod, ttl)
+}
+
+// SetDedupWindow set the count of recently received calls remembered on every
+// rpc connection, a call resent after timeout is responded with the stored
+// response instead of executed again, see cluster.RetryPolicy.Resend, zero
+// disables deduplication
+func SetDedupWindow(n int) {
+	remote.dedupWindow = n
+}
+
+// SetSlowCallThreshold set the threshold of slow remote calls, the calls take
+// longer than threshold are logged with the method, session, payload size and
+// caller, zero disables the log
+func SetSlowCallThreshold(d time.Duration) {
+	remote.slowCall = d
+}
+
+// SetRateLimit set the rate limit of requests from every calling server, the
+// requests over the limit are rejected with ErrThrottled, which should be
+// called before the server starts, nil limit disables the limit
+func SetRateLimit(limit *RateLimit) {
+	if limit == nil || limit.QPS <= 0 {
+		remote.throttler = nil
+		return
+	}
+	remote.throttler = newThrottler(limit)
+}
+
+// SetSysRPCWeight set the priority of system rpc over user rpc, system
+// requests are processed prior to user requests from the same server, and
+// weight is the max system requests processed in a row while user requests
+// are waiting, 0 for strict priority, which is the default
+func SetSysRPCWeight(weight int) {
+	remote.sysWeight = weight
+}
+
+// SetFallbackHandler set the handler of remote requests whose service or
+// method does not exist, the handler receives the raw request, and the data
+// of user rpc request can be split into arguments by DecodeArgs
+func SetFallbackHandler(h rpc.FallbackHandler) {
+	remote.fallback = h
+}
+
+// DecodeArgs splits the data of user rpc request into arguments, which are
+// serialized by the rpc serializer of the service individually
+func DecodeArgs(data []byte) ([][]byte, error) {
+	return decodeArgs(data)
+}
+
+// SetAccessController set the controller consulted before dispatching every
+// remote request, nil controller allows all requests
+func SetAccessController(c rpc.AccessController) {
+	remote.access = c
+}
+
+// SetMaxPayload set the size limits of the arguments and the replies of remote
+// calls, the oversized requests are rejected with rpc.CodePayloadTooLarge
+// before dispatched, the oversized replies are replaced with the error, and
+// the connection is closed when a frame exceeds the limit far before it is
+// completely received, zero means unlimited
+func SetMaxPayload(args, reply int) {
+	cluster.SetMaxPayload(args, reply)
+	remote.maxArgs, remote.maxReply = args, reply
+}
+
+// SetRPCKeepalive set the keepalive of connections between servers, a ping
+// is sent every interval, and the connection is closed when the peer does not
+// respond in misses intervals, so that half-open connections are detected,
+// all servers in cluster should use the same keepalive, zero interval disables
+// keepalive
+func SetRPCKeepalive(interval time.Duration, misses int) {
+	cluster.SetKeepalive(interval, misses)
+	remote.idleTimeout = 0
+	if interval > 0 && misses > 0 {
+		remote.idleTimeout = interval * time.Duration(misses)
+	}
+}
+
 // SetCheckOriginFunc set the function that check `Origin` in http headers
 func SetCheckOriginFunc(fn func(*http.Request) bool) {
 	env.checkOrigin = fn
@@ -113,3 +439,23 @@ func SetMasterServerID(id string) {
 func Shutdown() {
 	close(env.die)
 }
+
+// GracefulShutdown stops accepting connections and requests, waits for the
+// in-flight remote requests to complete and their responses to be written,
+// then closes the connections and shuts the server down, the waiting is
+// bounded by ctx, and the ctx error returned when in-flight requests do not
+// complete in time
+func GracefulShutdown(ctx context.Context) error {
+	if app.listener != nil {
+		app.listener.Close()
+	}
+
+	err := remote.drain(ctx)
+	if err != nil {
+		log.Errorf("drain in-flight requests failed: %s", err.Error())
+	}
+
+	transporter.closeAcceptors()
+	Shutdown()
+	return err
+}
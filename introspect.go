@@ -0,0 +1,85 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sort"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+)
+
+const (
+	// introspectService is the built-in service describes the services of
+	// the server, replies are always serialized with json
+	introspectService = "__rpc"
+	introspectRoute   = introspectService + ".Introspect"
+)
+
+// Services returns the description of services registered in current server,
+// which are sorted by name and version
+func Services() []component.ServiceInfo {
+	var infos []component.ServiceInfo
+	handler.RLock()
+	for _, s := range handler.serviceMap {
+		infos = append(infos, s.Info())
+	}
+	handler.RUnlock()
+
+	remote.RLock()
+	for _, s := range remote.serviceMap {
+		infos = append(infos, s.Info())
+	}
+	remote.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name != infos[j].Name {
+			return infos[i].Name < infos[j].Name
+		}
+		return infos[i].Version < infos[j].Version
+	})
+	return infos
+}
+
+// Introspect returns the description of services registered in the server of
+// the type, which the session is routed to
+func Introspect(s *session.Session, svrType string) ([]component.ServiceInfo, error) {
+	var infos []component.ServiceInfo
+	if err := s.Call(svrType+"."+introspectRoute, &infos); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// introspect responds the description of services registered in current server
+func (rs *remoteService) introspect(rr *rpc.Request) *rpc.Response {
+	response := newResponse(rr)
+	data, err := serializerOf(introspectService).Serialize(Services())
+	if err != nil {
+		log.Errorf(err.Error())
+		response.SetError(&rpc.Error{Code: rpc.CodeInternal, Message: err.Error()})
+		return response
+	}
+	response.Data = data
+	return response
+}
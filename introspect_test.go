@@ -0,0 +1,44 @@
+package starx
+
+import (
+	"net"
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/component"
+)
+
+func TestRemoteService_Introspect(t *testing.T) {
+	if err := remote.registerVersion(&StubComp{}, "v1"); err != nil {
+		t.Fatal(err)
+	}
+	defer remote.unregister("StubComp@v1")
+
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	rr := &rpc.Request{Kind: rpc.User, ServiceMethod: introspectRoute}
+	response := remote.handleRequest(newAcceptor(1, conn), rr)
+	if response.Error != "" {
+		t.Fatal(response.Error)
+	}
+
+	var infos []component.ServiceInfo
+	if err := serializerOf(introspectService).Deserialize(response.Data, &infos); err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		if info.Name != "StubComp" {
+			continue
+		}
+		if info.Version != "v1" || len(info.Methods) != 2 {
+			t.Fatalf("unexpected service info: %+v", info)
+		}
+		if m := info.Methods[1]; m.Name != "Add" || !m.Remote || m.Reply != "int" {
+			t.Fatalf("unexpected method info: %+v", m)
+		}
+		return
+	}
+	t.Fatalf("StubComp should be described, got %+v", infos)
+}
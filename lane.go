@@ -0,0 +1,114 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import "github.com/lonnng/starx/cluster/rpc"
+
+// lanes queues the requests of a connection in two lanes, the requests of
+// system rpc, e.g: session binding and handler routing, are processed prior
+// to the bulk requests of user rpc
+type lanes struct {
+	sys    chan *unhandledRequest
+	user   chan *unhandledRequest
+	weight int // max system requests processed in a row while user requests waiting, 0 for strict priority
+	served int // system requests processed since the last user request
+}
+
+func newLanes(size, weight int) *lanes {
+	return &lanes{
+		sys:    make(chan *unhandledRequest, size),
+		user:   make(chan *unhandledRequest, size),
+		weight: weight,
+	}
+}
+
+func (l *lanes) push(r *unhandledRequest) {
+	if r.rr.Kind == rpc.Sys {
+		l.sys <- r
+	} else {
+		l.user <- r
+	}
+}
+
+// offer queues the request like push, and reports false instead of blocking
+// when the lane is full
+func (l *lanes) offer(r *unhandledRequest) bool {
+	lane := l.user
+	if r.rr.Kind == rpc.Sys {
+		lane = l.sys
+	}
+	select {
+	case lane <- r:
+		return true
+	default:
+		return false
+	}
+}
+
+// next returns the request to process, it blocks until a request arrived, and
+// returns false when end
+func (l *lanes) next(end <-chan bool) (*unhandledRequest, bool) {
+	// system requests first, unless the weight exhausted
+	if l.weight <= 0 || l.served < l.weight {
+		select {
+		case r := <-l.sys:
+			l.served++
+			return r, true
+		default:
+		}
+	}
+
+	select {
+	case r := <-l.user:
+		l.served = 0
+		return r, true
+	default:
+	}
+
+	select {
+	case r := <-l.sys:
+		l.served++
+		return r, true
+	case r := <-l.user:
+		l.served = 0
+		return r, true
+	case <-end:
+		return nil, false
+	}
+}
+
+// discard releases the queued requests, they are refused with reason if not nil
+func (l *lanes) discard(rs *remoteService, reason *rpc.Error) {
+	for {
+		var r *unhandledRequest
+		select {
+		case r = <-l.sys:
+		case r = <-l.user:
+		default:
+			return
+		}
+		if reason != nil {
+			rs.refuse(r, reason)
+		} else {
+			r.done(rs)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package starx
+
+import (
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+func pushRequests(l *lanes, kinds ...rpc.RpcKind) {
+	for i, kind := range kinds {
+		l.push(&unhandledRequest{rr: &rpc.Request{Kind: kind, Seq: uint64(i)}})
+	}
+}
+
+func nextKinds(t *testing.T, l *lanes, n int) []rpc.RpcKind {
+	end := make(chan bool)
+	kinds := make([]rpc.RpcKind, 0, n)
+	for i := 0; i < n; i++ {
+		r, ok := l.next(end)
+		if !ok {
+			t.Fatal("unexpected end")
+		}
+		kinds = append(kinds, r.rr.Kind)
+	}
+	return kinds
+}
+
+func TestLanes_Strict(t *testing.T) {
+	l := newLanes(16, 0)
+	pushRequests(l, rpc.User, rpc.User, rpc.Sys, rpc.User, rpc.Sys)
+
+	expect := []rpc.RpcKind{rpc.Sys, rpc.Sys, rpc.User, rpc.User, rpc.User}
+	for i, kind := range nextKinds(t, l, len(expect)) {
+		if kind != expect[i] {
+			t.Fatalf("request %d: expect kind %v, got %v", i, expect[i], kind)
+		}
+	}
+}
+
+func TestLanes_Weighted(t *testing.T) {
+	l := newLanes(16, 2)
+	pushRequests(l, rpc.Sys, rpc.Sys, rpc.Sys, rpc.Sys, rpc.Sys, rpc.User, rpc.User)
+
+	expect := []rpc.RpcKind{rpc.Sys, rpc.Sys, rpc.User, rpc.Sys, rpc.Sys, rpc.User, rpc.Sys}
+	for i, kind := range nextKinds(t, l, len(expect)) {
+		if kind != expect[i] {
+			t.Fatalf("request %d: expect kind %v, got %v", i, expect[i], kind)
+		}
+	}
+}
+
+func TestLanes_End(t *testing.T) {
+	l := newLanes(16, 0)
+	end := make(chan bool, 1)
+	end <- true
+	if _, ok := l.next(end); ok {
+		t.Fatal("should end when no request queued")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"strconv"
+
+	"github.com/lonnng/starx/session"
+)
+
+// CloseReason represents why the session is closed
+type CloseReason int
+
+const (
+	// CloseDisconnected means the connection closed by client or network
+	CloseDisconnected CloseReason = iota
+
+	// CloseKicked means the session closed by server, e.g: session.Close
+	CloseKicked
+
+	// CloseHeartbeatTimeout means the client does not send heartbeat in time
+	CloseHeartbeatTimeout
+
+	// CloseProtocolError means the client sends invalid packets
+	CloseProtocolError
+
+	// CloseByFrontend means the backend session closed since the frontend
+	// session closed
+	CloseByFrontend
+
+	// CloseFrontendLost means the backend session closed since the
+	// connection to the frontend server lost
+	CloseFrontendLost
+
+	// CloseMigrated means the session migrated to another frontend server
+	CloseMigrated
+
+	// CloseIdle means the session sends no request beyond the idle limit
+	CloseIdle
+
+	// CloseSlowClient means the client reads too slowly, and the send buffer
+	// overflows with SendDisconnect
+	CloseSlowClient
+
+	// CloseResumed means the session created when client connected is
+	// replaced by the session client resumed with reconnect token
+	CloseResumed
+
+	// CloseTooManyRequests means the client sends requests beyond the rate
+	// limit, and is kicked by RequestKick
+	CloseTooManyRequests
+)
+
+var closeReasonNames = []string{
+	CloseDisconnected:     "Disconnected",
+	CloseKicked:           "Kicked",
+	CloseHeartbeatTimeout: "HeartbeatTimeout",
+	CloseProtocolError:    "ProtocolError",
+	CloseByFrontend:       "ByFrontend",
+	CloseFrontendLost:     "FrontendLost",
+	CloseMigrated:         "Migrated",
+	CloseIdle:             "Idle",
+	CloseSlowClient:       "SlowClient",
+	CloseResumed:          "Resumed",
+	CloseTooManyRequests:  "TooManyRequests",
+}
+
+func (r CloseReason) String() string {
+	if r >= 0 && int(r) < len(closeReasonNames) {
+		return closeReasonNames[r]
+	}
+	return strconv.Itoa(int(r))
+}
+
+func (t *transportService) sessionCreatedCallback(cb func(*session.Session)) {
+	t.sessionCbLock.Lock()
+	defer t.sessionCbLock.Unlock()
+
+	t.sessionCreateCb = append(t.sessionCreateCb, cb)
+}
+
+// sessionCreated fires the callbacks on session created
+func (t *transportService) sessionCreated(s *session.Session) {
+	t.sessionCbLock.RLock()
+	defer t.sessionCbLock.RUnlock()
+
+	for _, cb := range t.sessionCreateCb {
+		cb(s)
+	}
+}
+
+// sessionClosed fires the callbacks on session closed
+func (t *transportService) sessionClosed(s *session.Session, reason CloseReason) {
+	t.sessionCbLock.RLock()
+	defer t.sessionCbLock.RUnlock()
+
+	for _, cb := range t.sessionCloseCb {
+		if cb != nil {
+			cb(s, reason)
+		}
+	}
+}
+
+// OnSessionCreated registers the callback fired when a session established,
+// on frontend server it is fired when client connected, and on backend
+// server it is fired when the first request of the frontend session received,
+// game code can load player state here
+func OnSessionCreated(cb func(*session.Session)) {
+	transporter.sessionCreatedCallback(cb)
+}
+
+// OnSessionClosedWithReason registers the callback fired when a session torn
+// down with the reason, on both frontend and backend server, game code can
+// persist player state here
+func OnSessionClosedWithReason(cb func(*session.Session, CloseReason)) {
+	transporter.sessionClosedCallback(cb)
+}
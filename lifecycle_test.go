@@ -0,0 +1,70 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/session"
+)
+
+func TestSessionLifecycle(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+
+	var (
+		mu      sync.Mutex
+		created = make(map[*session.Session]int)
+		reasons = make(map[*session.Session]CloseReason)
+	)
+	OnSessionCreated(func(s *session.Session) {
+		mu.Lock()
+		created[s]++
+		mu.Unlock()
+	})
+	OnSessionClosedWithReason(func(s *session.Session, reason CloseReason) {
+		mu.Lock()
+		reasons[s] = reason
+		mu.Unlock()
+	})
+
+	s := ac.Session(9)
+	if ac.Session(9) != s {
+		t.Fatal("session of the same frontend session should be reused")
+	}
+
+	rs := newRemote()
+	rs.handleRequest(ac, &rpc.Request{Kind: rpc.Sys, ServiceMethod: sessionClosedRoute, Sid: 9})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if created[s] != 1 {
+		t.Fatalf("created callback should be fired once, got %d", created[s])
+	}
+	if reason, ok := reasons[s]; !ok || reason != CloseByFrontend {
+		t.Fatalf("expect closed by frontend, got %v", reason)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+)
+
+// ErrServerBusy is responded when the requests exceed the concurrency limit
+var ErrServerBusy = errors.New("remote: server is busy")
+
+// OverflowPolicy decides how to handle the requests over the concurrency limit
+type OverflowPolicy int
+
+const (
+	// OverflowQueue queues the requests until the running ones complete,
+	// and rejects the requests when the queue is full
+	OverflowQueue OverflowPolicy = iota
+
+	// OverflowReject rejects the requests immediately
+	OverflowReject
+)
+
+// ConcurrencyLimit limits the requests dispatched by remote server concurrently,
+// the requests over the limit are rejected with ErrServerBusy, so a flood of
+// calls can not exhaust the goroutines and memory of the server
+type ConcurrencyLimit struct {
+	MaxInFlight int            // max requests in processing or waiting in connection queues
+	Overflow    OverflowPolicy // how to handle the requests over the limit
+	MaxQueue    int            // max requests waiting for the limit with OverflowQueue
+}
+
+type limiter struct {
+	sem      chan struct{} // slots of the requests in processing
+	overflow OverflowPolicy
+	max      int32
+	maxQueue int32
+	admitted int32 // requests admitted and not completed, in processing or queued
+}
+
+func newLimiter(c *ConcurrencyLimit) *limiter {
+	return &limiter{
+		sem:      make(chan struct{}, c.MaxInFlight),
+		overflow: c.Overflow,
+		max:      int32(c.MaxInFlight),
+		maxQueue: int32(c.MaxQueue),
+	}
+}
+
+// admission of a request by the limiter
+type admission int
+
+const (
+	admitNow      admission = iota // under the limit
+	admitQueued                    // waits for the limit in the queue of its worker
+	admitRejected                  // over the limit
+)
+
+// acquire admits the request without blocking, the admitted request takes a
+// slot with wait when its worker dequeues it, or cancel
+func (l *limiter) acquire() admission {
+	n := atomic.AddInt32(&l.admitted, 1)
+	if n <= l.max {
+		return admitNow
+	}
+	if l.overflow == OverflowQueue && n <= l.max+l.maxQueue {
+		return admitQueued
+	}
+	atomic.AddInt32(&l.admitted, -1)
+	return admitRejected
+}
+
+// wait blocks the dequeued request until a slot is free. Slots are taken by
+// the requests dequeued only, never by the arrivals, so a worker waits for
+// the requests in processing, none of them is queued behind it
+func (l *limiter) wait() {
+	l.sem <- struct{}{}
+}
+
+// cancel gives up the request has not taken a slot
+func (l *limiter) cancel() {
+	atomic.AddInt32(&l.admitted, -1)
+}
+
+// release frees the slot of the request completed
+func (l *limiter) release() {
+	<-l.sem
+	atomic.AddInt32(&l.admitted, -1)
+}
+
+// limited reports whether the request is under the concurrency limit, frames
+// of opened streams and session closed notifications are always accepted
+func limited(rr *rpc.Request) bool {
+	return rr.Stream == 0 && !isSessionClosedRequest(rr)
+}
+
+// admit reports whether the request is admitted, the request over the limit
+// is rejected, the returned limiter should be waited for before the request
+// processed. The goroutine reading the connection never blocks, so the
+// cancellations, pings and stream frames are read while requests queued, the
+// admitted request waits for the limit in its worker
+func (rs *remoteService) admit(ac *acceptor, rr *rpc.Request) (l *limiter, ok bool) {
+	l = rs.limiter
+	if l == nil || !limited(rr) {
+		return nil, true
+	}
+	if l.acquire() != admitRejected {
+		return l, true
+	}
+	rs.reject(ac, rr, &rpc.Error{Code: rpc.CodeUnavailable, Message: ErrServerBusy.Error()})
+	return nil, false
+}
+
+// reject responds the error to the request, requests in batch are responded
+// one by one
+func (rs *remoteService) reject(ac *acceptor, rr *rpc.Request, reason *rpc.Error) {
+	if rr.Kind != rpc.Batch {
+		if rr.Notify {
+			return
+		}
+		response := newResponse(rr)
+		response.SetError(reason)
+		if err := ac.writeResponse(response); err != nil {
+			log.Errorf(err.Error())
+		}
+		rpc.FreeResponse(response)
+		return
+	}
+
+	batch, err := rs.decodeBatch(rr)
+	if err != nil {
+		log.Errorf("remote: invalid batch request: %s", err.Error())
+		return
+	}
+
+	responses := rpc.BatchResponse{Responses: make([]rpc.Response, 0, len(batch.Requests))}
+	for i := range batch.Requests {
+		if batch.Requests[i].Notify {
+			continue
+		}
+		response := newResponse(&batch.Requests[i])
+		response.SetError(reason)
+		responses.Responses = append(responses.Responses, *response)
+		rpc.FreeResponse(response)
+	}
+	writeBatchResponse(ac, responses)
+}
+
+// expired reports whether the deadline of queued request has passed, or it
+// waits in queue longer than the max queue delay, nobody waits for the reply
+// or the reply is useless, system requests are never dropped for queue delay
+func (rs *remoteService) expired(r *unhandledRequest) bool {
+	if !limited(r.rr) {
+		return false
+	}
+	now := time.Now()
+	if r.rr.Deadline > 0 && now.UnixNano() > r.rr.Deadline {
+		return true
+	}
+	return rs.queueDelay > 0 && r.rr.Kind != rpc.Sys && !r.arrived.IsZero() &&
+		now.Sub(r.arrived) > rs.queueDelay
+}
+
+// drop responds the expired error to the request instead of dispatching it
+func (rs *remoteService) drop(r *unhandledRequest) {
+	log.Infof("remote: drop expired call %s, Sid=%d, queued %v", r.rr.ServiceMethod, r.rr.Sid, time.Since(r.arrived))
+	if r.bs.dedup != nil && cancellable(r.rr) {
+		r.bs.dedup.forget(r.rr.Seq)
+	}
+	rs.reject(r.bs, r.rr, &rpc.Error{Code: rpc.CodeDeadlineExceeded, Message: rpc.ErrDeadlineExceeded.Error()})
+}
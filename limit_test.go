@@ -0,0 +1,193 @@
+package starx
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+func TestLimiter_Reject(t *testing.T) {
+	l := newLimiter(&ConcurrencyLimit{MaxInFlight: 2, Overflow: OverflowReject})
+	if l.acquire() != admitNow || l.acquire() != admitNow {
+		t.Fatal("requests under the limit should be admitted")
+	}
+	if l.acquire() != admitRejected {
+		t.Fatal("request over the limit should be rejected")
+	}
+	l.wait()
+	l.release()
+	if l.acquire() != admitNow {
+		t.Fatal("request should be admitted after released")
+	}
+}
+
+func TestLimiter_Queue(t *testing.T) {
+	l := newLimiter(&ConcurrencyLimit{MaxInFlight: 1, Overflow: OverflowQueue, MaxQueue: 1})
+	if l.acquire() != admitNow {
+		t.Fatal("request under the limit should be admitted")
+	}
+	l.wait()
+	if l.acquire() != admitQueued {
+		t.Fatal("request over the limit should be queued")
+	}
+	if l.acquire() != admitRejected {
+		t.Fatal("request should be rejected when the queue is full")
+	}
+
+	admitted := make(chan bool, 1)
+	go func() {
+		l.wait()
+		admitted <- true
+	}()
+	select {
+	case <-admitted:
+		t.Fatal("queued request should wait for the limit")
+	case <-time.After(10 * time.Millisecond):
+	}
+	l.release()
+	<-admitted
+	if atomic.LoadInt32(&l.admitted) != 1 {
+		t.Fatal("completed request should leave the limit")
+	}
+
+	// the queued request canceled leaves room in the queue
+	if l.acquire() != admitQueued {
+		t.Fatal("request over the limit should be queued")
+	}
+	l.cancel()
+	if l.acquire() != admitQueued {
+		t.Fatal("canceled request should leave the queue")
+	}
+}
+
+func TestLimiter_ArrivalTakesNoSlot(t *testing.T) {
+	l := newLimiter(&ConcurrencyLimit{MaxInFlight: 1, Overflow: OverflowQueue, MaxQueue: 2})
+	l.acquire()
+	l.wait()
+	if l.acquire() != admitQueued {
+		t.Fatal("request over the limit should be queued")
+	}
+	l.release()
+
+	// the request arrives before the queued one dequeued, it waits behind
+	// the queued one in the worker, and must not hold the slot freed
+	if l.acquire() != admitQueued {
+		t.Fatal("arrival should be queued while others queued")
+	}
+	admitted := make(chan bool, 1)
+	go func() {
+		l.wait()
+		admitted <- true
+	}()
+	select {
+	case <-admitted:
+	case <-time.After(time.Second):
+		t.Fatal("queued request should take the slot freed")
+	}
+}
+
+func TestRemoteService_LimitQueue(t *testing.T) {
+	rs := newRemote()
+	rs.limiter = newLimiter(&ConcurrencyLimit{MaxInFlight: 1, Overflow: OverflowQueue, MaxQueue: 1})
+	comp := &SlowComp{release: make(chan struct{})}
+	if err := rs.register(comp); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer := net.Pipe()
+	go rs.handle(conn)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	seri := serializerOf("SlowComp")
+	blocked, _ := encodeArgs(seri, true)
+	fast, _ := encodeArgs(seri, false)
+
+	slow := client.AsyncCall(rpc.User, "SlowComp", "Wait", 1, blocked, nil)
+	queued := client.AsyncCall(rpc.User, "SlowComp", "Wait", 2, fast, nil)
+
+	// the connection is still read while a request waits for the limit
+	rejected := client.AsyncCall(rpc.User, "SlowComp", "Wait", 3, fast, nil)
+	select {
+	case call := <-rejected.Done:
+		if rpc.Code(call.Error) != rpc.CodeUnavailable {
+			t.Fatalf("expect call over the queue rejected, got: %v", call.Error)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call over the queue should be rejected while others queued")
+	}
+
+	close(comp.release)
+	for _, call := range []*rpc.Call{slow, queued} {
+		if call := <-call.Done; call.Error != nil {
+			t.Fatal(call.Error)
+		}
+	}
+}
+
+func TestLimited(t *testing.T) {
+	if !limited(&rpc.Request{ServiceMethod: "Room.Join"}) {
+		t.Fatal("requests should be limited")
+	}
+	if limited(&rpc.Request{ServiceMethod: "Room.Watch", Stream: rpc.StreamData}) {
+		t.Fatal("stream frames should not be limited")
+	}
+	if limited(&rpc.Request{ServiceMethod: sessionClosedRoute}) {
+		t.Fatal("session closed notifications should not be limited")
+	}
+}
+
+func TestRemoteService_Expired(t *testing.T) {
+	rs := newRemote()
+	rs.queueDelay = 10 * time.Millisecond
+
+	queued := time.Now().Add(-20 * time.Millisecond)
+	if !rs.expired(&unhandledRequest{rr: &rpc.Request{Kind: rpc.User, ServiceMethod: "Room.Join"}, arrived: queued}) {
+		t.Fatal("request queued longer than the max delay should expire")
+	}
+	if rs.expired(&unhandledRequest{rr: &rpc.Request{Kind: rpc.Sys, ServiceMethod: "Room.Join"}, arrived: queued}) {
+		t.Fatal("system request should not expire for queue delay")
+	}
+	if rs.expired(&unhandledRequest{rr: &rpc.Request{Kind: rpc.User, ServiceMethod: "Room.Join"}, arrived: time.Now()}) {
+		t.Fatal("fresh request should not expire")
+	}
+
+	deadline := time.Now().Add(-time.Millisecond).UnixNano()
+	rr := &rpc.Request{Kind: rpc.Sys, ServiceMethod: "Room.Join", Deadline: deadline}
+	if !rs.expired(&unhandledRequest{rr: rr, arrived: time.Now()}) {
+		t.Fatal("request should expire when the deadline passed")
+	}
+}
+
+func TestRemoteService_QueueDelay(t *testing.T) {
+	rs := newRemote()
+	rs.queueDelay = 20 * time.Millisecond
+	comp := &SlowComp{release: make(chan struct{})}
+	if err := rs.register(comp); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer := net.Pipe()
+	go rs.handle(conn)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	seri := serializerOf("SlowComp")
+	blocked, _ := encodeArgs(seri, true)
+	fast, _ := encodeArgs(seri, false)
+
+	slow := client.AsyncCall(rpc.User, "SlowComp", "Wait", 1, blocked, nil)
+	queued := client.AsyncCall(rpc.User, "SlowComp", "Wait", 1, fast, nil)
+	time.Sleep(50 * time.Millisecond)
+	close(comp.release)
+
+	if call := <-slow.Done; call.Error != nil {
+		t.Fatal(call.Error)
+	}
+	if call := <-queued.Done; rpc.Code(call.Error) != rpc.CodeDeadlineExceeded {
+		t.Fatalf("expect queued call expired, got: %v", call.Error)
+	}
+}
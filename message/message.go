@@ -21,6 +21,7 @@ const (
 const (
 	msgRouteCompressMask = 0x01
 	msgTypeMask          = 0x07
+	msgCodeMask          = 0x10
 	msgRouteLengthMask   = 0xFF
 	msgHeadLength        = 0x03
 )
@@ -46,6 +47,7 @@ var (
 type Message struct {
 	Type       MessageType
 	ID         uint
+	Code       uint // status code of response, zero means success
 	Route      string
 	Data       []byte
 	compressed bool
@@ -85,8 +87,11 @@ func invalidType(t MessageType) bool {
 // request  |----000-|<message id>|<route>
 // notify   |----001-|<route>
 // response |----010-|<message id>
+// response |---1010-|<message id>|<status code>
 // push     |----011-|<route>
 // The figure above indicates that the bit does not affect the type of message.
+// The status code of response is encoded only when it is not zero, and the 5th
+// bit of flag is set.
 func Encode(m *Message) ([]byte, error) {
 	if invalidType(m.Type) {
 		log.Errorf("wrong message type")
@@ -100,21 +105,17 @@ func Encode(m *Message) ([]byte, error) {
 	if compressed {
 		flag |= msgRouteCompressMask
 	}
+	withCode := m.Type == Response && m.Code != 0
+	if withCode {
+		flag |= msgCodeMask
+	}
 	buf = append(buf, flag)
 
 	if m.Type == Request || m.Type == Response {
-		n := m.ID
-		// variant length encode
-		for {
-			b := byte(n % 128)
-			n >>= 7
-			if n != 0 {
-				buf = append(buf, b+128)
-			} else {
-				buf = append(buf, b)
-				break
-			}
-		}
+		buf = appendVarint(buf, m.ID)
+	}
+	if withCode {
+		buf = appendVarint(buf, m.Code)
 	}
 
 	if msgRoute(m.Type) {
@@ -147,19 +148,10 @@ func Decode(data []byte) (*Message, error) {
 	}
 
 	if m.Type == Request || m.Type == Response {
-		id := uint(0)
-		// little end byte order
-		// WARNING: must can be stored in 64 bits integer
-		// variant length encode
-		for i := offset; i < len(data); i++ {
-			b := data[i]
-			id += (uint(b&0x7F) << uint(7*(i-offset)))
-			if b < 128 {
-				offset = i + 1
-				break
-			}
-		}
-		m.ID = id
+		m.ID, offset = readVarint(data, offset)
+	}
+	if m.Type == Response && flag&msgCodeMask != 0 {
+		m.Code, offset = readVarint(data, offset)
 	}
 
 	if msgRoute(m.Type) {
@@ -206,3 +198,32 @@ func SetDict(dict map[string]uint16) {
 		codeDict[code] = r
 	}
 }
+
+// variant length encode
+func appendVarint(buf []byte, n uint) []byte {
+	for {
+		b := byte(n % 128)
+		n >>= 7
+		if n != 0 {
+			buf = append(buf, b+128)
+		} else {
+			return append(buf, b)
+		}
+	}
+}
+
+// readVarint decodes the variant length integer at offset, returns the value
+// and the offset after it
+// little end byte order
+// WARNING: must can be stored in 64 bits integer
+func readVarint(data []byte, offset int) (uint, int) {
+	n := uint(0)
+	for i := offset; i < len(data); i++ {
+		b := data[i]
+		n += (uint(b&0x7F) << uint(7*(i-offset)))
+		if b < 128 {
+			return n, i + 1
+		}
+	}
+	return n, offset
+}
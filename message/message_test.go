@@ -162,3 +162,30 @@ func TestEncode(t *testing.T) {
 		t.Error("not equal")
 	}
 }
+
+func TestEncode_ResponseCode(t *testing.T) {
+	m := &Message{
+		Type: Response,
+		ID:   300,
+		Code: 4001,
+		Data: []byte(`invalid name`),
+	}
+	em, err := m.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm, err := Decode(em)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, dm) {
+		t.Fatalf("not equal: %s", dm)
+	}
+
+	// success response is encoded as before
+	m.Code = 0
+	em, _ = m.Encode()
+	if em[0]&msgCodeMask != 0 {
+		t.Fatal("code flag should not be set for success response")
+	}
+}
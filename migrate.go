@@ -0,0 +1,311 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	ErrNoSessionStore   = errors.New("session store not set")
+	ErrNotFrontendSvr   = errors.New("migration target is not a frontend server")
+	ErrSessionMigrating = errors.New("session is migrating")
+)
+
+// migrateTimeout is how long the backend servers keep the parked sessions,
+// which are closed when no frontend server adopts them in time
+var migrateTimeout = time.Minute
+
+var (
+	parkLock sync.Mutex
+	parked   = make(map[string]*session.Session) // token -> parked backend session
+)
+
+// Redirect is delivered to the client by the kick packet when its session
+// migrates, the client reconnects to the host, and resumes the session with
+// the token, e.g: sends it in the login request whose handler calls
+// ResumeSession
+type Redirect struct {
+	Host  string `json:"host"`
+	Port  int    `json:"port"`
+	Token string `json:"token"`
+}
+
+// MigrateSession transfers the session to the frontend server svrId, so the
+// frontend server can be drained without dropping players. The backend
+// servers park the session, the uid, attributes and the pushes not sent yet
+// are saved in the session store, then the client is redirected to the target
+// server. The session store must be shared by the frontend servers
+func MigrateSession(s *session.Session, svrId string) error {
+	a, ok := s.Entity.(*agent)
+	if !ok {
+		return ErrNotFrontend
+	}
+	store := storeOf()
+	if store == nil {
+		return ErrNoSessionStore
+	}
+	svr, err := cluster.Server(svrId)
+	if err != nil {
+		return err
+	}
+	if !svr.IsFrontend {
+		return ErrNotFrontendSvr
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	// stop dispatching the messages of client before parking
+	if !atomic.CompareAndSwapInt32(&a.migrating, 0, 1) {
+		return ErrSessionMigrating
+	}
+	servers, err := cluster.ParkSession(s, token)
+	if err != nil {
+		atomic.StoreInt32(&a.migrating, 0)
+		return err
+	}
+
+	snapshot := s.Snapshot()
+	snapshot.Servers = servers
+	snapshot.Pending = a.pending()
+	if err := store.Save(migrateKey(token), snapshot); err != nil {
+		return err
+	}
+	return a.kick(s, &Redirect{Host: svr.Host, Port: svr.Port, Token: token}, CloseMigrated)
+}
+
+// ResumeSession restores the session migrated by MigrateSession with the
+// token delivered to the client, the backend servers attach the parked
+// session to s, and the pushes not sent before migration are sent to client
+func ResumeSession(s *session.Session, token string) error {
+	if _, ok := s.Entity.(*agent); !ok {
+		return ErrNotFrontend
+	}
+	store := storeOf()
+	if store == nil {
+		return ErrNoSessionStore
+	}
+
+	// the token can be used only once
+	key := migrateKey(token)
+	snapshot, err := store.Load(key)
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(key); err != nil {
+		return err
+	}
+
+	if err := s.Recover(snapshot); err != nil {
+		return err
+	}
+	if err := cluster.AdoptSession(s, token, snapshot.Servers); err != nil {
+		return err
+	}
+	for _, data := range snapshot.Pending {
+		if err := s.Entity.Send(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func migrateKey(token string) string {
+	return "migrate:" + token
+}
+
+// pending takes the packets not sent to the client yet, the pushes coalesced
+// precede the packets buffered
+func (a *agent) pending() [][]byte {
+	packets := a.batch.take()
+	for {
+		select {
+		case data := <-a.sendBuffer:
+			packets = append(packets, data)
+		default:
+			return packets
+		}
+	}
+}
+
+// park detaches the backend session from the frontend session which is
+// migrating, the pushes to the session are buffered until adopted
+func (a *acceptor) park(rr *rpc.Request) *rpc.Response {
+	response := newResponse(rr)
+	if err := rr.DecodeData(); err != nil {
+		response.SetError(&rpc.Error{Code: rpc.CodeInvalidArgument, Message: err.Error()})
+		return response
+	}
+
+	token := string(rr.Data)
+	s := a.Session(rr.Sid)
+	a.removeSession(s.ID)
+	s.Entity = &parkedEntity{id: a.id}
+
+	parkLock.Lock()
+	parked[token] = s
+	parkLock.Unlock()
+
+	time.AfterFunc(migrateTimeout, func() {
+		if s := unpark(token); s != nil {
+			transporter.closeSession(s, CloseFrontendLost)
+		}
+	})
+	return response
+}
+
+// adopt attaches the parked session to the frontend session which the
+// session migrated to
+func (a *acceptor) adopt(rr *rpc.Request) *rpc.Response {
+	response := newResponse(rr)
+	if err := rr.DecodeData(); err != nil {
+		response.SetError(&rpc.Error{Code: rpc.CodeInvalidArgument, Message: err.Error()})
+		return response
+	}
+
+	s := unpark(string(rr.Data))
+	if s == nil {
+		response.SetError(&rpc.Error{Code: rpc.CodeNotFound, Message: ErrSessionNotFound.Error()})
+		return response
+	}
+	a.attach(rr.Sid, s)
+
+	// the buffered pushes are delivered through the entity of session
+	entity := s.Entity.(*parkedEntity)
+	s.Entity = a
+	entity.adopt(a)
+	return response
+}
+
+func unpark(token string) *session.Session {
+	parkLock.Lock()
+	defer parkLock.Unlock()
+
+	s, ok := parked[token]
+	if !ok {
+		return nil
+	}
+	delete(parked, token)
+	return s
+}
+
+// attach adds the backend session of the frontend session sid, the session
+// created before attached is replaced
+func (a *acceptor) attach(sid int64, s *session.Session) {
+	a.sessionLock.Lock()
+	replaced, ok := a.sessionMap[a.f2bMap[sid]]
+	if ok {
+		delete(a.sessionMap, replaced.ID)
+		delete(a.b2fMap, replaced.ID)
+	}
+	a.sessionMap[s.ID] = s
+	a.f2bMap[sid] = s.ID
+	a.b2fMap[s.ID] = sid
+	a.sessionLock.Unlock()
+
+	if ok {
+		transporter.closeSession(replaced, CloseByFrontend)
+	}
+}
+
+// parkedEntity is the entity of the parked session, which buffers the pushes
+// and responses, and delivers them after the session adopted
+type parkedEntity struct {
+	sync.Mutex
+	id      int64                 // id of the entity parked the session
+	target  session.NetworkEntity // entity adopted the session
+	pending []func(session.NetworkEntity) error
+}
+
+func (e *parkedEntity) do(fn func(session.NetworkEntity) error) error {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.target != nil {
+		return fn(e.target)
+	}
+	e.pending = append(e.pending, fn)
+	return nil
+}
+
+func (e *parkedEntity) adopt(target session.NetworkEntity) {
+	e.Lock()
+	defer e.Unlock()
+
+	for _, fn := range e.pending {
+		if err := fn(target); err != nil {
+			log.Errorf("deliver to adopted session failed: %s", err.Error())
+		}
+	}
+	e.pending = nil
+	e.target = target
+}
+
+func (e *parkedEntity) ID() int64 {
+	return e.id
+}
+
+func (e *parkedEntity) Send(data []byte) error {
+	return e.do(func(t session.NetworkEntity) error { return t.Send(data) })
+}
+
+func (e *parkedEntity) Push(s *session.Session, route string, v interface{}) error {
+	return e.do(func(t session.NetworkEntity) error { return t.Push(s, route, v) })
+}
+
+func (e *parkedEntity) Response(s *session.Session, v interface{}) error {
+	return e.do(func(t session.NetworkEntity) error { return t.Response(s, v) })
+}
+
+func (e *parkedEntity) ResponseWithCode(s *session.Session, code uint, v interface{}) error {
+	return e.do(func(t session.NetworkEntity) error { return t.ResponseWithCode(s, code, v) })
+}
+
+func (e *parkedEntity) Kick(s *session.Session, v interface{}) error {
+	return e.do(func(t session.NetworkEntity) error { return t.Kick(s, v) })
+}
+
+func (e *parkedEntity) Call(*session.Session, string, interface{}, ...interface{}) error {
+	return ErrSessionMigrating
+}
+
+func (e *parkedEntity) Close() {}
@@ -0,0 +1,129 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/message"
+)
+
+func TestSessionMigrate(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	from := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(from)
+
+	conn, peer = net.Pipe()
+	defer peer.Close()
+	to := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(to)
+
+	s := from.Session(5)
+	s.Set("room", "lobby")
+
+	rs := newRemote()
+	token := []byte("token")
+	response := rs.handleRequest(from, &rpc.Request{Kind: rpc.Sys, ServiceMethod: sessionParkRoute, Sid: 5, Data: token})
+	if response.ErrorCode != rpc.CodeOK {
+		t.Fatalf("park failed: %s", response.Error)
+	}
+	if from.Session(5) == s {
+		t.Fatal("parked session should be detached from the frontend session")
+	}
+
+	// pushed while migrating
+	if err := s.Push("onChat", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 512)
+		if n, err := peer.Read(buf); err == nil {
+			received <- buf[:n]
+		}
+	}()
+
+	response = rs.handleRequest(to, &rpc.Request{Kind: rpc.Sys, ServiceMethod: sessionAdoptRoute, Sid: 8, Data: token})
+	if response.ErrorCode != rpc.CodeOK {
+		t.Fatalf("adopt failed: %s", response.Error)
+	}
+	if to.Session(8) != s || s.String("room") != "lobby" {
+		t.Fatal("parked session should be adopted with its attributes")
+	}
+
+	select {
+	case data := <-received:
+		if !bytes.Contains(data, []byte("onChat")) || !bytes.Contains(data, []byte("hello")) {
+			t.Fatalf("unexpected push delivered after adopted: %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("push buffered while migrating should be delivered after adopted")
+	}
+
+	response = rs.handleRequest(to, &rpc.Request{Kind: rpc.Sys, ServiceMethod: sessionAdoptRoute, Sid: 9, Data: token})
+	if response.ErrorCode != rpc.CodeNotFound {
+		t.Fatal("token should be used only once")
+	}
+}
+
+func TestSessionMigrate_AccessController(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+
+	rs := newRemote()
+	rs.access = rpc.AccessControllerFunc(func(kind rpc.RpcKind, serviceMethod string, sid int64, p *rpc.Peer) error {
+		return rpc.Errorf(rpc.CodePermissionDenied, "%s is not allowed", serviceMethod)
+	})
+	for _, route := range []string{sessionParkRoute, sessionAdoptRoute} {
+		response := rs.handleRequest(ac, &rpc.Request{Kind: rpc.Sys, ServiceMethod: route, Sid: 5, Data: []byte("token")})
+		if response.ErrorCode != rpc.CodePermissionDenied {
+			t.Fatalf("%s should be checked by access controller, got %d", route, response.ErrorCode)
+		}
+	}
+	if unpark("token") != nil {
+		t.Fatal("denied park should not park the session")
+	}
+}
+
+func TestAgent_Pending(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := transporter.createAgent(conn)
+	defer a.closeWith(CloseKicked)
+
+	coalesced := encodePacket(t, &message.Message{Type: message.Push, Route: "onMove", Data: []byte("1")})
+	buffered := encodePacket(t, &message.Message{Type: message.Push, Route: "onMove", Data: []byte("2")})
+	a.batch.add(coalesced)
+	a.sendBuffer <- buffered
+
+	pending := a.pending()
+	if len(pending) != 2 || !bytes.Equal(pending[0], coalesced) || !bytes.Equal(pending[1], buffered) {
+		t.Fatalf("pending should take the coalesced pushes before the buffered packets, got %q", pending)
+	}
+}
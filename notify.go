@@ -0,0 +1,50 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
+	routelib "github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/session"
+)
+
+// Notify invokes a remote method without waiting for reply, the remote server
+// never responses, which saves a round trip for the events that need no
+// acknowledgment, e.g: analytics, presence pings
+func Notify(s *session.Session, route string, args ...interface{}) error {
+	r, err := routelib.Decode(route)
+	if err != nil {
+		return err
+	}
+
+	if app.config.Type == r.ServerType {
+		return ErrRPCLocal
+	}
+
+	seri := serializerOf(r.Service)
+	data, err := encodeArgs(seri, args...)
+	if err != nil {
+		return err
+	}
+
+	return cluster.Notify(rpc.User, r, s, data)
+}
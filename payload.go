@@ -0,0 +1,65 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+)
+
+// oversized reports whether the buffered truncated frame exceeds the payload
+// limit, the connection sends it should be closed, since the frame can not be
+// skipped without reading
+func (rs *remoteService) oversized(buffered int) bool {
+	max := rpc.MaxFrame(rs.maxArgs)
+	return max > 0 && buffered > max
+}
+
+// checkArgs returns the error when the arguments of request exceed the limit,
+// it is checked on the wire before queued, decodeArgs limits them again when
+// decompressed
+func (rs *remoteService) checkArgs(rr *rpc.Request) error {
+	if rs.maxArgs > 0 && len(rr.Data) > rs.maxArgs {
+		log.Warnf("remote: arguments of %s too large, %d bytes", rr.ServiceMethod, len(rr.Data))
+		return rpc.PayloadTooLarge("arguments", len(rr.Data), rs.maxArgs)
+	}
+	return nil
+}
+
+// decodeArgs decompresses the arguments of request, the arguments inflated
+// beyond the limit are rejected before decompressed completely
+func (rs *remoteService) decodeArgs(rr *rpc.Request) error {
+	if err := rr.DecodeDataLimit(rs.maxArgs); err != nil {
+		log.Warnf("remote: decode arguments of %s failed: %s", rr.ServiceMethod, err.Error())
+		return err
+	}
+	return nil
+}
+
+// checkReply replaces the oversized reply with the error
+func (rs *remoteService) checkReply(response *rpc.Response) {
+	if rs.maxReply > 0 && len(response.Data) > rs.maxReply {
+		log.Warnf("remote: reply of %s too large, %d bytes", response.ServiceMethod, len(response.Data))
+		err := rpc.PayloadTooLarge("reply", len(response.Data), rs.maxReply)
+		response.Data = nil
+		response.SetError(err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+func TestRemoteService_MaxPayload(t *testing.T) {
+	rs := newRemote()
+	rs.maxArgs, rs.maxReply = 64, 48
+	if err := rs.register(&EchoComp{}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer := net.Pipe()
+	go rs.handle(conn)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	call := func(data []byte) error {
+		args, _ := encodeArgs(serializerOf("EchoComp"), &EchoArgs{Data: data})
+		reply := new([]byte)
+		return client.Call(rpc.User, "EchoComp", "Echo", 1, reply, args)
+	}
+
+	if err := call([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if err := call(bytes.Repeat([]byte("a"), 128)); rpc.Code(err) != rpc.CodePayloadTooLarge {
+		t.Fatalf("expect oversized arguments rejected, got: %v", err)
+	}
+	if err := call(bytes.Repeat([]byte("a"), 40)); rpc.Code(err) != rpc.CodePayloadTooLarge {
+		t.Fatalf("expect oversized reply rejected, got: %v", err)
+	}
+}
+
+func TestRemoteService_OversizedFrame(t *testing.T) {
+	rs := newRemote()
+	rs.maxArgs = 16
+
+	conn, peer := net.Pipe()
+	go rs.handle(conn)
+	defer peer.Close()
+
+	req := &rpc.Request{Kind: rpc.User, ServiceMethod: "EchoComp.Echo", Data: make([]byte, 64<<10)}
+	data, err := req.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the connection is closed before the frame completed
+	done := make(chan error, 1)
+	go func() {
+		_, err := peer.Write(data[:len(data)-1])
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("connection should be closed on oversized frame")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("connection should be closed on oversized frame")
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync"
+
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	storeLock    sync.RWMutex
+	sessionStore session.Store // nil means sessions are not persisted
+)
+
+// SetSessionStore persists the sessions bound to a uid in the store, the
+// frontend saves the snapshot when the session changed under the reconnect
+// token delivered to the client as sys.resume of handshake response, and
+// deletes it when the session closed. A client reconnecting after
+// a frontend crash recovers it by RecoverSession with the last token received
+func SetSessionStore(store session.Store) {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	sessionStore = store
+}
+
+// RecoverSession restores the bound uid and attributes of the session from
+// the snapshot saved under the reconnect token, returns
+// session.ErrSnapshotNotFound when there is no snapshot, a snapshot can be
+// recovered only once
+func RecoverSession(s *session.Session, token string) error {
+	store := storeOf()
+	if store == nil {
+		return session.ErrSnapshotNotFound
+	}
+	key := storeKey(token)
+	snapshot, err := store.Load(key)
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(key); err != nil {
+		return err
+	}
+	if err := s.Recover(snapshot); err != nil {
+		return err
+	}
+
+	// saved again under the token of current connection
+	if a, ok := s.Entity.(*agent); ok {
+		persist(a)
+	}
+	return nil
+}
+
+func storeOf() session.Store {
+	storeLock.RLock()
+	defer storeLock.RUnlock()
+
+	return sessionStore
+}
+
+func storeKey(token string) string {
+	return "session:" + token
+}
+
+// persister saves the snapshots of sessions in background, so the goroutine
+// of client does not wait for the session store, the changes of a session
+// made before its snapshot saved are coalesced
+var persister = &sessionPersister{
+	jobs:  make(map[int64]*persistJob),
+	wake:  make(chan struct{}, 1),
+	saved: make(map[int64]persisted),
+}
+
+type sessionPersister struct {
+	sync.Mutex
+	jobs  map[int64]*persistJob // sid -> latest job not done yet
+	wake  chan struct{}
+	start sync.Once
+
+	saveLock sync.Mutex          // held by the goroutine saving snapshots
+	saved    map[int64]persisted // sid -> snapshot persisted
+}
+
+type persistJob struct {
+	s      *session.Session
+	key    string // key of the snapshot in store
+	closed bool   // the snapshot is deleted
+}
+
+type persisted struct {
+	key      string
+	revision uint64
+}
+
+// persist schedules saving the snapshot of the session of agent if it changed
+// since the revision saved
+func persist(a *agent) {
+	token := a.reconnectToken()
+	if token == "" {
+		return
+	}
+	persister.schedule(&persistJob{s: a.session, key: storeKey(token)})
+}
+
+// forgetSnapshot schedules deleting the snapshot of the closed session
+func forgetSnapshot(s *session.Session) {
+	persister.schedule(&persistJob{s: s, closed: true})
+}
+
+func (p *sessionPersister) schedule(job *persistJob) {
+	if storeOf() == nil {
+		return
+	}
+	p.start.Do(func() { go p.run() })
+
+	p.Lock()
+	p.jobs[job.s.ID] = job
+	p.Unlock()
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *sessionPersister) run() {
+	for range p.wake {
+		p.flush()
+	}
+}
+
+// flush does the jobs scheduled
+func (p *sessionPersister) flush() {
+	p.saveLock.Lock()
+	defer p.saveLock.Unlock()
+
+	p.Lock()
+	jobs := p.jobs
+	p.jobs = make(map[int64]*persistJob)
+	p.Unlock()
+
+	store := storeOf()
+	if store == nil {
+		return
+	}
+	for sid, job := range jobs {
+		last, ok := p.saved[sid]
+		if job.closed {
+			if ok {
+				delete(p.saved, sid)
+				p.delete(store, last.key)
+			}
+			continue
+		}
+		if job.s.Uid <= 0 {
+			continue
+		}
+
+		revision := job.s.Revision()
+		if ok && last.key == job.key && last.revision == revision {
+			continue
+		}
+		if err := store.Save(job.key, job.s.Snapshot()); err != nil {
+			log.Errorf("save session snapshot failed, key=%s, error=%s", job.key, err.Error())
+			continue
+		}
+		p.saved[sid] = persisted{key: job.key, revision: revision}
+
+		// the token rotated by reconnection
+		if ok && last.key != job.key {
+			p.delete(store, last.key)
+		}
+	}
+}
+
+func (p *sessionPersister) delete(store session.Store, key string) {
+	if err := store.Delete(key); err != nil {
+		log.Errorf("delete session snapshot failed, key=%s, error=%s", key, err.Error())
+	}
+}
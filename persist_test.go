@@ -0,0 +1,116 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/lonnng/starx/session"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	saved     map[string]*session.Snapshot
+	saveCount int
+}
+
+func (m *memoryStore) Save(key string, snapshot *session.Snapshot) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.saved[key] = snapshot
+	m.saveCount++
+	return nil
+}
+
+func (m *memoryStore) Load(key string) (*session.Snapshot, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if snapshot, ok := m.saved[key]; ok {
+		return snapshot, nil
+	}
+	return nil, session.ErrSnapshotNotFound
+}
+
+func (m *memoryStore) Delete(key string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.saved, key)
+	return nil
+}
+
+func TestRecoverSession(t *testing.T) {
+	store := &memoryStore{saved: make(map[string]*session.Snapshot)}
+	SetSessionStore(store)
+	defer SetSessionStore(nil)
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	crashed := transporter.createAgent(conn)
+	defer crashed.closeWith(CloseKicked)
+	token, _, err := crashed.reconnect(nil)
+	if err != nil || token == "" {
+		t.Fatalf("reconnect token should be issued with session store, err=%v", err)
+	}
+	crashed.session.Bind(1001)
+	crashed.session.Set("room", "lobby")
+
+	persist(crashed)
+	persister.flush()
+	persist(crashed)
+	persister.flush()
+	if store.saveCount != 1 {
+		t.Fatal("unchanged session should not be saved again")
+	}
+	crashed.session.Unbind()
+
+	conn, peer = net.Pipe()
+	defer peer.Close()
+	a := transporter.createAgent(conn)
+	defer a.closeWith(CloseKicked)
+	next, _, _ := a.reconnect(nil)
+	s := a.session
+	if err := RecoverSession(s, token); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Unbind()
+	if s.Uid != 1001 || s.String("room") != "lobby" {
+		t.Fatalf("unexpected recovered session, uid=%d, room=%s", s.Uid, s.String("room"))
+	}
+	if err := RecoverSession(session.New(nil), token); err != session.ErrSnapshotNotFound {
+		t.Fatalf("snapshot should be recovered only once, got %v", err)
+	}
+
+	// saved under the token of the new connection, and deleted when closed
+	persister.flush()
+	if _, err := store.Load(storeKey(next)); err != nil {
+		t.Fatalf("recovered session should be saved under new token, got %v", err)
+	}
+	forgetSnapshot(s)
+	persister.flush()
+	if _, err := store.Load(storeKey(next)); err != session.ErrSnapshotNotFound {
+		t.Fatalf("snapshot of closed session should be deleted, got %v", err)
+	}
+}
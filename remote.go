@@ -21,148 +21,567 @@
 package starx
 
 import (
-	"bytes"
-	"encoding/gob"
+	"context"
 	"errors"
+	"fmt"
 	"net"
 	"os"
 	"reflect"
 	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/lonnng/starx/cluster/rpc"
 	"github.com/lonnng/starx/component"
 	"github.com/lonnng/starx/log"
 	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/serialize"
+	"github.com/lonnng/starx/session"
 )
 
 var remote = newRemote()
 
+var ErrServerDraining = errors.New("remote: server is shutting down")
+
 type remoteService struct {
-	serviceMap map[string]*component.Service // all handler service
-}
+	services                            // its lock protects pools too
+	interceptors []rpc.Interceptor      // wrap the dispatch of every request
+	panicHandler rpc.PanicHandler       // handle the panic of methods
+	limiter      *limiter               // limit the requests dispatched concurrently
+	throttler    *throttler             // limit the request rate of every caller
+	cache        *replyCache            // cached replies of idempotent methods
+	sysWeight    int                    // max system requests processed in a row while user requests waiting
+	fallback     rpc.FallbackHandler    // handle the requests to unknown routes
+	access       rpc.AccessController   // decide whether the caller can call the method
+	idleTimeout  time.Duration          // close the connection receives nothing in timeout, zero means never
+	workers      int                    // goroutines processing the requests of a connection
+	dedupWindow  int                    // calls remembered for deduplication of every connection, zero means disabled
+	slowCall     time.Duration          // calls take longer than threshold are logged, zero means disabled
+	pools        map[string]*workerPool // service name => worker pool processing the requests of the service
+	maxArgs      int                    // size limit of request arguments, zero means unlimited
+	maxReply     int                    // size limit of replies, zero means unlimited
+	queueDelay   time.Duration          // requests queued longer are dropped before dispatch, zero means unlimited
 
-type unhandledRequest struct {
-	bs *acceptor
-	rr *rpc.Request
+	drainLock sync.Mutex    // protects following
+	inflight  int           // requests and streams in processing
+	draining  bool          // whether stop accepting requests
+	drained   chan struct{} // closed when all in-flight requests completed on draining
 }
 
-func newRemote() *remoteService {
-	return &remoteService{
-		serviceMap: make(map[string]*component.Service),
-	}
+type unhandledRequest struct {
+	bs      *acceptor
+	rr      *rpc.Request
+	l       *limiter  // released after the request completed
+	waiting bool      // has not taken a slot of the limit, takes it when dequeued
+	arrived time.Time // time the request received, before queued behind the limit
 }
 
-func (rs *remoteService) register(rcvr component.Component) error {
-	if rs.serviceMap == nil {
-		rs.serviceMap = make(map[string]*component.Service)
-	}
-
-	s := &component.Service{
-		Type: reflect.TypeOf(rcvr),
-		Rcvr: reflect.ValueOf(rcvr),
+// done releases the resources of the request
+func (r *unhandledRequest) done(rs *remoteService) {
+	if cancellable(r.rr) {
+		r.bs.untrack(r.rr.Seq)
 	}
-	s.Name = reflect.Indirect(s.Rcvr).Type().Name()
-	if _, present := rs.serviceMap[s.Name]; present {
-		return errors.New("remote: service already defined: " + s.Name)
-	}
-
-	if err := s.ScanHandler(); err != nil {
-		return err
+	rpc.FreeRequest(r.rr)
+	if r.l != nil {
+		if r.waiting {
+			r.l.cancel()
+		} else {
+			r.l.release()
+		}
 	}
+	rs.leave()
+}
 
-	if err := s.ScanRemote(); err != nil {
-		return err
+func newRemote() *remoteService {
+	return &remoteService{
+		services: newServices("remote", true),
+		workers:  1,
+		cache:    newReplyCache(),
 	}
-	rs.serviceMap[s.Name] = s
-	return nil
 }
 
 // Server handle request
 func (rs *remoteService) handle(conn net.Conn) {
 	defer conn.Close()
-	// message buffer
-	requestChan := make(chan *unhandledRequest, packetBufferSize)
-	endChan := make(chan bool, 1)
-	// all user logic will be handled in single goroutine
-	// synchronized in below routine
-	go func() {
-		for {
-			select {
-			case r := <-requestChan:
-				rs.processRequest(r.bs, r.rr)
-			case <-endChan:
-				close(requestChan)
-				return
-			}
-		}
-	}()
+	// message buffer, requests are partitioned by session, the requests of
+	// the same session are processed in order, and the responses of different
+	// sessions are written back out of order
+	queues := make([]*lanes, rs.workers)
+	endChan := make(chan bool)
+	for i := range queues {
+		queues[i] = newLanes(packetBufferSize, rs.sysWeight)
+		go rs.work(queues[i], endChan, nil)
+	}
 
 	acceptor := transporter.createAcceptor(conn)
+	if rs.dedupWindow > 0 {
+		acceptor.dedup = newDedupWindow(rs.dedupWindow)
+	}
 	transporter.dumpAcceptor()
 	tmp := make([]byte, 0) // save truncated data
 	buf := make([]byte, 512)
 	for {
+		if rs.idleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(rs.idleTimeout))
+		}
 		n, err := conn.Read(buf)
 		if err != nil {
 			log.Infof("session closed(" + err.Error() + ")")
 			transporter.dumpAcceptor()
 			acceptor.Close()
-			endChan <- true
+			close(endChan)
 			break
 		}
 		tmp = append(tmp, buf[:n]...)
-		// TODO
-		// Refactor this loop
-		// read all request from buffer, and send to handle queue
+		// read all request from buffer, and send to handle queue, the
+		// truncated request is kept until the rest arrived
 		for {
-			rr := &rpc.Request{} // save decoded packet
-			if tmp, err = rr.UnmarshalMsg(tmp); err != nil {
+			rr, rest, err := rpc.DecodeRequest(tmp)
+			if err != nil {
+				log.Errorf(err.Error())
+				tmp = tmp[:0]
+				break
+			}
+			tmp = rest
+			if rr == nil {
+				if rs.oversized(len(tmp)) {
+					log.Warnf("remote: oversized frame from %s, %d bytes buffered", conn.RemoteAddr(), len(tmp))
+					conn.Close()
+				}
 				break
-			} else {
-				requestChan <- &unhandledRequest{acceptor, rr}
 			}
+			// cancellation is handled immediately, the call may be in
+			// processing or queued
+			if rr.Kind == rpc.Cancel {
+				acceptor.cancel(rr.Seq)
+				rpc.FreeRequest(rr)
+				continue
+			}
+			if rr.Kind == rpc.Ping {
+				acceptor.pong()
+				rpc.FreeRequest(rr)
+				continue
+			}
+			if rr.Kind == rpc.Batch {
+				rs.acceptBatch(acceptor, queues, rr)
+				rpc.FreeRequest(rr)
+				continue
+			}
+			rs.accept(acceptor, queues, rr)
 		}
 	}
 }
 
+// accept queues the request admitted, the request rejected is freed
+func (rs *remoteService) accept(ac *acceptor, queues []*lanes, rr *rpc.Request) {
+	if err := rs.checkArgs(rr); err != nil {
+		rs.reject(ac, rr, err.(*rpc.Error))
+		rpc.FreeRequest(rr)
+		return
+	}
+	if rs.duplicate(ac, rr) {
+		rpc.FreeRequest(rr)
+		return
+	}
+	if !rs.throttle(ac, rr) {
+		rpc.FreeRequest(rr)
+		return
+	}
+	arrived := time.Now()
+	rs.hold()
+	l, ok := rs.admit(ac, rr)
+	if !ok {
+		rpc.FreeRequest(rr)
+		rs.leave()
+		return
+	}
+	if cancellable(rr) {
+		ac.track(rr.Seq)
+		if ac.dedup != nil {
+			ac.dedup.begin(rr.Seq)
+		}
+	}
+	rs.enqueue(queues, &unhandledRequest{bs: ac, rr: rr, l: l, waiting: l != nil, arrived: arrived})
+}
+
+// acceptBatch unpacks the batch, and every call in it is admitted and
+// responded like the request sent alone, so the batch does not bypass the
+// rate limit, the concurrency limit and the deduplication
+func (rs *remoteService) acceptBatch(ac *acceptor, queues []*lanes, rr *rpc.Request) {
+	if err := rs.checkArgs(rr); err != nil {
+		rs.reject(ac, rr, err.(*rpc.Error))
+		return
+	}
+	ac.setEncoding(rr.AcceptEncoding)
+
+	batch, err := rs.decodeBatch(rr)
+	if err != nil {
+		log.Errorf("remote: invalid batch request: %s", err.Error())
+		return
+	}
+	for i := range batch.Requests {
+		call := rpc.GetRequest()
+		*call = batch.Requests[i]
+		rs.accept(ac, queues, call)
+	}
+}
+
+// work processes the requests in queue until end, the requests still queued
+// are responded with reason, or discarded silently when reason is nil, e.g: the
+// connection closed
+func (rs *remoteService) work(requests *lanes, end <-chan bool, reason *rpc.Error) {
+	for {
+		r, ok := requests.next(end)
+		if !ok {
+			requests.discard(rs, reason)
+			return
+		}
+		// the time waiting for the limit counts in the queue delay
+		if r.waiting {
+			r.l.wait()
+			r.waiting = false
+		}
+		if rs.expired(r) {
+			rs.drop(r)
+		} else {
+			rs.processRequest(r.bs, r.rr)
+		}
+		r.done(rs)
+	}
+}
+
 func isSessionClosedRequest(rr *rpc.Request) bool {
 	return rr.ServiceMethod == sessionClosedRoute
 }
 
+func newResponse(rr *rpc.Request) *rpc.Response {
+	response := rpc.GetResponse()
+	response.ServiceMethod = rr.ServiceMethod
+	response.Seq = rr.Seq
+	response.Sid = rr.Sid
+	response.Kind = rpc.RemoteResponse
+	response.TraceID = rr.TraceID
+	return response
+}
+
 func (rs *remoteService) processRequest(ac *acceptor, rr *rpc.Request) {
+	// the call abandoned by the caller in queue
+	if cancellable(rr) && ac.callContext(rr.Seq).Err() != nil {
+		if ac.dedup != nil {
+			ac.dedup.forget(rr.Seq)
+		}
+		return
+	}
+
+	response := rs.handleRequest(ac, rr)
+	if ac.dedup != nil && cancellable(rr) {
+		ac.dedup.complete(rr.Seq, response)
+	}
+
+	// invalid request, no response
+	if response == nil {
+		return
+	}
+
+	// nobody waits for the response of the canceled call
+	if cancellable(rr) && ac.callContext(rr.Seq).Err() != nil {
+		rpc.FreeResponse(response)
+		return
+	}
+
+	if err := ac.writeResponse(response); err != nil {
+		log.Errorf(err.Error())
+	}
+	rpc.FreeResponse(response)
+}
+
+func (rs *remoteService) decodeBatch(rr *rpc.Request) (*rpc.BatchRequest, error) {
+	batch := &rpc.BatchRequest{}
+	if err := rs.decodeArgs(rr); err != nil {
+		return nil, err
+	}
+	if _, err := batch.UnmarshalMsg(rr.Data); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// writeBatchResponse responses the calls of the batch in one frame
+func writeBatchResponse(ac *acceptor, responses rpc.BatchResponse) {
+	if len(responses.Responses) == 0 {
+		return
+	}
+
+	data, err := responses.MarshalMsg(nil)
+	if err != nil {
+		log.Errorf(err.Error())
+		return
+	}
+
+	response := rpc.GetResponse()
+	response.Kind = rpc.RemoteBatch
+	response.Data = data
+	if err := ac.writeResponse(response); err != nil {
+		log.Errorf(err.Error())
+	}
+	rpc.FreeResponse(response)
+}
+
+// handleRequest dispatches the request, and returns the response, or nil when
+// the request needs no response
+func (rs *remoteService) handleRequest(ac *acceptor, rr *rpc.Request) *rpc.Response {
+	// session migrating between frontend servers, the pushes and kicks of
+	// the uid bound on this server, and the broadcasts of cluster channels,
+	// which are checked by the access controller like the calls
+	switch rr.ServiceMethod {
+	case sessionParkRoute, sessionAdoptRoute, uidPushRoute, uidKickRoute, channelBroadcastRoute:
+		if err := rs.allow(ac, rr); err != nil {
+			response := newResponse(rr)
+			response.SetError(err)
+			return response
+		}
+	}
+	switch rr.ServiceMethod {
+	case sessionParkRoute:
+		return ac.park(rr)
+	case sessionAdoptRoute:
+		return ac.adopt(rr)
+	case uidPushRoute, uidKickRoute:
+		return forwardedUID(rr)
+	case channelBroadcastRoute:
+		return forwardedBroadcast(rr)
+	}
+
 	var session = ac.Session(rr.Sid)
 
 	// session closed notify request
 	if isSessionClosedRequest(rr) {
-		transporter.closeSession(session)
+		// the uid bound on frontend, for the callbacks cleaning up player state
+		if err := rr.DecodeData(); err == nil && session.Uid == 0 {
+			if uid, err := strconv.ParseInt(string(rr.Data), 10, 64); err == nil {
+				session.Uid = uid
+			}
+		}
+		transporter.closeSession(session, CloseByFrontend)
+		return nil
+	}
+
+	// attributes changed by frontend session
+	if rr.ServiceMethod == sessionSyncRoute {
+		err := rr.DecodeData()
+		if err == nil {
+			err = session.ApplyChanges(rr.Data)
+		}
+		if err != nil {
+			log.Errorf("apply session changes failed: %s", err.Error())
+		}
+		return nil
+	}
+
+	// uid bound by frontend session, which must be unique in cluster
+	if rr.ServiceMethod == sessionBindRoute {
+		return bindUID(session, rr)
+	}
+
+	// members of cluster channels joined on frontend
+	if rr.ServiceMethod == channelJoinRoute || rr.ServiceMethod == channelLeaveRoute {
+		trackChannel(ac, session, rr)
+		return nil
+	}
+
+	// bidirectional stream frames
+	if rr.Stream != 0 {
+		rs.processStream(ac, rr)
+		return nil
+	}
+
+	// stop accepting requests on draining
+	if rs.isDraining() {
+		if rr.Notify {
+			return nil
+		}
+		response := newResponse(rr)
+		response.SetError(&rpc.Error{Code: rpc.CodeUnavailable, Message: ErrServerDraining.Error()})
+		return response
+	}
+
+	if err := rs.allow(ac, rr); err != nil {
+		if rr.Notify {
+			return nil
+		}
+		response := newResponse(rr)
+		response.SetError(err)
+		return response
+	}
+
+	// the address of client forwarded by frontend
+	if rr.Meta.ClientAddr != "" {
+		session.SetRemoteAddr(rr.Meta.ClientAddr)
+	}
+	session.SetSerializer(rr.Meta.Serializer)
+
+	// the calls of the session are routed to the servers picked by frontend,
+	// the servers of session are copied only when changed
+	for svrType, id := range rr.Meta.Affinity {
+		if svrType != app.config.Type {
+			session.SetServerID(svrType, id)
+		}
+	}
+
+	// calls to other servers in processing the request belong to the trace
+	session.TraceID, session.SpanID = rr.TraceID, ""
+	if rr.TraceID != "" {
+		session.SpanID = rpc.NewSpanID()
+	}
+
+	// the frontend tells the compression of replies and pushes it accepts
+	// in every request
+	ac.setEncoding(rr.AcceptEncoding)
+
+	handler := rpc.Chain(func(rr *rpc.Request) (*rpc.Response, error) {
+		if rr.ServiceMethod == introspectRoute {
+			return rs.introspect(rr), nil
+		}
+		start := time.Now()
+		response := rs.cached(rr, func() *rpc.Response {
+			return rs.dispatch(ac, session, rr)
+		})
+		rs.logSlow(ac, rr, time.Since(start))
+		return response, nil
+	}, rs.interceptors...)
+
+	var response *rpc.Response
+	err := rs.decodeArgs(rr)
+	if err == nil {
+		response, err = handler(rr)
+	}
+	if err != nil {
+		log.Errorf(err.Error())
+		response = newResponse(rr)
+		response.SetError(err)
+	}
+	if response != nil {
+		rs.checkReply(response)
+	}
+
+	// nobody waits for the reply of notification
+	if rr.Notify && response != nil {
+		rpc.FreeResponse(response)
+		return nil
+	}
+	return response
+}
+
+func (rs *remoteService) processStream(ac *acceptor, rr *rpc.Request) {
+	if rr.Stream != rpc.StreamOpen {
+		if stream := ac.stream(rr.Seq); stream != nil {
+			stream.Deliver(rr.Stream, rr.Data)
+		}
+		return
+	}
+
+	// the request will be freed once the stream opened, but the stream
+	// lives longer, so the stream should not reference the request
+	seq, serviceMethod, sid := rr.Seq, rr.ServiceMethod, rr.Sid
+	stream := rpc.NewBidiStream(seq, func(flag rpc.StreamFlag, data []byte) error {
+		return rpc.WriteResponse(ac.socket, &rpc.Response{
+			Kind:          rpc.RemoteStream,
+			ServiceMethod: serviceMethod,
+			Seq:           seq,
+			Sid:           sid,
+			Stream:        flag,
+			Data:          data,
+		})
+	})
+
+	if err := rs.allow(ac, rr); err != nil {
+		stream.CloseWithError(err)
+		return
+	}
+
+	route, err := route.Decode(rr.ServiceMethod)
+	if err != nil {
+		log.Errorf(err.Error())
+		stream.CloseWithError(err)
 		return
 	}
 
+	service, ok := rs.enter(route.Service, route.Version)
+	if !ok || service == nil {
+		str := "remote: servive " + route.Service + " does not exists"
+		log.Errorf(str)
+		stream.CloseWithError(errors.New(str))
+		return
+	}
+
+	m, ok := service.RemoteMethods[route.Method]
+	if !ok || m == nil || !isBidiStreamMethod(m.Method.Type) {
+		service.Release()
+		str := "remote: service " + route.Service + " does not contain stream method: " + route.Method
+		log.Errorf(str)
+		stream.CloseWithError(errors.New(str))
+		return
+	}
+
+	if rs.isDraining() {
+		service.Release()
+		stream.CloseWithError(ErrServerDraining)
+		return
+	}
+
+	// the stream method blocks on receiving frames, which are delivered by
+	// current goroutine, so invoke it in an individual goroutine
+	ac.addStream(stream)
+	rs.hold()
+	// the panic handler of the stream method gets a detached copy, the
+	// pooled request is reused once current request done
+	detached := &rpc.Request{ServiceMethod: serviceMethod, Seq: seq, Sid: sid}
+	go func() {
+		defer rs.leave()
+		defer ac.removeStream(seq)
+		defer service.Release()
+
+		ret, err := rs.call(detached, m.Method, []reflect.Value{service.Rcvr, reflect.ValueOf(stream)})
+		if err == nil {
+			if e := ret[1].Interface(); e != nil {
+				err = e.(error)
+			}
+		}
+		stream.CloseWithError(err)
+	}()
+}
+
+// dispatch invokes the method specified by the request, and returns the
+// response, or nil when the request can not be responded
+func (rs *remoteService) dispatch(ac *acceptor, session *session.Session, rr *rpc.Request) *rpc.Response {
 	var (
 		err      error
 		service  *component.Service
 		ok       bool
-		response = &rpc.Response{
-			ServiceMethod: rr.ServiceMethod,
-			Seq:           rr.Seq,
-			Sid:           rr.Sid,
-			Kind:          rpc.RemoteResponse,
-		}
+		response = newResponse(rr)
 	)
 
 	route, err := route.Decode(rr.ServiceMethod)
 	if err != nil {
 		log.Errorf(err.Error())
-		response.Error = err.Error()
-		goto WRITE_RESPONSE
+		response.SetError(&rpc.Error{Code: rpc.CodeNotFound, Message: err.Error()})
+		goto RESPONSE
 	}
 
-	service, ok = rs.serviceMap[route.Service]
+	service, ok = rs.enter(route.Service, route.Version)
 	if !ok || service == nil {
 		str := "remote: servive " + route.Service + " does not exists"
-		log.Errorf(str)
-		response.Error = str
-		goto WRITE_RESPONSE
+		rs.notFound(rr, response, str)
+		goto RESPONSE
+	}
+	defer service.Release()
+
+	// nobody waits for the expired call
+	if rr.Deadline > 0 && time.Now().UnixNano() > rr.Deadline {
+		log.Infof("remote: drop expired call %s, Sid=%d", rr.ServiceMethod, rr.Sid)
+		response.SetError(&rpc.Error{Code: rpc.CodeDeadlineExceeded, Message: rpc.ErrDeadlineExceeded.Error()})
+		goto RESPONSE
 	}
 
 	switch rr.Kind {
@@ -170,97 +589,333 @@ func (rs *remoteService) processRequest(ac *acceptor, rr *rpc.Request) {
 		m, ok := service.HandlerMethods[route.Method]
 		if !ok || m == nil {
 			str := "remote: service " + route.Service + "does not contain method: " + route.Method
-			log.Errorf(str)
-			response.Error = str
-			goto WRITE_RESPONSE
+			rs.notFound(rr, response, str)
+			goto RESPONSE
 		}
 		var data interface{}
 		if m.Raw {
 			data = rr.Data
 		} else {
 			data = reflect.New(m.Type.Elem()).Interface()
-			err := serializer.Deserialize(rr.Data, data)
+			err := serializerFor(session).Deserialize(rr.Data, data)
 			if err != nil {
 				str := "deserialize error: " + err.Error()
 				log.Errorf(str)
-				response.Error = str
-				goto WRITE_RESPONSE
+				response.SetError(&rpc.Error{Code: rpc.CodeInvalidArgument, Message: str})
+				goto RESPONSE
 			}
 		}
 
-		ret, err := rs.call(m.Method, []reflect.Value{
-			service.Rcvr,
-			reflect.ValueOf(session),
-			reflect.ValueOf(data)})
+		args := []reflect.Value{service.Rcvr}
+		if m.Context {
+			ctx, cancel := rs.context(ac, rr)
+			defer cancel()
+			args = append(args, reflect.ValueOf(ctx))
+		}
+		args = append(args, reflect.ValueOf(session), reflect.ValueOf(data))
+
+		start := m.Begin()
+		defer func() { m.End(start, response.Error != "") }()
+
+		ret, err := rs.call(rr, m.Method, args)
 		if err != nil {
 			log.Errorf(err.Error())
-			response.Error = err.Error()
+			response.SetError(err)
 		} else {
 			// handler method encounter error
 			if err := ret[0].Interface(); err != nil {
 				log.Errorf(err.(error).Error())
-				response.Error = err.(error).Error()
+				response.SetError(err.(error))
 			}
 		}
 	case rpc.User:
-		var args []interface{}
-		var params = []reflect.Value{service.Rcvr}
-		//json.Unmarshal(rr.Data, &args)
-		gob.NewDecoder(bytes.NewReader(rr.Data)).Decode(&args)
+		m, ok := service.RemoteMethods[route.Method]
+		if !ok || m == nil {
+			str := "remote: service " + route.Service + " does not contain method: " + route.Method
+			rs.notFound(rr, response, str)
+			goto RESPONSE
+		}
 
-		for _, arg := range args {
-			params = append(params, reflect.ValueOf(arg))
+		seri := serializerOf(service.Name)
+		if m.Stub {
+			start := m.Begin()
+			defer func() { m.End(start, response.Error != "") }()
+
+			reply, err := rs.callStub(rr, service, route.Method, seri)
+			if err != nil {
+				response.SetError(err)
+				goto RESPONSE
+			}
+			data, err := seri.Serialize(reply)
+			if err != nil {
+				response.SetError(&rpc.Error{Code: rpc.CodeInternal, Message: err.Error()})
+				goto RESPONSE
+			}
+			response.Data = data
+			goto RESPONSE
 		}
 
-		m, ok := service.RemoteMethods[route.Method]
-		if !ok || m == nil {
-			response.Error = "remote: service " + route.Service + " does not contain method: " + route.Method
-			goto WRITE_RESPONSE
+		args, err := decodeParams(seri, m.Method.Type, rr.Data)
+		if err != nil {
+			log.Errorf(err.Error())
+			response.SetError(&rpc.Error{Code: rpc.CodeInvalidArgument, Message: err.Error()})
+			goto RESPONSE
+		}
+
+		if isStreamMethod(m.Method.Type) {
+			stream := newStream(ac.socket, rr, seri)
+			args = append(args, reflect.ValueOf(stream))
 		}
-		ret, err := rs.call(m.Method, params)
+
+		start := m.Begin()
+		defer func() { m.End(start, response.Error != "") }()
+
+		ret, err := rs.call(rr, m.Method, append([]reflect.Value{service.Rcvr}, args...))
 		if err != nil {
-			response.Error = err.Error()
+			response.SetError(err)
 		} else {
 			// handler method encounter error
 			if err := ret[1].Interface(); err != nil {
-				response.Error = err.(error).Error()
+				response.SetError(err.(error))
 			} else {
-				buf := bytes.NewBuffer([]byte(nil))
-				if err := gob.NewEncoder(buf).Encode(ret[0].Interface()); err != nil {
-					response.Error = err.Error()
-					goto WRITE_RESPONSE
+				data, err := seri.Serialize(ret[0].Interface())
+				if err != nil {
+					response.SetError(&rpc.Error{Code: rpc.CodeInternal, Message: err.Error()})
+					goto RESPONSE
 				}
-				response.Data = buf.Bytes()
+				response.Data = data
 			}
 		}
 	default:
-		log.Errorf("invalid rpc namespace")
+		methods, ok := service.KindMethods[rr.Kind]
+		if !ok && !rpc.IsCustomKind(rr.Kind) {
+			log.Errorf("invalid rpc namespace")
+			return nil
+		}
+		m, ok := methods[route.Method]
+		if !ok || m == nil {
+			str := "remote: service " + route.Service + " does not contain " + rr.Kind.String() + " method: " + route.Method
+			rs.notFound(rr, response, str)
+			goto RESPONSE
+		}
+
+		start := m.Begin()
+		defer func() { m.End(start, response.Error != "") }()
+
+		var data []byte
+		perr := rs.protect(rr, func() {
+			data, err = m.Invoke(service.Rcvr, m.Method, session, rr.Data)
+		})
+		if perr != nil {
+			err = perr
+		}
+		if err != nil {
+			response.SetError(err)
+			goto RESPONSE
+		}
+		response.Data = data
+	}
+
+RESPONSE:
+	return response
+}
+
+// allow consults the access controller whether the caller can call the method
+func (rs *remoteService) allow(ac *acceptor, rr *rpc.Request) error {
+	if rs.access == nil {
+		return nil
+	}
+	err := rs.access.Allow(rr.Kind, rr.ServiceMethod, rr.Sid, ac.peer())
+	if err != nil {
+		log.Infof("remote: call %s from %s denied: %s", rr.ServiceMethod, ac.socket.RemoteAddr(), err.Error())
+	}
+	return err
+}
+
+// notFound responds the request whose service or method does not exist by
+// the fallback handler, or the not found error if no fallback handler
+func (rs *remoteService) notFound(rr *rpc.Request, response *rpc.Response, str string) {
+	if rs.fallback == nil {
+		log.Errorf(str)
+		response.SetError(&rpc.Error{Code: rpc.CodeNotFound, Message: str})
 		return
 	}
 
-WRITE_RESPONSE:
-	if err := rpc.WriteResponse(ac.socket, response); err != nil {
-		log.Errorf(err.Error())
+	var (
+		data []byte
+		err  error
+	)
+	if perr := rs.protect(rr, func() { data, err = rs.fallback(rr) }); perr != nil {
+		err = perr
+	}
+	if err != nil {
+		response.SetError(err)
+		return
+	}
+	response.Data = data
+}
+
+// decodeParams deserializes every argument of the remote call into the
+// parameter type of the remote method
+func decodeParams(seri serialize.Serializer, mt reflect.Type, data []byte) ([]reflect.Value, error) {
+	args, err := decodeArgs(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// the first parameter is the receiver, and the stream parameter
+	// does not transfer from the caller
+	n := mt.NumIn() - 1
+	if isStreamMethod(mt) {
+		n--
+	}
+	if len(args) != n {
+		return nil, fmt.Errorf("remote: method needs %d arguments, but got %d", n, len(args))
+	}
+
+	params := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		t := mt.In(i + 1)
+		if t.Kind() == reflect.Ptr {
+			v := reflect.New(t.Elem())
+			if err := seri.Deserialize(arg, v.Interface()); err != nil {
+				return nil, err
+			}
+			params[i] = v
+		} else {
+			v := reflect.New(t)
+			if err := seri.Deserialize(arg, v.Interface()); err != nil {
+				return nil, err
+			}
+			params[i] = v.Elem()
+		}
+	}
+	return params, nil
+}
+
+// context returns the context of the request, which will be done when the
+// deadline of the request exceeded, or the call canceled by the caller
+func (rs *remoteService) context(ac *acceptor, rr *rpc.Request) (context.Context, context.CancelFunc) {
+	parent := context.Background()
+	if ac != nil && cancellable(rr) {
+		parent = ac.callContext(rr.Seq)
 	}
+	ctx := rpc.NewContext(parent, rr)
+	if rr.Deadline > 0 {
+		return context.WithDeadline(ctx, time.Unix(0, rr.Deadline))
+	}
+	return context.WithCancel(ctx)
+}
+
+func (rs *remoteService) call(rr *rpc.Request, method reflect.Method, args []reflect.Value) (rets []reflect.Value, err error) {
+	err = rs.protect(rr, func() {
+		rets = method.Func.Call(args)
+	})
+	return rets, err
+}
+
+// callStub calls the remote method through the generated stub, the arguments
+// are deserialized by the stub
+func (rs *remoteService) callStub(rr *rpc.Request, service *component.Service, method string, seri serialize.Serializer) (reply interface{}, err error) {
+	args, err := decodeArgs(rr.Data)
+	if err != nil {
+		return nil, &rpc.Error{Code: rpc.CodeInvalidArgument, Message: err.Error()}
+	}
+
+	stub := service.Rcvr.Interface().(component.RemoteStub)
+	perr := rs.protect(rr, func() {
+		reply, err = stub.StarxDispatch(method, seri, args)
+	})
+	if perr != nil {
+		return nil, perr
+	}
+	return reply, err
 }
 
-func (rs *remoteService) call(method reflect.Method, args []reflect.Value) (rets []reflect.Value, err error) {
+// protect calls fn, and recovers the panic as an error by the panic handler
+func (rs *remoteService) protect(rr *rpc.Request, fn func()) (err error) {
 	defer func() {
 		if rec := recover(); rec != nil {
-			log.Errorf("rpc call error: %+v", rec)
-			os.Stderr.Write(debug.Stack())
-			if s, ok := rec.(string); ok {
-				err = errors.New(s)
-			} else {
-				err = errors.New("rpc call internal error")
+			handler := rs.panicHandler
+			if handler == nil {
+				handler = defaultPanicHandler
+			}
+			err = handler(rr, rec, debug.Stack())
+			if err == nil {
+				err = &rpc.Error{Code: rpc.CodeInternal, Message: "rpc call internal error"}
 			}
 		}
 	}()
-	rets = method.Func.Call(args)
-	return rets, nil
+	fn()
+	return nil
+}
+
+// defaultPanicHandler logs the panic, and responds an internal error
+func defaultPanicHandler(rr *rpc.Request, rec interface{}, stack []byte) error {
+	log.Errorf("rpc call %s error: %+v", rr.ServiceMethod, rec)
+	os.Stderr.Write(stack)
+	if s, ok := rec.(string); ok {
+		return &rpc.Error{Code: rpc.CodeInternal, Message: s}
+	}
+	return &rpc.Error{Code: rpc.CodeInternal, Message: "rpc call internal error"}
+}
+
+// hold marks a request or stream in processing
+func (rs *remoteService) hold() {
+	rs.drainLock.Lock()
+	defer rs.drainLock.Unlock()
+
+	rs.inflight++
+}
+
+// leave marks a request or stream completed
+func (rs *remoteService) leave() {
+	rs.drainLock.Lock()
+	defer rs.drainLock.Unlock()
+
+	rs.inflight--
+	if rs.draining && rs.inflight == 0 {
+		select {
+		case <-rs.drained:
+		default:
+			close(rs.drained)
+		}
+	}
+}
+
+func (rs *remoteService) isDraining() bool {
+	rs.drainLock.Lock()
+	defer rs.drainLock.Unlock()
+
+	return rs.draining
+}
+
+// drain stops accepting requests, and waits for the in-flight requests and
+// streams to complete, or ctx done
+func (rs *remoteService) drain(ctx context.Context) error {
+	rs.drainLock.Lock()
+	if !rs.draining {
+		rs.draining = true
+		rs.drained = make(chan struct{})
+		if rs.inflight == 0 {
+			close(rs.drained)
+		}
+	}
+	drained := rs.drained
+	rs.drainLock.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (rs *remoteService) dumpServiceMap() {
+	rs.RLock()
+	defer rs.RUnlock()
+
 	for sn, s := range rs.serviceMap {
 		for mn := range s.HandlerMethods {
 			log.Infof("registered service: %s.%s", sn, mn)
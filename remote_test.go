@@ -0,0 +1,623 @@
+package starx
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/cluster/rpc/bench"
+	"github.com/lonnng/starx/component"
+	"github.com/lonnng/starx/serialize"
+	"github.com/lonnng/starx/serialize/gob"
+	"github.com/lonnng/starx/serialize/json"
+	"github.com/lonnng/starx/session"
+)
+
+type RemoteArgs struct {
+	Name  string
+	Level int
+}
+
+type RemoteComp struct{}
+
+func (r *RemoteComp) Hello(name string, args *RemoteArgs) (interface{}, error) {
+	return nil, nil
+}
+
+func TestDecodeParams(t *testing.T) {
+	mt := reflect.TypeOf(&RemoteComp{}).Method(0).Type
+	for _, s := range []serialize.Serializer{gob.NewSerializer(), json.NewSerializer()} {
+		data, err := encodeArgs(s, "starx", &RemoteArgs{"test", 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		params, err := decodeParams(s, mt, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(params) != 2 || params[0].String() != "starx" {
+			t.Fatalf("unexpected params: %v", params)
+		}
+
+		if args := params[1].Interface().(*RemoteArgs); !reflect.DeepEqual(args, &RemoteArgs{"test", 10}) {
+			t.Fatalf("unexpected args: %+v", args)
+		}
+
+		data, _ = encodeArgs(s, "starx")
+		if _, err := decodeParams(s, mt, data); err == nil {
+			t.Fatal("arguments count mismatch should fail")
+		}
+	}
+}
+
+type PatchComp struct {
+	component.Base
+	version int
+}
+
+func (p *PatchComp) Hello(s *session.Session, data []byte) error {
+	return nil
+}
+
+func TestRemoteService_Reregister(t *testing.T) {
+	rs := newRemote()
+	if err := rs.register(&PatchComp{version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.register(&PatchComp{version: 2}); err == nil {
+		t.Fatal("duplicate service should fail")
+	}
+
+	old, err := rs.reregister(&PatchComp{version: 2}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Rcvr.Interface().(*PatchComp).version != 1 {
+		t.Fatal("reregister should return the replaced service")
+	}
+
+	s, ok := rs.service("PatchComp", "")
+	if !ok || s.Rcvr.Interface().(*PatchComp).version != 2 {
+		t.Fatal("service should be replaced")
+	}
+
+	if _, err := rs.unregister("PatchComp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rs.service("PatchComp", ""); ok {
+		t.Fatal("service should be removed")
+	}
+	if _, err := rs.unregister("PatchComp"); err == nil {
+		t.Fatal("remove nonexistent service should fail")
+	}
+}
+
+func TestRemoteService_ReregisterVersion(t *testing.T) {
+	rs := newRemote()
+	if err := rs.registerVersion(&PatchComp{version: 1}, "v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := rs.reregister(&PatchComp{version: 2}, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old == nil || old.Rcvr.Interface().(*PatchComp).version != 1 {
+		t.Fatal("reregister should replace the service of the same version")
+	}
+	s, ok := rs.service("PatchComp", "v2")
+	if !ok || s.Version != "v2" || s.Rcvr.Interface().(*PatchComp).version != 2 {
+		t.Fatal("service should be replaced with its version kept")
+	}
+	if _, ok := rs.serviceMap["PatchComp"]; ok {
+		t.Fatal("unversioned service should not be registered")
+	}
+}
+
+func TestRemoteService_Swap(t *testing.T) {
+	rs := newRemote()
+	if err := rs.registerVersion(&PatchComp{version: 1}, "v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := rs.swap("PatchComp@v2", &PatchComp{version: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Rcvr.Interface().(*PatchComp).version != 1 {
+		t.Fatal("swap should return the replaced service")
+	}
+
+	s, ok := rs.service("PatchComp", "v2")
+	if !ok || s.Rcvr.Interface().(*PatchComp).version != 2 {
+		t.Fatal("receiver should be swapped")
+	}
+	if s.Name != "PatchComp" || s.Version != "v2" {
+		t.Fatalf("swapped service should keep name and version, got %s@%s", s.Name, s.Version)
+	}
+
+	if _, err := rs.swap("NoComp", &PatchComp{}); err == nil {
+		t.Fatal("swap nonexistent service should fail")
+	}
+}
+
+func TestRemoteService_Drain(t *testing.T) {
+	rs := newRemote()
+	rs.hold()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := rs.drain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	if !rs.isDraining() {
+		t.Fatal("should stop accepting requests")
+	}
+
+	// stream frames of in-flight streams are still accepted
+	rs.hold()
+	rs.leave()
+
+	done := make(chan error, 1)
+	go func() { done <- rs.drain(context.Background()) }()
+	rs.leave()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// requests rejected on draining complete as well
+	rs.hold()
+	rs.leave()
+	if err := rs.drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type StubComp struct {
+	component.Base
+}
+
+func (c *StubComp) Hello(s *session.Session, data []byte) error {
+	return nil
+}
+
+func (c *StubComp) Add(a int, args *RemoteArgs) (int, error) {
+	return a + args.Level, nil
+}
+
+// stub generated by: starx-rpc-gen -type StubComp
+
+// StarxStubMethods implements component.RemoteStub
+func (c *StubComp) StarxStubMethods() []string {
+	return []string{"Add"}
+}
+
+// StarxDispatch implements component.RemoteStub
+func (c *StubComp) StarxDispatch(method string, seri serialize.Serializer, args [][]byte) (interface{}, error) {
+	switch method {
+	case "Add":
+		if len(args) != 2 {
+			return nil, rpc.Errorf(rpc.CodeInvalidArgument, "remote: method needs %d arguments, but got %d", 2, len(args))
+		}
+		var a0 int
+		if err := seri.Deserialize(args[0], &a0); err != nil {
+			return nil, &rpc.Error{Code: rpc.CodeInvalidArgument, Message: err.Error()}
+		}
+		a1 := new(RemoteArgs)
+		if err := seri.Deserialize(args[1], a1); err != nil {
+			return nil, &rpc.Error{Code: rpc.CodeInvalidArgument, Message: err.Error()}
+		}
+		reply, err := c.Add(a0, a1)
+		return reply, err
+	}
+	return nil, component.ErrNoStubMethod
+}
+
+func TestRemoteService_Stub(t *testing.T) {
+	rs := newRemote()
+	if err := rs.register(&StubComp{}); err != nil {
+		t.Fatal(err)
+	}
+	service, _ := rs.service("StubComp", "")
+	if m := service.RemoteMethods["Add"]; m == nil || !m.Stub {
+		t.Fatal("method with generated stub should be dispatched by stub")
+	}
+
+	seri := serializerOf("StubComp")
+	data, err := encodeArgs(seri, 1, &RemoteArgs{Level: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := &rpc.Request{Kind: rpc.User, ServiceMethod: "StubComp.Add", Data: data}
+	response := rs.dispatch(nil, nil, rr)
+	if response.Error != "" {
+		t.Fatal(response.Error)
+	}
+	var sum int
+	if err := seri.Deserialize(response.Data, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 3 {
+		t.Fatalf("expect 3, got %d", sum)
+	}
+
+	data, _ = encodeArgs(seri, 1)
+	rr = &rpc.Request{Kind: rpc.User, ServiceMethod: "StubComp.Add", Data: data}
+	if response := rs.dispatch(nil, nil, rr); response.ErrorCode != rpc.CodeInvalidArgument {
+		t.Fatalf("expect invalid argument, got %q", response.Error)
+	}
+}
+
+type PanicComp struct {
+	component.Base
+}
+
+func (c *PanicComp) Hello(s *session.Session, data []byte) error {
+	return nil
+}
+
+func (c *PanicComp) Boom() (interface{}, error) {
+	panic("boom")
+}
+
+func TestRemoteService_PanicHandler(t *testing.T) {
+	rs := newRemote()
+	if err := rs.register(&PanicComp{}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := encodeArgs(serializerOf("PanicComp"))
+	rr := &rpc.Request{Kind: rpc.User, ServiceMethod: "PanicComp.Boom", Data: data}
+	if response := rs.dispatch(nil, nil, rr); response.ErrorCode != rpc.CodeInternal || response.Error != "boom" {
+		t.Fatalf("expect internal error, got %d %q", response.ErrorCode, response.Error)
+	}
+
+	var (
+		recovered interface{}
+		stack     []byte
+	)
+	rs.panicHandler = func(req *rpc.Request, rec interface{}, s []byte) error {
+		recovered, stack = rec, s
+		return rpc.Errorf(rpc.CodeUnavailable, "%s panics", req.ServiceMethod)
+	}
+	response := rs.dispatch(nil, nil, rr)
+	if response.ErrorCode != rpc.CodeUnavailable || response.Error != "PanicComp.Boom panics" {
+		t.Fatalf("unexpected response error: %d %q", response.ErrorCode, response.Error)
+	}
+	if recovered != "boom" || len(stack) == 0 {
+		t.Fatalf("panic handler should receive the recovered value and stack, got %v", recovered)
+	}
+}
+
+func TestRemoteService_Fallback(t *testing.T) {
+	rs := newRemote()
+	if err := rs.register(&StubComp{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := &rpc.Request{Kind: rpc.User, ServiceMethod: "Script.Eval"}
+	if response := rs.dispatch(nil, nil, rr); response.ErrorCode != rpc.CodeNotFound {
+		t.Fatalf("expect not found, got %q", response.Error)
+	}
+
+	rs.fallback = func(req *rpc.Request) ([]byte, error) {
+		if req.ServiceMethod == "StubComp.Sub" {
+			return nil, rpc.Errorf(100, "route %s not found", req.ServiceMethod)
+		}
+		return []byte(req.ServiceMethod), nil
+	}
+	for _, route := range []string{"Script.Eval", "StubComp.Eval"} {
+		rr := &rpc.Request{Kind: rpc.User, ServiceMethod: route}
+		if response := rs.dispatch(nil, nil, rr); response.Error != "" || string(response.Data) != route {
+			t.Fatalf("%s: unexpected response: %q %q", route, response.Error, response.Data)
+		}
+	}
+
+	rr = &rpc.Request{Kind: rpc.Sys, ServiceMethod: "StubComp.Sub"}
+	if response := rs.dispatch(nil, nil, rr); response.ErrorCode != 100 {
+		t.Fatalf("expect code 100, got %d", response.ErrorCode)
+	}
+}
+
+func TestRemoteService_AccessController(t *testing.T) {
+	rs := newRemote()
+	if err := rs.register(&StubComp{}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+	ac := newAcceptor(1, conn)
+
+	var caller *rpc.Peer
+	rs.access = rpc.AccessControllerFunc(func(kind rpc.RpcKind, serviceMethod string, sid int64, p *rpc.Peer) error {
+		caller = p
+		if kind == rpc.User && serviceMethod == "StubComp.Add" {
+			return rpc.Errorf(rpc.CodePermissionDenied, "%s is not allowed", serviceMethod)
+		}
+		return nil
+	})
+
+	seri := serializerOf("StubComp")
+	data, _ := encodeArgs(seri, 1, &RemoteArgs{Level: 2})
+	response := rs.handleRequest(ac, &rpc.Request{Kind: rpc.User, ServiceMethod: "StubComp.Add", Data: data})
+	if response.ErrorCode != rpc.CodePermissionDenied {
+		t.Fatalf("expect permission denied, got %d %q", response.ErrorCode, response.Error)
+	}
+	if caller == nil || caller.Addr == nil {
+		t.Fatal("access controller should receive the caller identity")
+	}
+
+	response = rs.handleRequest(ac, &rpc.Request{Kind: rpc.Sys, ServiceMethod: "StubComp.Hello"})
+	if response.Error != "" {
+		t.Fatalf("allowed call should succeed, got %q", response.Error)
+	}
+}
+
+func TestRemoteService_Cancel(t *testing.T) {
+	rs := newRemote()
+	if err := rs.register(&StubComp{}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+	ac := newAcceptor(1, conn)
+
+	written := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 512)
+		if _, err := peer.Read(buf); err == nil {
+			written <- struct{}{}
+		}
+	}()
+
+	rr := &rpc.Request{Kind: rpc.Sys, ServiceMethod: "StubComp.Hello", Seq: 5}
+	ac.track(rr.Seq)
+	ctx, cancel := rs.context(ac, rr)
+	defer cancel()
+
+	ac.cancel(rr.Seq)
+	if ctx.Err() == nil {
+		t.Fatal("context of the canceled call should be done")
+	}
+
+	rs.processRequest(ac, rr)
+	select {
+	case <-written:
+		t.Fatal("canceled call should not be responded")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	ac.untrack(rr.Seq)
+	if ac.callContext(rr.Seq).Err() != nil {
+		t.Fatal("untracked call should have no context")
+	}
+}
+
+type SlowComp struct {
+	component.Base
+	release chan struct{}
+}
+
+func (c *SlowComp) Hello(s *session.Session, data []byte) error {
+	return nil
+}
+
+func (c *SlowComp) Wait(block bool) (bool, error) {
+	if block {
+		<-c.release
+	}
+	return block, nil
+}
+
+func TestRemoteService_Workers(t *testing.T) {
+	rs := newRemote()
+	rs.workers = 2
+	comp := &SlowComp{release: make(chan struct{})}
+	if err := rs.register(comp); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer := net.Pipe()
+	go rs.handle(conn)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	seri := serializerOf("SlowComp")
+	blocked, _ := encodeArgs(seri, true)
+	fast, _ := encodeArgs(seri, false)
+
+	slow := client.AsyncCall(rpc.User, "SlowComp", "Wait", 0, blocked, nil)
+	// the session 1 is processed by another worker
+	select {
+	case call := <-client.AsyncCall(rpc.User, "SlowComp", "Wait", 1, fast, nil).Done:
+		if call.Error != nil {
+			t.Fatal(call.Error)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call of another session should not be blocked")
+	}
+
+	close(comp.release)
+	if call := <-slow.Done; call.Error != nil {
+		t.Fatal(call.Error)
+	}
+}
+
+type EchoComp struct {
+	component.Base
+}
+
+type EchoArgs struct {
+	Data []byte
+}
+
+func (c *EchoComp) Hello(s *session.Session, data []byte) error {
+	return nil
+}
+
+func (c *EchoComp) Echo(args *EchoArgs) (*EchoArgs, error) {
+	return args, nil
+}
+
+func BenchmarkRemoteService_Call(b *testing.B) {
+	rs := newRemote()
+	if err := rs.register(&EchoComp{}); err != nil {
+		b.Fatal(err)
+	}
+	defer delete(serviceSerializers, "EchoComp")
+
+	codecs := map[string]serialize.Serializer{"gob": gob.NewSerializer(), "json": json.NewSerializer()}
+	for name, seri := range codecs {
+		for _, size := range []int{64, 1024, 16 * 1024} {
+			b.Run(name+"/"+strconv.Itoa(size), func(b *testing.B) {
+				SetServiceRPCSerializer("EchoComp", seri)
+				args, err := encodeArgs(seri, &EchoArgs{Data: make([]byte, size)})
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				conn, peer := net.Pipe()
+				go rs.handle(conn)
+				client := rpc.NewClient(peer)
+				defer client.Close()
+
+				b.SetBytes(int64(size))
+				b.ResetTimer()
+				r := bench.Run(client, bench.Config{Kind: rpc.User, Service: "EchoComp", Method: "Echo", Args: args, Calls: b.N, Concurrency: 8})
+				if r.Errors > 0 {
+					b.Fatalf("%d calls failed", r.Errors)
+				}
+				b.ReportMetric(float64(r.P99.Nanoseconds()), "p99-ns")
+			})
+		}
+	}
+}
+
+type AdminComp struct {
+	component.Base
+	reloaded string
+}
+
+func (c *AdminComp) Hello(s *session.Session, data []byte) error {
+	return nil
+}
+
+func (c *AdminComp) AdminReload(name string) error {
+	c.reloaded = name
+	return nil
+}
+
+func TestRemoteService_CustomKind(t *testing.T) {
+	const adminKind = rpc.MinCustomKind + 2
+	validate := func(method reflect.Method) bool {
+		return strings.HasPrefix(method.Name, "Admin")
+	}
+	invoke := func(rcvr reflect.Value, method reflect.Method, s *session.Session, data []byte) ([]byte, error) {
+		ret := method.Func.Call([]reflect.Value{rcvr, reflect.ValueOf(string(data))})
+		if err := ret[0].Interface(); err != nil {
+			return nil, err.(error)
+		}
+		return []byte("ok"), nil
+	}
+	if err := component.RegisterKind(adminKind, "AdminRpc", validate, invoke); err != nil {
+		t.Fatal(err)
+	}
+	defer component.UnregisterKind(adminKind)
+
+	rs := newRemote()
+	comp := &AdminComp{}
+	if err := rs.register(comp); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := &rpc.Request{Kind: adminKind, ServiceMethod: "AdminComp.AdminReload", Data: []byte("maps")}
+	response := rs.dispatch(nil, nil, rr)
+	if response.Error != "" {
+		t.Fatal(response.Error)
+	}
+	if string(response.Data) != "ok" || comp.reloaded != "maps" {
+		t.Fatalf("unexpected reply %q, reloaded %q", response.Data, comp.reloaded)
+	}
+
+	// methods of custom kind are not published in user namespace
+	rr = &rpc.Request{Kind: rpc.User, ServiceMethod: "AdminComp.AdminReload"}
+	if response := rs.dispatch(nil, nil, rr); response.ErrorCode != rpc.CodeNotFound {
+		t.Fatalf("expect not found, got %q", response.Error)
+	}
+}
+
+func TestRemoteService_ClientAddr(t *testing.T) {
+	rs := newRemote()
+	if err := rs.register(&StubComp{}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+	ac := newAcceptor(1, conn)
+
+	rr := &rpc.Request{Kind: rpc.Sys, ServiceMethod: "StubComp.Hello", Sid: 7, Meta: rpc.Metadata{ClientAddr: "10.0.0.1:3250"}}
+	if response := rs.handleRequest(ac, rr); response.Error != "" {
+		t.Fatal(response.Error)
+	}
+	if addr := ac.Session(7).Meta().RemoteAddr; addr != "10.0.0.1:3250" {
+		t.Fatalf("backend session should know the client address, got %q", addr)
+	}
+}
+
+func TestRemoteService_Serializer(t *testing.T) {
+	rs := newRemote()
+	if err := rs.register(&StubComp{}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+	ac := newAcceptor(1, conn)
+
+	rr := &rpc.Request{Kind: rpc.Sys, ServiceMethod: "StubComp.Hello", Sid: 8, Meta: rpc.Metadata{Serializer: "json"}}
+	if response := rs.handleRequest(ac, rr); response.Error != "" {
+		t.Fatal(response.Error)
+	}
+	if seri := ac.Session(8).Meta().Serializer; seri != "json" {
+		t.Fatalf("backend session should use the serializer negotiated by client, got %q", seri)
+	}
+}
+
+func TestRemoteService_Affinity(t *testing.T) {
+	rs := newRemote()
+	if err := rs.register(&StubComp{}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+	ac := newAcceptor(1, conn)
+
+	affinity := map[string]string{"chat": "chat-2", app.config.Type: "other"}
+	rr := &rpc.Request{Kind: rpc.Sys, ServiceMethod: "StubComp.Hello", Sid: 9, Meta: rpc.Metadata{Affinity: affinity}}
+	if response := rs.handleRequest(ac, rr); response.Error != "" {
+		t.Fatal(response.Error)
+	}
+	s := ac.Session(9)
+	if id := s.ServerID("chat"); id != "chat-2" {
+		t.Fatalf("calls of backend session should be routed to the server picked by frontend, got %q", id)
+	}
+	if id := s.ServerID(app.config.Type); id != "" {
+		t.Fatalf("server of current type should not be routed, got %q", id)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package starx
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	suspendLock sync.Mutex
+	suspended   = make(map[string]*session.Session) // reconnect token -> suspended session
+)
+
+// SetResumeGrace keeps the session alive for d after the client disconnected,
+// so a client on flaky mobile networks can resume it. The client receives a
+// reconnect token as sys.resume of handshake response, and sends it as
+// sys.resume in the handshake of the new connection, the bound uid,
+// attributes, backend sessions and pushes in the meantime are kept. A token
+// can be used only once, a new one is issued in every handshake. The session
+// is closed with the reason of disconnection if client does not come back in
+// time, zero disables, it should be called before server started
+func SetResumeGrace(d time.Duration) {
+	env.resumeGrace = d
+}
+
+// reconnect takes the session suspended with the token in handshake payload,
+// and issues a new token to the agent, the token is empty when neither resume
+// nor session store is enabled
+func (a *agent) reconnect(data []byte) (string, *session.Session, error) {
+	if env.resumeGrace <= 0 && storeOf() == nil {
+		return "", nil, nil
+	}
+
+	hs := struct {
+		Sys struct {
+			Resume string `json:"resume"`
+		} `json:"sys"`
+	}{}
+	if len(data) > 0 {
+		json.Unmarshal(data, &hs)
+	}
+	var s *session.Session
+	if hs.Sys.Resume != "" && env.resumeGrace > 0 {
+		s = unsuspend(hs.Sys.Resume)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		if s != nil {
+			transporter.closeSession(s, CloseDisconnected)
+		}
+		return "", nil, err
+	}
+	transporter.Lock()
+	a.token = token
+	transporter.Unlock()
+	return token, s, nil
+}
+
+func (a *agent) reconnectToken() string {
+	transporter.RLock()
+	defer transporter.RUnlock()
+
+	return a.token
+}
+
+// resumable reports whether the session of agent is suspended rather than
+// closed, only the sessions lost by network can be resumed
+func (a *agent) resumable(reason CloseReason) bool {
+	if env.resumeGrace <= 0 || (reason != CloseDisconnected && reason != CloseHeartbeatTimeout) {
+		return false
+	}
+
+	transporter.RLock()
+	defer transporter.RUnlock()
+	return a.token != ""
+}
+
+// suspend keeps the session of the disconnected agent for the resume grace,
+// the packets not sent and the pushes in the meantime are buffered until
+// resumed
+func (t *transportService) suspend(a *agent, reason CloseReason, pending [][]byte) {
+	t.Lock()
+	if t.agents[a.id] == a {
+		delete(t.agents, a.id)
+	}
+	token := a.token
+	t.Unlock()
+
+	s := a.session
+	entity := &parkedEntity{id: a.id}
+	for _, data := range pending {
+		entity.Send(data)
+	}
+	s.Entity = entity
+
+	suspendLock.Lock()
+	suspended[token] = s
+	suspendLock.Unlock()
+
+	time.AfterFunc(env.resumeGrace, func() {
+		if s := unsuspend(token); s != nil {
+			t.closeSession(s, reason)
+		}
+	})
+}
+
+// resume replaces the session created when the agent connected with the
+// suspended session, the buffered packets are sent after the handshake
+// response, the suspended session is closed if the agent closed in handshake
+func (t *transportService) resume(a *agent, s *session.Session) {
+	created := a.session
+	t.Lock()
+	if a.status == statusClosed {
+		t.Unlock()
+		t.closeSession(s, CloseDisconnected)
+		return
+	}
+	delete(t.agents, a.id)
+	a.id, a.session = s.ID, s
+	t.agents[a.id] = a
+	t.Unlock()
+
+	s.SetMeta(created.Meta())
+	entity := s.Entity.(*parkedEntity)
+	s.Entity = a
+	entity.adopt(a)
+	t.sessionClosed(created, CloseResumed)
+
+	// the snapshot is saved under the new token
+	persist(a)
+}
+
+func unsuspend(token string) *session.Session {
+	suspendLock.Lock()
+	defer suspendLock.Unlock()
+
+	s, ok := suspended[token]
+	if !ok {
+		return nil
+	}
+	delete(suspended, token)
+	return s
+}
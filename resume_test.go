@@ -0,0 +1,111 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package starx
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSessionResume(t *testing.T) {
+	SetResumeGrace(time.Minute)
+	defer SetResumeGrace(0)
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := transporter.createAgent(conn)
+	token, _, err := a.reconnect(nil)
+	if err != nil || token == "" {
+		t.Fatalf("reconnect token should be issued, err=%v", err)
+	}
+	s := a.session
+	s.Set("room", "lobby")
+
+	// queued before disconnected, the packets of an encrypted session are
+	// buffered in plain text and resent
+	a.keys.Store(&payloadKeys{})
+	if err := s.Push("onNotice", []byte("queued")); err != nil {
+		t.Fatal(err)
+	}
+	a.closeWith(CloseDisconnected)
+	if s.Entity.ID() != s.ID {
+		t.Fatal("suspended session should keep its id for the closed notification")
+	}
+
+	// pushed while disconnected
+	if err := s.Push("onChat", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer = net.Pipe()
+	defer peer.Close()
+	b := transporter.createAgent(conn)
+	defer b.closeWith(CloseKicked)
+	next, resumed, err := b.reconnect([]byte(`{"sys":{"resume":"` + token + `"}}`))
+	if err != nil || resumed != s || next == token {
+		t.Fatalf("session should be resumed with a new token, err=%v", err)
+	}
+	transporter.resume(b, resumed)
+
+	if b.session != s || b.id != s.ID || s.Entity != b || s.String("room") != "lobby" {
+		t.Fatal("agent should take over the suspended session")
+	}
+	if got, err := transporter.agent(s.ID); err != nil || got != b {
+		t.Fatal("agent should be registered with the id of resumed session")
+	}
+	select {
+	case data := <-b.sendBuffer:
+		if !bytes.Contains(data, []byte("queued")) {
+			t.Fatalf("unexpected packet resent after resumed: %q", data)
+		}
+	default:
+		t.Fatal("packet queued before disconnected should be resent after resumed")
+	}
+	select {
+	case data := <-b.sendBuffer:
+		if !bytes.Contains(data, []byte("onChat")) || !bytes.Contains(data, []byte("hello")) {
+			t.Fatalf("unexpected push delivered after resumed: %q", data)
+		}
+	default:
+		t.Fatal("push buffered while disconnected should be delivered after resumed")
+	}
+
+	if _, again, _ := b.reconnect([]byte(`{"sys":{"resume":"` + token + `"}}`)); again != nil {
+		t.Fatal("token should be used only once")
+	}
+}
+
+func TestSessionResume_Expired(t *testing.T) {
+	SetResumeGrace(10 * time.Millisecond)
+	defer SetResumeGrace(0)
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := transporter.createAgent(conn)
+	token, _, _ := a.reconnect(nil)
+	a.closeWith(CloseHeartbeatTimeout)
+
+	time.Sleep(50 * time.Millisecond)
+	if unsuspend(token) != nil {
+		t.Fatal("session should be closed after the resume grace")
+	}
+}
@@ -13,18 +13,39 @@ var (
 	ErrInvalidRoute        = errors.New("invalid route")
 )
 
+// versionSep separates the method and the version in route, e.g: Room.Join@v2
+const versionSep = "@"
+
 type Route struct {
 	ServerType string
 	Service    string
 	Method     string
+	Version    string // version of the service, empty for the latest
 }
 
 func NewRoute(server, service, method string) *Route {
-	return &Route{server, service, method}
+	return &Route{ServerType: server, Service: service, Method: method}
 }
 
 func (r *Route) String() string {
-	return fmt.Sprintf("%s.%s.%s", r.ServerType, r.Service, r.Method)
+	return fmt.Sprintf("%s.%s.%s", r.ServerType, r.Service, r.VersionedMethod())
+}
+
+// VersionedMethod returns the method with the version suffix, which is
+// transferred to the remote server
+func (r *Route) VersionedMethod() string {
+	if r.Version == "" {
+		return r.Method
+	}
+	return r.Method + versionSep + r.Version
+}
+
+// SplitVersion splits the method and the version, e.g: Join@v2 => Join, v2
+func SplitVersion(method string) (string, string) {
+	if i := strings.LastIndex(method, versionSep); i >= 0 {
+		return method[:i], method[i+1:]
+	}
+	return method, ""
 }
 
 func Decode(route string) (*Route, error) {
@@ -34,13 +55,25 @@ func Decode(route string) (*Route, error) {
 			return nil, ErrRouteFieldCantEmpty
 		}
 	}
+
+	var rt *Route
 	switch len(r) {
 	case 3:
-		return NewRoute(r[0], r[1], r[2]), nil
+		rt = NewRoute(r[0], r[1], r[2])
 	case 2:
-		return NewRoute("", r[0], r[1]), nil
+		rt = NewRoute("", r[0], r[1])
 	default:
 		log.Errorf("invalid route: " + route)
 		return nil, ErrInvalidRoute
 	}
+
+	rt.Method, rt.Version = SplitVersion(rt.Method)
+	if strings.Contains(rt.Method+rt.Service+rt.ServerType, versionSep) {
+		log.Errorf("invalid route: " + route)
+		return nil, ErrInvalidRoute
+	}
+	if rt.Method == "" || (rt.Version == "" && strings.HasSuffix(route, versionSep)) {
+		return nil, ErrRouteFieldCantEmpty
+	}
+	return rt, nil
 }
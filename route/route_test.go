@@ -27,3 +27,26 @@ func TestDecodeRoute(t *testing.T) {
 		t.Error(err.Error())
 	}
 }
+
+func TestDecodeVersion(t *testing.T) {
+	r, err := Decode("chat.Room.Join@v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Method != "Join" || r.Version != "v2" {
+		t.Fatalf("unexpected route: %+v", r)
+	}
+	if r.String() != "chat.Room.Join@v2" || r.VersionedMethod() != "Join@v2" {
+		t.Fatalf("unexpected route string: %s", r.String())
+	}
+
+	if r, err := Decode("Room.Join"); err != nil || r.Version != "" || r.VersionedMethod() != "Join" {
+		t.Fatalf("unexpected route: %+v, %v", r, err)
+	}
+
+	for _, s := range []string{"Room.Join@", "Room.@v2", "Room@v1.Join", "Room.Join@v1@v2"} {
+		if _, err := Decode(s); err == nil {
+			t.Fatalf("route %s should be invalid", s)
+		}
+	}
+}
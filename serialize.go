@@ -21,14 +21,140 @@
 package starx
 
 import (
+	"encoding/json"
+	"sync"
+
+	"github.com/lonnng/starx/log"
 	"github.com/lonnng/starx/serialize"
+	"github.com/lonnng/starx/serialize/gob"
+	jsonserialize "github.com/lonnng/starx/serialize/json"
 	"github.com/lonnng/starx/serialize/protobuf"
+	"github.com/lonnng/starx/session"
 )
 
 // Default serializer
 var serializer serialize.Serializer = protobuf.NewSerializer()
 
+var (
+	// Default serializer of remote call arguments and replies
+	rpcSerializer serialize.Serializer = gob.NewSerializer()
+
+	// Serializers of remote call arguments and replies of special services
+	serviceSerializers = map[string]serialize.Serializer{
+		introspectService: jsonserialize.NewSerializer(),
+	}
+
+	// Serializers of payloads which clients negotiate in handshake by name
+	clientSerializers = map[string]serialize.Serializer{
+		"json":     jsonserialize.NewSerializer(),
+		"protobuf": protobuf.NewSerializer(),
+	}
+)
+
 // Customize serializer
 func SetSerializer(seri serialize.Serializer) {
 	serializer = seri
 }
+
+// Customize serializer of remote call arguments and replies
+func SetRPCSerializer(seri serialize.Serializer) {
+	rpcSerializer = seri
+}
+
+// Customize serializer of remote call arguments and replies of the special
+// service, the caller and the callee must use the same serializer
+func SetServiceRPCSerializer(service string, seri serialize.Serializer) {
+	serviceSerializers[service] = seri
+}
+
+func serializerOf(service string) serialize.Serializer {
+	if seri, ok := serviceSerializers[service]; ok && seri != nil {
+		return seri
+	}
+	return rpcSerializer
+}
+
+// Register serializer of payloads which clients negotiate in handshake with
+// sys.serializer, e.g: json for web clients, protobuf for native clients, the
+// payloads of the sessions not negotiated are serialized by the default
+// serializer
+func RegisterSerializer(name string, seri serialize.Serializer) {
+	clientSerializers[name] = seri
+}
+
+// negotiateSerializer returns the name of the serializer requested by the
+// client in handshake, empty when not requested or not registered
+func negotiateSerializer(data []byte) string {
+	hs := struct {
+		Sys struct {
+			Serializer string `json:"serializer"`
+		} `json:"sys"`
+	}{}
+	if len(data) > 0 {
+		json.Unmarshal(data, &hs)
+	}
+	if _, ok := clientSerializers[hs.Sys.Serializer]; !ok {
+		return ""
+	}
+	return hs.Sys.Serializer
+}
+
+// serializerFor returns the serializer of payloads of the session
+func serializerFor(s *session.Session) serialize.Serializer {
+	if name := s.Meta().Serializer; name != "" {
+		if seri, ok := clientSerializers[name]; ok && seri != nil {
+			return seri
+		}
+	}
+	return serializer
+}
+
+// serializeFor serializes v by the serializer of the session, []byte is
+// sent raw
+func serializeFor(s *session.Session, v interface{}) ([]byte, error) {
+	if data, ok := v.([]byte); ok {
+		return data, nil
+	}
+	data, err := serializerFor(s).Serialize(v)
+	if err != nil {
+		log.Errorf(err.Error())
+		return nil, err
+	}
+	return data, nil
+}
+
+// payloads serializes a message pushed to many sessions once for every
+// serializer of them, it is safe for concurrent use
+type payloads struct {
+	sync.Mutex
+	v    interface{}
+	data map[string][]byte // serializer name -> payload
+}
+
+func newPayloads(v interface{}) *payloads {
+	return &payloads{v: v, data: make(map[string][]byte)}
+}
+
+// of returns the payload serialized for the session
+func (p *payloads) of(s *session.Session) ([]byte, error) {
+	if data, ok := p.v.([]byte); ok {
+		return data, nil
+	}
+	name := s.Meta().Serializer
+	if _, ok := clientSerializers[name]; !ok {
+		name = ""
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if data, ok := p.data[name]; ok {
+		return data, nil
+	}
+	data, err := serializeFor(s, p.v)
+	if err != nil {
+		return nil, err
+	}
+	p.data[name] = data
+	return data, nil
+}
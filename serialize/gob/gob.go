@@ -0,0 +1,24 @@
+package gob
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+type Serializer struct{}
+
+func NewSerializer() *Serializer {
+	return &Serializer{}
+}
+
+func (s *Serializer) Serialize(v interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte(nil))
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *Serializer) Deserialize(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestNegotiateSerializer(t *testing.T) {
+	cases := map[string]string{
+		``:                                 "",
+		`{"sys":{}}`:                       "",
+		`{"sys":{"serializer":"json"}}`:    "json",
+		`{"sys":{"serializer":"msgpack"}}`: "",
+	}
+	for data, want := range cases {
+		if got := negotiateSerializer([]byte(data)); got != want {
+			t.Fatalf("handshake %q: expect serializer %q, got %q", data, want, got)
+		}
+	}
+}
+
+func TestSerializeFor(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := transporter.createAgent(conn)
+	defer a.closeWith(CloseDisconnected)
+	meta := a.session.Meta()
+	meta.Serializer = "json"
+	a.session.SetMeta(meta)
+
+	msg := struct {
+		Text string `json:"text"`
+	}{"hello"}
+	if err := a.session.Push("onChat", msg); err != nil {
+		t.Fatal(err)
+	}
+	data := <-a.sendBuffer
+	if !bytes.Contains(data, []byte(`{"text":"hello"}`)) {
+		t.Fatalf("payload should be serialized by the serializer of session: %q", data)
+	}
+
+	// the default serializer can not serialize the message
+	conn, peer = net.Pipe()
+	defer peer.Close()
+	b := transporter.createAgent(conn)
+	defer b.closeWith(CloseDisconnected)
+	if _, err := serializeFor(b.session, msg); err == nil {
+		t.Fatal("payload of session not negotiated should be serialized by the default serializer")
+	}
+
+	p := newPayloads(msg)
+	first, err := p.of(a.session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := p.of(a.session); &again[0] != &first[0] {
+		t.Fatal("payload should be serialized once for every serializer")
+	}
+	if _, err := p.of(b.session); err == nil {
+		t.Fatal("payload of session not negotiated should be serialized by the default serializer")
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/lonnng/starx/component"
+)
+
+// services is the service map shared by the handler service and the remote
+// service, the services are looked up by requests while registered, replaced
+// and removed at runtime
+type services struct {
+	sync.RWMutex                               // protects serviceMap and aliases
+	serviceMap   map[string]*component.Service // service key => service
+	aliases      map[string]string             // alias => service name
+	kind         string                        // prefix of errors, e.g: handler
+	remote       bool                          // whether the remote methods are scanned
+}
+
+func newServices(kind string, remote bool) services {
+	return services{
+		serviceMap: make(map[string]*component.Service),
+		aliases:    make(map[string]string),
+		kind:       kind,
+		remote:     remote,
+	}
+}
+
+func (ss *services) error(str string) error {
+	return errors.New(ss.kind + ": " + str)
+}
+
+// scan returns the service of rcvr with its methods scanned
+func (ss *services) scan(rcvr component.Component, version string) (*component.Service, error) {
+	s := &component.Service{
+		Type:    reflect.TypeOf(rcvr),
+		Rcvr:    reflect.ValueOf(rcvr),
+		Version: version,
+	}
+	s.Name = reflect.Indirect(s.Rcvr).Type().Name()
+
+	if err := s.ScanHandler(); err != nil {
+		return nil, err
+	}
+	if ss.remote {
+		if err := s.ScanRemote(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (ss *services) register(rcvr component.Component) error {
+	return ss.registerVersion(rcvr, "")
+}
+
+// registerVersion registers rcvr as the version of the service, different
+// versions of the same service are live simultaneously
+func (ss *services) registerVersion(rcvr component.Component, version string) error {
+	_, err := ss.install(rcvr, version, false)
+	return err
+}
+
+// reregister replaces the service which has the same name and version with
+// rcvr, and returns the replaced service, requests in flight complete on the
+// old one
+func (ss *services) reregister(rcvr component.Component, version string) (*component.Service, error) {
+	return ss.install(rcvr, version, true)
+}
+
+func (ss *services) install(rcvr component.Component, version string, replace bool) (*component.Service, error) {
+	s, err := ss.scan(rcvr, version)
+	if err != nil {
+		return nil, err
+	}
+
+	ss.Lock()
+	defer ss.Unlock()
+
+	if ss.serviceMap == nil {
+		ss.serviceMap = make(map[string]*component.Service)
+	}
+
+	key := serviceKey(s.Name, s.Version)
+	old, ok := ss.serviceMap[key]
+	if ok && !replace {
+		return nil, ss.error("service already defined: " + key)
+	}
+	ss.serviceMap[key] = s
+	return old, nil
+}
+
+// swap replaces the receiver of the named service with rcvr atomically, the
+// service keeps its name, version and aliases, so requests never see a
+// registration gap, and returns the replaced service
+func (ss *services) swap(name string, rcvr component.Component) (*component.Service, error) {
+	s, err := ss.scan(rcvr, "")
+	if err != nil {
+		return nil, err
+	}
+
+	ss.Lock()
+	defer ss.Unlock()
+
+	if service, ok := ss.aliases[name]; ok {
+		name = service
+	}
+	old, ok := ss.serviceMap[name]
+	if !ok {
+		return nil, ss.error("service does not exists: " + name)
+	}
+	s.Name, s.Version = old.Name, old.Version
+	ss.serviceMap[name] = s
+	return old, nil
+}
+
+// unregister removes the service, and returns the removed service
+func (ss *services) unregister(name string) (*component.Service, error) {
+	ss.Lock()
+	defer ss.Unlock()
+
+	s, ok := ss.serviceMap[name]
+	if !ok {
+		return nil, ss.error("service does not exists: " + name)
+	}
+	delete(ss.serviceMap, name)
+	removeAliases(ss.serviceMap, ss.aliases, s.Name)
+	return s, nil
+}
+
+// alias registers the names as the aliases of the service
+func (ss *services) alias(names []string, service string) error {
+	ss.Lock()
+	defer ss.Unlock()
+
+	if ss.aliases == nil {
+		ss.aliases = make(map[string]string)
+	}
+	if err := addAliases(ss.serviceMap, ss.aliases, names, service); err != nil {
+		return ss.error(err.Error())
+	}
+	return nil
+}
+
+// service returns the best matching version of the service, the name can be
+// an alias of the service
+func (ss *services) service(name, version string) (*component.Service, bool) {
+	ss.RLock()
+	defer ss.RUnlock()
+
+	if service, ok := ss.aliases[name]; ok {
+		name = service
+	}
+	return lookupService(ss.serviceMap, name, version)
+}
+
+// enter returns the service like service, and holds it for the call, which
+// must release it after completed, the service is looked up and held under
+// the lock, so the one removed is not held any more
+func (ss *services) enter(name, version string) (*component.Service, bool) {
+	ss.RLock()
+	defer ss.RUnlock()
+
+	if service, ok := ss.aliases[name]; ok {
+		name = service
+	}
+	s, ok := lookupService(ss.serviceMap, name, version)
+	if ok && s != nil {
+		s.Hold()
+	}
+	return s, ok
+}
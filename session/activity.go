@@ -0,0 +1,55 @@
+package session
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Activity is the traffic statistics of session, for per-player traffic
+// analysis and abuse detection, they are counted by frontend server
+type Activity struct {
+	Requests   int64     // requests and notifies received
+	Pushes     int64     // pushes sent
+	BytesIn    int64     // bytes received, including heartbeats
+	BytesOut   int64     // bytes sent, including heartbeats
+	LastActive time.Time // time of the last request
+}
+
+// activity is the counters of session, accessed atomically
+type activity struct {
+	requests int64
+	pushes   int64
+	bytesIn  int64
+	bytesOut int64
+}
+
+// Activity returns the traffic statistics of session
+func (s *Session) Activity() Activity {
+	return Activity{
+		Requests:   atomic.LoadInt64(&s.activity.requests),
+		Pushes:     atomic.LoadInt64(&s.activity.pushes),
+		BytesIn:    atomic.LoadInt64(&s.activity.bytesIn),
+		BytesOut:   atomic.LoadInt64(&s.activity.bytesOut),
+		LastActive: s.LastActive(),
+	}
+}
+
+// RecordRequest counts a request or notify received
+func (s *Session) RecordRequest() {
+	atomic.AddInt64(&s.activity.requests, 1)
+}
+
+// RecordPush counts a push sent
+func (s *Session) RecordPush() {
+	atomic.AddInt64(&s.activity.pushes, 1)
+}
+
+// RecordIn counts the bytes received
+func (s *Session) RecordIn(n int) {
+	atomic.AddInt64(&s.activity.bytesIn, int64(n))
+}
+
+// RecordOut counts the bytes sent
+func (s *Session) RecordOut(n int) {
+	atomic.AddInt64(&s.activity.bytesOut, int64(n))
+}
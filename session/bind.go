@@ -0,0 +1,168 @@
+package session
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lonnng/starx/log"
+)
+
+// ReasonDuplicateLogin is the kick reason of the sessions replaced by a new
+// session of the same uid in single session mode
+const ReasonDuplicateLogin = "duplicate login"
+
+var (
+	bindLock      sync.RWMutex
+	bindings      = make(map[int64]map[int64]*Session) // uid => session id => session
+	singleSession bool                                 // whether a uid binds one session only
+	bindHook      func(*Session, int64) error          // called before a session bound
+	bindCb        []func(*Session)                     // called after a session bound
+)
+
+// SetSingleSession set whether a uid can be bound to one session only, the
+// sessions bound before are kicked with ReasonDuplicateLogin when a new
+// session bound in single session mode, default several sessions, e.g: phone
+// and tablet, can be bound to the same uid
+func SetSingleSession(single bool) {
+	bindLock.Lock()
+	defer bindLock.Unlock()
+
+	singleSession = single
+}
+
+// SetBindHook sets the function called before a session bound, e.g: to kick
+// the sessions bound in other servers, the binding fails when it returns an
+// error, nil removes the hook
+func SetBindHook(fn func(s *Session, uid int64) error) {
+	bindLock.Lock()
+	defer bindLock.Unlock()
+
+	bindHook = fn
+}
+
+// OnBind registers the callback fired after a session bound to uid by Bind,
+// BindExclusive or Upgrade, e.g: to load the player data
+func OnBind(cb func(s *Session)) {
+	bindLock.Lock()
+	defer bindLock.Unlock()
+
+	bindCb = append(bindCb, cb)
+}
+
+func (s *Session) Bind(uid int64) error {
+	bindLock.RLock()
+	single := singleSession
+	bindLock.RUnlock()
+
+	if err := s.bind(uid, single, nil); err != nil {
+		return err
+	}
+	s.bound()
+	return nil
+}
+
+// BindExclusive binds the session to uid, and kicks the sessions bound before
+// with ReasonDuplicateLogin regardless of single session mode
+func (s *Session) BindExclusive(uid int64) error {
+	if err := s.bind(uid, true, nil); err != nil {
+		return err
+	}
+	s.bound()
+	return nil
+}
+
+// bound fires the callbacks on session bound
+func (s *Session) bound() {
+	bindLock.RLock()
+	callbacks := bindCb
+	bindLock.RUnlock()
+
+	for _, cb := range callbacks {
+		cb(s)
+	}
+}
+
+// bind binds the session to uid, guard is called with bindLock held before
+// binding, and the binding fails when it returns an error
+func (s *Session) bind(uid int64, single bool, guard func() error) error {
+	if uid < 1 {
+		log.Errorf("uid invalid: %d", uid)
+		return ErrIllegalUID
+	}
+
+	bindLock.RLock()
+	hook := bindHook
+	bindLock.RUnlock()
+	if hook != nil {
+		if err := hook(s, uid); err != nil {
+			return err
+		}
+	}
+
+	bindLock.Lock()
+	if guard != nil {
+		if err := guard(); err != nil {
+			bindLock.Unlock()
+			return err
+		}
+	}
+	unbind(s)
+	s.Uid = uid
+	atomic.AddUint64(&s.revision, 1)
+	var replaced []*Session
+	if single {
+		for _, old := range bindings[uid] {
+			replaced = append(replaced, old)
+			delete(bindings[uid], old.ID)
+		}
+	}
+	if bindings[uid] == nil {
+		bindings[uid] = make(map[int64]*Session)
+	}
+	bindings[uid][s.ID] = s
+	bindLock.Unlock()
+
+	for _, old := range replaced {
+		if err := old.Kick(ReasonDuplicateLogin); err != nil {
+			log.Errorf("kick replaced session failed: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// Unbind removes the session from the sessions of its uid, it is called when
+// the session closed
+func (s *Session) Unbind() {
+	bindLock.Lock()
+	defer bindLock.Unlock()
+
+	unbind(s)
+}
+
+// unbind should be called with bindLock held
+func unbind(s *Session) {
+	if s.Uid < 1 {
+		return
+	}
+	if sessions, ok := bindings[s.Uid]; ok {
+		delete(sessions, s.ID)
+		if len(sessions) == 0 {
+			delete(bindings, s.Uid)
+		}
+	}
+}
+
+// SessionsOf returns the sessions bound to the uid, in the order of session
+// id
+func SessionsOf(uid int64) []*Session {
+	bindLock.RLock()
+	defer bindLock.RUnlock()
+
+	sessions := make([]*Session, 0, len(bindings[uid]))
+	for _, s := range bindings[uid] {
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
@@ -0,0 +1,99 @@
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sync/atomic"
+	"time"
+)
+
+// changes is the changed attributes of session, which are replicated between
+// frontend session and backend session
+type changes struct {
+	Set     map[string]interface{} // changed keys => values
+	Removed []string               // removed keys
+	Expires map[string]int64       // changed keys => deadlines in unix nanoseconds, for the keys set with ttl
+	Claims  map[string]interface{} // claims stored by Upgrade, nil means unchanged
+}
+
+// touch marks the key changed, it should be called with dataLock held
+func (s *Session) touch(key string) {
+	if s.dirty == nil {
+		s.dirty = make(map[string]struct{})
+	}
+	s.dirty[key] = struct{}{}
+	atomic.AddUint64(&s.revision, 1)
+}
+
+// Revision returns the count of changes of the attributes and the bound uid,
+// which tells whether the session changed since persisted
+func (s *Session) Revision() uint64 {
+	return atomic.LoadUint64(&s.revision)
+}
+
+// EncodeChanges returns the attributes changed since the last call, nil when
+// nothing changed, values are encoded by gob, the custom types stored in
+// session should be registered by gob.Register
+func (s *Session) EncodeChanges() ([]byte, error) {
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	if len(s.dirty) == 0 && !s.claimsDirty {
+		return nil, nil
+	}
+	c := changes{Set: make(map[string]interface{}), Expires: make(map[string]int64)}
+	if s.claimsDirty {
+		c.Claims = s.Claims()
+	}
+	data, now := s.attrs(), time.Now().UnixNano()
+	for key := range s.dirty {
+		if v, ok := data.get(key, now); ok {
+			c.Set[key] = v
+			if deadline, ok := data.expires[key]; ok {
+				c.Expires[key] = deadline
+			}
+		} else {
+			c.Removed = append(c.Removed, key)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(&c); err != nil {
+		return nil, err
+	}
+	s.dirty = nil
+	s.claimsDirty = false
+	return buf.Bytes(), nil
+}
+
+// ApplyChanges applies the changes encoded by EncodeChanges of the peer
+// session, the applied keys are not marked changed
+func (s *Session) ApplyChanges(data []byte) error {
+	var c changes
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&c); err != nil {
+		return err
+	}
+
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	s.update(func(data *attributes) {
+		for key, v := range c.Set {
+			data.set(key, v, c.Expires[key])
+		}
+		for _, key := range c.Removed {
+			data.remove(key)
+		}
+	})
+	for key := range c.Set {
+		delete(s.dirty, key)
+	}
+	for _, key := range c.Removed {
+		delete(s.dirty, key)
+	}
+	if c.Claims != nil {
+		s.claims.Store(c.Claims)
+	}
+	atomic.AddUint64(&s.revision, 1)
+	return nil
+}
@@ -0,0 +1,80 @@
+package session
+
+// Handle is a restricted view of session, which game code can hold in its own
+// goroutines, e.g: a room loop pushing frames. It pushes and responses through
+// the network entity of session, and reads the attributes of session when
+// detached, so it never races the network loop mutating the live session
+type Handle struct {
+	view *Session // copy of the session when detached, never modified
+}
+
+// Detach returns the handle of session, the attributes, bound uid and the
+// id of request in processing are captured, so the response of handle goes
+// to the request detached from even if the client sends the next one
+func (s *Session) Detach() *Handle {
+	view := &Session{
+		ID:      s.ID,
+		Uid:     s.Uid,
+		Entity:  s.Entity,
+		LastID:  s.LastID,
+		TraceID: s.TraceID,
+		SpanID:  s.SpanID,
+	}
+	view.data.Store(s.attrs())
+	if m, ok := s.meta.Load().(*Meta); ok {
+		view.meta.Store(m)
+	}
+	return &Handle{view: view}
+}
+
+// Clone returns the handle of session, the same as Detach
+func (s *Session) Clone() *Handle {
+	return s.Detach()
+}
+
+// ID returns the id of session
+func (h *Handle) ID() int64 {
+	return h.view.ID
+}
+
+// Uid returns the uid bound to session when detached
+func (h *Handle) Uid() int64 {
+	return h.view.Uid
+}
+
+// Get returns the value of key when detached, and reports whether the key
+// exists
+func (h *Handle) Get(key string) (interface{}, bool) {
+	return h.view.Get(key)
+}
+
+// Value returns the value of key when detached
+func (h *Handle) Value(key string) interface{} {
+	return h.view.Value(key)
+}
+
+// State returns a copy of the attributes when detached
+func (h *Handle) State() map[string]interface{} {
+	return h.view.State()
+}
+
+// Meta returns the metadata of the client connection
+func (h *Handle) Meta() Meta {
+	return h.view.Meta()
+}
+
+// Push message to the client of session
+func (h *Handle) Push(route string, v interface{}) error {
+	return h.view.Push(route, v)
+}
+
+// Response message to the request detached from
+func (h *Handle) Response(v interface{}) error {
+	return h.view.Response(v)
+}
+
+// ResponseWithCode responses message with status code to the request
+// detached from
+func (h *Handle) ResponseWithCode(code uint, v interface{}) error {
+	return h.view.ResponseWithCode(code, v)
+}
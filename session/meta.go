@@ -0,0 +1,48 @@
+package session
+
+import "time"
+
+// Meta is the metadata of the client connection of session
+type Meta struct {
+	RemoteAddr  string                 // address of the client, forwarded to backend servers
+	ConnectedAt time.Time              // time the client connected, zero in backend servers
+	Options     map[string]interface{} // protocol options negotiated in handshake, e.g: heartbeat
+	Handshake   []byte                 // handshake payload sent by the client
+	Serializer  string                 // serializer of payloads negotiated in handshake, empty for default
+}
+
+// Meta returns the metadata of the client connection, e.g: for geo and risk
+// checks, backend servers know the remote address only
+func (s *Session) Meta() Meta {
+	if m, ok := s.meta.Load().(*Meta); ok {
+		return *m
+	}
+	return Meta{}
+}
+
+// SetMeta sets the metadata of the client connection
+func (s *Session) SetMeta(m Meta) {
+	s.meta.Store(&m)
+}
+
+// SetRemoteAddr sets the address of the client, it is called by backend
+// servers with the address forwarded by frontend
+func (s *Session) SetRemoteAddr(addr string) {
+	m := s.Meta()
+	if m.RemoteAddr == addr {
+		return
+	}
+	m.RemoteAddr = addr
+	s.SetMeta(m)
+}
+
+// SetSerializer sets the serializer of payloads, it is called by backend
+// servers with the serializer forwarded by frontend
+func (s *Session) SetSerializer(name string) {
+	m := s.Meta()
+	if m.Serializer == name {
+		return
+	}
+	m.Serializer = name
+	s.SetMeta(m)
+}
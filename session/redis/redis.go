@@ -0,0 +1,321 @@
+// Package redis implements session.Store on redis, it talks the redis
+// protocol(RESP) directly and does not depend on a redis client library.
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/session"
+)
+
+// ErrProtocol is returned when the reply of redis server is malformed
+var ErrProtocol = errors.New("redis: malformed reply")
+
+// Config of the redis store
+type Config struct {
+	Addr        string        // address of redis server, e.g: 127.0.0.1:6379
+	Password    string        // password for AUTH, empty means no auth
+	DB          int           // database selected after connected
+	Prefix      string        // prefix of keys, default: starx:session:
+	TTL         time.Duration // expiration of snapshots, zero means never expire
+	DialTimeout time.Duration // timeout of dialing, default: 5s
+	Timeout     time.Duration // timeout of a command, default: 5s
+}
+
+// Store saves the session snapshots in redis
+type Store struct {
+	config Config
+
+	sync.Mutex // protects following fields
+	conn       net.Conn
+	reader     *bufio.Reader
+}
+
+// Error is the error replied by redis server
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// New returns a store on the redis server, the connection is dialed on the
+// first command, and re-dialed after it broken
+func New(config Config) *Store {
+	if config.Prefix == "" {
+		config.Prefix = "starx:session:"
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = 5 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	return &Store{config: config}
+}
+
+// Save stores the snapshot of key
+func (s *Store) Save(key string, snapshot *session.Snapshot) error {
+	data, err := session.EncodeSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+	args := []string{"SET", s.config.Prefix + key, string(data)}
+	if s.config.TTL > 0 {
+		ms := int64(s.config.TTL / time.Millisecond)
+		if ms < 1 {
+			ms = 1
+		}
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	_, err = s.do(args...)
+	return err
+}
+
+// Load returns the snapshot of key, or session.ErrSnapshotNotFound
+func (s *Store) Load(key string) (*session.Snapshot, error) {
+	reply, err := s.do("GET", s.config.Prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, session.ErrSnapshotNotFound
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, ErrProtocol
+	}
+	return session.DecodeSnapshot(data)
+}
+
+// Delete removes the snapshot of key
+func (s *Store) Delete(key string) error {
+	_, err := s.do("DEL", s.config.Prefix+key)
+	return err
+}
+
+// Close closes the connection to redis server
+func (s *Store) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn, s.reader = nil, nil
+	return err
+}
+
+// do sends the command and reads its reply, a command failed on a broken
+// connection is retried once on a new connection
+func (s *Store) do(args ...string) (interface{}, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	reused := s.conn != nil
+	reply, err := s.roundTrip(args)
+	if err == nil || !reused {
+		return reply, err
+	}
+	if _, ok := err.(Error); ok {
+		return reply, err
+	}
+	return s.roundTrip(args)
+}
+
+func (s *Store) roundTrip(args []string) (interface{}, error) {
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := s.command(args)
+	if _, ok := err.(Error); err != nil && !ok {
+		s.conn.Close()
+		s.conn, s.reader = nil, nil
+	}
+	return reply, err
+}
+
+func (s *Store) dial() error {
+	conn, err := net.DialTimeout("tcp", s.config.Addr, s.config.DialTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	if s.config.Password != "" {
+		setup = append(setup, []string{"AUTH", s.config.Password})
+	}
+	if s.config.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.config.DB)})
+	}
+	for _, args := range setup {
+		if _, err := s.command(args); err != nil {
+			conn.Close()
+			s.conn, s.reader = nil, nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) command(args []string) (interface{}, error) {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	// a stalled server fails the command instead of blocking the callers
+	s.conn.SetDeadline(time.Now().Add(s.config.Timeout))
+	if _, err := s.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(s.reader)
+}
+
+// readReply reads a reply, bulk strings are returned as []byte and the nil
+// bulk string as nil
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, ErrProtocol
+	}
+
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n < -1 {
+			return nil, ErrProtocol
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n < -1 {
+			return nil, ErrProtocol
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			if replies[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply type %q", line[0])
+	}
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, ErrProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+// ChannelStore saves the members of channels in a redis hash, it implements
+// starx.ChannelStore, and shares the connection of the session store
+type ChannelStore struct {
+	store *Store
+	key   string
+}
+
+// Channels returns the channel store on the hash of key, default:
+// starx:channels
+func (s *Store) Channels(key string) *ChannelStore {
+	if key == "" {
+		key = "starx:channels"
+	}
+	return &ChannelStore{store: s, key: key}
+}
+
+// Save stores the uids of the members of channel
+func (c *ChannelStore) Save(name string, uids []int64) error {
+	buf := make([]byte, 0, len(uids)*8)
+	for i, uid := range uids {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendInt(buf, uid, 10)
+	}
+	_, err := c.store.do("HSET", c.key, name, string(buf))
+	return err
+}
+
+// Load returns the uids of the members of all channels saved
+func (c *ChannelStore) Load() (map[string][]int64, error) {
+	reply, err := c.store.do("HGETALL", c.key)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := reply.([]interface{})
+	if !ok || len(fields)%2 != 0 {
+		return nil, ErrProtocol
+	}
+
+	channels := make(map[string][]int64, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		name, ok := fields[i].([]byte)
+		value, ok2 := fields[i+1].([]byte)
+		if !ok || !ok2 {
+			return nil, ErrProtocol
+		}
+		uids := []int64{}
+		for _, s := range strings.Split(string(value), ",") {
+			if s == "" {
+				continue
+			}
+			uid, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, ErrProtocol
+			}
+			uids = append(uids, uid)
+		}
+		channels[string(name)] = uids
+	}
+	return channels, nil
+}
+
+// Delete removes the channel
+func (c *ChannelStore) Delete(name string) error {
+	_, err := c.store.do("HDEL", c.key, name)
+	return err
+}
@@ -0,0 +1,231 @@
+package redis
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/session"
+)
+
+// fakeServer serves GET/SET/DEL/HSET/HGETALL/HDEL/AUTH/SELECT of redis
+// protocol in memory
+type fakeServer struct {
+	sync.Mutex
+	ln       net.Listener
+	data     map[string]string
+	hashes   map[string]map[string]string
+	commands [][]string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln, data: make(map[string]string), hashes: make(map[string]map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		s.Lock()
+		s.commands = append(s.commands, args)
+		var out string
+		switch args[0] {
+		case "GET":
+			if v, ok := s.data[args[1]]; ok {
+				out = "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+			} else {
+				out = "$-1\r\n"
+			}
+		case "SET":
+			s.data[args[1]] = args[2]
+			out = "+OK\r\n"
+		case "DEL":
+			delete(s.data, args[1])
+			out = ":1\r\n"
+		case "HSET":
+			if s.hashes[args[1]] == nil {
+				s.hashes[args[1]] = make(map[string]string)
+			}
+			s.hashes[args[1]][args[2]] = args[3]
+			out = ":1\r\n"
+		case "HGETALL":
+			hash := s.hashes[args[1]]
+			out = "*" + strconv.Itoa(len(hash)*2) + "\r\n"
+			for k, v := range hash {
+				out += "$" + strconv.Itoa(len(k)) + "\r\n" + k + "\r\n"
+				out += "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+			}
+		case "HDEL":
+			delete(s.hashes[args[1]], args[2])
+			out = ":1\r\n"
+		case "AUTH":
+			if args[1] == "secret" {
+				out = "+OK\r\n"
+			} else {
+				out = "-ERR invalid password\r\n"
+			}
+		default:
+			out = "+OK\r\n"
+		}
+		s.Unlock()
+		conn.Write([]byte(out))
+	}
+}
+
+func TestStore(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.ln.Close()
+
+	store := New(Config{Addr: server.ln.Addr().String(), Password: "secret", DB: 2})
+	defer store.Close()
+
+	if _, err := store.Load("1"); err != session.ErrSnapshotNotFound {
+		t.Fatalf("expect ErrSnapshotNotFound, got %v", err)
+	}
+	snapshot := &session.Snapshot{Uid: 1, Data: map[string]interface{}{"level": 3}}
+	if err := store.Save("1", snapshot); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Uid != 1 || loaded.Data["level"] != 3 {
+		t.Fatalf("unexpected snapshot: %+v", loaded)
+	}
+	if err := store.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load("1"); err != session.ErrSnapshotNotFound {
+		t.Fatalf("expect ErrSnapshotNotFound, got %v", err)
+	}
+
+	server.Lock()
+	defer server.Unlock()
+	if first := server.commands[0]; first[0] != "AUTH" {
+		t.Fatalf("expect AUTH first, got %v", first)
+	}
+	if second := server.commands[1]; second[0] != "SELECT" || second[1] != "2" {
+		t.Fatalf("expect SELECT 2, got %v", second)
+	}
+	if _, ok := server.data["starx:session:1"]; ok {
+		t.Fatal("snapshot should be deleted")
+	}
+}
+
+func TestStore_AuthFailed(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.ln.Close()
+
+	store := New(Config{Addr: server.ln.Addr().String(), Password: "wrong"})
+	if _, err := store.Load("1"); err == nil || err.Error() != "ERR invalid password" {
+		t.Fatalf("expect auth error, got %v", err)
+	}
+}
+
+func TestStore_Reconnect(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.ln.Close()
+
+	store := New(Config{Addr: server.ln.Addr().String()})
+	defer store.Close()
+
+	if err := store.Save("1", &session.Snapshot{Uid: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// break the connection, the next command should redial
+	store.conn.Close()
+	if _, err := store.Load("1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore_Timeout(t *testing.T) {
+	// a server accepting connections but never replying
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	store := New(Config{Addr: ln.Addr().String(), Timeout: 20 * time.Millisecond})
+	defer store.Close()
+
+	start := time.Now()
+	if err := store.Save("1", &session.Snapshot{Uid: 1}); err == nil {
+		t.Fatal("command to a stalled server should fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("command should fail after the timeout, took %v", elapsed)
+	}
+}
+
+func TestChannelStore(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.ln.Close()
+
+	store := New(Config{Addr: server.ln.Addr().String()})
+	defer store.Close()
+	channels := store.Channels("")
+
+	if err := channels.Save("guild:1", []int64{3, 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := channels.Save("guild:2", nil); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := channels.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uids := loaded["guild:1"]; len(loaded) != 2 || len(uids) != 2 || uids[0] != 3 || uids[1] != 5 {
+		t.Fatalf("unexpected channels: %v", loaded)
+	}
+	if err := channels.Delete("guild:1"); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := channels.Load(); len(loaded) != 1 {
+		t.Fatalf("channel should be deleted, got %v", loaded)
+	}
+
+	server.Lock()
+	defer server.Unlock()
+	if _, ok := server.hashes["starx:channels"]; !ok {
+		t.Fatal("channels should be saved in the default hash")
+	}
+}
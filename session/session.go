@@ -4,6 +4,8 @@ import (
 	"errors"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lonnng/starx/log"
@@ -15,7 +17,9 @@ type NetworkEntity interface {
 	Send([]byte) error
 	Push(session *Session, route string, v interface{}) error
 	Response(session *Session, v interface{}) error
+	ResponseWithCode(session *Session, code uint, v interface{}) error
 	Call(session *Session, route string, reply interface{}, args ...interface{}) error
+	Kick(session *Session, v interface{}) error
 	Close()
 }
 
@@ -33,32 +37,90 @@ var (
 //
 // This is user sessions, does not contain raw sockets information
 type Session struct {
-	ID        int64                  // session global unique id
-	Uid       int64                  // binding user id
-	Entity    NetworkEntity          // raw session id, agent in frontend server, or acceptor in backend server
-	LastID    uint                   // last request id
-	data      map[string]interface{} // session data store
-	lastTime  int64                  // last heartbeat time
-	serverIDs map[string]string      // map of server type -> server id
+	ID        int64               // session global unique id
+	Uid       int64               // binding user id
+	Entity    NetworkEntity       // raw session id, agent in frontend server, or acceptor in backend server
+	LastID    uint                // last request id
+	TraceID   string              // trace id of the message in processing
+	SpanID    string              // span id of current server in the trace
+	dataLock  sync.Mutex          // serializes the writers of data, protects dirty and claimsDirty
+	data      atomic.Value        // session data store, *attributes replaced on write
+	dirty     map[string]struct{} // keys changed since the last synchronization
+	revision  uint64              // count of changes, accessed atomically
+	lastTime  int64               // last request time in nanoseconds, accessed atomically
+	timeout   int64               // heartbeat timeout, zero means the default, accessed atomically
+	serverMu  sync.Mutex          // serializes the writers of serverIDs
+	serverIDs atomic.Value        // server type -> server id, map[string]string replaced on write
+	meta      atomic.Value        // metadata of client connection, *Meta
+	tags      map[string]struct{} // tags of session, guarded by tagLock
+	activity  activity            // traffic counters of session
+	claims    atomic.Value        // claims of the authenticated client, map[string]interface{}
+
+	claimsDirty bool // claims changed since the last synchronization
 }
 
 // Create new session instance
 func New(entity NetworkEntity) *Session {
-	return &Session{
-		ID:        service.Connections.SessionID(),
-		Entity:    entity,
-		data:      make(map[string]interface{}),
-		lastTime:  time.Now().Unix(),
-		serverIDs: make(map[string]string),
-	}
+	s := &Session{
+		ID:       service.Connections.SessionID(),
+		Entity:   entity,
+		lastTime: time.Now().UnixNano(),
+	}
+	s.data.Store(&attributes{})
+	s.serverIDs.Store(map[string]string{})
+	return s
+}
+
+// attrs returns the snapshot of data, which is never modified after stored,
+// so the readers, e.g: broadcasters reading routing attributes of hot
+// sessions, do not contend for lock
+func (s *Session) attrs() *attributes {
+	data, _ := s.data.Load().(*attributes)
+	return data
+}
+
+// update applies fn to a copy of data and stores the copy, the expired
+// entries are dropped from the copy, it should be called with dataLock held
+func (s *Session) update(fn func(data *attributes)) {
+	data := s.attrs().clone(time.Now().UnixNano())
+	fn(data)
+	s.data.Store(data)
+}
+
+// MarkActive records the session sends a request now
+func (s *Session) MarkActive() {
+	atomic.StoreInt64(&s.lastTime, time.Now().UnixNano())
+}
+
+// LastActive returns the time of the last request of the session, or the
+// time created when no request received
+func (s *Session) LastActive() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&s.lastTime))
+}
+
+// SetTimeout overrides the heartbeat timeout of the session, e.g: longer for
+// players in loading screens, shorter for unauthenticated sockets, zero
+// restores the default(twice the heartbeat interval). The timeout should be
+// longer than the heartbeat interval, and the sessions are checked once per
+// interval
+func (s *Session) SetTimeout(d time.Duration) {
+	atomic.StoreInt64(&s.timeout, int64(d))
+}
+
+// Timeout returns the heartbeat timeout of the session, zero means the default
+func (s *Session) Timeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.timeout))
 }
 
 func (s *Session) ServerID(svrType string) string {
-	id, ok := s.serverIDs[svrType]
-	if !ok {
-		return ""
-	}
-	return id
+	return s.ServerIDs()[svrType]
+}
+
+// ServerIDs returns the servers of the session, server type -> server id, the
+// map is replaced when changed, and must not be modified
+func (s *Session) ServerIDs() map[string]string {
+	ids, _ := s.serverIDs.Load().(map[string]string)
+	return ids
 }
 
 // Set server id of the special type, delete type when id empty
@@ -71,11 +133,23 @@ func (s *Session) SetServerID(svrType, svrID string) {
 		return
 	}
 
-	if svrID == "" {
-		delete(s.serverIDs, svrType)
+	s.serverMu.Lock()
+	defer s.serverMu.Unlock()
+
+	old := s.ServerIDs()
+	if id, ok := old[svrType]; id == svrID && (ok || svrID == "") {
 		return
 	}
-	s.serverIDs[svrType] = svrID
+	ids := make(map[string]string, len(old)+1)
+	for t, id := range old {
+		ids[t] = id
+	}
+	if svrID == "" {
+		delete(ids, svrType)
+	} else {
+		ids[svrType] = svrID
+	}
+	s.serverIDs.Store(ids)
 }
 
 // Session send packet data
@@ -93,13 +167,11 @@ func (s *Session) Response(v interface{}) error {
 	return s.Entity.Response(s, v)
 }
 
-func (s *Session) Bind(uid int64) error {
-	if uid < 1 {
-		log.Errorf("uid invalid: %d", uid)
-		return ErrIllegalUID
-	}
-	s.Uid = uid
-	return nil
+// ResponseWithCode responses the status code with the body, so the clients
+// distinguish success, validation failure and server error uniformly, zero
+// code means success
+func (s *Session) ResponseWithCode(code uint, v interface{}) error {
+	return s.Entity.ResponseWithCode(s, code, v)
 }
 
 func (s *Session) Call(route string, reply interface{}, args ...interface{}) error {
@@ -113,21 +185,45 @@ func (s *Session) Close() {
 	s.Entity.Close()
 }
 
+// Kick sends the reason to the client as the final message, e.g: ban,
+// duplicate login and maintenance notice, and closes the connection after it
+// is flushed, the client receives it on "onKick"
+func (s *Session) Kick(reason interface{}) error {
+	return s.Entity.Kick(s, reason)
+}
+
 func (s *Session) Remove(key string) {
-	delete(s.data, key)
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	s.update(func(data *attributes) { data.remove(key) })
+	s.touch(key)
 }
 
+// Set stores the value of key, it is safe for concurrent use, so handlers can
+// attach per-player state, e.g: room id, login flags. The data is copied on
+// write, so the attributes should be few and written much less than read
 func (s *Session) Set(key string, value interface{}) {
-	s.data[key] = value
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	s.update(func(data *attributes) { data.set(key, value, 0) })
+	s.touch(key)
+}
+
+// Get returns the value of key, and reports whether the key exists, it reads
+// the snapshot of data without lock
+func (s *Session) Get(key string) (interface{}, bool) {
+	return s.attrs().get(key, time.Now().UnixNano())
 }
 
 func (s *Session) HasKey(key string) bool {
-	_, has := s.data[key]
+	_, has := s.Get(key)
 	return has
 }
 
 func (s *Session) Int(key string) int {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return 0
 	}
@@ -140,7 +236,7 @@ func (s *Session) Int(key string) int {
 }
 
 func (s *Session) Int8(key string) int8 {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return 0
 	}
@@ -153,7 +249,7 @@ func (s *Session) Int8(key string) int8 {
 }
 
 func (s *Session) Int16(key string) int16 {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return 0
 	}
@@ -166,7 +262,7 @@ func (s *Session) Int16(key string) int16 {
 }
 
 func (s *Session) Int32(key string) int32 {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return 0
 	}
@@ -179,7 +275,7 @@ func (s *Session) Int32(key string) int32 {
 }
 
 func (s *Session) Int64(key string) int64 {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return 0
 	}
@@ -192,7 +288,7 @@ func (s *Session) Int64(key string) int64 {
 }
 
 func (s *Session) Uint(key string) uint {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return 0
 	}
@@ -205,7 +301,7 @@ func (s *Session) Uint(key string) uint {
 }
 
 func (s *Session) Uint8(key string) uint8 {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return 0
 	}
@@ -218,7 +314,7 @@ func (s *Session) Uint8(key string) uint8 {
 }
 
 func (s *Session) Uint16(key string) uint16 {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return 0
 	}
@@ -231,7 +327,7 @@ func (s *Session) Uint16(key string) uint16 {
 }
 
 func (s *Session) Uint32(key string) uint32 {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return 0
 	}
@@ -244,7 +340,7 @@ func (s *Session) Uint32(key string) uint32 {
 }
 
 func (s *Session) Uint64(key string) uint64 {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return 0
 	}
@@ -257,7 +353,7 @@ func (s *Session) Uint64(key string) uint64 {
 }
 
 func (s *Session) Float32(key string) float32 {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return 0
 	}
@@ -270,7 +366,7 @@ func (s *Session) Float32(key string) float32 {
 }
 
 func (s *Session) Float64(key string) float64 {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return 0
 	}
@@ -283,7 +379,7 @@ func (s *Session) Float64(key string) float64 {
 }
 
 func (s *Session) String(key string) string {
-	v, ok := s.data[key]
+	v, ok := s.Get(key)
 	if !ok {
 		return ""
 	}
@@ -296,20 +392,37 @@ func (s *Session) String(key string) string {
 }
 
 func (s *Session) Value(key string) interface{} {
-	return s.data[key]
+	v, _ := s.Get(key)
+	return v
 }
 
-// Retrieve all session state
+// Retrieve all session state, the returned map is a copy, which is safe to
+// read while the session is modified
 func (s *Session) State() map[string]interface{} {
-	return s.data
+	return s.attrs().clone(time.Now().UnixNano()).values
 }
 
 // Restore session state after reconnect
 func (s *Session) Restore(data map[string]interface{}) {
-	s.data = data
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	state := &attributes{values: make(map[string]interface{}, len(data))}
+	for k, v := range data {
+		state.values[k] = v
+	}
+	s.data.Store(state)
+	atomic.AddUint64(&s.revision, 1)
 }
 
 func (s *Session) Clear() {
 	log.Debugf("Clear session data: Id=%d, Uid=%d", s.ID, s.Uid)
-	s.data = map[string]interface{}{}
+
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	for key := range s.attrs().values {
+		s.touch(key)
+	}
+	s.data.Store(&attributes{})
 }
@@ -1,6 +1,13 @@
 package session
 
-import "testing"
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 func TestNewSession(t *testing.T) {
 	s := New(nil)
@@ -173,3 +180,461 @@ func TestSession_Restore(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestSession_Get(t *testing.T) {
+	s := New(nil)
+	if _, ok := s.Get("room"); ok {
+		t.Fatal("missing key should not be found")
+	}
+	s.Set("room", int64(1001))
+	if v, ok := s.Get("room"); !ok || v.(int64) != 1001 {
+		t.Fatalf("unexpected value %v", v)
+	}
+	if s.Int64("room") != 1001 || s.Int("room") != 0 {
+		t.Fatal("typed accessor should return the value of the type only")
+	}
+}
+
+func TestSession_Concurrent(t *testing.T) {
+	s := New(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Set("login", true)
+				s.Int("room")
+				s.State()
+				s.Remove("login")
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSession_Changes(t *testing.T) {
+	backend, frontend := New(nil), New(nil)
+	frontend.Set("login", true)
+	frontend.Set("stale", "x")
+	frontend.EncodeChanges()
+
+	backend.Set("room", 1001)
+	backend.Set("login", false)
+	backend.Remove("stale")
+	data, err := backend.EncodeChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := frontend.ApplyChanges(data); err != nil {
+		t.Fatal(err)
+	}
+	if frontend.Int("room") != 1001 || frontend.Value("login") != false || frontend.HasKey("stale") {
+		t.Fatalf("unexpected state after applied: %v", frontend.State())
+	}
+
+	// applied keys are not replicated back
+	if data, _ := frontend.EncodeChanges(); data != nil {
+		t.Fatal("applied changes should not be marked changed")
+	}
+	if data, _ := backend.EncodeChanges(); data != nil {
+		t.Fatal("changes should be cleared after encoded")
+	}
+}
+
+type kickEntity struct {
+	id     int64
+	kicked interface{}
+}
+
+func (e *kickEntity) ID() int64                                                { return e.id }
+func (e *kickEntity) Send([]byte) error                                        { return nil }
+func (e *kickEntity) Push(*Session, string, interface{}) error                 { return nil }
+func (e *kickEntity) Response(*Session, interface{}) error                     { return nil }
+func (e *kickEntity) Call(*Session, string, interface{}, ...interface{}) error { return nil }
+func (e *kickEntity) ResponseWithCode(*Session, uint, interface{}) error       { return nil }
+func (e *kickEntity) Kick(s *Session, v interface{}) error                     { e.kicked = v; return nil }
+func (e *kickEntity) Close()                                                   {}
+
+func TestSession_BindMultiple(t *testing.T) {
+	phone, tablet := New(&kickEntity{}), New(&kickEntity{})
+	phone.Bind(42)
+	tablet.Bind(42)
+	defer phone.Unbind()
+	defer tablet.Unbind()
+
+	sessions := SessionsOf(42)
+	if len(sessions) != 2 || sessions[0] != phone || sessions[1] != tablet {
+		t.Fatalf("expect both sessions bound, got %d", len(sessions))
+	}
+
+	// rebind to another uid
+	tablet.Bind(43)
+	if len(SessionsOf(42)) != 1 || len(SessionsOf(43)) != 1 {
+		t.Fatal("rebound session should leave the old uid")
+	}
+
+	tablet.Unbind()
+	if len(SessionsOf(43)) != 0 {
+		t.Fatal("unbound session should be removed")
+	}
+}
+
+func TestSession_BindSingle(t *testing.T) {
+	SetSingleSession(true)
+	defer SetSingleSession(false)
+
+	old, entity := New(nil), &kickEntity{}
+	old.Entity = entity
+	old.Bind(44)
+	s := New(&kickEntity{})
+	s.Bind(44)
+	defer s.Unbind()
+
+	if sessions := SessionsOf(44); len(sessions) != 1 || sessions[0] != s {
+		t.Fatal("new session should replace the old one")
+	}
+	if entity.kicked != ReasonDuplicateLogin {
+		t.Fatalf("replaced session should be kicked, got %v", entity.kicked)
+	}
+}
+
+func TestSession_Snapshot(t *testing.T) {
+	s := New(&kickEntity{})
+	s.Bind(45)
+	s.Set("level", 7)
+	s.Unbind()
+
+	data, err := EncodeSnapshot(s.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := DecodeSnapshot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recovered := New(&kickEntity{})
+	revision := recovered.Revision()
+	if err := recovered.Recover(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Unbind()
+	if recovered.Uid != 45 || recovered.Int("level") != 7 {
+		t.Fatalf("unexpected recovered session, uid=%d, level=%d", recovered.Uid, recovered.Int("level"))
+	}
+	if recovered.Revision() == revision {
+		t.Fatal("recover should change the revision")
+	}
+}
+
+func TestSession_BindHook(t *testing.T) {
+	var hooked int64
+	SetBindHook(func(s *Session, uid int64) error {
+		if uid == 99 {
+			return ErrIllegalUID
+		}
+		hooked = uid
+		return nil
+	})
+	defer SetBindHook(nil)
+
+	old, entity := New(nil), &kickEntity{}
+	old.Entity = entity
+	old.Bind(46)
+	s := New(&kickEntity{})
+	if err := s.BindExclusive(46); err != nil || hooked != 46 {
+		t.Fatalf("hook should be called before bound, err=%v", err)
+	}
+	defer s.Unbind()
+	if entity.kicked != ReasonDuplicateLogin {
+		t.Fatal("session bound before should be kicked by exclusive binding")
+	}
+	if err := s.Bind(99); err != ErrIllegalUID || s.Uid != 46 {
+		t.Fatal("binding should fail when hook returns error")
+	}
+}
+
+func TestSession_Meta(t *testing.T) {
+	s := New(nil)
+	if m := s.Meta(); m.RemoteAddr != "" || !m.ConnectedAt.IsZero() {
+		t.Fatal("meta should be empty before set")
+	}
+
+	s.SetMeta(Meta{RemoteAddr: "10.0.0.1:3250", Handshake: []byte("{}")})
+	s.SetRemoteAddr("10.0.0.2:3250")
+	m := s.Meta()
+	if m.RemoteAddr != "10.0.0.2:3250" || string(m.Handshake) != "{}" {
+		t.Fatalf("unexpected meta: %+v", m)
+	}
+}
+
+func TestSession_Tags(t *testing.T) {
+	s1, s2 := New(nil), New(nil)
+	s1.AddTag("guild:123")
+	s1.AddTag("lobby")
+	s2.AddTag("lobby")
+
+	if tagged := SessionsTagged("lobby"); len(tagged) != 2 || tagged[0] != s1 || tagged[1] != s2 {
+		t.Fatalf("unexpected sessions tagged lobby: %v", tagged)
+	}
+	if tags := s1.Tags(); len(tags) != 2 || tags[0] != "guild:123" || !s1.HasTag("lobby") {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+
+	s2.RemoveTag("lobby")
+	if tagged := SessionsTagged("lobby"); len(tagged) != 1 || tagged[0] != s1 || s2.HasTag("lobby") {
+		t.Fatal("untagged session should be removed from index")
+	}
+	s1.ClearTags()
+	if len(SessionsTagged("lobby")) != 0 || len(SessionsTagged("guild:123")) != 0 || len(s1.Tags()) != 0 {
+		t.Fatal("tags should be cleared")
+	}
+}
+
+func TestSession_CopyOnWrite(t *testing.T) {
+	s := New(nil)
+	s.Set("room", 1001)
+	before := s.attrs()
+	s.Set("room", 1002)
+	s.Remove("login")
+	if before.values["room"] != 1001 {
+		t.Fatal("snapshot read before should not be modified by writes")
+	}
+
+	data := map[string]interface{}{"room": 1003}
+	s.Restore(data)
+	data["room"] = 1004
+	if s.Int("room") != 1003 {
+		t.Fatal("restored data should be copied")
+	}
+}
+
+func BenchmarkSession_GetParallel(b *testing.B) {
+	s := New(nil)
+	s.Set("room", 1001)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.Int("room")
+		}
+	})
+}
+
+type responseEntity struct {
+	kickEntity
+	responded uint
+}
+
+func (e *responseEntity) Response(s *Session, v interface{}) error {
+	e.responded = s.LastID
+	return nil
+}
+
+func TestSession_Detach(t *testing.T) {
+	entity := &responseEntity{}
+	s := New(entity)
+	s.Set("room", 1001)
+	s.LastID = 3
+	h := s.Detach()
+
+	// the network loop goes on with the live session
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			s.Set("room", 1002+i)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if h.Value("room") != 1001 {
+			t.Fatal("handle should read the attributes when detached")
+		}
+	}
+	wg.Wait()
+
+	s.LastID = 4
+	if err := h.Response("ok"); err != nil || entity.responded != 3 {
+		t.Fatalf("handle should response to the request detached from, got %d", entity.responded)
+	}
+	if h.ID() != s.ID || s.LastID != 4 {
+		t.Fatal("live session should not be modified by handle")
+	}
+}
+
+func TestSession_SetWithTTL(t *testing.T) {
+	s := New(nil)
+	s.SetWithTTL("cooldown", true, 20*time.Millisecond)
+	s.SetWithTTL("pending", 1, time.Minute)
+	if !s.HasKey("cooldown") || s.TTL("cooldown") <= 0 {
+		t.Fatal("key should exist before expired")
+	}
+
+	// replicated and saved with the deadline
+	backend := New(nil)
+	data, _ := s.EncodeChanges()
+	if err := backend.ApplyChanges(data); err != nil {
+		t.Fatal(err)
+	}
+	if backend.TTL("cooldown") <= 0 {
+		t.Fatal("deadline should be replicated")
+	}
+	recovered := New(nil)
+	recovered.Recover(s.Snapshot())
+	if recovered.TTL("pending") <= 0 {
+		t.Fatal("deadline should be saved in snapshot")
+	}
+
+	s.Set("pending", 2)
+	time.Sleep(30 * time.Millisecond)
+	if s.HasKey("cooldown") || backend.HasKey("cooldown") {
+		t.Fatal("key should disappear after expired")
+	}
+	if _, ok := s.State()["cooldown"]; ok {
+		t.Fatal("expired key should not be in state")
+	}
+	if s.Int("pending") != 2 || s.TTL("pending") != 0 {
+		t.Fatal("key set without ttl should never expire")
+	}
+}
+
+func TestSession_Activity(t *testing.T) {
+	s := New(nil)
+	s.MarkActive()
+	s.RecordRequest()
+	s.RecordRequest()
+	s.RecordPush()
+	s.RecordIn(64)
+	s.RecordOut(128)
+	s.RecordOut(2)
+
+	act := s.Activity()
+	if act.Requests != 2 || act.Pushes != 1 || act.BytesIn != 64 || act.BytesOut != 130 {
+		t.Fatalf("unexpected activity: %+v", act)
+	}
+	if act.LastActive.IsZero() {
+		t.Fatal("activity should carry the last active time")
+	}
+}
+
+func TestSession_Upgrade(t *testing.T) {
+	var bound []int64
+	OnBind(func(s *Session) { bound = append(bound, s.Uid) })
+	defer func() { bindCb = nil }()
+
+	s := New(nil)
+	defer s.Unbind()
+	s.Set(GuestPrefix+"cart", []int{1, 2})
+	s.SetWithTTL(GuestPrefix+"coupon", "NEW10", time.Minute)
+	s.Set("locale", "en")
+	s.EncodeChanges()
+
+	if err := s.Upgrade(101, map[string]interface{}{"role": "player"}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Uid != 101 || len(SessionsOf(101)) != 1 {
+		t.Fatal("session should be bound to uid")
+	}
+	if len(bound) != 1 || bound[0] != 101 {
+		t.Fatalf("bind callbacks should be fired once, got %v", bound)
+	}
+	if role, ok := s.Claim("role"); !ok || role != "player" {
+		t.Fatalf("claims should be stored, got %v", s.Claims())
+	}
+	if s.HasKey(GuestPrefix+"cart") || s.HasKey(GuestPrefix+"coupon") {
+		t.Fatal("guest-scoped attributes should be removed")
+	}
+	if cart, ok := s.Get("cart"); !ok || len(cart.([]int)) != 2 || s.String("locale") != "en" {
+		t.Fatal("guest-scoped attributes should be migrated")
+	}
+	if ttl := s.TTL("coupon"); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("ttl of the migrated attribute should be kept, got %v", ttl)
+	}
+
+	peer := New(nil)
+	if err := peer.ApplyChanges(mustEncodeChanges(t, s)); err != nil {
+		t.Fatal(err)
+	}
+	if !peer.HasKey("cart") || peer.HasKey(GuestPrefix+"cart") {
+		t.Fatal("migrated attributes should be replicated")
+	}
+	if role, ok := peer.Claim("role"); !ok || role != "player" {
+		t.Fatalf("claims should be replicated, got %v", peer.Claims())
+	}
+
+	recovered := New(nil)
+	defer recovered.Unbind()
+	if err := recovered.Recover(s.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	if role, ok := recovered.Claim("role"); !ok || role != "player" {
+		t.Fatalf("claims should be recovered, got %v", recovered.Claims())
+	}
+
+	if err := s.Upgrade(102, nil); err != ErrAuthenticated {
+		t.Fatalf("expect ErrAuthenticated, got %v", err)
+	}
+}
+
+func TestSession_UpgradeConcurrently(t *testing.T) {
+	s := New(nil)
+	defer s.Unbind()
+
+	var wg sync.WaitGroup
+	var upgraded int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(uid int64) {
+			defer wg.Done()
+			if s.Upgrade(uid, nil) == nil {
+				atomic.AddInt32(&upgraded, 1)
+			}
+		}(int64(200 + i))
+	}
+	wg.Wait()
+
+	if upgraded != 1 || len(SessionsOf(s.Uid)) != 1 {
+		t.Fatalf("session should be upgraded once, got %d", upgraded)
+	}
+}
+
+func mustEncodeChanges(t *testing.T, s *Session) []byte {
+	data, err := s.EncodeChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSession_ServerIDs(t *testing.T) {
+	s := New(nil)
+	s.SetServerID("chat", "chat-1")
+	ids := s.ServerIDs()
+
+	// unchanged servers do not replace the map
+	s.SetServerID("chat", "chat-1")
+	s.SetServerID("game", "")
+	if next := s.ServerIDs(); reflect.ValueOf(next).Pointer() != reflect.ValueOf(ids).Pointer() {
+		t.Fatalf("unchanged servers should not be copied: %v", next)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.SetServerID("game", "game-"+strconv.Itoa(i))
+				s.ServerID("game")
+				for range s.ServerIDs() {
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s.SetServerID("chat", "")
+	if ids["chat"] != "chat-1" || s.ServerID("chat") != "" {
+		t.Fatal("the map returned should not be modified by later changes")
+	}
+}
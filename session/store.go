@@ -0,0 +1,82 @@
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"time"
+)
+
+// ErrSnapshotNotFound is returned by store when the snapshot does not exist
+// or expired
+var ErrSnapshotNotFound = errors.New("session snapshot not found")
+
+// Snapshot is the logical state of a session, which survives the crash of the
+// frontend server
+type Snapshot struct {
+	Uid     int64                  // bound user id
+	Data    map[string]interface{} // attributes
+	Expires map[string]int64       // deadlines of the attributes set with ttl in unix nanoseconds
+	Servers map[string]string      // server type -> id of the backend server
+	Pending [][]byte               // packets not sent to the client yet
+	Claims  map[string]interface{} // claims stored by Upgrade
+}
+
+// Store persists the snapshots of sessions, so a client reconnecting after a
+// frontend crash can restore its session on another frontend server
+type Store interface {
+	// Save stores the snapshot of key, e.g: the uid of session
+	Save(key string, snapshot *Snapshot) error
+
+	// Load returns the snapshot of key, or ErrSnapshotNotFound
+	Load(key string) (*Snapshot, error)
+
+	// Delete removes the snapshot of key
+	Delete(key string) error
+}
+
+// Snapshot returns the snapshot of session
+func (s *Session) Snapshot() *Snapshot {
+	data := s.attrs().clone(time.Now().UnixNano())
+	return &Snapshot{Uid: s.Uid, Data: data.values, Expires: data.expires, Servers: s.ServerIDs(), Claims: s.Claims()}
+}
+
+// Recover restores the bound uid, claims, attributes and backend servers from
+// the snapshot, the pending packets are left to the caller
+func (s *Session) Recover(snapshot *Snapshot) error {
+	for t, id := range snapshot.Servers {
+		s.SetServerID(t, id)
+	}
+	data := snapshot.Data
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	s.Restore(data)
+	s.expire(snapshot.Expires)
+	if snapshot.Claims != nil {
+		s.setClaims(snapshot.Claims)
+	}
+	if snapshot.Uid > 0 {
+		return s.Bind(snapshot.Uid)
+	}
+	return nil
+}
+
+// EncodeSnapshot encodes the snapshot by gob, the custom types stored in
+// session should be registered by gob.Register
+func EncodeSnapshot(snapshot *Snapshot) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(snapshot); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeSnapshot decodes the snapshot encoded by EncodeSnapshot
+func DecodeSnapshot(data []byte) (*Snapshot, error) {
+	snapshot := &Snapshot{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,94 @@
+package session
+
+import (
+	"sort"
+	"sync"
+)
+
+var (
+	tagLock sync.RWMutex
+	tagged  = make(map[string]map[int64]*Session) // tag => session id => session
+)
+
+// AddTag tags the session, e.g: guild:123, lobby, the sessions with the same
+// tag form a lightweight group without channel, which is removed when the
+// last session untagged
+func (s *Session) AddTag(tag string) {
+	tagLock.Lock()
+	defer tagLock.Unlock()
+
+	if s.tags == nil {
+		s.tags = make(map[string]struct{})
+	}
+	s.tags[tag] = struct{}{}
+	if tagged[tag] == nil {
+		tagged[tag] = make(map[int64]*Session)
+	}
+	tagged[tag][s.ID] = s
+}
+
+// RemoveTag removes the tag from the session
+func (s *Session) RemoveTag(tag string) {
+	tagLock.Lock()
+	defer tagLock.Unlock()
+
+	removeTag(s, tag)
+}
+
+// HasTag reports whether the session has the tag
+func (s *Session) HasTag(tag string) bool {
+	tagLock.RLock()
+	defer tagLock.RUnlock()
+
+	_, ok := s.tags[tag]
+	return ok
+}
+
+// Tags returns the tags of the session in order
+func (s *Session) Tags() []string {
+	tagLock.RLock()
+	defer tagLock.RUnlock()
+
+	tags := make([]string, 0, len(s.tags))
+	for tag := range s.tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// ClearTags removes all tags of the session, it is called when the session
+// closed
+func (s *Session) ClearTags() {
+	tagLock.Lock()
+	defer tagLock.Unlock()
+
+	for tag := range s.tags {
+		removeTag(s, tag)
+	}
+}
+
+// removeTag should be called with tagLock held
+func removeTag(s *Session, tag string) {
+	delete(s.tags, tag)
+	if sessions, ok := tagged[tag]; ok {
+		delete(sessions, s.ID)
+		if len(sessions) == 0 {
+			delete(tagged, tag)
+		}
+	}
+}
+
+// SessionsTagged returns the sessions with the tag, in the order of session
+// id
+func SessionsTagged(tag string) []*Session {
+	tagLock.RLock()
+	defer tagLock.RUnlock()
+
+	sessions := make([]*Session, 0, len(tagged[tag]))
+	for _, s := range tagged[tag] {
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
@@ -0,0 +1,96 @@
+package session
+
+import "time"
+
+// attributes is the snapshot of session data, which is never modified after
+// stored, the copy made by clone is modified before stored
+type attributes struct {
+	values  map[string]interface{}
+	expires map[string]int64 // key => deadline in unix nanoseconds, for the keys set with ttl
+}
+
+// get returns the value of key, the expired value does not exist
+func (a *attributes) get(key string, now int64) (interface{}, bool) {
+	v, ok := a.values[key]
+	if !ok {
+		return nil, false
+	}
+	if deadline, ok := a.expires[key]; ok && now >= deadline {
+		return nil, false
+	}
+	return v, true
+}
+
+// clone copies the attributes not expired at now
+func (a *attributes) clone(now int64) *attributes {
+	c := &attributes{values: make(map[string]interface{}, len(a.values)+1)}
+	for k, v := range a.values {
+		if deadline, ok := a.expires[k]; ok {
+			if now >= deadline {
+				continue
+			}
+			if c.expires == nil {
+				c.expires = make(map[string]int64)
+			}
+			c.expires[k] = deadline
+		}
+		c.values[k] = v
+	}
+	return c
+}
+
+// set stores the value of key, zero deadline means never expired
+func (a *attributes) set(key string, value interface{}, deadline int64) {
+	a.values[key] = value
+	if deadline == 0 {
+		delete(a.expires, key)
+		return
+	}
+	if a.expires == nil {
+		a.expires = make(map[string]int64)
+	}
+	a.expires[key] = deadline
+}
+
+func (a *attributes) remove(key string) {
+	delete(a.values, key)
+	delete(a.expires, key)
+}
+
+// SetWithTTL stores the value of key, which disappears after ttl, e.g:
+// anti-spam cooldowns, pending confirmations. The deadline is replicated
+// between frontend session and backend session, and saved in the snapshot
+// of session. Set the key again without ttl to keep it
+func (s *Session) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	deadline := time.Now().Add(ttl).UnixNano()
+	s.update(func(data *attributes) { data.set(key, value, deadline) })
+	s.touch(key)
+}
+
+// TTL returns the time to live of key, zero when the key does not exist or
+// is never expired
+func (s *Session) TTL(key string) time.Duration {
+	data, now := s.attrs(), time.Now().UnixNano()
+	deadline, ok := data.expires[key]
+	if !ok || now >= deadline {
+		return 0
+	}
+	return time.Duration(deadline - now)
+}
+
+// expire sets the deadline of the key existing
+func (s *Session) expire(deadlines map[string]int64) {
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	s.update(func(data *attributes) {
+		for key, deadline := range deadlines {
+			if v, ok := data.values[key]; ok {
+				data.set(key, v, deadline)
+			}
+		}
+	})
+}
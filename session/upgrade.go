@@ -0,0 +1,98 @@
+package session
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// GuestPrefix prefixes the keys of guest-scoped attributes, e.g: guest.cart,
+// which are migrated to the keys without the prefix when session upgraded
+const GuestPrefix = "guest."
+
+// ErrAuthenticated is returned when upgrading a session bound to uid already
+var ErrAuthenticated = errors.New("session authenticated already")
+
+// Upgrade transitions the anonymous session to authenticated without
+// reconnect, it binds the session to uid, stores the claims, e.g: roles
+// verified by the login service, migrates the guest-scoped attributes, and
+// fires the callbacks registered by OnBind at last. The claims are replicated
+// to the backend servers like attributes, and kept in Snapshot, so their
+// values should be registered by gob.Register unless builtin types
+func (s *Session) Upgrade(uid int64, claims map[string]interface{}) error {
+	bindLock.RLock()
+	single := singleSession
+	authenticated := s.Uid > 0
+	bindLock.RUnlock()
+	if authenticated {
+		return ErrAuthenticated
+	}
+
+	// the session may be bound concurrently, checked again with bindLock held
+	guard := func() error {
+		if s.Uid > 0 {
+			return ErrAuthenticated
+		}
+		s.setClaims(claims)
+		return nil
+	}
+	if err := s.bind(uid, single, guard); err != nil {
+		return err
+	}
+
+	s.migrateGuest()
+	s.bound()
+	return nil
+}
+
+// setClaims stores the copy of claims, which are marked changed
+func (s *Session) setClaims(claims map[string]interface{}) {
+	c := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		c[k] = v
+	}
+
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	s.claims.Store(c)
+	s.claimsDirty = true
+	atomic.AddUint64(&s.revision, 1)
+}
+
+// migrateGuest moves the guest-scoped attributes to the keys without prefix,
+// the deadlines of the keys set with ttl are kept
+func (s *Session) migrateGuest() {
+	s.dataLock.Lock()
+	defer s.dataLock.Unlock()
+
+	var keys []string
+	s.update(func(data *attributes) {
+		for k := range data.values {
+			if strings.HasPrefix(k, GuestPrefix) {
+				keys = append(keys, k)
+			}
+		}
+		for _, k := range keys {
+			data.set(strings.TrimPrefix(k, GuestPrefix), data.values[k], data.expires[k])
+			data.remove(k)
+		}
+	})
+	for _, k := range keys {
+		s.touch(k)
+		s.touch(strings.TrimPrefix(k, GuestPrefix))
+	}
+}
+
+// Claims returns the claims of the authenticated client stored by Upgrade,
+// nil for the anonymous session, it should not be modified
+func (s *Session) Claims() map[string]interface{} {
+	c, _ := s.claims.Load().(map[string]interface{})
+	return c
+}
+
+// Claim returns the claim of key
+func (s *Session) Claim(key string) (interface{}, bool) {
+	v, ok := s.Claims()[key]
+	return v, ok
+}
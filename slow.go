@@ -0,0 +1,46 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package starx
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+)
+
+// logSlow logs the call which takes longer than the slow threshold
+func (rs *remoteService) logSlow(ac *acceptor, rr *rpc.Request, elapsed time.Duration) {
+	if rs.slowCall <= 0 || elapsed < rs.slowCall {
+		return
+	}
+	log.Warnf("remote: slow call %s", describeCall(ac, rr, elapsed))
+}
+
+// describeCall returns the description of call, includes the method, session,
+// payload size and caller
+func describeCall(ac *acceptor, rr *rpc.Request, elapsed time.Duration) string {
+	from := rr.Caller
+	if ac != nil {
+		from = caller(ac, rr)
+	}
+	return fmt.Sprintf("%s took %s, Sid=%d, Size=%d, Caller=%s", rr.ServiceMethod, elapsed, rr.Sid, len(rr.Data), from)
+}
@@ -0,0 +1,16 @@
+package starx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+func TestDescribeCall(t *testing.T) {
+	rr := &rpc.Request{ServiceMethod: "Room.Join", Sid: 7, Data: []byte("hello"), Caller: "gate-1"}
+	expect := "Room.Join took 1.5s, Sid=7, Size=5, Caller=gate-1"
+	if s := describeCall(nil, rr, 1500*time.Millisecond); s != expect {
+		t.Fatalf("expect %q, got %q", expect, s)
+	}
+}
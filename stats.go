@@ -0,0 +1,161 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/lonnng/starx/session"
+)
+
+// SessionStats is the count of the sessions of current frontend server
+type SessionStats struct {
+	Handshaking int64 // connected, and the handshake is not completed
+	Working     int64 // the handshake completed
+}
+
+// Total returns the count of all sessions
+func (s SessionStats) Total() int64 {
+	return s.Handshaking + s.Working
+}
+
+type threshold struct {
+	count int64
+	cb    func(SessionStats, bool)
+}
+
+var (
+	thresholdLock sync.RWMutex
+	thresholds    []threshold
+)
+
+// SessionCounts returns the count of the sessions of current frontend server
+func SessionCounts() SessionStats {
+	return SessionStats{
+		Handshaking: atomic.LoadInt64(&transporter.handshaking),
+		Working:     atomic.LoadInt64(&transporter.working),
+	}
+}
+
+// Traffic is the traffic statistics of all sessions of current frontend
+// server since started
+type Traffic struct {
+	Requests int64 // requests and notifies received
+	Pushes   int64 // pushes sent
+	BytesIn  int64 // bytes received, including heartbeats
+	BytesOut int64 // bytes sent, including heartbeats
+}
+
+// SessionTraffic returns the traffic statistics of all sessions of current
+// frontend server, the statistics of every session are returned by
+// session.Activity
+func SessionTraffic() Traffic {
+	t := &transporter.traffic
+	return Traffic{
+		Requests: atomic.LoadInt64(&t.Requests),
+		Pushes:   atomic.LoadInt64(&t.Pushes),
+		BytesIn:  atomic.LoadInt64(&t.BytesIn),
+		BytesOut: atomic.LoadInt64(&t.BytesOut),
+	}
+}
+
+// recordRequest counts a request of the agent
+func (a *agent) recordRequest() {
+	a.session.RecordRequest()
+	atomic.AddInt64(&transporter.traffic.Requests, 1)
+}
+
+// recordPush counts a push to the session of frontend
+func recordPush(s *session.Session) {
+	if _, ok := s.Entity.(*agent); ok {
+		s.RecordPush()
+		atomic.AddInt64(&transporter.traffic.Pushes, 1)
+	}
+}
+
+func (a *agent) recordIn(n int) {
+	a.session.RecordIn(n)
+	atomic.AddInt64(&transporter.traffic.BytesIn, int64(n))
+}
+
+func (a *agent) recordOut(n int) {
+	a.session.RecordOut(n)
+	atomic.AddInt64(&transporter.traffic.BytesOut, int64(n))
+}
+
+// OnSessionThreshold registers the callback fired when the total count of
+// sessions crosses the threshold, up is true when the count rises to the
+// threshold, and false when it falls below, e.g: to drive autoscaling and
+// alerting. The callback runs in the goroutine of the session created or
+// closed, and should not block
+func OnSessionThreshold(count int64, cb func(stats SessionStats, up bool)) {
+	thresholdLock.Lock()
+	defer thresholdLock.Unlock()
+
+	thresholds = append(thresholds, threshold{count: count, cb: cb})
+}
+
+// crossed fires the callbacks of the thresholds crossed when the total count
+// of sessions changed
+func crossed(from, to int64) {
+	thresholdLock.RLock()
+	list := thresholds
+	thresholdLock.RUnlock()
+
+	for _, th := range list {
+		switch {
+		case from < th.count && to >= th.count:
+			th.cb(SessionCounts(), true)
+		case from >= th.count && to < th.count:
+			th.cb(SessionCounts(), false)
+		}
+	}
+}
+
+// setStatus changes the status of agent, and counts the sessions of the agents
+// managed by transporter
+func (t *transportService) setStatus(a *agent, status networkStatus) {
+	t.Lock()
+	from := a.status
+	a.status = status
+	managed := t.agents[a.id] == a
+	t.Unlock()
+
+	if !managed || from == status || from == statusClosed {
+		return
+	}
+	t.count(from, -1)
+	t.count(status, 1)
+	if status == statusClosed {
+		n := atomic.AddInt64(&t.sessions, -1)
+		crossed(n+1, n)
+	}
+}
+
+func (t *transportService) count(status networkStatus, delta int64) {
+	switch status {
+	case statusStart, statusHandshake:
+		atomic.AddInt64(&t.handshaking, delta)
+	case statusWorking:
+		atomic.AddInt64(&t.working, delta)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSessionCounts(t *testing.T) {
+	base := SessionCounts()
+	type event struct {
+		stats SessionStats
+		up    bool
+	}
+	events := make(chan event, 4)
+	OnSessionThreshold(base.Total()+1, func(stats SessionStats, up bool) {
+		select {
+		case events <- event{stats, up}:
+		default:
+		}
+	})
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := transporter.createAgent(conn)
+	if e := <-events; !e.up || e.stats.Handshaking != base.Handshaking+1 {
+		t.Fatalf("unexpected event on session created: %+v", e)
+	}
+
+	transporter.setStatus(a, statusWorking)
+	if stats := SessionCounts(); stats.Working != base.Working+1 || stats.Handshaking != base.Handshaking {
+		t.Fatalf("unexpected counts after handshake: %+v", stats)
+	}
+
+	a.closeWith(CloseDisconnected)
+	if e := <-events; e.up || e.stats != base {
+		t.Fatalf("unexpected event on session closed: %+v", e)
+	}
+}
+
+func TestSessionTraffic(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	a := transporter.createAgent(conn)
+	defer a.closeWith(CloseDisconnected)
+
+	base := SessionTraffic()
+	a.recordIn(12)
+	a.recordRequest()
+	a.recordOut(30)
+	recordPush(a.session)
+
+	want := Traffic{
+		Requests: base.Requests + 1,
+		Pushes:   base.Pushes + 1,
+		BytesIn:  base.BytesIn + 12,
+		BytesOut: base.BytesOut + 30,
+	}
+	if traffic := SessionTraffic(); traffic != want {
+		t.Fatalf("expect traffic %+v, got %+v", want, traffic)
+	}
+	if act := a.session.Activity(); act.Requests != 1 || act.Pushes != 1 || act.BytesIn != 12 || act.BytesOut != 30 {
+		t.Fatalf("unexpected activity of session: %+v", act)
+	}
+
+	// pushes to the sessions of backend are not counted
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+	recordPush(ac.Session(1))
+	if traffic := SessionTraffic(); traffic.Pushes != want.Pushes {
+		t.Fatalf("push of backend session should not be counted, got %d", traffic.Pushes)
+	}
+}
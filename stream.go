@@ -0,0 +1,162 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"errors"
+	"io"
+	"reflect"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+	routelib "github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/serialize"
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	ErrInvalidStreamReceiver = errors.New("stream receiver should be a function with one argument")
+
+	typeOfStream     = reflect.TypeOf((*Stream)(nil))
+	typeOfBidiStream = reflect.TypeOf((*rpc.BidiStream)(nil))
+)
+
+// Stream sends incremental replies of a remote call to the caller, a remote
+// method that declares *Stream as its last parameter can send any number of
+// replies before it returns the final reply
+type Stream struct {
+	w             io.Writer
+	serviceMethod string
+	seq           uint64
+	sid           int64
+	seri          serialize.Serializer
+}
+
+// newStream returns the stream of the request, the stream does not reference
+// the request, which will be freed after dispatched
+func newStream(w io.Writer, rr *rpc.Request, seri serialize.Serializer) *Stream {
+	return &Stream{
+		w:             w,
+		serviceMethod: rr.ServiceMethod,
+		seq:           rr.Seq,
+		sid:           rr.Sid,
+		seri:          seri,
+	}
+}
+
+// Send the value to the caller as an incremental reply
+func (s *Stream) Send(v interface{}) error {
+	data, err := s.seri.Serialize(v)
+	if err != nil {
+		return err
+	}
+
+	return rpc.WriteResponse(s.w, &rpc.Response{
+		Kind:          rpc.RemoteStream,
+		ServiceMethod: s.serviceMethod,
+		Seq:           s.seq,
+		Sid:           s.sid,
+		Data:          data,
+	})
+}
+
+// isStreamMethod reports whether the last parameter of the method is *Stream
+func isStreamMethod(mt reflect.Type) bool {
+	return mt.NumIn() > 1 && mt.In(mt.NumIn()-1) == typeOfStream
+}
+
+// isBidiStreamMethod reports whether the method accepts a bidirectional
+// stream as the only argument
+func isBidiStreamMethod(mt reflect.Type) bool {
+	return mt.NumIn() == 2 && mt.In(1) == typeOfBidiStream
+}
+
+// OpenStream opens a bidirectional stream to the remote method, which must
+// accept *rpc.BidiStream as the only argument, two servers can exchange an
+// ordered sequence of frames over the stream until both sides closed
+func OpenStream(s *session.Session, route string) (*rpc.BidiStream, error) {
+	r, err := routelib.Decode(route)
+	if err != nil {
+		return nil, err
+	}
+
+	if app.config.Type == r.ServerType {
+		return nil, ErrRPCLocal
+	}
+
+	return cluster.OpenStream(rpc.User, r, s)
+}
+
+// CallStream invokes a remote method which streams replies, recv must be a
+// function with one argument, that will be invoked with every incremental
+// reply, and the final reply will be stored in reply
+func CallStream(s *session.Session, route string, reply interface{}, recv interface{}, args ...interface{}) error {
+	if reflect.TypeOf(reply).Kind() != reflect.Ptr {
+		return session.ErrReplyShouldBePtr
+	}
+
+	fn := reflect.ValueOf(recv)
+	if fn.Kind() != reflect.Func || fn.Type().NumIn() != 1 {
+		return ErrInvalidStreamReceiver
+	}
+
+	r, err := routelib.Decode(route)
+	if err != nil {
+		return err
+	}
+
+	if app.config.Type == r.ServerType {
+		return ErrRPCLocal
+	}
+
+	seri := serializerOf(r.Service)
+	data, err := encodeArgs(seri, args...)
+	if err != nil {
+		return err
+	}
+
+	typ := fn.Type().In(0)
+	ret, err := cluster.Stream(rpc.User, r, s, data, func(data []byte) {
+		var (
+			v   reflect.Value
+			err error
+		)
+		if typ.Kind() == reflect.Ptr {
+			v = reflect.New(typ.Elem())
+			err = seri.Deserialize(data, v.Interface())
+		} else {
+			v = reflect.New(typ)
+			err = seri.Deserialize(data, v.Interface())
+			v = v.Elem()
+		}
+		if err != nil {
+			log.Errorf(err.Error())
+			return
+		}
+		fn.Call([]reflect.Value{v})
+	})
+	if err != nil {
+		return err
+	}
+
+	return seri.Deserialize(ret, reply)
+}
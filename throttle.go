@@ -0,0 +1,176 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package starx
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+// ErrThrottled is responded when the requests of the caller exceed its rate
+// limit
+var ErrThrottled = errors.New("remote: caller is throttled")
+
+// RateLimit limits the requests of every calling server with token bucket, so
+// one misbehaving frontend can not monopolize a shared backend, every call in
+// a batch counts as a request
+type RateLimit struct {
+	QPS   float64 // requests allowed per second of every caller
+	Burst int     // max requests allowed in a burst
+}
+
+// bucket is the token bucket of a caller
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type throttler struct {
+	sync.Mutex
+	qps     float64
+	burst   float64
+	idle    time.Duration      // a bucket idle longer is full, and evicted
+	swept   time.Time          // last time idle buckets evicted
+	buckets map[string]*bucket // caller => bucket
+}
+
+func newThrottler(l *RateLimit) *throttler {
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &throttler{
+		qps:     l.QPS,
+		burst:   burst,
+		idle:    time.Duration(burst / l.QPS * float64(time.Second)),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow reports whether the caller has a token at the moment
+func (t *throttler) allow(caller string, now time.Time) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	t.sweep(now)
+
+	b, ok := t.buckets[caller]
+	if !ok {
+		b = &bucket{tokens: t.burst, last: now}
+		t.buckets[caller] = b
+	}
+
+	return b.take(now, t.qps, t.burst)
+}
+
+// sweep evicts the buckets refilled to full, which are same as new buckets,
+// so the callers gone do not leak
+func (t *throttler) sweep(now time.Time) {
+	if now.Sub(t.swept) < t.idle {
+		return
+	}
+	t.swept = now
+	for caller, b := range t.buckets {
+		if now.Sub(b.last) >= t.idle {
+			delete(t.buckets, caller)
+		}
+	}
+}
+
+// take refills the tokens elapsed since last request, and reports whether a
+// token is taken
+func (b *bucket) take(now time.Time, qps, burst float64) bool {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * qps
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// caller returns the authenticated identity of the caller: the common name
+// of the verified certificate with mutual TLS, the server id sent by caller
+// when it is registered on the host of the connection, otherwise the remote
+// host, the port is excluded since it changes on every reconnection
+func caller(ac *acceptor, rr *rpc.Request) string {
+	if conn, ok := ac.socket.(tlsConn); ok {
+		if certs := conn.ConnectionState().PeerCertificates; len(certs) > 0 && certs[0].Subject.CommonName != "" {
+			return certs[0].Subject.CommonName
+		}
+	}
+
+	host := remoteHost(ac.socket.RemoteAddr())
+	if rr.Caller != "" {
+		if svr, err := cluster.Server(rr.Caller); err == nil && registeredOn(svr, host) {
+			return rr.Caller
+		}
+	}
+	return host
+}
+
+// remoteHost returns the host of the address without port
+func remoteHost(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
+
+// registeredOn reports whether the server is registered on the host, servers
+// listen on unix domain socket are on the local host
+func registeredOn(svr *cluster.ServerConfig, host string) bool {
+	if rpc.IsUnixAddress(svr.Host) {
+		return host == "" || host == "@"
+	}
+	if svr.Host == host {
+		return true
+	}
+	ip := net.ParseIP(svr.Host)
+	return ip != nil && ip.Equal(net.ParseIP(host))
+}
+
+// throttle reports whether the request is allowed by the rate limit of the
+// caller, the request over the limit is rejected
+func (rs *remoteService) throttle(ac *acceptor, rr *rpc.Request) bool {
+	t := rs.throttler
+	if t == nil || !limited(rr) {
+		return true
+	}
+	if !t.allow(caller(ac, rr), time.Now()) {
+		rs.reject(ac, rr, &rpc.Error{Code: rpc.CodeResourceExhausted, Message: ErrThrottled.Error()})
+		return false
+	}
+	return true
+}
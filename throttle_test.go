@@ -0,0 +1,132 @@
+package starx
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+func TestThrottler_Allow(t *testing.T) {
+	th := newThrottler(&RateLimit{QPS: 10, Burst: 2})
+	now := time.Now()
+
+	if !th.allow("gate-1", now) || !th.allow("gate-1", now) {
+		t.Fatal("requests in burst should be allowed")
+	}
+	if th.allow("gate-1", now) {
+		t.Fatal("requests over burst should be throttled")
+	}
+	if !th.allow("gate-2", now) {
+		t.Fatal("callers should be throttled separately")
+	}
+
+	// one token refilled every 100ms
+	if th.allow("gate-1", now.Add(50*time.Millisecond)) {
+		t.Fatal("token should not be refilled in 50ms")
+	}
+	if !th.allow("gate-1", now.Add(100*time.Millisecond)) {
+		t.Fatal("token should be refilled in 100ms")
+	}
+
+	// tokens never exceed burst
+	later := now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if !th.allow("gate-1", later) {
+			t.Fatal("bucket should be full after idle")
+		}
+	}
+	if th.allow("gate-1", later) {
+		t.Fatal("tokens should not exceed burst")
+	}
+}
+
+func TestThrottler_Sweep(t *testing.T) {
+	th := newThrottler(&RateLimit{QPS: 10, Burst: 2})
+	now := time.Now()
+
+	th.allow("gate-1", now)
+	th.allow("gate-2", now.Add(150*time.Millisecond))
+
+	// gate-1 is full after 200ms, gate-2 is still refilling
+	th.allow("gate-3", now.Add(250*time.Millisecond))
+	if _, ok := th.buckets["gate-1"]; ok {
+		t.Fatal("idle bucket should be evicted")
+	}
+	if _, ok := th.buckets["gate-2"]; !ok {
+		t.Fatal("refilling bucket should be kept")
+	}
+}
+
+func TestThrottle_Caller(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ac := newAcceptor(1, conn)
+	cluster.Register(&cluster.ServerConfig{Type: "throttle", Id: "throttle-local", Host: "127.0.0.1", Port: 1})
+	cluster.Register(&cluster.ServerConfig{Type: "throttle", Id: "throttle-remote", Host: "10.0.0.1", Port: 1})
+	defer cluster.RemoveServer("throttle-local")
+	defer cluster.RemoveServer("throttle-remote")
+
+	cases := map[string]string{
+		"":                "127.0.0.1",
+		"throttle-local":  "throttle-local",
+		"throttle-remote": "127.0.0.1",
+		"unknown":         "127.0.0.1",
+	}
+	for id, expect := range cases {
+		if got := caller(ac, &rpc.Request{Caller: id}); got != expect {
+			t.Fatalf("caller %q: expect %s, got %s", id, expect, got)
+		}
+	}
+}
+
+func TestRemoteService_BatchThrottled(t *testing.T) {
+	rs := newRemote()
+	rs.throttler = newThrottler(&RateLimit{QPS: 0.001, Burst: 1})
+	if err := rs.register(&CounterComp{}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, peer := net.Pipe()
+	go rs.handle(conn)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	seri := serializerOf("CounterComp")
+	args, _ := encodeArgs(seri, 0)
+	batch := client.NewBatch(rpc.User)
+	var calls []*rpc.Call
+	for i := 0; i < 3; i++ {
+		calls = append(calls, batch.Add("CounterComp", "Incr", 1, args))
+	}
+	if err := batch.Send(); err != nil {
+		t.Fatal(err)
+	}
+
+	throttled := 0
+	for _, call := range calls {
+		select {
+		case <-call.Done:
+		case <-time.After(time.Second):
+			t.Fatal("every call in batch should be responded")
+		}
+		if rpc.Code(call.Error) == rpc.CodeResourceExhausted {
+			throttled++
+		}
+	}
+	if throttled != 2 {
+		t.Fatalf("calls in batch should be throttled one by one, got %d throttled", throttled)
+	}
+}
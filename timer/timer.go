@@ -1,6 +1,7 @@
 package timer
 
 import (
+	"sync"
 	"time"
 )
 
@@ -9,10 +10,12 @@ type Timer struct {
 	end        chan bool
 	limitCount int
 	counter    int
+	stop       sync.Once
 }
 
+// Stop the timer, it is safe to stop a timer more than once
 func (t *Timer) Stop() {
-	t.end <- true
+	t.stop.Do(func() { t.end <- true })
 }
 
 func Register(d time.Duration, fn func()) *Timer {
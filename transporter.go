@@ -23,6 +23,7 @@ package starx
 import (
 	"errors"
 	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -34,11 +35,25 @@ import (
 	"github.com/lonnng/starx/session"
 )
 
-const sessionClosedRoute = "__Session.Closed"
+const (
+	sessionClosedRoute = "__Session.Closed"
+	sessionSyncRoute   = "__Session.Sync"
+	sessionParkRoute   = "__Session.Park"
+	sessionAdoptRoute  = "__Session.Adopt"
+	sessionBindRoute   = "__Session.Bind"
+	uidPushRoute       = "__Session.PushUID"
+	uidKickRoute       = "__Session.KickUID"
+
+	channelJoinRoute      = "__Channel.Join"
+	channelLeaveRoute     = "__Channel.Leave"
+	channelBroadcastRoute = "__Channel.Broadcast"
+)
 
 var (
 	ErrSessionOnNotify = errors.New("current session working on notify mode")
 	ErrSessionNotFound = errors.New("session not found")
+	ErrNotBackend      = errors.New("session does not belong to backend server")
+	ErrNotFrontend     = errors.New("session does not belong to frontend server")
 )
 
 var (
@@ -56,8 +71,15 @@ type transportService struct {
 	acceptorUid int64               // acceptor unique id
 	acceptors   map[int64]*acceptor // acceptor map
 
-	sessionCloseCbLock sync.RWMutex             // protect sessionCloseCb
-	sessionCloseCb     []func(*session.Session) // callback on session closed
+	sessions    int64 // count of agents, accessed atomically
+	handshaking int64 // count of agents not working, accessed atomically
+	working     int64 // count of agents working, accessed atomically
+
+	traffic Traffic // traffic of all agents, accessed atomically
+
+	sessionCbLock   sync.RWMutex                          // protect following
+	sessionCloseCb  []func(*session.Session, CloseReason) // callback on session closed
+	sessionCreateCb []func(*session.Session)              // callback on session created
 }
 
 // Create new t service
@@ -74,9 +96,14 @@ func (t *transportService) createAgent(conn net.Conn) *agent {
 	a := newAgent(conn)
 	// add to maps
 	t.Lock()
-	defer t.Unlock()
-
 	t.agents[a.id] = a
+	t.Unlock()
+
+	atomic.AddInt64(&t.handshaking, 1)
+	n := atomic.AddInt64(&t.sessions, 1)
+	crossed(n-1, n)
+
+	t.sessionCreated(a.session)
 	return a
 }
 
@@ -87,7 +114,7 @@ func (t *transportService) agent(id int64) (*agent, error) {
 
 	a, ok := t.agents[id]
 	if !ok {
-		return nil, errors.New("agent id: " + string(id) + " not exists!")
+		return nil, errors.New("agent id: " + strconv.FormatInt(id, 10) + " not exists!")
 	}
 
 	return a, nil
@@ -106,13 +133,24 @@ func (t *transportService) createAcceptor(conn net.Conn) *acceptor {
 	return a
 }
 
+// closeAcceptors closes the connections of all acceptors, the acceptors will
+// be removed once their connections closed
+func (t *transportService) closeAcceptors() {
+	t.RLock()
+	defer t.RUnlock()
+
+	for _, a := range t.acceptors {
+		a.socket.Close()
+	}
+}
+
 func (t *transportService) acceptor(id int64) (*acceptor, error) {
 	t.RLock()
 	defer t.RUnlock()
 
 	rs, ok := t.acceptors[id]
 	if !ok || rs == nil {
-		return nil, errors.New("acceptor id: " + string(id) + " not exists!")
+		return nil, errors.New("acceptor id: " + strconv.FormatInt(id, 10) + " not exists!")
 	}
 
 	return rs, nil
@@ -121,8 +159,8 @@ func (t *transportService) acceptor(id int64) (*acceptor, error) {
 // Send packet data, call by package internal, the second argument was packaged packet
 // if current server is frontend server, send to client by agent, else send to frontend
 // server by acceptor
-func (t *transportService) send(session *session.Session, data []byte) {
-	session.Entity.Send(data)
+func (t *transportService) send(session *session.Session, data []byte) error {
+	return session.Entity.Send(data)
 }
 
 // Push message to client
@@ -150,13 +188,16 @@ func (t *transportService) push(session *session.Session, route string, data []b
 		return err
 	}
 
-	t.send(session, ep)
+	if err := t.send(session, ep); err != nil {
+		return err
+	}
+	recordPush(session)
 	return nil
 }
 
 // Response message to client
 // call by all package, the last argument was packaged message
-func (t *transportService) response(session *session.Session, data []byte) error {
+func (t *transportService) response(session *session.Session, code uint, data []byte) error {
 	// current message is notify message, can not response
 	if session.LastID <= 0 {
 		return ErrSessionOnNotify
@@ -164,6 +205,7 @@ func (t *transportService) response(session *session.Session, data []byte) error
 	m, err := message.Encode(&message.Message{
 		Type: message.MessageType(message.Response),
 		ID:   session.LastID,
+		Code: code,
 		Data: data,
 	})
 	if err != nil {
@@ -182,8 +224,7 @@ func (t *transportService) response(session *session.Session, data []byte) error
 		return err
 	}
 
-	t.send(session, ep)
-	return nil
+	return t.send(session, ep)
 }
 
 // TODO: implement backend server broadcast
@@ -224,14 +265,15 @@ func (t *transportService) Session(sid int64) (*session.Session, error) {
 }
 
 // Close session
-func (t *transportService) closeSession(session *session.Session) {
-	t.sessionCloseCbLock.RLock()
-	for _, cb := range t.sessionCloseCb {
-		if cb != nil {
-			cb(session)
-		}
+func (t *transportService) closeSession(session *session.Session, reason CloseReason) {
+	t.sessionClosed(session, reason)
+	if app.config.IsFrontend {
+		forgetSnapshot(session)
 	}
-	t.sessionCloseCbLock.RUnlock()
+	session.Unbind()
+	session.ClearTags()
+	ChannelService.leave(session)
+	channelMembers.forget(session)
 
 	t.Lock()
 	defer t.Unlock()
@@ -240,15 +282,14 @@ func (t *transportService) closeSession(session *session.Session) {
 		if agent, ok := t.agents[session.Entity.ID()]; ok && (agent != nil) {
 			delete(t.agents, session.Entity.ID())
 		}
-		// notify all backend server, current session has been closed.
-		cluster.SessionClosed(session)
+		// notify all backend server, current session has been closed, the
+		// migrated session has been parked on backend servers already
+		if reason != CloseMigrated {
+			cluster.SessionClosed(session)
+		}
 	} else {
 		if acceptor, ok := t.acceptors[session.Entity.ID()]; ok && (acceptor != nil) {
-			delete(acceptor.sessionMap, session.ID)
-			if fid, ok := acceptor.b2fMap[session.ID]; ok {
-				delete(acceptor.b2fMap, session.ID)
-				delete(acceptor.f2bMap, fid)
-			}
+			acceptor.removeSession(session.ID)
 		}
 	}
 }
@@ -265,28 +306,51 @@ func (t *transportService) heartbeat() {
 	if !app.config.IsFrontend || t.agents == nil {
 		return
 	}
-	dt := time.Now().Add(-2 * env.heartbeatInternal)
-	dtu := dt.Unix()
-
+	now := time.Now()
+	idle := idlePolicyOf()
 	for _, agent := range t.agents {
+		if agent.expired(now) {
+			log.Debugf("Session heartbeat timeout, LastTime=%d, Timeout=%s", agent.lastTime, agent.session.Timeout())
+			agent.closeWith(CloseHeartbeatTimeout)
+			continue
+		}
+
 		if agent.status != statusWorking {
 			continue
 		}
 
-		if agent.lastTime < dtu {
-			log.Debugf("Session heartbeat timeout, LastTime=%d, Deadline=%d", agent.lastTime, dtu)
-			agent.Close()
+		if idle != nil && agent.evictIdle(now, idle) {
 			continue
 		}
 
 		if err := agent.Send(heartbeatPacket); err != nil {
 			log.Error(err)
-			agent.Close()
+			agent.closeWith(CloseDisconnected)
 			continue
 		}
 	}
 }
 
+// allSessions returns the sessions of agents in frontend server, or the sessions
+// of acceptors in backend server
+func (t *transportService) allSessions() []*session.Session {
+	t.RLock()
+	defer t.RUnlock()
+
+	var sessions []*session.Session
+	for _, a := range t.agents {
+		sessions = append(sessions, a.session)
+	}
+	for _, a := range t.acceptors {
+		a.sessionLock.RLock()
+		for _, s := range a.sessionMap {
+			sessions = append(sessions, s)
+		}
+		a.sessionLock.RUnlock()
+	}
+	return sessions
+}
+
 // Dump all agents
 func (t *transportService) dumpAgents() {
 	t.RLock()
@@ -309,9 +373,9 @@ func (t *transportService) dumpAcceptor() {
 	}
 }
 
-func (t *transportService) sessionClosedCallback(cb func(*session.Session)) {
-	t.sessionCloseCbLock.Lock()
-	defer t.sessionCloseCbLock.Unlock()
+func (t *transportService) sessionClosedCallback(cb func(*session.Session, CloseReason)) {
+	t.sessionCbLock.Lock()
+	defer t.sessionCbLock.Unlock()
 
 	t.sessionCloseCb = append(t.sessionCloseCb, cb)
 }
@@ -319,5 +383,100 @@ func (t *transportService) sessionClosedCallback(cb func(*session.Session)) {
 // Callback when session closed
 // Waring: session has closed,
 func OnSessionClosed(cb func(*session.Session)) {
-	transporter.sessionClosedCallback(cb)
+	transporter.sessionClosedCallback(func(s *session.Session, _ CloseReason) {
+		cb(s)
+	})
+}
+
+// PushSession replicates the attributes changed by backend handlers to the
+// frontend session, so the later requests see them regardless of the server
+// handles them, it should be called on backend server
+func PushSession(s *session.Session) error {
+	a, ok := s.Entity.(*acceptor)
+	if !ok {
+		return ErrNotBackend
+	}
+	return a.pushSession(s)
+}
+
+// SyncSession replicates the attributes changed on frontend session to the
+// backend servers, which the session is routed to, it should be called on
+// frontend server
+func SyncSession(s *session.Session) error {
+	if _, ok := s.Entity.(*agent); !ok {
+		return ErrNotFrontend
+	}
+	data, err := s.EncodeChanges()
+	if err != nil || data == nil {
+		return err
+	}
+	cluster.SyncSession(s, data)
+	return nil
+}
+
+// PushToUID pushes the message to all sessions bound to the uid, e.g: phone
+// and tablet of the same player, it returns the first error, and the message
+// is still pushed to the other sessions. With unique binding, it works on any
+// server, the message is forwarded to the registry servers, which push it to
+// the frontend servers owning the uid, serialized by the default serializer
+func PushToUID(uid int64, route string, v interface{}) error {
+	svrType := uniqueTypeOf()
+	if svrType == "" {
+		return pushToLocalUID(uid, route, v)
+	}
+
+	data, err := serializeOrRaw(v)
+	if err != nil {
+		return err
+	}
+	var first error
+	if svrType == app.config.Type {
+		first = pushToLocalUID(uid, route, v)
+	}
+	if err := cluster.PushUID(svrType, uid, route, data); err != nil && first == nil {
+		first = err
+	}
+	return first
+}
+
+// pushToLocalUID pushes the message to the sessions of current server bound
+// to the uid
+func pushToLocalUID(uid int64, route string, v interface{}) error {
+	var first error
+	for _, s := range session.SessionsOf(uid) {
+		if err := s.Push(route, v); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// PushToTag pushes the message to the sessions of current server with the
+// tag, it returns the first error, and the message is still pushed to the
+// other sessions
+func PushToTag(tag, route string, v interface{}) error {
+	var first error
+	for _, s := range session.SessionsTagged(tag) {
+		if err := s.Push(route, v); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// PushToFiltered pushes the message to the sessions of current server which
+// the filter returns true for, e.g: everyone in a zone, everyone above level
+// 10, the sessions of backend server are the ones routed to it. It returns
+// the first error, and the message is still pushed to the other sessions
+func PushToFiltered(route string, data []byte, filter func(*session.Session) bool) error {
+	var first error
+	for _, s := range transporter.allSessions() {
+		if !filter(s) {
+			continue
+		}
+		if err := s.Push(route, data); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
 }
@@ -1,10 +1,14 @@
 package starx
 
 import (
+	"net"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/lonnng/starx/cluster/rpc"
 	"github.com/lonnng/starx/packet"
+	"github.com/lonnng/starx/session"
 )
 
 func Test1(t *testing.T) {
@@ -12,3 +16,117 @@ func Test1(t *testing.T) {
 		t.Error("wrong heartbeat packet")
 	}
 }
+
+func TestSessionSync(t *testing.T) {
+	rs := newRemote()
+	conn, peer := net.Pipe()
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	// frontend session 7 changes attributes
+	frontend := session.New(nil)
+	frontend.Set("login", true)
+	data, _ := frontend.EncodeChanges()
+	rs.handleRequest(ac, &rpc.Request{Kind: rpc.Sys, ServiceMethod: sessionSyncRoute, Sid: 7, Data: data})
+
+	// the backend handler reads and changes the attributes
+	backend := ac.Session(7)
+	if backend.Value("login") != true {
+		t.Fatal("frontend changes should be applied to backend session")
+	}
+	backend.Set("room", int64(1001))
+	go PushSession(backend)
+
+	select {
+	case resp := <-client.ResponseChan:
+		if resp.Kind != rpc.HandlerSession || resp.Sid != 7 {
+			t.Fatalf("unexpected response %v, Sid=%d", resp.Kind, resp.Sid)
+		}
+		if err := frontend.ApplyChanges(resp.Data); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("backend changes should be pushed to frontend")
+	}
+	if frontend.Int64("room") != 1001 {
+		t.Fatal("backend changes should be applied to frontend session")
+	}
+}
+
+func TestPushToFiltered(t *testing.T) {
+	conn, peer := net.Pipe()
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	ac.Session(11).Set("level", 5)
+	ac.Session(12).Set("level", 12)
+
+	go PushToFiltered("onReward", []byte("gold"), func(s *session.Session) bool {
+		return s.Int("level") > 10
+	})
+
+	select {
+	case resp := <-client.ResponseChan:
+		if resp.Kind != rpc.HandlerPush || resp.Sid != 12 || resp.Route != "onReward" || string(resp.Data) != "gold" {
+			t.Fatalf("unexpected push %v, Sid=%d, Route=%s", resp.Kind, resp.Sid, resp.Route)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message should be pushed to the matched session")
+	}
+	select {
+	case resp := <-client.ResponseChan:
+		t.Fatalf("message should not be pushed to the other sessions, Sid=%d", resp.Sid)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPushToTag(t *testing.T) {
+	conn, peer := net.Pipe()
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	member, other := ac.Session(21), ac.Session(22)
+	member.AddTag("guild:123")
+	other.AddTag("lobby")
+	defer member.ClearTags()
+	defer other.ClearTags()
+
+	go PushToTag("guild:123", "onNotice", []byte("war"))
+
+	select {
+	case resp := <-client.ResponseChan:
+		if resp.Kind != rpc.HandlerPush || resp.Sid != 21 || resp.Route != "onNotice" || string(resp.Data) != "war" {
+			t.Fatalf("unexpected push %v, Sid=%d, Route=%s", resp.Kind, resp.Sid, resp.Route)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message should be pushed to the tagged session")
+	}
+	select {
+	case resp := <-client.ResponseChan:
+		t.Fatalf("message should not be pushed to the other sessions, Sid=%d", resp.Sid)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSessionClosedUID(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+
+	s := ac.Session(51)
+	rs := newRemote()
+	rs.handleRequest(ac, &rpc.Request{Kind: rpc.Sys, ServiceMethod: sessionClosedRoute, Sid: 51, Notify: true, Data: []byte("9")})
+	if s.Uid != 9 {
+		t.Fatalf("closed backend session should carry the uid bound on frontend, got %d", s.Uid)
+	}
+	if ac.Session(51) == s {
+		t.Fatal("backend session should be removed")
+	}
+}
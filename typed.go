@@ -0,0 +1,124 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/route"
+	"github.com/lonnng/starx/serialize"
+)
+
+// callTyped calls the remote method of the service registered in this server
+// with plain values, e.g: callTyped("Room.Join", uid, &JoinArgs{}), and
+// returns the reply, so the callers need not wrap the arguments in reflection
+func (rs *remoteService) callTyped(serviceMethod string, args ...interface{}) (interface{}, error) {
+	r, err := route.Decode(serviceMethod)
+	if err != nil {
+		return nil, &rpc.Error{Code: rpc.CodeNotFound, Message: err.Error()}
+	}
+
+	service, ok := rs.enter(r.Service, r.Version)
+	if !ok {
+		return nil, &rpc.Error{Code: rpc.CodeNotFound, Message: "remote: servive " + r.Service + " does not exists"}
+	}
+	defer service.Release()
+	m, ok := service.RemoteMethods[r.Method]
+	if !ok || m == nil {
+		return nil, &rpc.Error{Code: rpc.CodeNotFound, Message: "remote: service " + r.Service + " does not contain method: " + r.Method}
+	}
+	if isStreamMethod(m.Method.Type) || isBidiStreamMethod(m.Method.Type) {
+		return nil, &rpc.Error{Code: rpc.CodeInvalidArgument, Message: "remote: stream method can not be called with values: " + serviceMethod}
+	}
+
+	params, err := typedParams(serializerOf(service.Name), m.Method.Type, args)
+	if err != nil {
+		return nil, &rpc.Error{Code: rpc.CodeInvalidArgument, Message: err.Error()}
+	}
+
+	start := m.Begin()
+	rr := &rpc.Request{ServiceMethod: serviceMethod}
+	rets, err := rs.call(rr, m.Method, append([]reflect.Value{service.Rcvr}, params...))
+	if err == nil {
+		if e := rets[1].Interface(); e != nil {
+			err = e.(error)
+		}
+	}
+	m.End(start, err != nil)
+	if err != nil {
+		return nil, err
+	}
+	return rets[0].Interface(), nil
+}
+
+// typedParams converts the values to the parameters of the method, the value
+// assignable to the parameter is passed directly, the encoded value, []byte,
+// is deserialized, and other values are converted by the serializer
+func typedParams(seri serialize.Serializer, mt reflect.Type, args []interface{}) ([]reflect.Value, error) {
+	// the first parameter is the receiver
+	n := mt.NumIn() - 1
+	if len(args) != n {
+		return nil, fmt.Errorf("remote: method needs %d arguments, but got %d", n, len(args))
+	}
+
+	params := make([]reflect.Value, n)
+	for i, arg := range args {
+		t := mt.In(i + 1)
+		if arg == nil {
+			switch t.Kind() {
+			case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+				params[i] = reflect.Zero(t)
+				continue
+			}
+			return nil, fmt.Errorf("remote: argument %d can not be nil", i)
+		}
+
+		v := reflect.ValueOf(arg)
+		if v.Type().AssignableTo(t) {
+			params[i] = v
+			continue
+		}
+
+		data, ok := arg.([]byte)
+		if !ok {
+			var err error
+			if data, err = seri.Serialize(arg); err != nil {
+				return nil, err
+			}
+		}
+		if t.Kind() == reflect.Ptr {
+			p := reflect.New(t.Elem())
+			if err := seri.Deserialize(data, p.Interface()); err != nil {
+				return nil, err
+			}
+			params[i] = p
+		} else {
+			p := reflect.New(t)
+			if err := seri.Deserialize(data, p.Interface()); err != nil {
+				return nil, err
+			}
+			params[i] = p.Elem()
+		}
+	}
+	return params, nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+func TestRemoteService_CallTyped(t *testing.T) {
+	rs := newRemote()
+	if err := rs.register(&StubComp{}); err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := rs.callTyped("StubComp.Add", 1, &RemoteArgs{Level: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.(int) != 3 {
+		t.Fatalf("expect 3, got %v", reply)
+	}
+
+	// encoded and convertible arguments
+	data, _ := serializerOf("StubComp").Serialize(&RemoteArgs{Level: 3})
+	reply, err = rs.callTyped("StubComp.Add", int8(1), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.(int) != 4 {
+		t.Fatalf("expect 4, got %v", reply)
+	}
+
+	if _, err := rs.callTyped("StubComp.Add", 1); err.(*rpc.Error).Code != rpc.CodeInvalidArgument {
+		t.Fatalf("expect invalid argument, got %v", err)
+	}
+	if _, err := rs.callTyped("StubComp.Sub", 1, nil); err.(*rpc.Error).Code != rpc.CodeNotFound {
+		t.Fatalf("expect not found, got %v", err)
+	}
+
+	if err := rs.register(&PanicComp{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.callTyped("PanicComp.Boom"); err == nil {
+		t.Fatal("panic should be recovered as error")
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/session"
+)
+
+var (
+	uniqueLock sync.RWMutex
+	uniqueType string // type of the registry servers of unique binding
+)
+
+// SetUniqueBinding makes a uid bound to one session in the cluster, the
+// frontend server binding a uid asks a server of svrType, e.g: the master or
+// login server, to kick the session bound to the uid before on any frontend
+// server with session.ReasonDuplicateLogin, the binding completes after the
+// kick sent, empty svrType disables it. It should be called on frontend
+// servers, and on the servers calling PushToUID or KickUID, which reach the
+// sessions of uid through the registry servers
+func SetUniqueBinding(svrType string) {
+	uniqueLock.Lock()
+	uniqueType = svrType
+	uniqueLock.Unlock()
+
+	if svrType == "" {
+		session.SetBindHook(nil)
+		return
+	}
+	session.SetBindHook(func(s *session.Session, uid int64) error {
+		// the backend sessions bound by the registry
+		if _, ok := s.Entity.(*agent); !ok {
+			return nil
+		}
+		return cluster.BindUID(svrType, s, uid)
+	})
+}
+
+// bindUID binds the uid to the backend session of the frontend session, and
+// kicks the sessions bound before, so their frontend servers kick them
+func bindUID(s *session.Session, rr *rpc.Request) *rpc.Response {
+	response := newResponse(rr)
+	if err := rr.DecodeData(); err != nil {
+		response.SetError(&rpc.Error{Code: rpc.CodeInvalidArgument, Message: err.Error()})
+		return response
+	}
+	uid, err := strconv.ParseInt(string(rr.Data), 10, 64)
+	if err == nil {
+		err = s.BindExclusive(uid)
+	}
+	if err != nil {
+		response.SetError(&rpc.Error{Code: rpc.CodeInvalidArgument, Message: err.Error()})
+	}
+	return response
+}
+
+func uniqueTypeOf() string {
+	uniqueLock.RLock()
+	defer uniqueLock.RUnlock()
+
+	return uniqueType
+}
+
+// KickUID kicks all sessions bound to the uid with the reason, it works on
+// any server with unique binding like PushToUID, it returns the first error,
+// and the other sessions are still kicked
+func KickUID(uid int64, reason interface{}) error {
+	svrType := uniqueTypeOf()
+	if svrType == "" {
+		return kickLocalUID(uid, reason)
+	}
+
+	data, err := serializeOrRaw(reason)
+	if err != nil {
+		return err
+	}
+	var first error
+	if svrType == app.config.Type {
+		first = kickLocalUID(uid, reason)
+	}
+	if err := cluster.KickUID(svrType, uid, data); err != nil && first == nil {
+		first = err
+	}
+	return first
+}
+
+// kickLocalUID kicks the sessions of current server bound to the uid
+func kickLocalUID(uid int64, reason interface{}) error {
+	var first error
+	for _, s := range session.SessionsOf(uid) {
+		if err := s.Kick(reason); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// forwardedUID pushes to or kicks the sessions bound to the uid, which is
+// forwarded by other servers, the registry servers hold the backend sessions
+// of all uids bound
+func forwardedUID(rr *rpc.Request) *rpc.Response {
+	response := newResponse(rr)
+	var m *cluster.UIDMessage
+	err := rr.DecodeData()
+	if err == nil {
+		m, err = cluster.DecodeUIDMessage(rr.Data)
+	}
+	if err != nil {
+		response.SetError(&rpc.Error{Code: rpc.CodeInvalidArgument, Message: err.Error()})
+		return response
+	}
+
+	if rr.ServiceMethod == uidPushRoute {
+		err = pushToLocalUID(m.Uid, m.Route, m.Data)
+	} else {
+		err = kickLocalUID(m.Uid, m.Data)
+	}
+	if err != nil {
+		response.SetError(err)
+	}
+	return response
+}
@@ -0,0 +1,142 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster"
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/serialize/json"
+)
+
+func TestUniqueBinding(t *testing.T) {
+	// the kick reason is a string
+	SetSerializer(json.NewSerializer())
+
+	rs := newRemote()
+	connect := func() (*acceptor, *rpc.Client) {
+		conn, peer := net.Pipe()
+		return transporter.createAcceptor(conn), rpc.NewClient(peer)
+	}
+	phone, phoneClient := connect()
+	defer transporter.removeAcceptor(phone)
+	defer phoneClient.Close()
+	tablet, tabletClient := connect()
+	defer transporter.removeAcceptor(tablet)
+	defer tabletClient.Close()
+
+	bind := func(ac *acceptor, sid int64) {
+		response := rs.handleRequest(ac, &rpc.Request{Kind: rpc.Sys, ServiceMethod: sessionBindRoute, Sid: sid, Data: []byte("77")})
+		if response.ErrorCode != rpc.CodeOK {
+			t.Fatalf("bind failed: %s", response.Error)
+		}
+	}
+	bind(phone, 1)
+	defer phone.Session(1).Unbind()
+	go rs.handleRequest(tablet, &rpc.Request{Kind: rpc.Sys, ServiceMethod: sessionBindRoute, Sid: 2, Data: []byte("77")})
+	defer tablet.Session(2).Unbind()
+
+	select {
+	case resp := <-phoneClient.ResponseChan:
+		if resp.Kind != rpc.HandlerKick || resp.Sid != 1 {
+			t.Fatalf("unexpected response %v, Sid=%d", resp.Kind, resp.Sid)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("session bound before should be kicked on its frontend")
+	}
+}
+
+func TestForwardedUID(t *testing.T) {
+	conn, peer := net.Pipe()
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	// the registry holds the backend session bound to uid
+	if err := ac.Session(3).BindExclusive(88); err != nil {
+		t.Fatal(err)
+	}
+	defer ac.Session(3).Unbind()
+
+	rs := newRemote()
+	forward := func(method string, m *cluster.UIDMessage) {
+		buf := &bytes.Buffer{}
+		gob.NewEncoder(buf).Encode(m)
+		go func() {
+			response := rs.handleRequest(ac, &rpc.Request{Kind: rpc.Sys, ServiceMethod: method, Data: buf.Bytes()})
+			if response.ErrorCode != rpc.CodeOK || response.Error != "" {
+				t.Errorf("forward failed: %s", response.Error)
+			}
+		}()
+	}
+	expect := func(kind rpc.ResponseKind, data string) {
+		select {
+		case resp := <-client.ResponseChan:
+			if resp.Kind != kind || resp.Sid != 3 || string(resp.Data) != data {
+				t.Fatalf("unexpected response %v, Sid=%d, Data=%s", resp.Kind, resp.Sid, resp.Data)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("forwarded message should be delivered to the frontend owning uid")
+		}
+	}
+
+	forward(uidPushRoute, &cluster.UIDMessage{Uid: 88, Route: "onMail", Data: []byte("mail")})
+	expect(rpc.HandlerPush, "mail")
+	forward(uidKickRoute, &cluster.UIDMessage{Uid: 88, Data: []byte("banned")})
+	expect(rpc.HandlerKick, "banned")
+}
+
+func TestForwardedUID_AccessController(t *testing.T) {
+	conn, peer := net.Pipe()
+	ac := transporter.createAcceptor(conn)
+	defer transporter.removeAcceptor(ac)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	if err := ac.Session(4).BindExclusive(89); err != nil {
+		t.Fatal(err)
+	}
+	defer ac.Session(4).Unbind()
+
+	rs := newRemote()
+	rs.access = rpc.AccessControllerFunc(func(kind rpc.RpcKind, serviceMethod string, sid int64, p *rpc.Peer) error {
+		return rpc.Errorf(rpc.CodePermissionDenied, "%s is not allowed", serviceMethod)
+	})
+	for _, route := range []string{uidPushRoute, uidKickRoute} {
+		buf := &bytes.Buffer{}
+		gob.NewEncoder(buf).Encode(&cluster.UIDMessage{Uid: 89, Route: "onMail", Data: []byte("mail")})
+		response := rs.handleRequest(ac, &rpc.Request{Kind: rpc.Sys, ServiceMethod: route, Data: buf.Bytes()})
+		if response.ErrorCode != rpc.CodePermissionDenied {
+			t.Fatalf("%s should be checked by access controller, got %d", route, response.ErrorCode)
+		}
+	}
+	select {
+	case resp := <-client.ResponseChan:
+		t.Fatalf("denied message should not be delivered, got %v", resp.Kind)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"encoding/gob"
 
 	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/serialize"
 	"os"
 )
 
@@ -40,16 +41,31 @@ func serializeOrRaw(v interface{}) ([]byte, error) {
 	return data, nil
 }
 
-func gobEncode(args ...interface{}) ([]byte, error) {
+// encodeArgs serializes every argument individually, so that the callee
+// can deserialize them into the parameter types of the remote method
+func encodeArgs(seri serialize.Serializer, args ...interface{}) ([]byte, error) {
+	list := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		data, err := seri.Serialize(arg)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, data)
+	}
+
 	buf := bytes.NewBuffer([]byte(nil))
-	if err := gob.NewEncoder(buf).Encode(args); err != nil {
+	if err := gob.NewEncoder(buf).Encode(list); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-func gobDecode(reply interface{}, data []byte) error {
-	return gob.NewDecoder(bytes.NewReader(data)).Decode(reply)
+func decodeArgs(data []byte) ([][]byte, error) {
+	var list [][]byte
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
 }
 
 func fileExists(filename string) bool {
@@ -0,0 +1,81 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lonnng/starx/component"
+)
+
+// serviceKey returns the key of the service in service map, e.g: Room@v2
+func serviceKey(name, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + "@" + version
+}
+
+// versionNumber returns the number of version like v2, unversioned service
+// is treated as v0
+func versionNumber(version string) (int, bool) {
+	if version == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// lookupService returns the best matching version of the service, which is
+// the exactly matching version, or the latest version that not newer than
+// the wanted one, the latest version is matched if no version wanted and
+// the unversioned service does not exist
+func lookupService(services map[string]*component.Service, name, version string) (*component.Service, bool) {
+	if s, ok := services[serviceKey(name, version)]; ok {
+		return s, true
+	}
+
+	want, ok := versionNumber(version)
+	if !ok {
+		return nil, false
+	}
+	var (
+		best *component.Service
+		max  = -1
+	)
+	for _, s := range services {
+		if s.Name != name {
+			continue
+		}
+		n, ok := versionNumber(s.Version)
+		if !ok || (version != "" && n > want) {
+			continue
+		}
+		if n > max {
+			best, max = s, n
+		}
+	}
+	return best, best != nil
+}
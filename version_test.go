@@ -0,0 +1,71 @@
+package starx
+
+import (
+	"testing"
+
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/component"
+)
+
+func TestLookupService(t *testing.T) {
+	services := map[string]*component.Service{
+		"Room@v1": {Name: "Room", Version: "v1"},
+		"Room@v3": {Name: "Room", Version: "v3"},
+		"Hall":    {Name: "Hall"},
+		"Hall@v2": {Name: "Hall", Version: "v2"},
+	}
+
+	cases := []struct {
+		name, version, expect string
+	}{
+		{"Room", "v1", "v1"},
+		{"Room", "v2", "v1"},
+		{"Room", "v4", "v3"},
+		{"Room", "", "v3"},
+		{"Hall", "", ""},
+		{"Hall", "v1", ""},
+		{"Hall", "v2", "v2"},
+	}
+	for _, c := range cases {
+		s, ok := lookupService(services, c.name, c.version)
+		if !ok || s.Name != c.name || s.Version != c.expect {
+			t.Fatalf("%s@%s: expect version %q, got %+v", c.name, c.version, c.expect, s)
+		}
+	}
+
+	for _, v := range []string{"v0", "beta"} {
+		if _, ok := lookupService(services, "Room", v); ok {
+			t.Fatalf("Room@%s should not match", v)
+		}
+	}
+	if _, ok := lookupService(services, "Lobby", ""); ok {
+		t.Fatal("Lobby should not match")
+	}
+}
+
+func TestRemoteService_Version(t *testing.T) {
+	rs := newRemote()
+	if err := rs.registerVersion(&StubComp{}, "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.registerVersion(&StubComp{}, "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.registerVersion(&StubComp{}, "v2"); err == nil {
+		t.Fatal("duplicate version should fail")
+	}
+
+	seri := serializerOf("StubComp")
+	data, _ := encodeArgs(seri, 1, &RemoteArgs{Level: 2})
+	for _, route := range []string{"StubComp.Add", "StubComp.Add@v1", "StubComp.Add@v3"} {
+		rr := &rpc.Request{Kind: rpc.User, ServiceMethod: route, Data: data}
+		if response := rs.dispatch(nil, nil, rr); response.Error != "" {
+			t.Fatalf("%s: %s", route, response.Error)
+		}
+	}
+
+	rr := &rpc.Request{Kind: rpc.User, ServiceMethod: "StubComp.Add@v0", Data: data}
+	if response := rs.dispatch(nil, nil, rr); response.ErrorCode != rpc.CodeNotFound {
+		t.Fatalf("expect not found, got %q", response.Error)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"github.com/lonnng/starx/cluster/rpc"
+	"github.com/lonnng/starx/log"
+	"github.com/lonnng/starx/route"
+)
+
+// errPoolClosed is responded to the requests still queued in a worker pool
+// when it closed, no worker is left to process them
+var errPoolClosed = &rpc.Error{Code: rpc.CodeUnavailable, Message: ErrServerBusy.Error()}
+
+// workerPool processes the requests of a service from all connections, so
+// heavy services can not starve the others, requests are partitioned by
+// session like the connection workers
+type workerPool struct {
+	queues []*lanes
+	end    chan bool
+}
+
+func newWorkerPool(rs *remoteService, size int) *workerPool {
+	p := &workerPool{
+		queues: make([]*lanes, size),
+		end:    make(chan bool),
+	}
+	for i := range p.queues {
+		p.queues[i] = newLanes(packetBufferSize, rs.sysWeight)
+		go rs.work(p.queues[i], p.end, errPoolClosed)
+	}
+	return p
+}
+
+// offer queues the request, and reports false when the queue is full
+func (p *workerPool) offer(r *unhandledRequest) bool {
+	return p.queues[uint64(r.rr.Sid)%uint64(len(p.queues))].offer(r)
+}
+
+// close stops the workers, and rejects the requests queued, the workers may be
+// busy and never come back for them
+func (p *workerPool) close(rs *remoteService) {
+	close(p.end)
+	for _, q := range p.queues {
+		q.discard(rs, errPoolClosed)
+	}
+}
+
+// setWorkers set the size of the worker pool of the service, zero removes the
+// pool and the requests are processed by the connection workers again
+func (rs *remoteService) setWorkers(service string, size int) {
+	rs.Lock()
+	old := rs.pools[service]
+	delete(rs.pools, service)
+	if size > 0 {
+		if rs.pools == nil {
+			rs.pools = make(map[string]*workerPool)
+		}
+		rs.pools[service] = newWorkerPool(rs, size)
+	}
+	rs.Unlock()
+
+	// no request is offered to the old pool once it removed, the rejections
+	// are written without holding the lock
+	if old != nil {
+		old.close(rs)
+	}
+}
+
+// poolOf returns the worker pool of the service requested, nil for the
+// requests processed by connection workers, e.g: stream frames, the caller
+// must hold rs.RLock
+func (rs *remoteService) poolOf(rr *rpc.Request) *workerPool {
+	if !limited(rr) {
+		return nil
+	}
+	if len(rs.pools) == 0 {
+		return nil
+	}
+	r, err := route.Decode(rr.ServiceMethod)
+	if err != nil {
+		return nil
+	}
+	name := r.Service
+	if service, ok := rs.aliases[name]; ok {
+		name = service
+	}
+	return rs.pools[name]
+}
+
+// enqueue queues the request to the worker pool of the service, or the
+// connection workers, the request is rejected when the pool is full
+func (rs *remoteService) enqueue(queues []*lanes, r *unhandledRequest) {
+	// the pool is looked up and offered under one lock, so a pool closed by
+	// setWorkers never receives requests after its workers exited
+	rs.RLock()
+	p := rs.poolOf(r.rr)
+	if p == nil {
+		rs.RUnlock()
+		queues[uint64(r.rr.Sid)%uint64(len(queues))].push(r)
+		return
+	}
+	ok := p.offer(r)
+	rs.RUnlock()
+	if ok {
+		return
+	}
+
+	log.Warnf("remote: worker pool of %s is full", r.rr.ServiceMethod)
+	rs.refuse(r, &rpc.Error{Code: rpc.CodeUnavailable, Message: ErrServerBusy.Error()})
+}
+
+// refuse responds the error to the request not processed, and releases it
+func (rs *remoteService) refuse(r *unhandledRequest, reason *rpc.Error) {
+	if r.bs.dedup != nil && cancellable(r.rr) {
+		r.bs.dedup.forget(r.rr.Seq)
+	}
+	rs.reject(r.bs, r.rr, reason)
+	r.done(rs)
+}
@@ -0,0 +1,116 @@
+// Copyright (c) starx Author. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package starx
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lonnng/starx/cluster/rpc"
+)
+
+func TestRemoteService_ServiceWorkers(t *testing.T) {
+	rs := newRemote()
+	comp := &SlowComp{release: make(chan struct{})}
+	if err := rs.register(comp); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.register(&EchoComp{}); err != nil {
+		t.Fatal(err)
+	}
+	rs.setWorkers("SlowComp", 1)
+	defer rs.setWorkers("SlowComp", 0)
+
+	conn, peer := net.Pipe()
+	go rs.handle(conn)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	blocked, _ := encodeArgs(serializerOf("SlowComp"), true)
+	slow := client.AsyncCall(rpc.User, "SlowComp", "Wait", 0, blocked, nil)
+
+	// the only connection worker is not occupied by the heavy call
+	args, _ := encodeArgs(serializerOf("EchoComp"), &EchoArgs{Data: []byte("hi")})
+	select {
+	case call := <-client.AsyncCall(rpc.User, "EchoComp", "Echo", 1, args, nil).Done:
+		if call.Error != nil {
+			t.Fatal(call.Error)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call of light service should not be blocked by the heavy one")
+	}
+
+	close(comp.release)
+	if call := <-slow.Done; call.Error != nil {
+		t.Fatal(call.Error)
+	}
+}
+
+func TestRemoteService_ServiceWorkersClosed(t *testing.T) {
+	rs := newRemote()
+	comp := &SlowComp{release: make(chan struct{})}
+	if err := rs.register(comp); err != nil {
+		t.Fatal(err)
+	}
+	rs.setWorkers("SlowComp", 1)
+
+	conn, peer := net.Pipe()
+	go rs.handle(conn)
+	client := rpc.NewClient(peer)
+	defer client.Close()
+
+	seri := serializerOf("SlowComp")
+	blocked, _ := encodeArgs(seri, true)
+	fast, _ := encodeArgs(seri, false)
+	slow := client.AsyncCall(rpc.User, "SlowComp", "Wait", 0, blocked, nil)
+	queued := client.AsyncCall(rpc.User, "SlowComp", "Wait", 0, fast, nil)
+
+	// wait the second call queued behind the blocked one
+	for deadline := time.Now().Add(time.Second); ; {
+		rs.RLock()
+		n := len(rs.pools["SlowComp"].queues[0].user)
+		rs.RUnlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("call should be queued in the pool")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queued call is rejected instead of stranded in the closed pool
+	rs.setWorkers("SlowComp", 0)
+	select {
+	case call := <-queued.Done:
+		if rpc.Code(call.Error) != rpc.CodeUnavailable {
+			t.Fatalf("expect unavailable, got %v", call.Error)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call queued in the closed pool should be rejected")
+	}
+
+	close(comp.release)
+	if call := <-slow.Done; call.Error != nil {
+		t.Fatal(call.Error)
+	}
+}